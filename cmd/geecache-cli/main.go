@@ -0,0 +1,252 @@
+// Command geecache-cli reads and writes a geecache cluster from the shell,
+// for debugging and scripts.
+//
+//	geecache-cli [flags] get <group> <key>
+//	geecache-cli [flags] set <group> <key> <value>   ("-" reads the value from stdin)
+//	geecache-cli [flags] delete <group> <key>
+//	geecache-cli [flags] stats [group]
+//	geecache-cli [flags] flush <group>
+//
+// get, set and delete go to the node owning the key through package
+// client, like a Group would; delete -prefix goes to every node, and so
+// do stats and flush, which use the admin API.
+package main
+
+import (
+	"GeeCache/geecache"
+	"GeeCache/geecache/client"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// options are the flags shared by the commands.
+type options struct {
+	peers      []string
+	token      string
+	adminToken string
+	format     string // "text", "json" or "raw"
+	timeout    time.Duration
+	skipCache  bool // get 直接回源，不读也不写缓存
+	refresh    bool // get 回源并替换缓存中的值
+	prefix     bool // delete 删除以 key 开头的所有 key
+	stdin      io.Reader
+	stdout     io.Writer
+}
+
+func main() {
+	o := &options{stdin: os.Stdin, stdout: os.Stdout}
+	fs := flag.NewFlagSet("geecache-cli", flag.ExitOnError)
+	peers := fs.String("peers", envOr("GEECACHE_PEERS", "http://localhost:8001"), "comma-separated URLs of every node, as configured on the nodes")
+	fs.StringVar(&o.token, "token", os.Getenv("GEECACHE_TOKEN"), "shared secret of peer requests")
+	fs.StringVar(&o.adminToken, "admin-token", os.Getenv("GEECACHE_ADMIN_TOKEN"), "bearer token of the admin API")
+	fs.StringVar(&o.format, "o", "text", "output format: text, json or raw")
+	fs.DurationVar(&o.timeout, "timeout", 10*time.Second, "timeout of the command")
+	fs.BoolVar(&o.skipCache, "skip-cache", false, "get: load the key from its origin, leaving the cache untouched")
+	fs.BoolVar(&o.refresh, "refresh", false, "get: reload the key from its origin into the cache")
+	fs.BoolVar(&o.prefix, "prefix", false, "delete: drop every key starting with the key from every node")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: geecache-cli [flags] get|set|delete|stats|flush ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	o.peers = strings.Split(*peers, ",")
+	if err := run(o, fs.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "geecache-cli:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func run(o *options, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing command, one of get, set, delete, stats, flush")
+	}
+	switch o.format {
+	case "text", "json", "raw":
+	default:
+		return fmt.Errorf("unknown output format %q", o.format)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+	cmd, args := args[0], args[1:]
+	need := map[string]int{"get": 2, "set": 3, "delete": 2, "flush": 1}[cmd]
+	if cmd != "stats" && len(args) != need || cmd == "stats" && len(args) > 1 {
+		return fmt.Errorf("wrong number of arguments for %s", cmd)
+	}
+	switch cmd {
+	case "get":
+		var opts []client.GetOption
+		switch {
+		case o.skipCache:
+			opts = append(opts, client.SkipCache)
+		case o.refresh:
+			opts = append(opts, client.ForceRefresh)
+		}
+		v, err := o.client().Get(ctx, args[0], args[1], opts...)
+		if err != nil {
+			return err
+		}
+		return o.printValue(args[0], args[1], v)
+	case "set":
+		value := []byte(args[2])
+		if args[2] == "-" {
+			var err error
+			if value, err = io.ReadAll(o.stdin); err != nil {
+				return err
+			}
+		}
+		return o.client().Set(ctx, args[0], args[1], value)
+	case "delete":
+		if o.prefix {
+			return o.client().InvalidatePrefix(ctx, args[0], args[1])
+		}
+		return o.client().Delete(ctx, args[0], args[1])
+	case "stats":
+		group := ""
+		if len(args) == 1 {
+			group = args[0]
+		}
+		return o.stats(ctx, group)
+	case "flush":
+		return o.flush(ctx, args[0])
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+// client returns a client routing requests to the nodes. A key whose owner
+// can't be reached fails.
+func (o *options) client() *client.Client {
+	quiet := geecache.NewStdLogger(log.New(os.Stderr, "", 0), geecache.LevelError)
+	return client.New(&geecache.HTTPPoolOptions{AuthToken: o.token, Logger: quiet}, o.peers...)
+}
+
+func (o *options) printValue(group, key string, v client.Value) error {
+	switch o.format {
+	case "raw":
+		_, err := o.stdout.Write(v.Bytes)
+		return err
+	case "json":
+		res := struct {
+			Group   string `json:"group"`
+			Key     string `json:"key"`
+			Value   string `json:"value,omitempty"`
+			Base64  []byte `json:"base64,omitempty"` // values that aren't UTF-8
+			Version uint64 `json:"version"`
+		}{Group: group, Key: key, Version: v.Version}
+		if b := v.Bytes; utf8.Valid(b) {
+			res.Value = string(b)
+		} else {
+			res.Base64 = b
+		}
+		return writeJSON(o.stdout, res)
+	}
+	_, err := fmt.Fprintf(o.stdout, "%s\n", v.Bytes)
+	return err
+}
+
+// nodeStats is the JSON answered by the admin stats endpoint.
+type nodeStats map[string]struct {
+	Stats map[string]int64 `json:"stats"`
+	Cache struct {
+		Bytes int64
+		Items int64
+		Gets  int64
+		Hits  int64
+	} `json:"cache"`
+}
+
+func (o *options) stats(ctx context.Context, group string) error {
+	all := make(map[string]nodeStats)
+	for _, peer := range o.peers {
+		var s nodeStats
+		if err := o.admin(ctx, http.MethodGet, peer, "stats", &s); err != nil {
+			return err
+		}
+		if group != "" {
+			s = nodeStats{group: s[group]}
+		}
+		all[peer] = s
+	}
+	if o.format != "text" {
+		return writeJSON(o.stdout, all)
+	}
+	tw := tabwriter.NewWriter(o.stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "NODE\tGROUP\tITEMS\tBYTES\tGETS\tHITS\tLOADS\tPEER LOADS\t")
+	for _, peer := range o.peers {
+		names := make([]string, 0, len(all[peer]))
+		for name := range all[peer] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s := all[peer][name]
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t\n", peer, name,
+				s.Cache.Items, s.Cache.Bytes, s.Stats["Gets"], s.Stats["CacheHits"], s.Stats["Loads"], s.Stats["PeerLoads"])
+		}
+	}
+	return tw.Flush()
+}
+
+func (o *options) flush(ctx context.Context, group string) error {
+	for _, peer := range o.peers {
+		if err := o.admin(ctx, http.MethodPost, peer, "flush/"+group, nil); err != nil {
+			return err
+		}
+	}
+	if o.format == "text" {
+		_, err := fmt.Fprintf(o.stdout, "flushed %s on %d nodes\n", group, len(o.peers))
+		return err
+	}
+	return nil
+}
+
+// adminPath is where nodes serve the admin API.
+const adminPath = "/_geecache/admin/"
+
+// admin calls the admin endpoint path of peer, decoding the answer into out.
+func (o *options) admin(ctx context.Context, method, peer, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(peer, "/")+adminPath+path, nil)
+	if err != nil {
+		return err
+	}
+	if o.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+o.adminToken)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("%s: %s: %s", peer, res.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
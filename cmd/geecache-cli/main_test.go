@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminCommands(t *testing.T) {
+	var flushed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer adm" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case adminPath + "stats":
+			w.Write([]byte(`{"g": {"stats": {"Gets": 7, "CacheHits": 5}, "cache": {"Items": 2, "Bytes": 30}}, "h": {}}`))
+		case adminPath + "flush/g":
+			flushed = append(flushed, r.Method)
+			w.Write([]byte(`{"group": "g", "flushed": true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	var out bytes.Buffer
+	o := &options{peers: []string{srv.URL}, adminToken: "adm", format: "text", timeout: time.Second, stdout: &out}
+
+	if err := run(o, []string{"stats", "g"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || strings.Join(strings.Fields(lines[1])[1:], " ") != "g 2 30 7 5 0 0" {
+		t.Fatalf("stats =\n%s", out.String())
+	}
+	if err := run(o, []string{"flush", "g"}); err != nil || len(flushed) != 1 || flushed[0] != http.MethodPost {
+		t.Fatalf("flush: %v, requests %v", err, flushed)
+	}
+	o.adminToken = "wrong"
+	if err := run(o, []string{"stats"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("stats with a wrong token: %v", err)
+	}
+	if err := run(o, []string{"get", "g"}); err == nil {
+		t.Fatalf("get without a key succeeded")
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"GeeCache/geecache"
+	"GeeCache/geecache/consistenthash"
+)
+
+// Config is the configuration file of geecached, in TOML or, with a .json
+// extension, JSON. See geecached.example.toml for every setting.
+type Config struct {
+	// Self is the URL peers use to reach this node, e.g.
+	// "http://10.0.0.1:8001". Listen defaults to its host and port.
+	Self   string   `json:"self"`
+	Listen string   `json:"listen"`
+	Peers  []string `json:"peers"` // every node of the cluster, Self included
+	// Ring is how keys are mapped to peers: "consistent" (default),
+	// "rendezvous", or "jump", which requires every node to list peers in
+	// the same order.
+	Ring string `json:"ring"`
+	// RingHash is the hash placing keys and peers on the ring: "crc32"
+	// (default), "xxhash" or "murmur3". Every node must use the same.
+	RingHash string `json:"ring_hash"`
+	// AntiEntropy is how often this node repairs its copies of keys
+	// other nodes own against their owners; never if 0. Replicas is
+	// ignored, kept so that older configs still load.
+	AntiEntropy duration `json:"anti_entropy"`
+	Replicas    int      `json:"replicas"`
+	// Migrate makes this node stream the entries it no longer owns to
+	// their new owners when the peers change.
+	Migrate bool `json:"migrate"`
+	// MinProtocol is the oldest peer protocol version this node talks
+	// to, 1 if 0. Raise it once every node of a rolling upgrade runs a
+	// release speaking the version.
+	MinProtocol int `json:"min_protocol"`
+	// SlowPeer, if set, logs peers whose p99 latency exceeds it.
+	SlowPeer duration `json:"slow_peer"`
+	// CompressResponses, if set, compresses the values of at least this
+	// size sent to peers, with zstd or gzip.
+	CompressResponses byteSize `json:"compress_responses"`
+	// Transport is how nodes talk to each other: "tcp" (default) or
+	// "http3", over QUIC, which requires tls and answers peers on the UDP
+	// port of listen. Every node must use the same.
+	Transport string `json:"transport"`
+
+	AuthToken  string `json:"auth_token"`  // shared secret of peer requests
+	AdminToken string `json:"admin_token"` // bearer token of the admin API
+	Debug      bool   `json:"debug"`       // /debug/vars and pprof below the admin API
+
+	API       string `json:"api"`       // address of the JSON API, none if empty
+	Memcached string `json:"memcached"` // address of the memcached protocol listener
+	Redis     string `json:"redis"`     // address of the RESP listener
+
+	// Invalidations, if set, is the channel other services publish
+	// invalidation messages on, "redis://[[user]:password@]host:port/channel"
+	// or "nats://[user:password@|token@]host:port/subject", see package
+	// invalidate.
+	Invalidations string `json:"invalidations"`
+
+	// CacheBytes, if set, is the cache budget of the node, shared among
+	// the groups in proportion to their weights instead of each group
+	// setting its own cache_bytes.
+	CacheBytes byteSize `json:"cache_bytes"`
+
+	TLS       *TLSConfig       `json:"tls"`
+	RateLimit *RateLimitConfig `json:"rate_limit"`
+	Groups    []GroupConfig    `json:"groups"`
+	Schedules []ScheduleConfig `json:"schedules"`
+}
+
+// TLSConfig names the credentials of peer traffic; with CA set peers must
+// present certificates signed by it.
+type TLSConfig struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	CA   string `json:"ca"`
+}
+
+// RateLimitConfig throttles incoming requests, see geecache.RateLimit.
+type RateLimitConfig struct {
+	Rate           float64 `json:"rate"`
+	Burst          int     `json:"burst"`
+	PerClientRate  float64 `json:"per_client_rate"`
+	PerClientBurst int     `json:"per_client_burst"`
+}
+
+// GroupConfig describes a group. Values come from Set or from Store; keys
+// that neither has are not found.
+type GroupConfig struct {
+	Name       string   `json:"name"`
+	CacheBytes byteSize `json:"cache_bytes"`
+	Weight     int      `json:"weight"` // share of the node's cache_bytes, defaults to 1
+	MaxEntry   byteSize `json:"max_entry_bytes"`
+	TTL        duration `json:"ttl"`
+	Idle       duration `json:"idle"`
+	Eviction   string   `json:"eviction"` // "lru" (default), "slru" or "clock"
+	Shards     int      `json:"shards"`
+	// HotCacheRatio is the share of the budget holding copies of popular
+	// keys owned by other nodes, see geecache.WithHotCache.
+	HotCacheRatio float64 `json:"hot_cache_ratio"`
+	// Consistency is "eventual" (default) or "read-your-writes", which
+	// reads every key from its owner, see geecache.ReadYourWrites.
+	Consistency string `json:"consistency"`
+	// SlowLoad, if set, logs loads from the origin taking longer.
+	SlowLoad duration `json:"slow_load"`
+	// PooledBuffers reads values fetched from peers into pooled buffers,
+	// see geecache.WithPooledBuffers.
+	PooledBuffers bool `json:"pooled_buffers"`
+	// ArenaBytes, if set, keeps values of at least ArenaMinBytes, 4KB if
+	// unset, off the Go heap in a region of that size, see
+	// geecache.WithArena.
+	ArenaBytes    byteSize `json:"arena_bytes"`
+	ArenaMinBytes byteSize `json:"arena_min_bytes"`
+	// ChunkBytes, if set, splits larger values into chunks of that size
+	// spread over the nodes, see geecache.WithChunking.
+	ChunkBytes byteSize `json:"chunk_bytes"`
+	// DedupWait, if set, makes the owner of a key answer peers asking for
+	// it while it loads after that long, and the peers ask again rather
+	// than load it themselves, see geecache.WithDistributedDedup.
+	DedupWait duration `json:"dedup_wait"`
+	// PrefixSeparator, if set, is the one character ending the namespaces
+	// of the keys, e.g. ":", which the cache indexes for prefix deletes,
+	// see geecache.WithPrefixIndex.
+	PrefixSeparator string `json:"prefix_separator"`
+	// Store is where values are read from on a miss and written to by
+	// Set: "dir:<path>" or "redis://[:password@]host:port[/db]".
+	Store string `json:"store"`
+	// Origin, instead of a store, names an earlier group this one reads
+	// through and writes to, e.g. a small group kept on each node in
+	// front of a large one spread over the cluster, see
+	// geecache.WithOrigin. Such a group isn't shared with the peers.
+	Origin string `json:"origin"`
+}
+
+// ScheduleConfig runs an action on a group at the minutes matching Spec,
+// a cron expression.
+type ScheduleConfig struct {
+	Spec     string  `json:"spec"`
+	Action   string  `json:"action"` // "flush" or "shrink"
+	Group    string  `json:"group"`
+	Fraction float64 `json:"fraction"` // of the budget kept by "shrink"
+}
+
+// loadConfig reads and checks the configuration file at path.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".json" {
+		// TOML 先解析成通用的 map，再借助 encoding/json 填入结构体，两种格式共用同一套字段定义
+		m, err := parseTOML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if data, err = json.Marshal(m); err != nil {
+			return nil, err
+		}
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := c.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// check validates c and fills in the defaults.
+func (c *Config) check() error {
+	u, err := url.Parse(c.Self)
+	switch {
+	case err == nil && u.Scheme == "unix":
+		if _, err := geecache.NormalizePeerAddr(c.Self); err != nil {
+			return err
+		}
+		if c.Listen == "" {
+			c.Listen = c.Self
+		}
+	case err != nil || u.Host == "":
+		return fmt.Errorf("self must be a URL like http://host:port or unix:///path, got %q", c.Self)
+	case c.Listen == "":
+		c.Listen = u.Host
+	}
+	if len(c.Peers) == 0 {
+		c.Peers = []string{c.Self}
+	}
+	switch c.Ring {
+	case "", "consistent", "rendezvous", "jump":
+	default:
+		return fmt.Errorf("unknown ring %q", c.Ring)
+	}
+	if _, ok := consistenthash.HashByName(c.RingHash); c.RingHash != "" && !ok {
+		return fmt.Errorf("unknown ring_hash %q", c.RingHash)
+	}
+	switch c.Transport {
+	case "", "tcp":
+	case "http3":
+		if c.TLS == nil {
+			return errors.New("transport http3 requires tls")
+		}
+		if strings.HasPrefix(c.Listen, "unix://") {
+			return errors.New("transport http3 can't listen on a unix socket")
+		}
+	default:
+		return fmt.Errorf("unknown transport %q", c.Transport)
+	}
+	if c.Invalidations != "" {
+		if _, err := newInvalidations(c.Invalidations); err != nil {
+			return err
+		}
+	}
+	if c.MinProtocol < 0 || c.MinProtocol > geecache.ProtocolVersion {
+		return fmt.Errorf("min_protocol must be at most %d, the version of this release", geecache.ProtocolVersion)
+	}
+	if len(c.Groups) == 0 {
+		return errors.New("no groups configured")
+	}
+	if c.CacheBytes < 0 {
+		return errors.New("cache_bytes must not be negative")
+	}
+	names := make(map[string]bool)
+	for _, g := range c.Groups {
+		if g.Name == "" {
+			return errors.New("group without a name")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("duplicate group %q", g.Name)
+		}
+		switch {
+		case g.Origin != "" && !names[g.Origin]:
+			return fmt.Errorf("group %q: origin %q must be a group listed before it", g.Name, g.Origin)
+		case g.Origin != "" && g.Store != "":
+			return fmt.Errorf("group %q: origin and store are exclusive", g.Name)
+		}
+		names[g.Name] = true
+		switch {
+		case c.CacheBytes > 0 && g.CacheBytes != 0:
+			return fmt.Errorf("group %q: cache_bytes is set for the node, give the group a weight instead", g.Name)
+		case c.CacheBytes == 0 && g.CacheBytes <= 0:
+			return fmt.Errorf("group %q: cache_bytes must be positive", g.Name)
+		case g.Weight < 0:
+			return fmt.Errorf("group %q: weight must not be negative", g.Name)
+		case g.HotCacheRatio < 0 || g.HotCacheRatio > 0.9:
+			return fmt.Errorf("group %q: hot_cache_ratio must be between 0 and 0.9", g.Name)
+		}
+		switch g.Consistency {
+		case "", "eventual", "read-your-writes":
+		default:
+			return fmt.Errorf("group %q: unknown consistency %q", g.Name, g.Consistency)
+		}
+		switch g.Eviction {
+		case "", "lru", "slru", "clock":
+		default:
+			return fmt.Errorf("group %q: unknown eviction policy %q", g.Name, g.Eviction)
+		}
+		if len(g.PrefixSeparator) > 1 {
+			return fmt.Errorf("group %q: prefix_separator must be a single byte", g.Name)
+		}
+	}
+	for _, s := range c.Schedules {
+		if !names[s.Group] {
+			return fmt.Errorf("schedule %q: unknown group %q", s.Spec, s.Group)
+		}
+		if s.Action != "flush" && s.Action != "shrink" {
+			return fmt.Errorf("schedule %q: unknown action %q", s.Spec, s.Action)
+		}
+	}
+	return nil
+}
+
+// duration is a time.Duration written like "10m" or "1h30m".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations are strings like \"10m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// byteSize is a number of bytes, written as a number or a string with a
+// unit like "64MB" or "1GiB".
+type byteSize int64
+
+func (n *byteSize) UnmarshalJSON(b []byte) error {
+	var v int64
+	if err := json.Unmarshal(b, &v); err == nil {
+		*n = byteSize(v)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("sizes are numbers or strings like \"64MB\"")
+	}
+	v, err := parseByteSize(s)
+	*n = byteSize(v)
+	return err
+}
+
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		n      int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"B", 1},
+	}
+	s = strings.TrimSpace(s)
+	for _, u := range units {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return int64(v * float64(u.n)), nil
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return v, nil
+}
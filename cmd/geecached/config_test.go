@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadExample(t *testing.T) {
+	cfg, err := loadConfig("geecached.example.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != "localhost:8001" || len(cfg.Peers) != 3 || cfg.RateLimit.Burst != 500 {
+		t.Fatalf("config = %+v", cfg)
+	}
+	g := cfg.Groups[1]
+	if g.Name != "sessions" || g.CacheBytes != 256e6 || g.MaxEntry != 1e6 || time.Duration(g.Idle) != 30*time.Minute {
+		t.Fatalf("group = %+v", g)
+	}
+	if s := cfg.Schedules[1]; s.Action != "shrink" || s.Fraction != 0.8 {
+		t.Fatalf("schedule = %+v", s)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geecached.json")
+	os.WriteFile(path, []byte(`{"self": "http://a:1", "groups": [{"name": "g", "cache_bytes": 1024, "ttl": "1m"}]}`), 0o644)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Peers, []string{"http://a:1"}) || time.Duration(cfg.Groups[0].TTL) != time.Minute {
+		t.Fatalf("config = %+v", cfg)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, tt := range []struct{ config, err string }{
+		{`self = "http://a:1"`, "no groups"},
+		{"self = \"http://a:1\"\nunknown = 1\n[[groups]]\nname = \"g\"\ncache_bytes = 1", "unknown field"},
+		{"self = \"http://a:1\"\n[[groups]]\nname = \"g\"\ncache_bytes = \"lots\"", "invalid size"},
+		{"self = \"http://a:1\"\ncache_bytes = \"1GB\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1", "give the group a weight"},
+		{"self = \"http://a:1\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1\nttl = 5", "durations are strings"},
+		{"self = \"http://a:1\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1\n[[schedules]]\nspec = \"* * * * *\"\naction = \"flush\"\ngroup = \"h\"", "unknown group"},
+		{"self = \"http://a:1\"\nring_hash = \"md5\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1", "unknown ring_hash"},
+		{"self = \"http://a:1\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1\nprefix_separator = \"::\"", "single byte"},
+		{"self = \"http://a:1\"\ninvalidations = \"kafka://b:1/t\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1", "unsupported invalidations"},
+		{"self = \"http://a:1\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1\norigin = \"h\"\n[[groups]]\nname = \"h\"\ncache_bytes = 1", "listed before it"},
+		{"self = \"http://a:1\"\nmin_protocol = 99\n[[groups]]\nname = \"g\"\ncache_bytes = 1", "min_protocol"},
+		{"self = \"http://a:1\"\ntransport = \"http3\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1", "requires tls"},
+		{"self = \"unix://sock\"\n[[groups]]\nname = \"g\"\ncache_bytes = 1", "unix:///absolute/path"},
+		{`self = "unterminated`, "line 1: unterminated string"},
+		{"self = 'a'\nself = 'b'", "line 2: duplicate key"},
+	} {
+		path := filepath.Join(t.TempDir(), "geecached.toml")
+		os.WriteFile(path, []byte(tt.config), 0o644)
+		if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.config, err, tt.err)
+		}
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	m, err := parseTOML(`
+a = "x # not a comment" # comment
+b = [1, 2,
+  3]
+c = 'C:\path'
+d = -1_000
+e = 0.5
+[t]
+f = true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"a": "x # not a comment",
+		"b": []any{int64(1), int64(2), int64(3)},
+		"c": `C:\path`,
+		"d": int64(-1000),
+		"e": 0.5,
+		"t": map[string]any{"f": true},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("parseTOML = %#v", m)
+	}
+}
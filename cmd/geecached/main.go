@@ -0,0 +1,403 @@
+// Command geecached runs a geecache node configured by a file, so that a
+// cluster can be deployed without writing Go code.
+//
+//	geecached -config /etc/geecached.toml
+//
+// Groups are filled by Set over the memcached or Redis protocols, or read
+// through from a store; see Config for the settings.
+package main
+
+import (
+	"GeeCache/geecache"
+	"GeeCache/geecache/consistenthash"
+	"GeeCache/geecache/http3peer"
+	"GeeCache/geecache/invalidate"
+	"GeeCache/geecache/memcachedserver"
+	"GeeCache/geecache/redisserver"
+	"GeeCache/geecache/store"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// shutdownTimeout bounds how long in-flight requests and pending store
+// writes may delay exiting.
+const shutdownTimeout = 30 * time.Second
+
+// defaultArenaMinBytes is the arena_min_bytes of groups setting only
+// arena_bytes.
+const defaultArenaMinBytes = 4 << 10
+
+func main() {
+	configFile := flag.String("config", "geecached.toml", "configuration file, TOML or JSON")
+	watch := flag.Duration("watch", 2*time.Second, "how often to check the configuration file for changes, 0 to reload only on SIGHUP")
+	flag.Parse()
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	n, err := start(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go n.watchConfig(*configFile, *watch)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	<-ch
+	log.Println("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	n.shutdown(ctx)
+}
+
+// node is a running geecached.
+type node struct {
+	mu        sync.Mutex // serializes reloads
+	cfg       *Config
+	groups    []*geecache.Group
+	pool      *geecache.HTTPPool
+	creds     *geecache.CertReloader
+	servers   []*http.Server
+	memcached *memcachedserver.Server
+	redis     *redisserver.Server
+	scheduler *geecache.Scheduler
+	inval     *invalidate.Subscriber // nil unless invalidations is set
+	manager   *geecache.CacheManager // nil unless the node has cache_bytes
+	http3     *http3.Server          // nil unless transport is http3
+
+	stopAntiEntropy func() // nil unless anti_entropy is set
+}
+
+// start creates the groups and starts the listeners of cfg.
+func start(cfg *Config) (*node, error) {
+	n := &node{cfg: cfg}
+	if cfg.CacheBytes > 0 {
+		n.manager = geecache.NewCacheManager(int64(cfg.CacheBytes))
+	}
+	for _, gc := range cfg.Groups {
+		g, err := newGroup(gc, n.manager)
+		if err != nil {
+			return nil, err
+		}
+		n.groups = append(n.groups, g)
+	}
+
+	opts := &geecache.HTTPPoolOptions{
+		AuthToken:          cfg.AuthToken,
+		AdminToken:         cfg.AdminToken,
+		EnableDebug:        cfg.Debug,
+		MigrateOnChange:    cfg.Migrate,
+		MinProtocolVersion: cfg.MinProtocol,
+		SlowPeerThreshold:  time.Duration(cfg.SlowPeer),
+		CompressResponses:  int(cfg.CompressResponses),
+	}
+	opts.Hash, _ = consistenthash.HashByName(cfg.RingHash)
+	switch cfg.Ring {
+	case "jump":
+		opts.NewRing = func() consistenthash.Ring { return consistenthash.NewJump(opts.Hash) }
+	case "rendezvous":
+		opts.NewRing = func() consistenthash.Ring { return consistenthash.NewRendezvous(opts.Hash) }
+	}
+	if cfg.TLS != nil {
+		creds, err := geecache.NewCertReloader(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.CA)
+		if err != nil {
+			return nil, err
+		}
+		creds.Watch(time.Minute, func(err error) { log.Println("reload TLS credentials:", err) })
+		n.creds, opts.TLS = creds, creds
+		if cfg.Transport == "http3" {
+			opts.Transport = http3peer.NewTransport(creds)
+		}
+	}
+	opts.RateLimit = rateLimit(cfg.RateLimit)
+	n.pool = geecache.NewHTTPPoolOpts(cfg.Self, opts)
+	n.pool.Set(cfg.Peers...)
+	for i, g := range n.groups {
+		if cfg.Groups[i].Origin == "" {
+			g.RegisterPeers(n.pool)
+		}
+	}
+	if cfg.AntiEntropy > 0 {
+		n.stopAntiEntropy = n.pool.StartAntiEntropy(time.Duration(cfg.AntiEntropy))
+	}
+
+	l, err := geecache.ListenPeer(cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: n.pool}
+	n.servers = append(n.servers, srv)
+	go func() {
+		var err error
+		if n.creds != nil {
+			srv.TLSConfig = n.creds.ServerConfig()
+			err = srv.ServeTLS(l, "", "")
+		} else {
+			err = srv.Serve(l)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	log.Println("geecache is running at", cfg.Self)
+	if cfg.Transport == "http3" {
+		// TCP 监听仍然保留，供健康检查与管理接口使用
+		n.http3 = http3peer.NewServer(cfg.Listen, n.pool, n.creds)
+		go func() {
+			if err := n.http3.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		log.Println("peers are served over HTTP/3 at", cfg.Listen)
+	}
+
+	if cfg.API != "" {
+		api := &http.Server{Addr: cfg.API, Handler: apiMux(cfg.AdminToken)}
+		n.servers = append(n.servers, api)
+		go func() {
+			if err := api.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		log.Println("API server is running at", cfg.API)
+	}
+	// 文本协议按 "<group>:<key>" 选择 group，不带前缀的 key 属于第一个 group
+	if cfg.Memcached != "" {
+		n.memcached = &memcachedserver.Server{Group: n.groups[0], Separator: ":", Groups: n.groupNames()}
+		go func() {
+			if err := n.memcached.ListenAndServe(cfg.Memcached); !errors.Is(err, memcachedserver.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		log.Println("memcached protocol is served at", cfg.Memcached)
+	}
+	if cfg.Redis != "" {
+		n.redis = &redisserver.Server{Group: n.groups[0], Separator: ":", Groups: n.groupNames()}
+		go func() {
+			if err := n.redis.ListenAndServe(cfg.Redis); !errors.Is(err, redisserver.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		log.Println("Redis protocol is served at", cfg.Redis)
+	}
+
+	if cfg.Invalidations != "" {
+		n.inval, _ = newInvalidations(cfg.Invalidations) // check 已经校验过
+		n.inval.Start()
+	}
+
+	if err := n.startScheduler(cfg.Schedules); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// startScheduler runs the scheduled actions, if any.
+func (n *node) startScheduler(schedules []ScheduleConfig) error {
+	if len(schedules) == 0 {
+		return nil
+	}
+	scheduler := geecache.NewScheduler(nil)
+	for _, s := range schedules {
+		var err error
+		if s.Action == "flush" {
+			err = scheduler.FlushGroup(s.Spec, s.Group)
+		} else {
+			err = scheduler.ShrinkGroup(s.Spec, s.Group, s.Fraction)
+		}
+		if err != nil {
+			return fmt.Errorf("schedule %q: %v", s.Spec, err)
+		}
+	}
+	scheduler.Start()
+	n.scheduler = scheduler
+	return nil
+}
+
+func rateLimit(rl *RateLimitConfig) *geecache.RateLimit {
+	if rl == nil {
+		return nil
+	}
+	return &geecache.RateLimit{Rate: rl.Rate, Burst: rl.Burst, PerClientRate: rl.PerClientRate, PerClientBurst: rl.PerClientBurst}
+}
+
+// apiMux serves the public API. Holders of the admin token may bypass the
+// cache with it.
+func apiMux(adminToken string) http.Handler {
+	o := &geecache.APIOptions{}
+	if adminToken != "" {
+		o.BypassAuth = geecache.TokenAuth(adminToken)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", geecache.NewAPIHandlerOpts("/api/", o))
+	return mux
+}
+
+// shutdown stops accepting requests, waits for those in flight and writes
+// the values still waiting for the stores.
+func (n *node) shutdown(ctx context.Context) {
+	if n.scheduler != nil {
+		n.scheduler.Stop()
+	}
+	if n.inval != nil {
+		n.inval.Stop()
+	}
+	if n.stopAntiEntropy != nil {
+		n.stopAntiEntropy()
+	}
+	if n.memcached != nil {
+		n.memcached.Close()
+	}
+	if n.redis != nil {
+		n.redis.Close()
+	}
+	for _, srv := range n.servers {
+		srv.Shutdown(ctx)
+	}
+	if n.http3 != nil {
+		n.http3.Shutdown(ctx)
+	}
+	for _, g := range n.groups {
+		if err := g.FlushWrites(ctx); err != nil {
+			log.Printf("group %s: %d writes lost: %v", g.Name(), g.PendingWrites(), err)
+		}
+	}
+}
+
+// groupNames returns the names of the node's groups.
+func (n *node) groupNames() []string {
+	names := make([]string, len(n.groups))
+	for i, g := range n.groups {
+		names[i] = g.Name()
+	}
+	return names
+}
+
+// newGroup creates the group described by gc, budgeted by m if it isn't
+// nil.
+func newGroup(gc GroupConfig, m *geecache.CacheManager) (*geecache.Group, error) {
+	opts := []geecache.Option{
+		geecache.WithPolicy("", geecache.Policy{TTL: time.Duration(gc.TTL), Idle: time.Duration(gc.Idle)}),
+	}
+	if m != nil {
+		// 配置摘要按节点的总预算计算，各节点配置相同时一致
+		opts = append(opts, geecache.WithCacheBytes(m.Total()), geecache.WithCacheManager(m, gc.Weight))
+	} else {
+		opts = append(opts, geecache.WithCacheBytes(int64(gc.CacheBytes)))
+	}
+	switch gc.Eviction {
+	case "slru":
+		opts = append(opts, geecache.WithEvictionPolicy(geecache.EvictSLRU))
+	case "clock":
+		opts = append(opts, geecache.WithEvictionPolicy(geecache.EvictClock))
+	}
+	if gc.MaxEntry > 0 {
+		opts = append(opts, geecache.WithMaxEntryBytes(int64(gc.MaxEntry)))
+	}
+	if gc.Shards > 0 {
+		opts = append(opts, geecache.WithShards(gc.Shards))
+	}
+	if gc.HotCacheRatio > 0 {
+		opts = append(opts, geecache.WithHotCache(gc.HotCacheRatio))
+	}
+	if gc.Consistency == "read-your-writes" {
+		opts = append(opts, geecache.WithConsistency(geecache.ReadYourWrites))
+	}
+	if gc.SlowLoad > 0 {
+		opts = append(opts, geecache.WithSlowLoadLog(time.Duration(gc.SlowLoad)))
+	}
+	if gc.PooledBuffers {
+		opts = append(opts, geecache.WithPooledBuffers())
+	}
+	if gc.ArenaBytes > 0 {
+		minBytes := int(gc.ArenaMinBytes)
+		if minBytes <= 0 {
+			minBytes = defaultArenaMinBytes
+		}
+		opts = append(opts, geecache.WithArena(minBytes, int64(gc.ArenaBytes)))
+	}
+	if gc.ChunkBytes > 0 {
+		opts = append(opts, geecache.WithChunking(int64(gc.ChunkBytes)))
+	}
+	if gc.DedupWait > 0 {
+		opts = append(opts, geecache.WithDistributedDedup(geecache.Dedup{Wait: time.Duration(gc.DedupWait)}))
+	}
+	if gc.PrefixSeparator != "" {
+		opts = append(opts, geecache.WithPrefixIndex(gc.PrefixSeparator[0]))
+	}
+	if gc.Store != "" {
+		s, err := openStore(gc.Store)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %v", gc.Name, err)
+		}
+		opts = append(opts, geecache.WithStore(s))
+	}
+	if gc.Origin != "" {
+		opts = append(opts, geecache.WithOrigin(geecache.GetGroup(gc.Origin)))
+	}
+	// 值只来自 Set 或 Store，两者都没有的 key 就是不存在
+	getter := geecache.GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", geecache.ErrNotFound, key)
+	})
+	return geecache.NewGroup(gc.Name, getter, opts...), nil
+}
+
+// newInvalidations returns the subscriber to the invalidation channel
+// named by spec.
+func newInvalidations(spec string) (*invalidate.Subscriber, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("invalidations must be a URL like redis://host:port/channel, got %q", spec)
+	}
+	o := &invalidate.Options{}
+	if u.User != nil {
+		var ok bool
+		if o.Password, ok = u.User.Password(); ok {
+			o.User = u.User.Username()
+		} else {
+			o.Token = u.User.Username() // NATS 的令牌写在用户名的位置
+		}
+	}
+	switch u.Scheme {
+	case "redis":
+		return invalidate.NewRedis(u.Host, strings.Trim(u.Path, "/"), o), nil
+	case "nats":
+		return invalidate.NewNATS(u.Host, strings.Trim(u.Path, "/"), o), nil
+	}
+	return nil, fmt.Errorf("unsupported invalidations %q, want redis:// or nats://", spec)
+}
+
+// openStore opens a store described as "dir:<path>" or
+// "redis://[:password@]host:port[/db]".
+func openStore(spec string) (geecache.Store, error) {
+	if path, ok := strings.CutPrefix(spec, "dir:"); ok {
+		return store.NewDir(path)
+	}
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("unsupported store %q", spec)
+	}
+	o := &store.RedisOptions{}
+	if u.User != nil {
+		o.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if o.DB, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database in %q", spec)
+		}
+	}
+	return store.NewRedis(u.Host, o), nil
+}
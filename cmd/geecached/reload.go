@@ -0,0 +1,195 @@
+package main
+
+import (
+	"GeeCache/geecache"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// 热加载：收到 SIGHUP 或配置文件被修改后重新读取配置，原地调整节点列表、
+// group 大小、过期策略、限流和定时任务，缓存的数据与进行中的请求不受影响
+
+// watchConfig reloads the configuration file on SIGHUP, and when its
+// modification time changes if interval isn't 0.
+func (n *node) watchConfig(path string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	mtime := modTime(path)
+	for {
+		select {
+		case <-hup:
+		case <-tick:
+			t := modTime(path)
+			if t.Equal(mtime) {
+				continue
+			}
+			mtime = t
+		}
+		cfg, err := loadConfig(path)
+		if err != nil {
+			// 配置有误时保留当前配置继续运行
+			log.Println("configuration not reloaded:", err)
+			continue
+		}
+		n.reload(cfg)
+	}
+}
+
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// reload applies cfg to the running node. Settings that can't change
+// without restarting, like listen addresses, credentials or the store of a
+// group, are reported and keep their current values. CheckManifests keeps
+// comparing the cache sizes the groups were created with.
+func (n *node) reload(cfg *Config) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	old := n.cfg
+	// applied 记录实际生效的配置：需要重启才能修改的设置保留原值，下次加载时仍会提示
+	applied := *cfg
+	restart := func(what string) { log.Printf("changing %s requires a restart", what) }
+	if cfg.Self != old.Self || cfg.Listen != old.Listen || cfg.Ring != old.Ring || cfg.RingHash != old.RingHash {
+		restart("self, listen or ring")
+		applied.Self, applied.Listen, applied.Ring, applied.RingHash = old.Self, old.Listen, old.Ring, old.RingHash
+	}
+	if cfg.AuthToken != old.AuthToken || cfg.AdminToken != old.AdminToken || !reflect.DeepEqual(cfg.TLS, old.TLS) || cfg.Transport != old.Transport {
+		restart("tokens, TLS files or transport") // 证书内容的轮换由 CertReloader 处理
+		applied.AuthToken, applied.AdminToken, applied.TLS, applied.Transport = old.AuthToken, old.AdminToken, old.TLS, old.Transport
+	}
+	if cfg.AntiEntropy != old.AntiEntropy || cfg.Migrate != old.Migrate {
+		restart("anti_entropy or migrate")
+		applied.AntiEntropy, applied.Migrate = old.AntiEntropy, old.Migrate
+	}
+	if cfg.MinProtocol != old.MinProtocol || cfg.SlowPeer != old.SlowPeer || cfg.CompressResponses != old.CompressResponses {
+		restart("min_protocol, slow_peer or compress_responses")
+		applied.MinProtocol, applied.SlowPeer, applied.CompressResponses = old.MinProtocol, old.SlowPeer, old.CompressResponses
+	}
+	if cfg.Debug != old.Debug || cfg.API != old.API || cfg.Memcached != old.Memcached || cfg.Redis != old.Redis {
+		restart("debug or front end addresses")
+		applied.Debug, applied.API, applied.Memcached, applied.Redis = old.Debug, old.API, old.Memcached, old.Redis
+	}
+	if cfg.Invalidations != old.Invalidations {
+		restart("invalidations")
+		applied.Invalidations = old.Invalidations
+	}
+
+	if (cfg.CacheBytes > 0) != (old.CacheBytes > 0) {
+		// 两种分配方式下各 group 的 cache_bytes 含义不同，无法只套用一部分
+		log.Println("configuration not reloaded: switching between node and group cache_bytes requires a restart")
+		return
+	}
+	if cfg.CacheBytes != old.CacheBytes {
+		n.manager.SetTotal(int64(cfg.CacheBytes))
+		log.Println("cache budget reloaded:", int64(cfg.CacheBytes))
+	}
+
+	if !reflect.DeepEqual(cfg.Peers, old.Peers) {
+		n.pool.Set(cfg.Peers...)
+		log.Println("peers reloaded:", cfg.Peers)
+	}
+	if !reflect.DeepEqual(cfg.RateLimit, old.RateLimit) {
+		n.pool.SetRateLimit(rateLimit(cfg.RateLimit))
+		log.Println("rate limit reloaded")
+	}
+
+	current := make(map[string]GroupConfig, len(old.Groups))
+	for _, gc := range old.Groups {
+		current[gc.Name] = gc
+	}
+	applied.Groups = nil
+	for _, gc := range cfg.Groups {
+		prev, ok := current[gc.Name]
+		delete(current, gc.Name)
+		if !ok {
+			g, err := newGroup(gc, n.manager)
+			if err != nil {
+				log.Printf("group %q not created: %v", gc.Name, err)
+				continue
+			}
+			if gc.Origin == "" {
+				g.RegisterPeers(n.pool)
+			}
+			n.groups = append(n.groups, g)
+			applied.Groups = append(applied.Groups, gc)
+			log.Println("group created:", gc.Name)
+			continue
+		}
+		g := geecache.GetGroup(gc.Name)
+		if n.manager != nil {
+			if gc.Weight != prev.Weight {
+				n.manager.SetWeight(g, gc.Weight)
+			}
+		} else if gc.CacheBytes != prev.CacheBytes {
+			g.SetCacheBytes(int64(gc.CacheBytes))
+		}
+		if gc.TTL != prev.TTL || gc.Idle != prev.Idle {
+			g.SetPolicy("", geecache.Policy{TTL: time.Duration(gc.TTL), Idle: time.Duration(gc.Idle)})
+		}
+		if gc.MaxEntry != prev.MaxEntry || gc.Eviction != prev.Eviction || gc.Shards != prev.Shards || gc.Store != prev.Store || gc.Origin != prev.Origin || gc.HotCacheRatio != prev.HotCacheRatio || gc.Consistency != prev.Consistency {
+			restart("max_entry_bytes, eviction, shards, store, origin, hot_cache_ratio or consistency of group " + gc.Name)
+			gc.MaxEntry, gc.Eviction, gc.Shards, gc.Store, gc.Origin = prev.MaxEntry, prev.Eviction, prev.Shards, prev.Store, prev.Origin
+			gc.HotCacheRatio, gc.Consistency = prev.HotCacheRatio, prev.Consistency
+		}
+		if gc.SlowLoad != prev.SlowLoad {
+			restart("slow_load of group " + gc.Name)
+			gc.SlowLoad = prev.SlowLoad
+		}
+		if gc.PooledBuffers != prev.PooledBuffers {
+			restart("pooled_buffers of group " + gc.Name)
+			gc.PooledBuffers = prev.PooledBuffers
+		}
+		if gc.ArenaBytes != prev.ArenaBytes || gc.ArenaMinBytes != prev.ArenaMinBytes {
+			restart("arena_bytes or arena_min_bytes of group " + gc.Name)
+			gc.ArenaBytes, gc.ArenaMinBytes = prev.ArenaBytes, prev.ArenaMinBytes
+		}
+		if gc.ChunkBytes != prev.ChunkBytes {
+			restart("chunk_bytes of group " + gc.Name)
+			gc.ChunkBytes = prev.ChunkBytes
+		}
+		if gc.DedupWait != prev.DedupWait {
+			restart("dedup_wait of group " + gc.Name)
+			gc.DedupWait = prev.DedupWait
+		}
+		if gc.PrefixSeparator != prev.PrefixSeparator {
+			restart("prefix_separator of group " + gc.Name)
+			gc.PrefixSeparator = prev.PrefixSeparator
+		}
+		applied.Groups = append(applied.Groups, gc)
+	}
+	for _, gc := range old.Groups {
+		if _, removed := current[gc.Name]; removed {
+			// group 不能销毁，继续按原有配置提供服务
+			log.Printf("group %q removed from the configuration keeps running until a restart", gc.Name)
+			applied.Groups = append(applied.Groups, gc)
+		}
+	}
+
+	if !reflect.DeepEqual(cfg.Schedules, old.Schedules) {
+		if n.scheduler != nil {
+			n.scheduler.Stop()
+			n.scheduler = nil
+		}
+		if err := n.startScheduler(cfg.Schedules); err != nil {
+			log.Println("schedules stopped:", err)
+			applied.Schedules = nil
+		}
+	}
+	n.cfg = &applied
+	log.Println("configuration reloaded")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"GeeCache/geecache"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	cfg := &Config{
+		Self:   "http://localhost:18101",
+		Peers:  []string{"http://localhost:18101"},
+		Groups: []GroupConfig{{Name: "reload-a", CacheBytes: 1 << 20, TTL: duration(time.Hour)}},
+	}
+	g, err := newGroup(cfg.Groups[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &node{cfg: cfg, groups: []*geecache.Group{g}}
+	n.pool = geecache.NewHTTPPoolOpts(cfg.Self, &geecache.HTTPPoolOptions{Middleware: []geecache.Middleware{}})
+	n.pool.Set(cfg.Peers...)
+	g.RegisterPeers(n.pool)
+	ctx := context.Background()
+	g.Set(ctx, "k", []byte("v"))
+
+	next := *cfg
+	next.Redis = ":16379"
+	next.RateLimit = &RateLimitConfig{Rate: 1, Burst: 1}
+	next.Groups = []GroupConfig{
+		{Name: "reload-a", CacheBytes: 2 << 20, TTL: duration(time.Minute), Store: "dir:" + t.TempDir()},
+		{Name: "reload-b", CacheBytes: 1 << 20},
+	}
+	n.reload(&next)
+
+	if g.CacheBytes() != 2<<20 {
+		t.Fatalf("cache bytes = %d after reload", g.CacheBytes())
+	}
+	if v, err := g.Get("k"); err != nil || v.String() != "v" {
+		t.Fatalf("cached value lost on reload: %q, %v", v.String(), err)
+	}
+	g.Set(ctx, "k2", []byte("v"))
+	if ttl, _ := g.TTL(ctx, "k2"); ttl > time.Minute {
+		t.Fatalf("ttl = %v after reloading the policy", ttl)
+	}
+	if geecache.GetGroup("reload-b") == nil || len(n.groups) != 2 {
+		t.Fatalf("new group wasn't created")
+	}
+	if n.cfg.Redis != "" || n.cfg.Groups[0].Store != "" {
+		t.Fatalf("settings needing a restart were applied: %+v", n.cfg)
+	}
+	codes := make([]int, 2)
+	for i := range codes {
+		rec := httptest.NewRecorder()
+		n.pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_geecache/reload-a/k", nil))
+		codes[i] = rec.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("status codes with the reloaded rate limit = %v", codes)
+	}
+}
+
+func TestReloadCacheBudget(t *testing.T) {
+	cfg := &Config{
+		Self:       "http://localhost:18102",
+		CacheBytes: 3 << 20,
+		Groups:     []GroupConfig{{Name: "budget-a", Weight: 2}},
+	}
+	n := &node{cfg: cfg, manager: geecache.NewCacheManager(int64(cfg.CacheBytes))}
+	g, err := newGroup(cfg.Groups[0], n.manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.groups = []*geecache.Group{g}
+	n.pool = geecache.NewHTTPPoolOpts(cfg.Self, &geecache.HTTPPoolOptions{Middleware: []geecache.Middleware{}})
+	if g.CacheBytes() != 3<<20 {
+		t.Fatalf("cache bytes = %d, want the whole budget", g.CacheBytes())
+	}
+
+	next := *cfg
+	next.CacheBytes = 4 << 20
+	next.Groups = []GroupConfig{{Name: "budget-a", Weight: 3}, {Name: "budget-b"}}
+	n.reload(&next)
+	if a, b := g.CacheBytes(), geecache.GetGroup("budget-b").CacheBytes(); a != 3<<20 || b != 1<<20 {
+		t.Fatalf("cache bytes after reload = %d and %d", a, b)
+	}
+
+	// 切换到按 group 分配需要重启，整份配置不生效
+	perGroup := next
+	perGroup.CacheBytes = 0
+	perGroup.Groups = []GroupConfig{{Name: "budget-a", CacheBytes: 1 << 20}, {Name: "budget-b", CacheBytes: 1 << 20}}
+	n.reload(&perGroup)
+	if g.CacheBytes() != 3<<20 || n.cfg.CacheBytes != 4<<20 {
+		t.Fatalf("switching to group budgets was applied: %d", g.CacheBytes())
+	}
+}
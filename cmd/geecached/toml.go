@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by configuration files:
+// key = value pairs, [table] and [[array of tables]] headers one level
+// deep, and basic or literal strings, integers, floats, booleans and
+// arrays, which may span several lines, as values. Anything else is
+// reported as an error rather than guessed at.
+func parseTOML(data string) (map[string]any, error) {
+	root := make(map[string]any)
+	cur := root
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			var err error
+			if cur, err = openTable(root, line); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isBareKey(key) {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		value = strings.TrimSpace(value)
+		// 多行数组：括号配平之前把后续行拼接进来
+		for strings.HasPrefix(value, "[") && !balanced(value) && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		if _, dup := cur[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, key)
+		}
+		p := &tomlParser{s: value}
+		v, err := p.value()
+		if err == nil && strings.TrimSpace(p.s[p.pos:]) != "" {
+			err = fmt.Errorf("unexpected %q after value", p.s[p.pos:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		cur[key] = v
+	}
+	return root, nil
+}
+
+// openTable returns the table a [name] or [[name]] header starts.
+func openTable(root map[string]any, header string) (map[string]any, error) {
+	array := strings.HasPrefix(header, "[[")
+	name := strings.TrimPrefix(header, "[")
+	if array {
+		name = strings.TrimPrefix(name, "[")
+		if !strings.HasSuffix(name, "]]") {
+			return nil, fmt.Errorf("unterminated table header")
+		}
+		name = strings.TrimSuffix(name, "]]")
+	} else {
+		if !strings.HasSuffix(name, "]") {
+			return nil, fmt.Errorf("unterminated table header")
+		}
+		name = strings.TrimSuffix(name, "]")
+	}
+	name = strings.TrimSpace(name)
+	if !isBareKey(name) {
+		return nil, fmt.Errorf("unsupported table name %q", name)
+	}
+	t := make(map[string]any)
+	switch existing := root[name].(type) {
+	case nil:
+		if array {
+			root[name] = []any{t}
+		} else {
+			root[name] = t
+		}
+	case []any:
+		if !array {
+			return nil, fmt.Errorf("%q is an array of tables", name)
+		}
+		root[name] = append(existing, t)
+	default:
+		return nil, fmt.Errorf("duplicate table %q", name)
+	}
+	return t, nil
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// stripComment removes a # comment that isn't inside a string.
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// balanced reports whether the brackets of an array value are closed.
+func balanced(s string) bool {
+	depth := 0
+	var quote rune
+	for _, c := range stripComment(s) {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+type tomlParser struct {
+	s   string
+	pos int
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) value() (any, error) {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		end := strings.IndexByte(p.s[p.pos+1:], '\'')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		s := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return s, nil
+	case c == '[':
+		return p.array()
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" \t,]", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	word := p.s[start:p.pos]
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.ReplaceAll(word, "_", "")
+	if n, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", word)
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			p.pos++
+			switch e := p.s[p.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			default:
+				return "", fmt.Errorf("unsupported escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+func (p *tomlParser) array() ([]any, error) {
+	p.pos++ // [
+	res := []any{}
+	for {
+		p.skipSpace()
+		if p.pos < len(p.s) && p.s[p.pos] == ']' {
+			p.pos++
+			return res, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+		p.skipSpace()
+		if p.pos == len(p.s) {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		switch p.s[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package geecache
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 按 group 的访问控制，用于多租户共享同一个缓存集群
+
+// Identity describes who sent a request to the HTTPPool.
+type Identity struct {
+	Token      string // bearer token, if one was presented
+	CommonName string // subject CN of the verified client certificate
+	IP         net.IP // remote address of the connection
+}
+
+// identify extracts the Identity of r.
+func identify(r *http.Request) Identity {
+	var id Identity
+	id.Token, _ = bearerToken(r)
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		id.CommonName = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	id.IP = net.ParseIP(host)
+	return id
+}
+
+// ACLRule matches identities by token, certificate CN or network. An
+// identity matching any entry is allowed; an empty rule allows no one.
+type ACLRule struct {
+	Tokens      []string
+	CommonNames []string
+	Networks    []*net.IPNet
+}
+
+// Allows reports whether id matches the rule.
+func (r ACLRule) Allows(id Identity) bool {
+	if id.Token != "" {
+		for _, token := range r.Tokens {
+			if subtle.ConstantTimeCompare([]byte(id.Token), []byte(token)) == 1 {
+				return true
+			}
+		}
+	}
+	if id.CommonName != "" {
+		for _, cn := range r.CommonNames {
+			if cn == id.CommonName {
+				return true
+			}
+		}
+	}
+	if id.IP != nil {
+		for _, n := range r.Networks {
+			if n.Contains(id.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r ACLRule) hasToken(token string) bool {
+	return token != "" && r.Allows(Identity{Token: token})
+}
+
+// GroupACL is the access policy of a single group. Admin implies Read, and
+// only Admin allows peer requests writing to the group.
+type GroupACL struct {
+	Read  ACLRule
+	Admin ACLRule
+}
+
+// ACL maps group names to their policies. The entry "*" applies to groups
+// without an entry of their own; groups matching neither are closed.
+type ACL map[string]GroupACL
+
+func (a ACL) lookup(group string) (GroupACL, bool) {
+	if g, ok := a[group]; ok {
+		return g, true
+	}
+	g, ok := a["*"]
+	return g, ok
+}
+
+// CanRead reports whether id may read values of group.
+func (a ACL) CanRead(group string, id Identity) bool {
+	g, ok := a.lookup(group)
+	return ok && (g.Read.Allows(id) || g.Admin.Allows(id))
+}
+
+// CanAdmin reports whether id may administer group.
+func (a ACL) CanAdmin(group string, id Identity) bool {
+	g, ok := a.lookup(group)
+	return ok && g.Admin.Allows(id)
+}
+
+// knowsToken reports whether token is granted anything by any rule.
+func (a ACL) knowsToken(token string) bool {
+	for _, g := range a {
+		if g.Read.hasToken(token) || g.Admin.hasToken(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetworks parses CIDRs (or bare IP addresses) for use in ACLRule.Networks.
+func ParseNetworks(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: s}
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,215 @@
+package geecache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 管理接口，挂载在 /<basepath>/admin/ 下，需要管理员权限
+
+const adminPrefix = "admin/"
+
+// isAdminPath reports whether path belongs to the admin API.
+func (p *HTTPPool) isAdminPath(path string) bool {
+	return strings.HasPrefix(path, p.basePath+adminPrefix)
+}
+
+// serveAdmin handles requests below the admin prefix:
+//
+//	GET    stats               statistics of every group
+//	POST   flush/<group>       drop every entry of group on this node
+//	DELETE <group>/<key>       drop key from this node
+//	DELETE <group>/<p>?prefix  drop every key starting with p from this node
+//	GET    prefix/<group>/<p>  values cached for the keys starting with p, see Group.PrefixStats
+//	GET    rebalance?peers=... entries that would move to other nodes, see PlanRebalance
+//	GET    peers               requests to every peer, see PeerStats
+//	GET    ring                share of the keys each node owns, see RingReport
+//	POST   ring                the same, also placing the keys of the body, one per line
+//	GET    debug/...           see HTTPPoolOptions.EnableDebug
+func (p *HTTPPool) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path[len(p.basePath+adminPrefix):]
+
+	switch {
+	case r.Method == http.MethodGet && path == "stats":
+		if p.checkAdmin(w, r, "") {
+			writeJSON(w, http.StatusOK, allGroupStats())
+		}
+	case r.Method == http.MethodGet && path == "peers":
+		if p.checkAdmin(w, r, "") {
+			writeJSON(w, http.StatusOK, p.PeerStats())
+		}
+	case r.Method == http.MethodGet && path == "rebalance":
+		if p.checkAdmin(w, r, "") {
+			p.serveRebalancePlan(w, r)
+		}
+	case (r.Method == http.MethodGet || r.Method == http.MethodPost) && path == "ring":
+		if p.checkAdmin(w, r, "") {
+			p.serveRing(w, r)
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "prefix/"):
+		name, prefix, _ := strings.Cut(strings.TrimPrefix(path, "prefix/"), "/")
+		if !p.checkAdmin(w, r, name) {
+			return
+		}
+		group := GetGroup(name)
+		if group == nil {
+			writeJSON(w, http.StatusNotFound, adminResult{Group: name, Error: "no such group"})
+			return
+		}
+		writeJSON(w, http.StatusOK, group.PrefixStats(prefix))
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "flush/"):
+		name := strings.TrimPrefix(path, "flush/")
+		if !p.checkAdmin(w, r, name) {
+			return
+		}
+		group := GetGroup(name)
+		if group == nil {
+			writeJSON(w, http.StatusNotFound, adminResult{Group: name, Error: "no such group"})
+			return
+		}
+		group.Clear()
+		p.opts.Logger.Info("group flushed via admin API", "group", name, "remote", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, adminResult{Group: name, Flushed: true})
+	case r.Method == http.MethodDelete && strings.Contains(path, "/"):
+		name, key, _ := strings.Cut(path, "/")
+		if !p.checkAdmin(w, r, name) {
+			return
+		}
+		group := GetGroup(name)
+		if group == nil {
+			writeJSON(w, http.StatusNotFound, adminResult{Group: name, Error: "no such group"})
+			return
+		}
+		if r.URL.Query().Has("prefix") {
+			n := group.RemovePrefix(key)
+			writeJSON(w, http.StatusOK, adminResult{Group: name, Key: key, Count: &n})
+			return
+		}
+		removed := group.Remove(key)
+		writeJSON(w, http.StatusOK, adminResult{Group: name, Key: key, Removed: &removed})
+	case p.opts.EnableDebug && strings.HasPrefix(path, "debug/"):
+		if !p.checkAdmin(w, r, "") {
+			return
+		}
+		if path == "debug/vars" {
+			p.serveVars(w, r)
+		} else if strings.HasPrefix(path, "debug/pprof/") {
+			servePprof(w, r, strings.TrimPrefix(path, "debug/pprof/"))
+		} else {
+			http.NotFound(w, r)
+		}
+	default:
+		writeJSON(w, http.StatusNotFound, adminResult{Error: "unknown admin endpoint"})
+	}
+}
+
+// adminResult is the JSON body answered by the admin API.
+type adminResult struct {
+	Group   string `json:"group,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Flushed bool   `json:"flushed,omitempty"`
+	Removed *bool  `json:"removed,omitempty"`
+	Count   *int   `json:"count,omitempty"` // of the keys removed by prefix
+	Error   string `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// checkAdmin writes an error response and returns false unless r may
+// administer group.
+func (p *HTTPPool) checkAdmin(w http.ResponseWriter, r *http.Request, group string) bool {
+	return p.authorize(w, r, EndpointAdmin, group)
+}
+
+// serveVars writes process, cache and peer statistics in the same JSON
+// shape as expvar's /debug/vars. expvar itself isn't used because
+// importing it registers the handler on http.DefaultServeMux, unprotected.
+func (p *HTTPPool) serveVars(w http.ResponseWriter, r *http.Request) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cmdline":  os.Args,
+		"memstats": ms,
+		"geecache": allGroupStats(),
+		"peers":    p.PeerStats(),
+	})
+}
+
+// servePprof serves the profiles of runtime/pprof in the format expected
+// by "go tool pprof". net/http/pprof isn't used for the same reason as
+// expvar: it registers itself on http.DefaultServeMux.
+func servePprof(w http.ResponseWriter, r *http.Request, name string) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	seconds := func() time.Duration {
+		sec, err := strconv.ParseInt(r.FormValue("seconds"), 10, 64)
+		if err != nil || sec <= 0 {
+			sec = 30
+		}
+		return time.Duration(sec) * time.Second
+	}
+	switch name {
+	case "":
+		profiles := pprof.Profiles()
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, p := range profiles {
+			fmt.Fprintf(w, "%s %d\n", p.Name(), p.Count())
+		}
+		fmt.Fprintln(w, "profile")
+		fmt.Fprintln(w, "trace")
+	case "profile":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := pprof.StartCPUProfile(w); err != nil {
+			http.Error(w, "could not enable CPU profiling: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sleep(r, seconds())
+		pprof.StopCPUProfile()
+	case "trace":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := trace.Start(w); err != nil {
+			http.Error(w, "could not enable tracing: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sleep(r, seconds())
+		trace.Stop()
+	default:
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			http.Error(w, "unknown profile "+name, http.StatusNotFound)
+			return
+		}
+		debug, _ := strconv.Atoi(r.FormValue("debug"))
+		if debug != 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		if name == "heap" && r.FormValue("gc") != "" {
+			runtime.GC()
+		}
+		profile.WriteTo(w, debug)
+	}
+}
+
+// sleep waits for d or until the client goes away.
+func sleep(r *http.Request, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,150 @@
+package geecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func adminRequest(pool *HTTPPool, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, defaultBasePath+adminPrefix+path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminDebugEndpoints(t *testing.T) {
+	g := NewGroup("debugged", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10))
+	g.Get("k")
+	g.Get("k")
+
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{AdminToken: "admin", EnableDebug: true})
+
+	if rec := adminRequest(pool, http.MethodGet, "debug/vars", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous debug/vars: status = %d", rec.Code)
+	}
+	if rec := adminRequest(pool, http.MethodGet, "debug/vars", "wrong"); rec.Code != http.StatusForbidden {
+		t.Fatalf("wrong token debug/vars: status = %d", rec.Code)
+	}
+
+	rec := adminRequest(pool, http.MethodGet, "debug/vars", "admin")
+	var vars struct {
+		Geecache map[string]struct {
+			Stats map[string]int64
+			Cache CacheStats
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("debug/vars is not JSON: %v", err)
+	}
+	st := vars.Geecache["debugged"]
+	if st.Stats["Gets"] != 2 || st.Stats["CacheHits"] != 1 || st.Cache.Items != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	rec = adminRequest(pool, http.MethodGet, "debug/pprof/", "admin")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine") {
+		t.Fatalf("pprof index: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	rec = adminRequest(pool, http.MethodGet, "debug/pprof/goroutine?debug=1", "admin")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Fatalf("goroutine profile: status = %d", rec.Code)
+	}
+
+	off := NewHTTPPoolOpts("", &HTTPPoolOptions{AdminToken: "admin"})
+	if rec := adminRequest(off, http.MethodGet, "debug/vars", "admin"); rec.Code != http.StatusNotFound {
+		t.Fatalf("debug endpoints mounted without EnableDebug: status = %d", rec.Code)
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	loads := 0
+	g := NewGroup("administered", GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10))
+	g.Get("a")
+	g.Get("b")
+
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		AdminToken: "admin",
+		ACL: ACL{"administered": {
+			Read:  ACLRule{Tokens: []string{"reader"}},
+			Admin: ACLRule{Tokens: []string{"owner"}},
+		}},
+	})
+
+	if rec := adminRequest(pool, http.MethodDelete, "administered/a", "reader"); rec.Code != http.StatusForbidden {
+		t.Fatalf("reader deleting a key: status = %d", rec.Code)
+	}
+	rec := adminRequest(pool, http.MethodDelete, "administered/a", "owner")
+	var res adminResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Removed == nil || !*res.Removed {
+		t.Fatalf("delete: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if g.Get("a"); loads != 3 {
+		t.Fatalf("deleted key was not reloaded, loads = %d", loads)
+	}
+
+	if rec := adminRequest(pool, http.MethodPost, "flush/administered", "owner"); rec.Code != http.StatusOK {
+		t.Fatalf("flush: status = %d", rec.Code)
+	}
+	if st := g.CacheStats(); st.Items != 0 {
+		t.Fatalf("items after flush = %d", st.Items)
+	}
+	if rec := adminRequest(pool, http.MethodPost, "flush/nonexistent", "admin"); rec.Code != http.StatusNotFound {
+		t.Fatalf("flush of unknown group: status = %d", rec.Code)
+	}
+
+	if rec := adminRequest(pool, http.MethodGet, "stats", "owner"); rec.Code != http.StatusForbidden {
+		t.Fatalf("group admin reading node stats: status = %d", rec.Code)
+	}
+	rec = adminRequest(pool, http.MethodGet, "stats", "admin")
+	var stats map[string]groupStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("stats is not JSON: %v", err)
+	}
+	if st, ok := stats["administered"]; !ok || st.Stats.Loads.Get() != 3 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestAdminRing(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{AdminToken: "admin", Middleware: []Middleware{}})
+	pool.Set("http://a", "http://b", "http://c")
+
+	var report RingReport
+	rec := adminRequest(pool, http.MethodGet, "ring", "admin")
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || len(report.Nodes) != 3 || report.Keys != nil {
+		t.Fatalf("ring: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if report.Imbalance < 1 || report.Imbalance > 2 {
+		t.Fatalf("imbalance = %v", report.Imbalance)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, defaultBasePath+adminPrefix+"ring", strings.NewReader("k1\nk2\n\nk3\n"))
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = httptest.NewRecorder()
+	pool.ServeHTTP(rec, req)
+	report = RingReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, n := range report.Keys {
+		total += n
+	}
+	if total != 3 || len(report.Keys) != 3 {
+		t.Fatalf("sample keys placed = %v", report.Keys)
+	}
+	if rec := adminRequest(pool, http.MethodGet, "ring", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("ring without a token: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// 过载保护：回源的并发数或耗时超过阈值时，按概率提前拒绝一部分未命中的加载，
+// 让节点在流量尖峰下保持稳定，而不是所有请求一起变慢直至超时
+
+// AdmissionControl configures the early rejection of loads on an
+// overloaded node. Past a threshold the rejection probability grows
+// linearly, reaching MaxReject at twice the threshold.
+type AdmissionControl struct {
+	MaxLoads   int           // concurrent loads (cache misses) before rejecting, 0 to ignore
+	MaxLatency time.Duration // average load latency before rejecting, 0 to ignore
+	// MaxReject caps the rejection probability, defaulting to 0.9. It is
+	// clamped to maxReject so that the loads let through keep measuring
+	// latency.
+	MaxReject float64
+}
+
+// WithAdmissionControl makes the group reject part of its loads with
+// ErrOverloaded while it is overloaded. Cache hits are always served.
+// The current rejection probability is reported by Group.RejectRate.
+func WithAdmissionControl(a AdmissionControl) Option {
+	return func(g *Group) {
+		switch {
+		case a.MaxReject <= 0:
+			a.MaxReject = 0.9
+		case a.MaxReject > maxReject:
+			// 拒绝全部回源后平均耗时不再更新，节点将永远处于过载状态
+			a.MaxReject = maxReject
+		}
+		g.admission = &admission{cfg: a}
+	}
+}
+
+// maxReject is the highest rejection probability AdmissionControl allows.
+const maxReject = 0.99
+
+type admission struct {
+	cfg     AdmissionControl
+	loading atomic.Int64
+	latency atomic.Int64 // 加载耗时的指数移动平均(ns)
+}
+
+// over returns how far x is past threshold t, from 0 at t to 1 at 2t.
+func over(x, t int64) float64 {
+	if t <= 0 || x <= t {
+		return 0
+	}
+	if x >= 2*t {
+		return 1
+	}
+	return float64(x-t) / float64(t)
+}
+
+// rate returns the probability of rejecting a load now.
+func (a *admission) rate() float64 {
+	p := over(a.loading.Load(), int64(a.cfg.MaxLoads))
+	if q := over(a.latency.Load(), int64(a.cfg.MaxLatency)); q > p {
+		p = q
+	}
+	return p * a.cfg.MaxReject
+}
+
+// admit decides whether a load may start.
+func (a *admission) admit() bool {
+	p := a.rate()
+	return p == 0 || rand.Float64() >= p
+}
+
+// begin records the start of an admitted load; the returned function
+// records its end.
+func (a *admission) begin() func() {
+	a.loading.Add(1)
+	start := time.Now()
+	return func() {
+		a.loading.Add(-1)
+		// 并发更新可能丢失个别样本，对平均值影响可以忽略
+		d := int64(time.Since(start))
+		avg := a.latency.Load()
+		a.latency.Store(avg + (d-avg)/8)
+	}
+}
+
+// RejectRate returns the probability with which the group currently
+// rejects loads, 0 without WithAdmissionControl.
+func (g *Group) RejectRate() float64 {
+	if g.admission == nil {
+		return 0
+	}
+	return g.admission.rate()
+}
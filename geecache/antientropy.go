@@ -0,0 +1,393 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	"GeeCache/geecache/lru"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 反熵修复：副本节点把自己持有副本的 key 发给归属节点，双方只对这些 key 计算
+// Merkle 树摘要，副本节点只拉取摘要不同的区间的条目，修复网络分区等原因造成的
+// 副本与归属节点的不一致
+
+// antiEntropyPath is served below the base path as _antientropy/<group>.
+const antiEntropyPath = "_antientropy/"
+
+// maxAntiEntropyBody bounds the key lists serveAntiEntropy reads.
+const maxAntiEntropyBody = 64 << 20
+
+// merkleDepth is the depth of the Merkle trees compared: keys are split
+// into 1<<merkleDepth ranges by hash, the leaves.
+const merkleDepth = 8
+
+// merkleTree is a complete binary tree of digests in heap order: node i
+// has children 2i+1 and 2i+2, and the leaves come last.
+type merkleTree []uint64
+
+// merkleBucket returns the leaf key falls into.
+func merkleBucket(key string) int {
+	return int(consistenthash.XXHash64([]byte(key)) >> (64 - merkleDepth))
+}
+
+// level returns the digests at depth d, the root being at depth 0.
+func (t merkleTree) level(d int) []uint64 {
+	return t[1<<d-1 : 1<<(d+1)-1]
+}
+
+// buildMerkle digests the entries of c matching match. A leaf is the XOR of
+// the digests of its entries, so that the order they're visited in
+// doesn't matter; expiry times are left out.
+func buildMerkle(c *shardedCache, match func(key string) bool) merkleTree {
+	t := make(merkleTree, 1<<(merkleDepth+1)-1)
+	leaves := t.level(merkleDepth)
+	var buf []byte
+	c.iterate(func(key string, v lru.Value, _ lru.EntryOptions) bool {
+		value, ok := viewOf(v)
+		if !ok || !match(key) {
+			return true
+		}
+		buf = append(append(append(buf[:0], key...), 0), value.b...)
+		leaves[merkleBucket(key)] ^= consistenthash.XXHash64(buf)
+		return true
+	})
+	var pair [16]byte
+	for i := len(t) - len(leaves) - 1; i >= 0; i-- {
+		binary.LittleEndian.PutUint64(pair[:8], t[2*i+1])
+		binary.LittleEndian.PutUint64(pair[8:], t[2*i+2])
+		t[i] = consistenthash.XXHash64(pair[:])
+	}
+	return t
+}
+
+// ownedBy matches the keys of g owner owns on ring.
+func ownedBy(g *Group, ring consistenthash.Ring, owner string) func(key string) bool {
+	return func(key string) bool {
+		return ring.Get(g.routeKey(key, "")) == owner
+	}
+}
+
+// writeKeys encodes keys as uvarint length-prefixed strings.
+func writeKeys(keys []string) []byte {
+	var b []byte
+	for _, key := range keys {
+		b = binary.AppendUvarint(b, uint64(len(key)))
+		b = append(b, key...)
+	}
+	return b
+}
+
+// readKeys decodes the keys written by writeKeys.
+func readKeys(r io.Reader) (map[string]bool, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	for len(b) > 0 {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || n > uint64(len(b)-size) {
+			return nil, errors.New("malformed key list")
+		}
+		b = b[size:]
+		keys[string(b[:n])] = true
+		b = b[n:]
+	}
+	return keys, nil
+}
+
+// copyCache is where the group keeps copies of keys other nodes own.
+func (g *Group) copyCache() *shardedCache {
+	if g.hotCache != nil {
+		return g.hotCache
+	}
+	return g.mainCache
+}
+
+// AntiEntropyReport sums up a round of RepairReplicas.
+type AntiEntropyReport struct {
+	Compared  int `json:"compared"`  // group and owner pairs whose digests were compared
+	Divergent int `json:"divergent"` // key ranges whose digests differed
+	Repaired  int `json:"repaired"`  // copies added or replaced
+	Dropped   int `json:"dropped"`   // copies of keys the owner no longer has
+}
+
+func (r *AntiEntropyReport) add(o AntiEntropyReport) {
+	r.Compared += o.Compared
+	r.Divergent += o.Divergent
+	r.Repaired += o.Repaired
+	r.Dropped += o.Dropped
+}
+
+// RepairReplicas makes this node's copies of keys other nodes own match
+// their owners. Copies are kept in the hot cache if the group has one.
+// For every group and owner, this node sends the keys it holds copies of
+// and compares the Merkle trees both sides build over just those keys,
+// then fetches the entries of the key ranges that differ, replacing its
+// copies and dropping those the owner no longer has. Keys it holds no
+// copy of are never added. Owners that are unreachable are skipped and
+// reported in the error.
+func (p *HTTPPool) RepairReplicas(ctx context.Context) (AntiEntropyReport, error) {
+	var report AntiEntropyReport
+	var firstErr error
+	for _, g := range allGroups() {
+		r, err := p.repairGroup(ctx, g)
+		report.add(r)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return report, firstErr
+}
+
+// StartAntiEntropy runs RepairReplicas every interval until stop is
+// called, logging the rounds that repaired anything.
+func (p *HTTPPool) StartAntiEntropy(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			report, err := p.RepairReplicas(ctx)
+			if err != nil && ctx.Err() == nil {
+				p.opts.Logger.Warn("anti-entropy round incomplete", "err", err)
+			}
+			if report.Divergent > 0 {
+				p.opts.Logger.Info("anti-entropy repaired replicas", "ranges", report.Divergent,
+					"repaired", report.Repaired, "dropped", report.Dropped)
+			}
+		}
+	}()
+	return cancel
+}
+
+// repairGroup repairs this node's copies of g against every owner.
+func (p *HTTPPool) repairGroup(ctx context.Context, g *Group) (AntiEntropyReport, error) {
+	var report AntiEntropyReport
+	p.mu.Lock()
+	var node string
+	var peers []string
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		peers = append(peers, peer)
+		if p.selves[peer] {
+			node = peer
+		} else {
+			getters[peer] = getter
+		}
+	}
+	p.mu.Unlock()
+	if node == "" {
+		return report, nil
+	}
+	sort.Strings(peers)
+	// 与对端按同一份节点列表建环，双方对 key 的归属的判断才一致
+	ring := p.newRing()
+	ring.Add(peers...)
+
+	var firstErr error
+	copies := g.copyCache()
+	for owner, getter := range getters {
+		q := url.Values{"node": {node}, "owner": {owner}, "peers": {strings.Join(peers, ",")}}
+		r, err := getter.repair(ctx, p, g, copies, q, ownedBy(g, ring, owner))
+		report.add(r)
+		if err != nil {
+			p.opts.Logger.Warn("anti-entropy with peer failed", "peer", owner, "group", g.name, "err", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("peer %s: %w", owner, err)
+			}
+		}
+	}
+	return report, firstErr
+}
+
+// repair compares the copies in c matching match with the entries of the
+// owner behind h for the same keys, and repairs the key ranges that differ.
+func (h *httpGetter) repair(ctx context.Context, p *HTTPPool, g *Group, c *shardedCache, q url.Values, match func(key string) bool) (AntiEntropyReport, error) {
+	var report AntiEntropyReport
+	var held []string
+	local := buildMerkle(c, func(key string) bool {
+		if !match(key) {
+			return false
+		}
+		held = append(held, key)
+		return true
+	})
+	if len(held) == 0 {
+		return report, nil
+	}
+	report.Compared = 1
+	// 请求里已带上全部 key，直接比较叶子摘要
+	q.Set("level", strconv.Itoa(merkleDepth))
+	leaves, err := h.merkleLevel(ctx, g, q, held)
+	if err != nil {
+		return report, err
+	}
+	buckets := make(map[int]bool)
+	for i, d := range local.level(merkleDepth) {
+		if i >= len(leaves) || leaves[i] != d {
+			buckets[i] = true
+		}
+	}
+	if len(buckets) == 0 {
+		return report, nil
+	}
+	report.Divergent = len(buckets)
+	q.Del("level")
+
+	// 只拉取摘要不同的区间里本节点持有的 key
+	var keys []string
+	stale := make(map[string]bool)
+	for _, key := range held {
+		if buckets[merkleBucket(key)] {
+			keys = append(keys, key)
+			stale[key] = true
+		}
+	}
+	res, err := h.antiEntropyRequest(ctx, g, q, keys)
+	if err != nil {
+		return report, err
+	}
+	defer res.Body.Close()
+	br := bufio.NewReader(p.ThrottleReader(ctx, TrafficReplication, res.Body))
+	now := time.Now().UnixNano()
+	for {
+		e, err := readEntry(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 没读完时不能判断哪些副本多余，只保留已修复的部分
+			return report, fmt.Errorf("reading repair entries: %w", err)
+		}
+		if !stale[e.key] {
+			continue
+		}
+		delete(stale, e.key)
+		if g.addEntryTo(c, e, now) {
+			report.Repaired++
+		}
+	}
+	for key := range stale {
+		if c.remove(key) {
+			report.Dropped++
+		}
+	}
+	return report, nil
+}
+
+// merkleLevel fetches the digests of one level of the owner's tree over
+// keys.
+func (h *httpGetter) merkleLevel(ctx context.Context, g *Group, q url.Values, keys []string) ([]uint64, error) {
+	res, err := h.antiEntropyRequest(ctx, g, q, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 8<<merkleDepth+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body)%8 != 0 {
+		return nil, fmt.Errorf("malformed digests of %d bytes", len(body))
+	}
+	digests := make([]uint64, len(body)/8)
+	for i := range digests {
+		digests[i] = binary.BigEndian.Uint64(body[8*i:])
+	}
+	return digests, nil
+}
+
+func (h *httpGetter) antiEntropyRequest(ctx context.Context, g *Group, q url.Values, keys []string) (*http.Response, error) {
+	u := h.baseURL + antiEntropyPath + url.PathEscape(g.name) + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(writeKeys(keys)))
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return nil, errorFromResponse(res, body)
+	}
+	return res, nil
+}
+
+// serveAntiEntropy answers POST _antientropy/<group> from a replica, node,
+// with owner and peers describing the ring and the keys node holds copies
+// of in the body: with level, the digests at that depth of the Merkle tree
+// of the entries of those keys owner owns; without, the entries.
+func (p *HTTPPool) serveAntiEntropy(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, p.basePath+antiEntropyPath)
+	if !p.authorize(w, r, EndpointPeer, name) {
+		return
+	}
+	group := GetGroup(name)
+	if group == nil {
+		writeError(w, fmt.Errorf("%w: %s", ErrGroupNotFound, name))
+		return
+	}
+	if p.Divergent(name) {
+		writeError(w, fmt.Errorf("%w: %s", ErrConfigMismatch, name))
+		return
+	}
+	if r.Method != http.MethodPost {
+		// 旧版本的副本节点不带 key 列表，按空列表回答会让它丢掉全部副本
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST the keys held", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	node, owner, list := q.Get("node"), q.Get("owner"), q.Get("peers")
+	if node == "" || list == "" || !p.isSelf(owner) {
+		http.Error(w, "node, owner (this node) and peers are required", http.StatusBadRequest)
+		return
+	}
+	keys, err := readKeys(http.MaxBytesReader(w, r.Body, maxAntiEntropyBody))
+	if err != nil {
+		http.Error(w, "bad key list: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ring := p.newRing()
+	ring.Add(p.normalizePeers(strings.Split(list, ","))...)
+	owned := ownedBy(group, ring, p.normalizePeers([]string{owner})[0])
+	match := func(key string) bool { return keys[key] && owned(key) }
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if v := q.Get("level"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 || depth > merkleDepth {
+			http.Error(w, "bad level", http.StatusBadRequest)
+			return
+		}
+		digests := buildMerkle(group.mainCache, match).level(depth)
+		body := make([]byte, 0, 8*len(digests))
+		for _, d := range digests {
+			body = binary.BigEndian.AppendUint64(body, d)
+		}
+		w.Write(body)
+		return
+	}
+	bw := bufio.NewWriter(p.ThrottleWriter(r.Context(), TrafficReplication, w))
+	group.writeEntries(bw, match)
+	bw.Flush()
+}
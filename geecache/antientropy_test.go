@@ -0,0 +1,78 @@
+package geecache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRepairReplicas(t *testing.T) {
+	ctx := context.Background()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v:" + key), nil
+	})
+	owner := NewGroup("anti-entropy", getter, WithCacheBytes(64<<10))
+	var ownerPool *HTTPPool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ownerPool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	ownerPool = NewHTTPPoolOpts(srv.URL, &HTTPPoolOptions{Middleware: []Middleware{}})
+
+	// 同一进程中的 group 是共享的，副本节点用另一个 group 冒充同名 group
+	replica := NewGroup("anti-entropy-replica", getter, WithCacheBytes(64<<10))
+	replica.name = owner.name
+	pool := NewHTTPPoolOpts("http://replica:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set(srv.URL, "http://replica:1")
+	ownerPool.Set(srv.URL, "http://replica:1")
+
+	var owned []string
+	for i := 0; len(owned) < 40; i++ {
+		key := "key" + strconv.Itoa(i)
+		if peer, ok := pool.PickPeer(key); ok && peer != nil {
+			owned = append(owned, key)
+		}
+	}
+	for _, key := range owned[:30] {
+		owner.Get(key)
+	}
+	// 副本上有一个过时的值、一个一致的值，和一个归属节点已经没有的 key
+	replica.populateCache(owned[0], ByteView{b: []byte("stale")}, false)
+	replica.populateCache(owned[1], ByteView{b: []byte("v:" + owned[1])}, false)
+	replica.populateCache(owned[35], ByteView{b: []byte("gone")}, false)
+
+	report, err := pool.repairGroup(ctx, replica)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Compared != 1 || report.Divergent == 0 || report.Repaired != 1 || report.Dropped != 1 {
+		t.Fatalf("report %+v", report)
+	}
+	if v, ok := replica.mainCache.get(owned[0]); !ok || v.String() != "v:"+owned[0] {
+		t.Fatalf("stale copy not repaired: %q", v.String())
+	}
+	if _, ok := replica.mainCache.get(owned[35]); ok {
+		t.Fatal("copy of a key the owner dropped kept")
+	}
+	// 副本节点没有的 key 不会被加进来
+	if _, ok := replica.mainCache.get(owned[2]); ok {
+		t.Fatal("key the replica held no copy of added")
+	}
+
+	report, err = pool.repairGroup(ctx, replica)
+	if err != nil || report.Divergent != 0 || report.Repaired != 0 {
+		t.Fatalf("second round: %+v, %v", report, err)
+	}
+
+	// 旧版本的副本节点用 GET 请求，不带 key 列表
+	res, err := http.Get(srv.URL + defaultBasePath + antiEntropyPath + owner.name + "?node=http://replica:1&owner=" + srv.URL + "&peers=" + srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status %d", res.StatusCode)
+	}
+}
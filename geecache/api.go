@@ -0,0 +1,210 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 对外的 JSON API。调用方可以通过 X-Deadline-Ms 指定整条链路的截止时间，
+// 超时后返回 504 并说明请求卡在了哪个阶段；有权限的调用方可以用
+// X-Geecache-Bypass: skip 或 refresh 让这次读取直接回源，见 SkipCache 与 ForceRefresh
+
+// deadlineHeader carries the caller's time budget in milliseconds.
+const deadlineHeader = "X-Deadline-Ms"
+
+// consistencyHeader set to "read-your-writes" makes the request read the
+// key from its owner, see ReadYourWrites.
+const consistencyHeader = "X-Consistency"
+
+// apiResponse is the JSON body answered by the API.
+type apiResponse struct {
+	Group      string  `json:"group"`
+	Key        string  `json:"key"`
+	Value      []byte  `json:"value,omitempty"` // base64 in JSON
+	Source     string  `json:"source,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+	Stage      string  `json:"stage,omitempty"` // where a timed out request was
+}
+
+// APIOptions configures the handler returned by NewAPIHandlerOpts.
+type APIOptions struct {
+	// Auth authorizes every request as EndpointPublic, nil to allow
+	// everyone.
+	Auth Authorizer
+	// BypassAuth authorizes, as EndpointAdmin of the group, the requests
+	// carrying an X-Geecache-Bypass header: each one costs a load from the
+	// origin. Typically TokenAuth of the node's AdminToken. If nil, the
+	// header is refused.
+	BypassAuth Authorizer
+}
+
+type apiHandler struct {
+	prefix string
+	opts   APIOptions
+}
+
+// NewAPIHandler returns the public JSON API serving
+//
+//	GET <prefix><group>/<key>
+//
+// with {"group", "key", "value" (base64), "source", "duration_ms"}. A
+// request may carry an X-Deadline-Ms header bounding the whole fetch
+// chain; when it is exceeded the answer is 504 Gateway Timeout naming
+// the stage the request was in. With an X-Consistency: read-your-writes
+// header the value is read from the owner of the key, see ReadYourWrites.
+// auth may be nil to allow everyone.
+func NewAPIHandler(prefix string, auth Authorizer) http.Handler {
+	return NewAPIHandlerOpts(prefix, &APIOptions{Auth: auth})
+}
+
+// NewAPIHandlerOpts is NewAPIHandler with options. With an
+// X-Geecache-Bypass: skip or refresh header allowed by o.BypassAuth, the
+// value is read from the origin as with SkipCache or ForceRefresh. o may
+// be nil.
+func NewAPIHandlerOpts(prefix string, o *APIOptions) http.Handler {
+	h := &apiHandler{prefix: prefix}
+	if o != nil {
+		h.opts = *o
+	}
+	if h.opts.Auth == nil {
+		h.opts.Auth = AllowAll()
+	}
+	return h
+}
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResponse{Error: "method not allowed"})
+		return
+	}
+	name, key, ok := splitPeerPath(h.prefix, r.URL.Path)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, apiResponse{Error: "expected " + h.prefix + "<group>/<key>"})
+		return
+	}
+	if !checkAuth(w, r, h.opts.Auth, EndpointPublic, name) {
+		return
+	}
+	resp := apiResponse{Group: name, Key: key}
+	group := GetGroup(name)
+	if group == nil {
+		resp.Error = ErrGroupNotFound.Error()
+		writeJSON(w, http.StatusNotFound, resp)
+		return
+	}
+
+	ctx := r.Context()
+	if v := r.Header.Get(deadlineHeader); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms <= 0 {
+			resp.Error = "invalid " + deadlineHeader
+			writeJSON(w, http.StatusBadRequest, resp)
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+		defer cancel()
+	}
+
+	var readOpts []GetOption
+	switch c := r.Header.Get(consistencyHeader); c {
+	case "":
+	case "read-your-writes":
+		readOpts = append(readOpts, WithReadConsistency(ReadYourWrites))
+	default:
+		resp.Error = "invalid " + consistencyHeader + " " + strconv.Quote(c)
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	if v := r.Header.Get(bypassHeader); v != "" {
+		opt, ok := headerBypass(v)
+		if !ok {
+			resp.Error = "invalid " + bypassHeader + " " + strconv.Quote(v)
+			writeJSON(w, http.StatusBadRequest, resp)
+			return
+		}
+		if err := h.authorizeBypass(r, name); err != nil {
+			status, _ := errorStatus(err)
+			resp.Error = err.Error()
+			writeJSON(w, status, resp)
+			return
+		}
+		readOpts = append(readOpts, opt)
+	}
+
+	// 回源的 Getter 不感知 ctx，无法中途取消；在另一个 goroutine 中加载，
+	// 超时后不再等待，加载完成的值仍会进入缓存
+	stage := &loadStage{}
+	stage.set("cache")
+	type result struct {
+		view ByteView
+		info LoadInfo
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		opts := append([]GetOption{WithLoadInfo(&res.info)}, readOpts...)
+		res.view, res.err = group.GetContext(withLoadStage(ctx, stage), key, opts...)
+		done <- res
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	resp.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	if errors.Is(res.err, context.DeadlineExceeded) {
+		resp.Error, resp.Stage = "deadline exceeded", stage.get()
+		writeJSON(w, http.StatusGatewayTimeout, resp)
+		return
+	}
+	if res.err != nil {
+		status, _ := errorStatus(res.err)
+		resp.Error = res.err.Error()
+		writeJSON(w, status, resp)
+		return
+	}
+	resp.Value, resp.Source = res.view.ByteSlice(), res.info.Source.String()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// authorizeBypass checks that r may bypass the cache of group.
+func (h *apiHandler) authorizeBypass(r *http.Request, group string) error {
+	if h.opts.BypassAuth == nil {
+		return fmt.Errorf("%w: %s not allowed", ErrForbidden, bypassHeader)
+	}
+	return h.opts.BypassAuth.Authorize(&AuthRequest{Endpoint: EndpointAdmin, Group: group, Identity: identify(r), Request: r})
+}
+
+// loadStage records which stage of a Get is in progress, so that a
+// request giving up can tell where it was waiting.
+type loadStage struct {
+	v atomic.Value // string
+}
+
+func (s *loadStage) set(stage string) { s.v.Store(stage) }
+func (s *loadStage) get() string      { return s.v.Load().(string) }
+
+type loadStageKey struct{}
+
+func withLoadStage(ctx context.Context, s *loadStage) context.Context {
+	return context.WithValue(ctx, loadStageKey{}, s)
+}
+
+// setLoadStage records stage in the loadStage carried by ctx, if any.
+func setLoadStage(ctx context.Context, stage string) {
+	if s, ok := ctx.Value(loadStageKey{}).(*loadStage); ok {
+		s.set(stage)
+	}
+}
@@ -0,0 +1,58 @@
+package geecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func apiGet(t *testing.T, h http.Handler, path, deadline string) (int, apiResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if deadline != "" {
+		req.Header.Set(deadlineHeader, deadline)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var resp apiResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: response is not JSON: %q", path, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func TestAPIDeadline(t *testing.T) {
+	NewGroup("api", GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return []byte("v:" + key), nil
+	}), WithCacheBytes(2<<10))
+	h := NewAPIHandler("/api/", nil)
+
+	code, resp := apiGet(t, h, "/api/api/fast", "1000")
+	if code != http.StatusOK || string(resp.Value) != "v:fast" || resp.Source != "loader" {
+		t.Fatalf("fast: %d %+v", code, resp)
+	}
+	if code, resp = apiGet(t, h, "/api/api/fast", ""); code != http.StatusOK || resp.Source != "cache" {
+		t.Fatalf("cached: %d %+v", code, resp)
+	}
+
+	start := time.Now()
+	code, resp = apiGet(t, h, "/api/api/slow", "20")
+	if code != http.StatusGatewayTimeout || resp.Stage != "loader" {
+		t.Fatalf("slow: %d %+v", code, resp)
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Fatalf("deadline of 20ms answered after %v", d)
+	}
+
+	if code, _ = apiGet(t, h, "/api/api/fast", "soon"); code != http.StatusBadRequest {
+		t.Fatalf("invalid deadline: status = %d", code)
+	}
+	if code, _ = apiGet(t, h, "/api/nonexistent/k", ""); code != http.StatusNotFound {
+		t.Fatalf("unknown group: status = %d", code)
+	}
+}
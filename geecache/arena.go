@@ -0,0 +1,154 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// 堆外存储：不小于阈值的值拷贝进一整块 mmap 得到的内存，缓存中只保存偏移和长度。
+// 这块内存不归 Go 堆管理，GC 既不扫描它也不把它计入堆大小，超大缓存不再推高
+// GC 的频率和停顿。读取时把值拷贝回堆上，条目离开缓存时归还所占的空间
+
+// WithArena makes the group keep the values of at least minBytes it caches
+// in an off-heap region of arenaBytes, mapped with mmap where available,
+// instead of on the Go heap, so that a large cache doesn't weigh on the
+// garbage collector. Values are copied out of the region when read, and
+// those that don't fit in it are cached on the heap as usual. The region
+// counts against neither the cache budget nor the heap; size it for the
+// share of the budget large values take.
+func WithArena(minBytes int, arenaBytes int64) Option {
+	return func(g *Group) {
+		g.arenaAbove, g.arenaBytes = max(minBytes, 1), arenaBytes
+		g.cacheOpts.arena = arenaBytes > 0
+	}
+}
+
+// ArenaBytes returns the bytes of the group's arena taken by cached
+// values, 0 without WithArena.
+func (g *Group) ArenaBytes() int64 {
+	if g.arena == nil {
+		return 0
+	}
+	return g.arena.inUse()
+}
+
+// arenaAlign is the granularity of arena allocations, which keeps small
+// free spans from piling up.
+const arenaAlign = 64
+
+// arena hands out space in a region outside the Go heap.
+type arena struct {
+	mem []byte
+
+	mu   sync.Mutex
+	free []span // 按偏移排序的空闲区间，归还时与相邻区间合并
+	used int64
+}
+
+type span struct {
+	off, n int
+}
+
+// newArena maps a region of size bytes. It is unmapped once the arena,
+// which every value stored in it references, is garbage collected.
+func newArena(size int64) (*arena, error) {
+	mem, err := mapArena(int(size))
+	if err != nil {
+		return nil, err
+	}
+	a := &arena{mem: mem, free: []span{{0, len(mem)}}}
+	runtime.SetFinalizer(a, func(a *arena) { unmapArena(a.mem) })
+	return a, nil
+}
+
+func arenaSize(n int) int {
+	return (n + arenaAlign - 1) &^ (arenaAlign - 1)
+}
+
+// store copies value into the arena, reporting false if there is no room.
+func (a *arena) store(value ByteView) (arenaView, bool) {
+	n := arenaSize(value.Len())
+	a.mu.Lock()
+	// 首次适配：值都不小，空闲区间不会很多，线性查找足够
+	i := 0
+	for i < len(a.free) && a.free[i].n < n {
+		i++
+	}
+	if i == len(a.free) {
+		a.mu.Unlock()
+		return arenaView{}, false
+	}
+	off := a.free[i].off
+	if a.free[i].n == n {
+		a.free = slices.Delete(a.free, i, i+1)
+	} else {
+		a.free[i].off += n
+		a.free[i].n -= n
+	}
+	a.used += int64(n)
+	a.mu.Unlock()
+	// 这段空间已归本条目所有，拷贝不必持锁
+	copy(a.mem[off:], value.b)
+	return arenaView{a: a, off: off, n: value.Len(), version: value.version, flags: value.flags, sum: value.sum}, true
+}
+
+// release returns the space of a value leaving the cache.
+func (a *arena) release(off, size int) {
+	n := arenaSize(size)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.used -= int64(n)
+	i := sort.Search(len(a.free), func(i int) bool { return a.free[i].off > off })
+	before := i > 0 && a.free[i-1].off+a.free[i-1].n == off
+	after := i < len(a.free) && off+n == a.free[i].off
+	switch {
+	case before && after:
+		a.free[i-1].n += n + a.free[i].n
+		a.free = slices.Delete(a.free, i, i+1)
+	case before:
+		a.free[i-1].n += n
+	case after:
+		a.free[i].off, a.free[i].n = off, a.free[i].n+n
+	default:
+		a.free = slices.Insert(a.free, i, span{off, n})
+	}
+}
+
+// inUse returns the bytes of the arena taken by values.
+func (a *arena) inUse() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.used
+}
+
+// arenaView is a value stored in an arena. Its space belongs to the cache
+// entry holding it, and is released when the entry leaves the cache.
+type arenaView struct {
+	a       *arena
+	off, n  int
+	version uint64
+	flags   uint32
+	sum     uint32
+}
+
+// Len implements lru.Value.
+func (v arenaView) Len() int {
+	return v.n
+}
+
+// view copies the value out of the arena. It must be called with the lock
+// of the shard caching v held, so that v can't be released meanwhile.
+func (v arenaView) view() ByteView {
+	return ByteView{b: cloneBytes(v.a.mem[v.off : v.off+v.n]), version: v.version, flags: v.flags, sum: v.sum}
+}
+
+// releaseArena returns the arena space of v, if it has any, once it left
+// the cache or was never added.
+func releaseArena(v lru.Value) {
+	if v, ok := v.(arenaView); ok {
+		v.a.release(v.off, v.n)
+	}
+}
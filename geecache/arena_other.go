@@ -0,0 +1,12 @@
+//go:build !unix
+
+package geecache
+
+// mapArena falls back to a heap allocation where mmap isn't available. A
+// single pointer-free slice still spares the garbage collector from
+// scanning the values it holds.
+func mapArena(size int) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+func unmapArena(mem []byte) {}
@@ -0,0 +1,89 @@
+package geecache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	g := NewGroup("arena", GetterFunc(func(key string) ([]byte, error) {
+		if key == "small" {
+			return []byte("v"), nil
+		}
+		return []byte(strings.Repeat(key, 200/len(key))), nil
+	}), WithArena(100, 4096))
+	if g.arena == nil {
+		t.Fatal("arena not mapped")
+	}
+
+	v, err := g.Get("big")
+	if err != nil || v.String() != strings.Repeat("big", 66) {
+		t.Fatalf("get = %q, %v", v.String(), err)
+	}
+	if v, _ := g.Get("big"); v.String() != strings.Repeat("big", 66) {
+		t.Fatalf("cached value = %q", v.String())
+	}
+	g.Get("small")
+	if n := g.ArenaBytes(); n != int64(arenaSize(198)) {
+		t.Fatalf("arena bytes = %d, want %d", n, arenaSize(198))
+	}
+
+	// 替换和删除都归还原来的空间
+	if err := g.Set(context.Background(), "big", []byte(strings.Repeat("x", 300))); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("big"); v.Len() != 300 || g.ArenaBytes() != int64(arenaSize(300)) {
+		t.Fatalf("after set: %d bytes, arena %d", v.Len(), g.ArenaBytes())
+	}
+	g.Remove("big")
+	if n := g.ArenaBytes(); n != 0 {
+		t.Fatalf("arena bytes after remove = %d", n)
+	}
+
+	// arena 放不下的值留在堆上
+	for i := 0; i < 32; i++ {
+		key := "key" + strconv.Itoa(i)
+		if v, err := g.Get(key); err != nil || !strings.HasPrefix(v.String(), key) {
+			t.Fatalf("get %s = %q, %v", key, v.String(), err)
+		}
+	}
+	if n := g.ArenaBytes(); n != 4096 {
+		t.Fatalf("arena bytes = %d, want it full", n)
+	}
+	g.Clear()
+	if n := g.ArenaBytes(); n != 0 {
+		t.Fatalf("arena bytes after clear = %d", n)
+	}
+}
+
+func TestArenaCoalesce(t *testing.T) {
+	a, err := newArena(4 * arenaAlign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var views []arenaView
+	for i := 0; i < 4; i++ {
+		v, ok := a.store(ByteView{b: []byte{byte(i)}})
+		if !ok {
+			t.Fatalf("store %d failed", i)
+		}
+		views = append(views, v)
+	}
+	if _, ok := a.store(ByteView{b: []byte{4}}); ok {
+		t.Fatal("stored past the end of the arena")
+	}
+	for _, i := range []int{1, 3, 2} {
+		releaseArena(views[i])
+	}
+	if len(a.free) != 1 || a.free[0] != (span{arenaAlign, 3 * arenaAlign}) {
+		t.Fatalf("free spans %v", a.free)
+	}
+	if v, ok := a.store(ByteView{b: make([]byte, 3*arenaAlign)}); !ok || v.off != arenaAlign {
+		t.Fatalf("store into merged span: %+v, %v", v, ok)
+	}
+	if views[0].view().b[0] != 0 {
+		t.Fatal("value overwritten")
+	}
+}
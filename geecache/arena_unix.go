@@ -0,0 +1,14 @@
+//go:build unix
+
+package geecache
+
+import "syscall"
+
+// mapArena maps an anonymous private region of size bytes.
+func mapArena(size int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func unmapArena(mem []byte) {
+	syscall.Munmap(mem)
+}
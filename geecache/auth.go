@@ -0,0 +1,236 @@
+package geecache
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// 可插拔的鉴权：节点间访问、管理接口和对外 API 可以分别配置不同的策略
+
+// An Endpoint is a class of requests with its own authorization policy.
+type Endpoint int
+
+const (
+	EndpointPeer   Endpoint = iota // peers fetching values, /_geecache/<group>/<key>
+	EndpointAdmin                  // the admin API, /_geecache/admin/
+	EndpointPublic                 // the application's API, see Protect
+)
+
+func (e Endpoint) String() string {
+	switch e {
+	case EndpointPeer:
+		return "peer"
+	case EndpointAdmin:
+		return "admin"
+	case EndpointPublic:
+		return "public"
+	}
+	return "unknown"
+}
+
+// AuthRequest describes a request to be authorized.
+type AuthRequest struct {
+	Endpoint Endpoint
+	Group    string // "" for admin operations on the whole node
+	// Write is set for peer requests changing the cache of the group,
+	// such as a PUT, PATCH or DELETE, rather than reading it.
+	Write    bool
+	Identity Identity
+	Request  *http.Request
+}
+
+// An Authorizer decides whether a request may proceed. It returns nil to
+// allow it, an error wrapping ErrUnauthorized when the caller has to
+// present (other) credentials, or any other error, typically ErrForbidden,
+// to deny it.
+type Authorizer interface {
+	Authorize(req *AuthRequest) error
+}
+
+// AuthorizerFunc adapts a function to Authorizer.
+type AuthorizerFunc func(req *AuthRequest) error
+
+// Authorize implements Authorizer.
+func (f AuthorizerFunc) Authorize(req *AuthRequest) error {
+	return f(req)
+}
+
+// AllowAll is an Authorizer allowing every request.
+func AllowAll() Authorizer {
+	return AuthorizerFunc(func(*AuthRequest) error { return nil })
+}
+
+// TokenAuth returns an Authorizer allowing requests presenting one of
+// tokens as "Authorization: Bearer <token>".
+func TokenAuth(tokens ...string) Authorizer {
+	rule := ACLRule{Tokens: tokens}
+	return AuthorizerFunc(func(req *AuthRequest) error {
+		if rule.hasToken(req.Identity.Token) {
+			return nil
+		}
+		if req.Identity.Token == "" {
+			return ErrUnauthorized
+		}
+		return ErrForbidden
+	})
+}
+
+// CertAuth returns an Authorizer allowing requests whose verified client
+// certificate has one of the given subject common names. It requires the
+// pool to be served with mutual TLS.
+func CertAuth(commonNames ...string) Authorizer {
+	rule := ACLRule{CommonNames: commonNames}
+	return AuthorizerFunc(func(req *AuthRequest) error {
+		if rule.Allows(Identity{CommonName: req.Identity.CommonName}) {
+			return nil
+		}
+		if req.Identity.CommonName == "" {
+			return ErrUnauthorized
+		}
+		return ErrForbidden
+	})
+}
+
+// AnyOf returns an Authorizer allowing requests allowed by any of as. If
+// all deny, the first error not wrapping ErrUnauthorized is returned, so
+// that known but insufficient credentials are reported as such.
+func AnyOf(as ...Authorizer) Authorizer {
+	return AuthorizerFunc(func(req *AuthRequest) error {
+		err := ErrUnauthorized
+		for _, a := range as {
+			e := a.Authorize(req)
+			if e == nil {
+				return nil
+			}
+			if errors.Is(err, ErrUnauthorized) {
+				err = e
+			}
+		}
+		return err
+	})
+}
+
+// peerAuthorizer is the default policy of peer requests: peers presenting
+// AuthToken may read and write any group, everybody else is subject to
+// acl, whose Read rules allow reads only and Admin rules writes too.
+type peerAuthorizer struct {
+	token string
+	acl   ACL
+}
+
+func (a peerAuthorizer) Authorize(req *AuthRequest) error {
+	id := req.Identity
+	// 使用常量时间比较，避免通过响应耗时逐字节猜出 token
+	if a.token != "" && subtle.ConstantTimeCompare([]byte(id.Token), []byte(a.token)) == 1 {
+		return nil // 节点之间需要读取任意 group
+	}
+	if a.acl == nil {
+		if a.token == "" {
+			return nil
+		}
+		return ErrUnauthorized
+	}
+	allowed := a.acl.CanRead(req.Group, id)
+	if req.Write {
+		allowed = a.acl.CanAdmin(req.Group, id)
+	}
+	if allowed {
+		return nil
+	}
+	if a.token != "" && !a.acl.knowsToken(id.Token) {
+		return ErrUnauthorized
+	}
+	return ErrForbidden
+}
+
+// isPeer reports whether r comes from another node: it presents
+// AuthToken, or the pool has neither AuthToken nor ACL and so no way to
+// tell nodes from clients.
+func (p *HTTPPool) isPeer(r *http.Request) bool {
+	if p.opts.AuthToken == "" {
+		return p.opts.ACL == nil
+	}
+	token, _ := bearerToken(r)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.opts.AuthToken)) == 1
+}
+
+// adminAuthorizer is the default policy of the admin API: AdminToken
+// administers everything, acl's Admin rules their groups. Without either
+// nobody is allowed.
+type adminAuthorizer struct {
+	token string
+	acl   ACL
+}
+
+func (a adminAuthorizer) Authorize(req *AuthRequest) error {
+	id := req.Identity
+	if a.token != "" && subtle.ConstantTimeCompare([]byte(id.Token), []byte(a.token)) == 1 {
+		return nil
+	}
+	if a.acl != nil {
+		group := req.Group
+		if group == "" {
+			group = "*"
+		}
+		if a.acl.CanAdmin(group, id) {
+			return nil
+		}
+	}
+	if id.Token == "" && id.CommonName == "" {
+		return ErrUnauthorized
+	}
+	return ErrForbidden
+}
+
+// authorize runs the Authorizer configured for e and, if it denies r,
+// writes the error response and returns false.
+func (p *HTTPPool) authorize(w http.ResponseWriter, r *http.Request, e Endpoint, group string) bool {
+	a := p.opts.PeerAuth
+	if e == EndpointAdmin {
+		a = p.opts.AdminAuth
+	}
+	return checkAuth(w, r, a, e, group)
+}
+
+// Protect wraps h, typically the application's own API, so that requests
+// are authorized by a as endpoint e before reaching it.
+func Protect(a Authorizer, e Endpoint, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checkAuth(w, r, a, e, "") {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// peerWrite reports whether a peer request with the given method changes
+// the cache.
+func peerWrite(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func checkAuth(w http.ResponseWriter, r *http.Request, a Authorizer, e Endpoint, group string) bool {
+	req := &AuthRequest{Endpoint: e, Group: group, Identity: identify(r), Request: r}
+	if e == EndpointPeer {
+		req.Write = peerWrite(r.Method)
+	}
+	err := a.Authorize(req)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUnauthorized):
+		realm := "geecache"
+		if e != EndpointPeer {
+			realm += "-" + e.String()
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	default:
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package geecache
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// 全局内存预算：由 CacheManager 持有进程的缓存总预算，按权重分给各个 group，
+// group 创建、替换或移除时重新分配，而不是每个 group 各自声明 cacheBytes
+
+// A CacheManager owns the cache budget of the process and shares it
+// among the groups created WithCacheManager, in proportion to their
+// weights. The shares are recomputed whenever a group joins or leaves, so
+// the groups together never claim more than the total.
+type CacheManager struct {
+	mu     sync.Mutex
+	total  int64
+	groups map[*Group]int // 权重
+}
+
+// ErrNotManaged is returned by CacheManager.SetWeight for a group the
+// manager doesn't budget.
+var ErrNotManaged = errors.New("geecache: group not managed by this CacheManager")
+
+// NewCacheManager returns a manager sharing totalBytes among its groups.
+func NewCacheManager(totalBytes int64) *CacheManager {
+	return &CacheManager{total: totalBytes, groups: make(map[*Group]int)}
+}
+
+// WithCacheManager makes m set the group's cache budget, a share of its
+// total proportional to weight; WithCacheBytes only counts towards the
+// configuration hash. Weights below 1 count as 1. A
+// group replaced by one of the same name leaves the manager.
+func WithCacheManager(m *CacheManager, weight int) Option {
+	return func(g *Group) {
+		g.manager, g.weight = m, weight
+	}
+}
+
+// Add makes m budget g, created without WithCacheManager, with weight.
+// Adding a group again changes its weight. Unlike groups created
+// WithCacheManager, g stays in m after being replaced until it's removed.
+func (m *CacheManager) Add(g *Group, weight int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if weight < 1 {
+		weight = 1
+	}
+	m.groups[g] = weight
+	m.rebalance()
+}
+
+// Remove stops budgeting g, leaving it its current budget, and shares
+// the total among the remaining groups.
+func (m *CacheManager) Remove(g *Group) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.groups[g]; !ok {
+		return
+	}
+	delete(m.groups, g)
+	m.rebalance()
+}
+
+// SetWeight changes the weight of a group m budgets.
+func (m *CacheManager) SetWeight(g *Group, weight int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.groups[g]; !ok {
+		return ErrNotManaged
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	m.groups[g] = weight
+	m.rebalance()
+	return nil
+}
+
+// SetTotal changes the budget shared among the groups.
+func (m *CacheManager) SetTotal(totalBytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = totalBytes
+	m.rebalance()
+}
+
+// Total returns the budget shared among the groups.
+func (m *CacheManager) Total() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// Budgets returns the budget of each group by name.
+func (m *CacheManager) Budgets() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[string]int64, len(m.groups))
+	for g := range m.groups {
+		res[g.name] = g.CacheBytes()
+	}
+	return res
+}
+
+// rebalance must be called with m.mu held.
+func (m *CacheManager) rebalance() {
+	var sum int64
+	for _, w := range m.groups {
+		sum += int64(w)
+	}
+	type share struct {
+		g     *Group
+		n     int64
+		delta int64
+	}
+	shares := make([]share, 0, len(m.groups))
+	for g, w := range m.groups {
+		n := m.total / sum * int64(w) // 先除后乘，避免大预算溢出
+		n += m.total % sum * int64(w) / sum
+		if n < 1 {
+			n = 1
+		}
+		shares = append(shares, share{g, n, n - g.CacheBytes()})
+	}
+	// 先收缩再扩大，调整过程中各 group 的预算之和不超过总预算
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].delta < shares[j].delta
+	})
+	for _, s := range shares {
+		s.g.SetCacheBytes(s.n)
+	}
+}
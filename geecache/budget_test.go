@@ -0,0 +1,37 @@
+package geecache
+
+import "testing"
+
+func TestCacheManager(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	m := NewCacheManager(9000)
+	a := NewGroup("budget-a", getter, WithCacheBytes(1<<20), WithCacheManager(m, 2))
+	if got := a.CacheBytes(); got != 9000 {
+		t.Fatalf("only group budget = %d, want 9000", got)
+	}
+	b := NewGroup("budget-b", getter, WithCacheBytes(1<<20), WithCacheManager(m, 1))
+	if a.CacheBytes() != 6000 || b.CacheBytes() != 3000 {
+		t.Fatalf("budgets = %v, want 6000 and 3000", m.Budgets())
+	}
+
+	// 替换后旧 group 离开 manager，新 group 按自己的权重分配
+	b2 := NewGroup("budget-b", getter, WithCacheBytes(1<<20), WithCacheManager(m, 4))
+	if a.CacheBytes() != 3000 || b2.CacheBytes() != 6000 || len(m.Budgets()) != 2 {
+		t.Fatalf("budgets after replacing = %v", m.Budgets())
+	}
+
+	if err := m.SetWeight(a, 1); err != nil {
+		t.Fatal(err)
+	}
+	m.SetTotal(1000)
+	if a.CacheBytes() != 200 || b2.CacheBytes() != 800 {
+		t.Fatalf("budgets = %v, want 200 and 800", m.Budgets())
+	}
+	m.Remove(b2)
+	if a.CacheBytes() != 1000 || b2.CacheBytes() != 800 {
+		t.Fatalf("budgets after removing = %d and %d", a.CacheBytes(), b2.CacheBytes())
+	}
+	if err := m.SetWeight(b2, 1); err != ErrNotManaged {
+		t.Fatalf("SetWeight of a removed group = %v", err)
+	}
+}
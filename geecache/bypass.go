@@ -0,0 +1,104 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+)
+
+// 按请求绕过缓存：调试工具或需要立即看到源数据变化的调用者，可以让某一次读取直接回源。
+// 标志随 ctx 传到加载的各个环节，转发给归属节点时也一并带上
+
+// cacheBypass tells how a Get treats the cache.
+type cacheBypass uint8
+
+const (
+	bypassNone    cacheBypass = iota
+	bypassSkip                // 不读也不写缓存
+	bypassRefresh             // 不读缓存，加载的结果替换缓存中的值
+)
+
+// SkipCache makes the call load the key from its origin, on the node
+// owning it, without reading or filling any cache: debugging tools use it
+// to see what the origin holds now.
+func SkipCache(o *getOptions) {
+	o.bypass = bypassSkip
+}
+
+// ForceRefresh makes the call reload the key from its origin, on the node
+// owning it, replacing the cached value with the result.
+func ForceRefresh(o *getOptions) {
+	o.bypass = bypassRefresh
+}
+
+type bypassKey struct{}
+
+// withBypass returns ctx carrying b to the loads of the call.
+func withBypass(ctx context.Context, b cacheBypass) context.Context {
+	return context.WithValue(ctx, bypassKey{}, b)
+}
+
+// bypassOf returns the cacheBypass carried by ctx.
+func bypassOf(ctx context.Context) cacheBypass {
+	b, _ := ctx.Value(bypassKey{}).(cacheBypass)
+	return b
+}
+
+// flightKey returns the key under which loads of key are deduplicated:
+// a load filling the cache can't answer a call skipping it, nor can one
+// started before a refresh was asked for.
+func flightKey(key string, b cacheBypass) string {
+	switch b {
+	case bypassSkip:
+		return "\x00skip\x00" + key
+	case bypassRefresh:
+		return "\x00refresh\x00" + key
+	}
+	return key
+}
+
+// setBypass marks req with b for the owner.
+func setBypass(req *pb.Request, b cacheBypass) {
+	req.SkipCache = b == bypassSkip
+	req.ForceRefresh = b == bypassRefresh
+}
+
+// requestBypass returns the GetOption asked for by a request from a peer,
+// nil for none.
+func requestBypass(in *pb.Request) GetOption {
+	switch {
+	case in.SkipCache:
+		return SkipCache
+	case in.ForceRefresh:
+		return ForceRefresh
+	}
+	return nil
+}
+
+// headerBypass returns the GetOption asked for by an X-Geecache-Bypass
+// header value, nil for none, and false if v is not understood.
+//
+// The header is ours rather than Cache-Control: proxies and browsers send
+// no-cache on their own, e.g. on a reload, and each would cost a load.
+func headerBypass(v string) (GetOption, bool) {
+	switch v {
+	case "":
+		return nil, true
+	case "skip":
+		return SkipCache, true
+	case "refresh":
+		return ForceRefresh, true
+	}
+	return nil, false
+}
+
+// bypassValue returns the X-Geecache-Bypass header value asking for what
+// in does, "" for none.
+func bypassValue(in *pb.Request) string {
+	switch {
+	case in.GetSkipCache():
+		return "skip"
+	case in.GetForceRefresh():
+		return "refresh"
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheBypass(t *testing.T) {
+	var loads atomic.Int64
+	g := NewGroup("bypass", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key + strconv.FormatInt(loads.Add(1), 10)), nil
+	}))
+	get := func(opts ...GetOption) string {
+		t.Helper()
+		v, err := g.Get("k", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.String()
+	}
+	if v := get(); v != "k1" {
+		t.Fatalf("first get = %q", v)
+	}
+	if v := get(SkipCache); v != "k2" {
+		t.Fatalf("get skipping the cache = %q", v)
+	}
+	if v := get(); v != "k1" {
+		t.Fatalf("get after skipping the cache = %q, want the cached value", v)
+	}
+	if v := get(ForceRefresh); v != "k3" {
+		t.Fatalf("refreshing get = %q", v)
+	}
+	if v := get(); v != "k3" {
+		t.Fatalf("get after a refresh = %q, want the refreshed value", v)
+	}
+	if n := g.Stats.CacheBypasses.Get(); n != 2 {
+		t.Fatalf("%d bypasses counted", n)
+	}
+
+	// 对端通过 X-Geecache-Bypass 收到同样的标志，Cache-Control 不再起作用
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	fetch := func(in *pb.Request) string {
+		t.Helper()
+		out := &pb.Response{}
+		if err := peer.Get(context.Background(), in, out); err != nil {
+			t.Fatal(err)
+		}
+		return string(out.Value)
+	}
+	if v := fetch(&pb.Request{Group: "bypass", Key: "k", SkipCache: true}); v != "k4" {
+		t.Fatalf("peer get skipping the cache = %q", v)
+	}
+	if v := fetch(&pb.Request{Group: "bypass", Key: "k", ForceRefresh: true}); v != "k5" {
+		t.Fatalf("refreshing peer get = %q", v)
+	}
+	if v := get(); v != "k5" {
+		t.Fatalf("get after a peer refresh = %q", v)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"bypass/k", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if n := loads.Load(); n != 5 {
+		t.Fatalf("Cache-Control: no-cache made %d loads, want none", n-5)
+	}
+
+	// 对外 API 只允许有管理权限的调用方绕过缓存
+	api := NewAPIHandlerOpts("/api/", &APIOptions{BypassAuth: TokenAuth("adm")})
+	apiBypass := func(token string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/bypass/k", nil)
+		req.Header.Set(bypassHeader, "refresh")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := apiBypass(""); code != http.StatusUnauthorized {
+		t.Fatalf("bypass without a token: status = %d", code)
+	}
+	if code := apiBypass("other"); code != http.StatusForbidden {
+		t.Fatalf("bypass with a wrong token: status = %d", code)
+	}
+	if code := apiBypass("adm"); code != http.StatusOK || loads.Load() != 6 {
+		t.Fatalf("bypass with the admin token: status = %d, %d loads", code, loads.Load())
+	}
+	if code, _ := apiGet(t, NewAPIHandler("/api/", nil), "/api/bypass/k", ""); code != http.StatusOK {
+		t.Fatalf("plain get: status = %d", code)
+	}
+}
+
+func TestPeerBypassNeedsToken(t *testing.T) {
+	var loads atomic.Int64
+	NewGroup("bypass-acl", GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte(key), nil
+	}))
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{AuthToken: "peer", Middleware: []Middleware{},
+		ACL: ACL{"bypass-acl": {Read: ACLRule{Tokens: []string{"reader"}}}}}))
+	defer srv.Close()
+	get := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"bypass-acl/k", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(bypassHeader, "refresh")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// 只能读取的客户端不能让节点回源
+	if code := get("reader"); code != http.StatusForbidden || loads.Load() != 0 {
+		t.Fatalf("bypass of a reader: status = %d, %d loads", code, loads.Load())
+	}
+	if code := get("peer"); code != http.StatusOK || loads.Load() != 1 {
+		t.Fatalf("bypass of a peer: status = %d, %d loads", code, loads.Load())
+	}
+}
@@ -1,10 +1,56 @@
 package geecache
 
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
 // 缓存值的抽象与封装
 // A ByteView holds an immutable view of bytes.
 type ByteView struct {
 	// byte 类型是能够支持任意的数据类型的存储，例如字符串、图片等。
-	b []byte
+	b       []byte
+	version uint64
+	expire  int64  // 过期时间的 UnixNano，0 表示不过期
+	flags   uint32 // 随值保存的标志位，缓存本身不解释
+
+	buf *pooledBuffer // 值在池化缓冲区中时不为 nil，见 Release
+	sum uint32        // 存入缓存时计算的 CRC-32C，0 表示未计算
+}
+
+// Version identifies the value of the key the view was read from: it
+// increases every time the key is loaded or set on its owner. Pass it to
+// Group.CompareAndSet to update the key only if it hasn't changed since.
+// Views not read from a group, such as slices, have version 0.
+func (v ByteView) Version() uint64 {
+	return v.version
+}
+
+// Expires returns when the value read expires from the cache it was read
+// from, the zero time if it doesn't. Values loaded from a group without a
+// TTL, and slices, don't expire.
+func (v ByteView) Expires() time.Time {
+	if v.expire == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, v.expire)
+}
+
+// TTL returns how long the value has left before it expires, 0 if it
+// doesn't expire. A value that already expired has 1ns left, so that 0
+// keeps meaning never.
+func (v ByteView) TTL() time.Duration {
+	if v.expire == 0 {
+		return 0
+	}
+	return max(time.Until(time.Unix(0, v.expire)), time.Nanosecond)
+}
+
+// Flags returns the flags the value was set with, see WithFlags, 0 for
+// values loaded from the Getter.
+func (v ByteView) Flags() uint32 {
+	return v.flags
 }
 
 // Len returns the view's length
@@ -24,6 +70,56 @@ func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// Reader returns an io.ReadSeeker over the bytes of the view.
+func (v ByteView) Reader() io.ReadSeeker {
+	return bytes.NewReader(v.b)
+}
+
+// At returns the byte at index i.
+func (v ByteView) At(i int) byte {
+	return v.b[i]
+}
+
+// Slice slices the view between the provided from and to indices.
+// 与原视图共享底层数组，不发生拷贝
+func (v ByteView) Slice(from, to int) ByteView {
+	return ByteView{b: v.b[from:to]}
+}
+
+// SliceFrom slices the view from the provided index until the end.
+func (v ByteView) SliceFrom(from int) ByteView {
+	return ByteView{b: v.b[from:]}
+}
+
+// Copy copies b into dest and returns the number of bytes copied.
+func (v ByteView) Copy(dest []byte) int {
+	return copy(dest, v.b)
+}
+
+// Equal returns whether the bytes in v are the same as the bytes in b2.
+func (v ByteView) Equal(b2 ByteView) bool {
+	return bytes.Equal(v.b, b2.b)
+}
+
+// EqualString returns whether the bytes in v are the same as the bytes in s.
+func (v ByteView) EqualString(s string) bool {
+	return string(v.b) == s
+}
+
+// EqualBytes returns whether the bytes in v are the same as the bytes in b2.
+func (v ByteView) EqualBytes(b2 []byte) bool {
+	return bytes.Equal(v.b, b2)
+}
+
+// WriteTo implements io.WriterTo on the bytes in v.
+func (v ByteView) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(v.b)
+	if err == nil && n != len(v.b) {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -0,0 +1,34 @@
+package geecache
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestByteView(t *testing.T) {
+	v := ByteView{b: []byte("geecache")}
+	if v.At(3) != 'c' {
+		t.Fatalf("At(3) = %q", v.At(3))
+	}
+	if s := v.Slice(3, 8); !s.EqualString("cache") || !s.Equal(v.SliceFrom(3)) {
+		t.Fatalf("Slice(3, 8) = %q", s)
+	}
+	if !v.EqualBytes([]byte("geecache")) || v.Equal(v.Slice(0, 3)) {
+		t.Fatal("Equal compared wrongly")
+	}
+
+	r := v.Reader()
+	r.Seek(3, io.SeekStart)
+	if rest, _ := io.ReadAll(r); string(rest) != "cache" {
+		t.Fatalf("read after seek = %q", rest)
+	}
+	var buf bytes.Buffer
+	if n, err := v.WriteTo(&buf); n != 8 || err != nil || buf.String() != "geecache" {
+		t.Fatalf("WriteTo = %d, %v", n, err)
+	}
+	dest := make([]byte, 3)
+	if n := v.Copy(dest); n != 3 || string(dest) != "gee" {
+		t.Fatalf("Copy = %d, %q", n, dest)
+	}
+}
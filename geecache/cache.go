@@ -3,6 +3,7 @@ package geecache
 import (
 	"GeeCache/geecache/lru"
 	"sync"
+	"time"
 )
 
 // 并发控制
@@ -10,29 +11,307 @@ type cache struct {
 	mu         sync.Mutex
 	lru        *lru.Cache
 	cacheBytes int64
+	nhit, nget int64
+	nevict     int64 // number of evictions
+
+	// 锁竞争统计，供分片自动调整使用
+	nlock, ncontended int64
+	wait              time.Duration
+	retired           bool // 已被拆分，持锁后发现此标记需重新路由
+	internal          bool // 正在搬动已有条目，不通知 Hooks
+	sizeHint          int  // lru 创建前 grow 预留的条目数
+
+	cacheOptions
+}
+
+// cacheOptions are the settings every shard of a group shares.
+type cacheOptions struct {
+	autoCompact bool // 大量删除后自动重建 lru 内部结构以释放内存
+	overhead    int64
+	sizer       func(key string, valueLen int) int64 // 可为 nil
+	policy      EvictionPolicy
+	keepExpired bool // 过期条目留到被淘汰为止，过载时作为旧值返回
+	arena       bool // 值可能存放在 arena 中，离开缓存时须归还空间
+	// 因容量被淘汰的条目交给下一级缓存，可为 nil
+	spill func(key string, value ByteView, expire time.Time)
+	// 条目离开缓存时调用，须立即返回，可为 nil
+	onEvict func(key string, value lru.Value)
+	hooks   *Hooks // 可为 nil
+	// 按以该分隔符结尾的前缀索引 key，见 WithPrefixIndex
+	prefixIndex bool
+	prefixSep   byte
+}
+
+// size returns the bytes accounted for an entry, see lru.Cache.Sizer.
+func (o *cacheOptions) size(key string, value lru.Value) int64 {
+	if o.sizer != nil {
+		return o.sizer(key, value.Len())
+	}
+	return int64(len(key)+value.Len()) + o.overhead
+}
+
+// lock acquires c.mu, recording whether and how long it had to wait.
+// 无竞争时 TryLock 直接成功，不必付出读取时钟的开销
+func (c *cache) lock() {
+	if !c.mu.TryLock() {
+		start := time.Now()
+		c.mu.Lock()
+		c.ncontended++
+		c.wait += time.Since(start)
+	}
+	c.nlock++
 }
 
-func (c *cache) add(key string, value ByteView) {
+func (c *cache) stats() CacheStats {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	s := CacheStats{
+		Gets:      c.nget,
+		Hits:      c.nhit,
+		Evictions: c.nevict,
+	}
+	if c.lru != nil {
+		s.Bytes = c.lru.Bytes()
+		s.Items = int64(c.lru.Len())
+		_, _, s.OldestAccess, _ = c.lru.GetOldest()
+	}
+	return s
+}
+
+// add must be called with c.mu held.
+func (c *cache) add(key string, value lru.Value) {
+	c.addWith(key, value, lru.EntryOptions{})
+}
+
+// addWith must be called with c.mu held.
+func (c *cache) addWith(key string, value lru.Value, o lru.EntryOptions) {
+	// 超过整个分片预算的条目加入后会把其它条目连同自己全部淘汰，直接不缓存
+	if c.cacheBytes > 0 && c.size(key, value) > c.cacheBytes {
+		if c.lru != nil {
+			c.lru.Remove(key) // 不能留下旧值
+		}
+		releaseArena(value)
+		return
+	}
 	//如果等于 nil 再创建实例。这种方法称之为延迟初始化(Lazy Initialization)，
 	//一个对象的延迟初始化意味着该对象的创建将会延迟至第一次使用该对象时。
 	//主要用于提高性能，并减少程序内存要求。
 	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil, 1)
+		onEvicted := func(key string, v lru.Value) {
+			c.nevict++
+			av, inArena := v.(arenaView)
+			if c.onEvict != nil {
+				if inArena {
+					v = av.view() // 回调在归还空间之后才执行
+				}
+				c.onEvict(key, v)
+			}
+			if inArena {
+				releaseArena(av)
+			}
+		}
+		switch c.policy {
+		case EvictSLRU:
+			c.lru = lru.NewSLRU(c.cacheBytes, 0, onEvicted)
+		case EvictClock:
+			c.lru = lru.NewClock(c.cacheBytes, onEvicted)
+		default:
+			c.lru = lru.New(c.cacheBytes, onEvicted, 1)
+		}
+		if c.spill != nil {
+			c.lru.OnCapacityEvicted = func(key string, v lru.Value, o lru.EntryOptions) {
+				if view, ok := viewOf(v); ok {
+					c.spill(key, view, o.Expire)
+				}
+			}
+		}
+		if c.hooks != nil {
+			c.setHooks(c.hooks)
+		}
+		if c.arena {
+			c.lru.OnReplaced = func(_ string, v lru.Value) { releaseArena(v) }
+		}
+		c.lru.Grow(c.sizeHint)
+		c.lru.EntryOverhead = c.overhead
+		c.lru.KeepExpired = c.keepExpired
+		if c.sizer != nil {
+			c.lru.Sizer = c.size
+		}
+		if c.prefixIndex {
+			c.lru.IndexPrefixes(c.prefixSep)
+		}
+	}
+	c.lru.AddWith(key, value, o)
+}
+
+// grow pre-sizes the shard for n more entries. It must be called with
+// c.mu held.
+func (c *cache) grow(n int) {
+	if c.lru == nil {
+		c.sizeHint += n
+		return
 	}
-	c.lru.Add(key, value)
+	c.lru.Grow(n)
 }
 
+// get must be called with c.mu held.
 func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.nget++
 	if c.lru == nil {
+		if c.hooks != nil && c.hooks.OnMiss != nil {
+			c.hooks.OnMiss(key)
+		}
 		return
 	}
 	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+		c.nhit++
+		switch v := v.(type) {
+		case ByteView:
+			return c.withExpiry(key, v), true
+		case compactedView:
+			// 被后台压缩过的冷数据，解压后放回缓存
+			view, err := v.view()
+			if err != nil {
+				return ByteView{}, false
+			}
+			c.internal = true
+			c.lru.Add(key, view)
+			c.internal = false
+			return c.withExpiry(key, view), true
+		case compressedView:
+			view, err := v.view()
+			if err != nil {
+				return ByteView{}, false
+			}
+			return c.withExpiry(key, view), true
+		case arenaView:
+			return c.withExpiry(key, v.view()), true
+		}
 	}
 
 	return
 }
+
+// withExpiry returns view with the expiry of key's entry, which Touch and
+// the "ttl" update may have changed since view was cached.
+func (c *cache) withExpiry(key string, view ByteView) ByteView {
+	view.expire = 0
+	if o, ok := c.lru.Options(key); ok && !o.Expire.IsZero() {
+		view.expire = o.Expire.UnixNano()
+	}
+	return view
+}
+
+// stale returns key's value even if it expired, see lru.Cache.KeepExpired.
+// It must be called with c.mu held.
+func (c *cache) stale(key string) (ByteView, bool) {
+	if c.lru == nil {
+		return ByteView{}, false
+	}
+	v, ok := c.lru.GetStale(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	return viewOf(v)
+}
+
+// viewOf returns the value a cache entry stands for.
+func viewOf(v lru.Value) (ByteView, bool) {
+	switch v := v.(type) {
+	case ByteView:
+		return v, true
+	case compactedView:
+		view, err := v.view()
+		return view, err == nil
+	case compressedView:
+		view, err := v.view()
+		return view, err == nil
+	case arenaView:
+		return v.view(), true
+	}
+	return ByteView{}, false
+}
+
+// remove drops key and reports whether it was cached. It must be called
+// with c.mu held.
+func (c *cache) remove(key string) bool {
+	if c.lru == nil {
+		return false
+	}
+	removed := c.lru.Remove(key)
+	c.maybeCompact()
+	return removed
+}
+
+// removePrefix drops the entries whose key starts with prefix and returns
+// how many there were.
+func (c *cache) removePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0
+	}
+	n := len(c.lru.RemovePrefix(prefix))
+	c.maybeCompact()
+	return n
+}
+
+// prefixStats counts the entries whose key starts with prefix.
+func (c *cache) prefixStats(prefix string) (n int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0, 0
+	}
+	return c.lru.PrefixStats(prefix)
+}
+
+// clear drops every entry, counting them as evictions.
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Purge()
+	}
+}
+
+// shrink evicts least recently used entries until at most maxBytes are used.
+func (c *cache) shrink(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	for c.lru.Len() > 0 && c.lru.Bytes() > maxBytes {
+		c.lru.RemoveCacheOldest()
+	}
+	c.maybeCompact()
+}
+
+// resize changes the shard's budget, evicting entries over it.
+func (c *cache) resize(cacheBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheBytes = cacheBytes
+	if c.lru == nil {
+		return
+	}
+	c.lru.Resize(cacheBytes)
+	c.maybeCompact()
+}
+
+// compact releases the memory retained by the lru after mass evictions.
+func (c *cache) compact() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Compact()
+	}
+}
+
+// maybeCompact must be called with c.mu held.
+func (c *cache) maybeCompact() {
+	if c.autoCompact && c.lru.Sparse() {
+		c.lru.Compact()
+	}
+}
@@ -0,0 +1,60 @@
+package geecache
+
+import "context"
+
+// 分级缓存：group 的数据源可以是另一个 group，例如每个进程内的小 L1 以集群共享的大 L2 为源。
+// 读取与写入逐级向下传递，下一级中 key 的失效逐级向上传递
+
+// WithOrigin makes next the origin of the group, e.g. a small L1 of the
+// process in front of a large L2 spread over the cluster: loads read the
+// key from next with the context of the call, and Set, Update and Delete
+// write through to next, as with a Store, which WithOrigin replaces. The
+// group's Getter is only called for keys next reports missing with
+// ErrNotFound, and the values it returns are set in next.
+//
+// Keys removed from or written to next on this node, and next's flushes,
+// are dropped from the group too, like from a derived group. Writes
+// reaching next on other nodes only show once the group's copy expires,
+// so give it a short TTL.
+func WithOrigin(next *Group) Option {
+	return func(g *Group) {
+		g.source.Store(next)
+		g.store = groupStore{g}
+	}
+}
+
+// groupStore is the Store of a group chained to another by WithOrigin. It
+// goes to the group's current source, which follows replacements of next.
+type groupStore struct {
+	g *Group
+}
+
+func (s groupStore) next() *Group {
+	return s.g.source.Load()
+}
+
+// Get reads key through the group, skipping or refreshing its cache when
+// the load it serves does.
+func (s groupStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var opts []GetOption
+	switch bypassOf(ctx) {
+	case bypassSkip:
+		opts = append(opts, SkipCache)
+	case bypassRefresh:
+		opts = append(opts, ForceRefresh)
+	}
+	v, err := s.next().GetContext(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer v.Release()
+	return v.ByteSlice(), nil
+}
+
+func (s groupStore) Set(ctx context.Context, key string, value []byte) error {
+	return s.next().Set(ctx, key, value)
+}
+
+func (s groupStore) Delete(ctx context.Context, key string) error {
+	return s.next().Delete(ctx, key)
+}
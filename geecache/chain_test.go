@@ -0,0 +1,67 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithOrigin(t *testing.T) {
+	var loads atomic.Int64
+	l2 := NewGroup("chain-l2", GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte("value of " + key), nil
+	}))
+	l1 := NewGroup("chain-l1", GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}), WithOrigin(l2))
+	ctx := context.Background()
+	get := func(g *Group) string {
+		t.Helper()
+		v, err := g.Get("k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.String()
+	}
+
+	for i := 0; i < 2; i++ {
+		if v := get(l1); v != "value of k" {
+			t.Fatalf("get = %q", v)
+		}
+	}
+	if n := loads.Load(); n != 1 || l1.Stats.LocalLoads.Get() != 1 {
+		t.Fatalf("%d origin loads and %d L1 loads, want 1 and 1", n, l1.Stats.LocalLoads.Get())
+	}
+
+	// 下一级的失效向上传递
+	l2.Remove("k")
+	get(l1)
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("%d origin loads after removing the key from L2, want 2", n)
+	}
+
+	// 写入与删除向下传递
+	if err := l1.Set(ctx, "k", []byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if v := get(l2); v != "written" {
+		t.Fatalf("L2 get after an L1 set = %q", v)
+	}
+	if v := get(l1); v != "written" {
+		t.Fatalf("L1 get after an L1 set = %q", v)
+	}
+	if err := l1.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if v := get(l1); v != "value of k" || loads.Load() != 3 {
+		t.Fatalf("get after a delete = %q with %d origin loads", v, loads.Load())
+	}
+
+	// 替换上一级后，下一级只登记替换后的 group
+	l1b := NewGroup("chain-l1", l1.getter, WithOrigin(l2))
+	if deps := l2.dependents.list(); len(deps) != 1 || deps[0] != l1b {
+		t.Fatalf("L2 dependents after replacing L1: %v", deps)
+	}
+}
@@ -0,0 +1,46 @@
+package geecache
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// 端到端校验：值存入缓存时计算 CRC-32C，随响应发给对端，对端收到后重新计算比对。
+// 内存中发生位翻转或者传输中被截断的值报告为 ErrCorrupted，而不是当作正常的值返回
+
+// checksumProtocol is the protocol version from which responses carry the
+// checksum of their value.
+const checksumProtocol = 3
+
+// checksumHeader carries the checksum of streamed values.
+const checksumHeader = "X-Geecache-Checksum"
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func checksum(b []byte) uint32 {
+	return crc32.Checksum(b, castagnoli)
+}
+
+// withChecksum returns v with the checksum of its bytes, computed when it
+// is cached so that later corruption in memory is caught too.
+func (v ByteView) withChecksum() ByteView {
+	v.sum = checksum(v.b)
+	return v
+}
+
+// checksum returns the CRC-32C of v, the one computed when v was cached if
+// there is one. 恰好为 0 的校验和会被重新计算，结果不变
+func (v ByteView) checksum() uint32 {
+	if v.sum != 0 {
+		return v.sum
+	}
+	return checksum(v.b)
+}
+
+// verifyChecksum fails with ErrCorrupted unless b has checksum sum.
+func verifyChecksum(b []byte, sum uint32) error {
+	if got := checksum(b); got != sum {
+		return fmt.Errorf("%w: checksum %08x of %d bytes, expected %08x", ErrCorrupted, got, len(b), sum)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	pb "GeeCache/geecache/geecachepb"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// 超大值分块：超过阈值的值切成若干块，每块以独立的 key 存放在各自的归属节点上，
+// 原 key 下只缓存一份记录分块信息的清单。Get 读到清单时逐块取回并重组，单个节点的
+// 缓存预算和单次响应的大小都不再受整个值的大小限制
+
+// WithChunking makes the group split the values above chunkBytes, loaded
+// from its Getter or given to Set, into chunks of chunkBytes cached on
+// the nodes owning their own keys, and cache a small manifest under the
+// value's key instead. Get reassembles the value transparently; when a
+// chunk was evicted meanwhile, the value is loaded again. chunkBytes
+// should leave room for the key under WithMaxEntryBytes, which chunked
+// values are otherwise exempt from. Values whose bytes start like a
+// manifest can't be cached, and groups with WithLeases, which refuse the
+// chunks, don't chunk.
+func WithChunking(chunkBytes int64) Option {
+	return func(g *Group) {
+		g.chunkBytes = chunkBytes
+	}
+}
+
+// chunkMagic starts every manifest. 以 NUL 开头，文本值不会与之混淆
+const chunkMagic = "\x00geecache-chunks\x01"
+
+// chunkMarker separates the key of a chunked value from the id and index
+// of its chunks in their keys.
+const chunkMarker = "\x00chunk/"
+
+// chunkManifest describes how a value was chunked.
+type chunkManifest struct {
+	id        uint64 // 每次分块随机生成，新旧值的分块互不覆盖
+	size      int64
+	chunkSize int64
+	sum       uint64 // 整个值的 XXHash64，重组后校验
+}
+
+func (m chunkManifest) chunks() int {
+	return int((m.size + m.chunkSize - 1) / m.chunkSize)
+}
+
+func (m chunkManifest) encode() []byte {
+	b := append([]byte(chunkMagic), make([]byte, 16)...)
+	binary.LittleEndian.PutUint64(b[len(chunkMagic):], m.id)
+	binary.LittleEndian.PutUint64(b[len(chunkMagic)+8:], m.sum)
+	b = binary.AppendUvarint(b, uint64(m.size))
+	return binary.AppendUvarint(b, uint64(m.chunkSize))
+}
+
+func decodeManifest(b []byte) (chunkManifest, error) {
+	var m chunkManifest
+	b = b[len(chunkMagic):]
+	if len(b) < 16 {
+		return m, errors.New("geecache: truncated chunk manifest")
+	}
+	m.id, m.sum = binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint64(b[8:])
+	b = b[16:]
+	size, n := binary.Uvarint(b)
+	chunkSize, k := binary.Uvarint(b[max(n, 0):])
+	if n <= 0 || k <= 0 || chunkSize == 0 {
+		return m, errors.New("geecache: corrupt chunk manifest")
+	}
+	m.size, m.chunkSize = int64(size), int64(chunkSize)
+	return m, nil
+}
+
+// isManifest reports whether v is the manifest of a chunked value.
+func isManifest(v ByteView) bool {
+	return bytes.HasPrefix(v.b, []byte(chunkMagic))
+}
+
+// chunkKey returns the key of chunk i of the value of key chunked as id.
+func chunkKey(key string, id uint64, i int) string {
+	return key + chunkMarker + strconv.FormatUint(id, 16) + "/" + strconv.Itoa(i)
+}
+
+func isChunkKey(key string) bool {
+	return strings.Contains(key, chunkMarker)
+}
+
+// shouldChunk reports whether a value of n bytes is to be chunked.
+func (g *Group) shouldChunk(n int) bool {
+	return g.chunkBytes > 0 && int64(n) > g.chunkBytes && g.leases == nil
+}
+
+// storeChunks caches the chunks of value on their owners and returns the
+// manifest to cache under key.
+func (g *Group) storeChunks(ctx context.Context, key string, value ByteView) (ByteView, error) {
+	m := chunkManifest{id: rand.Uint64(), size: int64(value.Len()), chunkSize: g.chunkBytes, sum: consistenthash.XXHash64(value.b)}
+	for i := 0; i < m.chunks(); i++ {
+		lo := int64(i) * m.chunkSize
+		// 拷贝一份，缓存的分块不能让整个值一直留在内存中
+		part := ByteView{b: cloneBytes(value.b[lo:min(lo+m.chunkSize, m.size)])}
+		if err := g.setChunk(ctx, chunkKey(key, m.id, i), part); err != nil {
+			return ByteView{}, fmt.Errorf("storing chunk %d of %q: %w", i, key, err)
+		}
+	}
+	return ByteView{b: m.encode(), version: value.version, flags: value.flags}, nil
+}
+
+// setChunk caches a chunk on the node owning its own key, bypassing the
+// group's AffinityResolver so that chunks spread over the ring.
+func (g *Group) setChunk(ctx context.Context, key string, part ByteView) error {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			return g.setOnPeer(ctx, peer, &pb.SetRequest{Group: g.name, Key: key, Value: part.b})
+		}
+	}
+	g.setLocally(key, part)
+	return nil
+}
+
+// wholeProtocol is the protocol version from which peers honor
+// pb.Request.Whole: older ones answer with the manifest of a chunked
+// value.
+const wholeProtocol = 4
+
+// checkWhole fails with ErrProtocolMismatch if peer, speaking version v,
+// answered a request for a whole value, in, with a manifest.
+func checkWhole(peer string, v int, in *pb.Request, out *pb.Response) error {
+	if !in.GetWhole() || v >= wholeProtocol || !isManifest(ByteView{b: out.Value}) {
+		return nil
+	}
+	return checkPeerProtocol(peer, v, wholeProtocol)
+}
+
+// readManifest makes the call return the manifest of a chunked value as
+// is, for peers and for reading the chunks themselves.
+func readManifest(o *getOptions) {
+	o.manifest = true
+}
+
+// assemble returns the value manifest m stands for. If a chunk is gone
+// the manifest is dropped and the value loaded, and chunked, once more.
+func (g *Group) assemble(ctx context.Context, key, routeKey string, m ByteView, opts []GetOption) (ByteView, error) {
+	for retried := false; ; retried = true {
+		value, err := g.readChunks(ctx, key, m)
+		m.Release()
+		if err == nil || !errors.Is(err, ErrNotFound) || retried {
+			return value, err
+		}
+		g.Stats.ChunksReloaded.Add(1)
+		g.dropManifest(ctx, key, routeKey)
+		if m, err = g.GetContext(ctx, key, append(opts[:len(opts):len(opts)], readManifest)...); err != nil || !isManifest(m) {
+			return m, err
+		}
+	}
+}
+
+func (g *Group) readChunks(ctx context.Context, key string, m ByteView) (ByteView, error) {
+	man, err := decodeManifest(m.b)
+	if err != nil {
+		return ByteView{}, err
+	}
+	b := make([]byte, 0, man.size)
+	for i := 0; i < man.chunks(); i++ {
+		ck := chunkKey(key, man.id, i)
+		part, err := g.GetContext(ctx, ck, WithAffinity(ck), readManifest)
+		if err != nil {
+			return ByteView{}, fmt.Errorf("chunk %d of %q: %w", i, key, err)
+		}
+		b = append(b, part.b...)
+		part.Release()
+	}
+	if int64(len(b)) != man.size || consistenthash.XXHash64(b) != man.sum {
+		// 分块属于被替换前的值等情况，与缺块一样重新加载
+		return ByteView{}, fmt.Errorf("%w: chunks of %q don't match their manifest", ErrNotFound, key)
+	}
+	return ByteView{b: b, version: m.version, expire: m.expire, flags: m.flags}, nil
+}
+
+// dropManifest removes the manifest of key from this node and its owner.
+func (g *Group) dropManifest(ctx context.Context, key, routeKey string) {
+	g.Remove(key)
+	if g.peers == nil {
+		return
+	}
+	peer, ok := g.peers.PickPeer(routeKey)
+	if !ok {
+		return
+	}
+	if setter, ok := peer.(PeerSetter); ok {
+		if err := setter.Delete(ctx, &pb.Request{Group: g.name, Key: key}); err != nil {
+			g.logger.Warn("[GeeCache] dropping chunk manifest failed", "group", g.name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/lru"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// oddChunksPicker sends the odd-numbered chunks to peer and owns every
+// other key.
+type oddChunksPicker struct {
+	peer PeerGetter
+}
+
+func (p oddChunksPicker) PickPeer(key string) (PeerGetter, bool) {
+	if isChunkKey(key) && (key[len(key)-1]-'0')%2 == 1 {
+		return p.peer, true
+	}
+	return nil, false
+}
+
+func TestChunking(t *testing.T) {
+	value := func(key string) []byte {
+		return []byte(strings.Repeat(key+"-", 1000/(len(key)+1)))
+	}
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return value(key), nil
+	})
+	remote := NewGroup("chunked", getter, WithChunking(128), WithMaxEntryBytes(200))
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+
+	// 同一进程中的 group 是共享的，用另一个 group 冒充本节点上的同名 group
+	g := NewGroup("chunked-local", getter, WithChunking(128), WithMaxEntryBytes(200))
+	g.name = "chunked"
+	// 按环分布时可能所有分块恰好都落在同一节点，这里固定把奇数号分块交给对端
+	g.RegisterPeers(oddChunksPicker{&httpGetter{baseURL: srv.URL + defaultBasePath}})
+	key := "big"
+
+	chunks := func() (local, onRemote []string) {
+		collect := func(c *shardedCache, keys *[]string) {
+			c.iterate(func(k string, v lru.Value, _ lru.EntryOptions) bool {
+				if isChunkKey(k) {
+					*keys = append(*keys, k)
+				}
+				return true
+			})
+		}
+		collect(g.mainCache, &local)
+		collect(remote.mainCache, &onRemote)
+		return
+	}
+	if v, err := g.Get(key); err != nil || v.String() != string(value(key)) {
+		t.Fatalf("get = %d bytes, %v", v.Len(), err)
+	}
+	local, onRemote := chunks()
+	if n := len(value(key)); len(local)+len(onRemote) != (n+127)/128 || len(local) == 0 || len(onRemote) == 0 {
+		t.Fatalf("chunks of %d bytes: %d here, %d on the peer", n, len(local), len(onRemote))
+	}
+	if v, err := g.Get(key); err != nil || v.String() != string(value(key)) {
+		t.Fatalf("cached get = %d bytes, %v", v.Len(), err)
+	}
+
+	// 分块被淘汰后重新加载整个值
+	remote.Remove(onRemote[0])
+	if v, err := g.Get(key); err != nil || v.String() != string(value(key)) {
+		t.Fatalf("get after losing a chunk = %d bytes, %v", v.Len(), err)
+	}
+	if n := g.Stats.ChunksReloaded.Get(); n != 1 {
+		t.Fatalf("%d reloads", n)
+	}
+
+	// Set 同样分块，flags 随清单保存
+	big := []byte(strings.Repeat("s", 500))
+	if err := g.Set(context.Background(), key, big, WithFlags(7)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get(key); err != nil || v.String() != string(big) || v.Flags() != 7 {
+		t.Fatalf("get after set = %d bytes, flags %d, %v", v.Len(), v.Flags(), err)
+	}
+}
+
+func TestWholeFromOldPeer(t *testing.T) {
+	manifest := []byte(chunkMagic + "rest of the manifest")
+	var version string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.Response{Value: manifest, Checksum: checksum(manifest)})
+		w.Header().Set(protocolHeader, version)
+		w.Write(body)
+	}))
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	get := func(whole bool) error {
+		return peer.Get(context.Background(), &pb.Request{Group: "g", Key: "k", Whole: whole}, &pb.Response{})
+	}
+
+	// 旧版本的节点不认识 whole，返回的清单不能当作值
+	version = "3"
+	if err := get(true); !errors.Is(err, ErrProtocolMismatch) {
+		t.Fatalf("whole value from an old peer: %v", err)
+	}
+	if err := get(false); err != nil {
+		t.Fatalf("manifest from an old peer: %v", err)
+	}
+	version = strconv.Itoa(wholeProtocol)
+	if err := get(true); err != nil {
+		t.Fatalf("value starting like a manifest: %v", err)
+	}
+}
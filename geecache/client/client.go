@@ -0,0 +1,168 @@
+// Package client reads and writes the groups of a geecache cluster from
+// processes that aren't part of it, such as stateless front ends: it
+// routes each key to the node owning it, like a node would, without
+// serving peers, joining the ring or creating any Group.
+//
+// Requests use the peer protocol of HTTPPool. Set and Delete change the
+// cache of the owner only, as between nodes; stores behind the groups are
+// left alone.
+package client
+
+import (
+	"GeeCache/geecache"
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoPeers reports a request made before the client was given any node.
+var ErrNoPeers = errors.New("geecache client: no peers")
+
+// Client sends requests for keys to the nodes owning them.
+type Client struct {
+	pool *geecache.HTTPPool
+}
+
+// New returns a client of the cluster made of peers, the URLs of every
+// node as configured on the nodes. o configures the requests like the
+// HTTPPoolOptions of the nodes: AuthToken, TLS, Transport, Hash, NewRing,
+// MinProtocolVersion and the like must match the cluster. It may be nil.
+func New(o *geecache.HTTPPoolOptions, peers ...string) *Client {
+	// self 为空：本进程不在环上，每个 key 都交给归属节点处理
+	c := &Client{pool: geecache.NewHTTPPoolOpts("", o)}
+	c.pool.Set(peers...)
+	return c
+}
+
+// SetPeers replaces the nodes of the cluster, e.g. from service discovery.
+func (c *Client) SetPeers(peers ...string) {
+	c.pool.Set(peers...)
+}
+
+// Value is a value read from the cluster.
+type Value struct {
+	Bytes   []byte
+	Version uint64    // see geecache.ByteView.Version
+	Flags   uint32    // see geecache.WithFlags
+	Expires time.Time // zero if the value doesn't expire
+}
+
+// A GetOption customizes a single Get.
+type GetOption func(*pb.Request)
+
+// SkipCache makes the owner load the key from its origin without reading
+// or filling its cache, see geecache.SkipCache.
+func SkipCache(in *pb.Request) {
+	in.SkipCache = true
+}
+
+// ForceRefresh makes the owner reload the key from its origin into its
+// cache, see geecache.ForceRefresh.
+func ForceRefresh(in *pb.Request) {
+	in.ForceRefresh = true
+}
+
+// WithAffinity routes the key by routeKey, see geecache.WithAffinity.
+// Groups created with an affinity function route keys the client doesn't
+// know of: the first node asked forwards the request to the owner.
+func WithAffinity(routeKey string) GetOption {
+	return func(in *pb.Request) {
+		in.Affinity = routeKey
+	}
+}
+
+// Get returns the value of key in group, loaded by its owner if the owner
+// doesn't have it. Errors wrap the geecache sentinel errors, e.g.
+// ErrNotFound for missing keys and ErrPeerUnavailable when the owner
+// can't be reached. The value is checked against the checksum sent by the
+// owner, as between nodes, and fails with ErrCorrupted if they differ.
+// Owners before protocol version 4 answer chunked values with their
+// manifest, which fails with ErrProtocolMismatch.
+func (c *Client) Get(ctx context.Context, group, key string, opts ...GetOption) (Value, error) {
+	in := &pb.Request{Group: group, Key: key, Whole: true}
+	for _, opt := range opts {
+		opt(in)
+	}
+	routeKey := key
+	if in.Affinity != "" {
+		routeKey = in.Affinity
+	}
+	peer, err := c.pick(routeKey)
+	if err != nil {
+		return Value{}, err
+	}
+	out := &pb.Response{}
+	if err := peer.Get(ctx, in, out); err != nil {
+		return Value{}, err
+	}
+	v := Value{Bytes: out.Value, Version: out.Version, Flags: out.Flags}
+	if out.ExpiresMs > 0 {
+		v.Expires = time.UnixMilli(out.ExpiresMs)
+	}
+	return v, nil
+}
+
+// Set caches value as the value of key in group on the owner of key.
+func (c *Client) Set(ctx context.Context, group, key string, value []byte) error {
+	setter, err := c.setter(key)
+	if err != nil {
+		return err
+	}
+	return setter.Set(ctx, &pb.SetRequest{Group: group, Key: key, Value: value})
+}
+
+// Delete drops key from the cache of group on the owner of key.
+func (c *Client) Delete(ctx context.Context, group, key string) error {
+	setter, err := c.setter(key)
+	if err != nil {
+		return err
+	}
+	return setter.Delete(ctx, &pb.Request{Group: group, Key: key})
+}
+
+// InvalidatePrefix drops every key of group starting with prefix from
+// every node, see geecache.Group.InvalidatePrefix.
+func (c *Client) InvalidatePrefix(ctx context.Context, group, prefix string) error {
+	if prefix == "" {
+		return errors.New("prefix is required")
+	}
+	peers := c.pool.AllPeers()
+	if len(peers) == 0 {
+		return ErrNoPeers
+	}
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = peer.(geecache.PeerSetter).Delete(ctx, &pb.Request{Group: group, Key: prefix, Prefix: true})
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// pick returns the node owning routeKey.
+func (c *Client) pick(routeKey string) (geecache.PeerGetter, error) {
+	peer, ok := c.pool.PickPeer(routeKey)
+	if !ok {
+		return nil, ErrNoPeers
+	}
+	return peer, nil
+}
+
+func (c *Client) setter(key string) (geecache.PeerSetter, error) {
+	peer, err := c.pick(key)
+	if err != nil {
+		return nil, err
+	}
+	setter, ok := peer.(geecache.PeerSetter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", geecache.ErrReadOnlyPeer, peer)
+	}
+	return setter, nil
+}
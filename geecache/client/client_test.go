@@ -0,0 +1,80 @@
+package client
+
+import (
+	"GeeCache/geecache"
+	pb "GeeCache/geecache/geecachepb"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestClient(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789"), 100)
+	g := geecache.NewGroup("client", geecache.GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, fmt.Errorf("%w: %s", geecache.ErrNotFound, key)
+		case "big":
+			return big, nil
+		}
+		return []byte("value of " + key), nil
+	}), geecache.WithChunking(64))
+	srv := httptest.NewServer(geecache.NewHTTPPoolOpts("", &geecache.HTTPPoolOptions{AuthToken: "secret", Middleware: []geecache.Middleware{}}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	if _, err := New(nil).Get(ctx, "client", "k"); !errors.Is(err, ErrNoPeers) {
+		t.Fatalf("get without peers: %v", err)
+	}
+	c := New(&geecache.HTTPPoolOptions{AuthToken: "secret"}, srv.URL)
+	get := func(key string) string {
+		t.Helper()
+		v, err := c.Get(ctx, "client", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(v.Bytes)
+	}
+	if v := get("k"); v != "value of k" {
+		t.Fatalf("get = %q", v)
+	}
+	// 分块的值由节点重组后返回，而不是返回清单
+	if v := get("big"); v != string(big) {
+		t.Fatalf("get of a chunked value = %q", v)
+	}
+	if _, err := c.Get(ctx, "client", "missing"); !errors.Is(err, geecache.ErrNotFound) {
+		t.Fatalf("get of a missing key: %v", err)
+	}
+
+	if err := c.Set(ctx, "client", "k", []byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("k"); v.String() != "written" {
+		t.Fatalf("node has %q after a client set", v.String())
+	}
+	if err := c.Delete(ctx, "client", "k"); err != nil {
+		t.Fatal(err)
+	}
+	if v := get("k"); v != "value of k" {
+		t.Fatalf("get after a delete = %q", v)
+	}
+
+	// 与节点之间一样校验值的校验和
+	corrupt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("flipped"), Checksum: 1, ProtocolVersion: geecache.ProtocolVersion})
+		w.Header().Set("X-Geecache-Protocol", strconv.Itoa(geecache.ProtocolVersion))
+		w.Write(body)
+	}))
+	defer corrupt.Close()
+	c.SetPeers(corrupt.URL)
+	if _, err := c.Get(ctx, "client", "k"); !errors.Is(err, geecache.ErrCorrupted) {
+		t.Fatalf("get of a corrupted value: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+	"bytes"
+	"compress/flate"
+	"io"
+	"time"
+)
+
+// 冷数据压缩：后台定期把长时间未访问的缓存值压缩存放，下次 Get 时透明解压，
+// 用 CPU 换取长尾冷数据场景下的缓存容量
+
+const (
+	// minCompactSize is the smallest value worth compressing.
+	minCompactSize = 256
+	// compactBatchBytes bounds the bytes compressed per lock acquisition so
+	// that a pass doesn't stall concurrent Gets for long.
+	compactBatchBytes = 1 << 20
+)
+
+// compactedView is a ByteView visited by the idle compactor. It replaces
+// the ByteView in the lru until the next access.
+type compactedView struct {
+	b          []byte
+	compressed bool // false if compression didn't pay off and b is the raw value
+	version    uint64
+	flags      uint32
+	sum        uint32
+}
+
+// Len implements lru.Value.
+func (v compactedView) Len() int {
+	return len(v.b)
+}
+
+func (v compactedView) view() (ByteView, error) {
+	if !v.compressed {
+		return ByteView{b: v.b, version: v.version, flags: v.flags, sum: v.sum}, nil
+	}
+	b, err := io.ReadAll(flate.NewReader(bytes.NewReader(v.b)))
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: b, version: v.version, flags: v.flags, sum: v.sum}, nil
+}
+
+func compactView(v ByteView) compactedView {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(v.b)
+	w.Close()
+	// 压缩率不足 10% 的不值得解压的开销
+	if buf.Len() >= v.Len()*9/10 {
+		return compactedView{b: v.b, version: v.version, flags: v.flags, sum: v.sum}
+	}
+	return compactedView{b: buf.Bytes(), compressed: true, version: v.version, flags: v.flags, sum: v.sum}
+}
+
+// compactIdle compresses the values not accessed within idle and returns
+// how many were compressed.
+func (c *cache) compactIdle(idle time.Duration) (compressed int) {
+	for more := true; more; {
+		more = false
+		c.mu.Lock()
+		if c.lru == nil {
+			c.mu.Unlock()
+			return
+		}
+		budget := compactBatchBytes
+		c.lru.WalkIdle(idle, func(key string, v lru.Value) (lru.Value, bool) {
+			view, ok := v.(ByteView)
+			if !ok || view.Len() < minCompactSize {
+				return nil, true
+			}
+			if budget <= 0 {
+				more = true
+				return nil, false
+			}
+			budget -= view.Len()
+			cv := compactView(view)
+			if cv.compressed {
+				compressed++
+			}
+			return cv, true
+		})
+		c.mu.Unlock()
+	}
+	return
+}
+
+// WithIdleCompression makes the group compress cached values that have not
+// been accessed for idle, decompressing them transparently on the next Get.
+func WithIdleCompression(idle time.Duration) Option {
+	return func(g *Group) {
+		g.compactIdle = idle
+	}
+}
+
+func (g *Group) compactLoop() {
+	interval := g.compactIdle / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		if n := g.mainCache.compactIdle(g.compactIdle); n > 0 {
+			g.logger.Debug("compressed idle entries", "group", g.name, "count", n)
+		}
+	}
+}
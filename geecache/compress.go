@@ -0,0 +1,142 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 大值透明压缩：超过阈值的值压缩后存入缓存，节点之间传输时也协商压缩，
+// 读取时透明解压。大段 JSON 之类的值可以显著节省内存和带宽
+
+// WithCompression makes the group keep values of at least minBytes
+// compressed in its cache, and compress them in responses to peers that
+// accept it. Values that don't compress by at least 10% are kept as is.
+func WithCompression(minBytes int) Option {
+	return func(g *Group) {
+		g.compressAbove = minBytes
+	}
+}
+
+// compressedView is a value stored compressed for good. Unlike
+// compactedView it stays compressed when accessed.
+type compressedView struct {
+	b       []byte
+	version uint64
+	flags   uint32
+	sum     uint32
+}
+
+// Len implements lru.Value.
+func (v compressedView) Len() int {
+	return len(v.b)
+}
+
+func (v compressedView) view() (ByteView, error) {
+	b, err := io.ReadAll(flate.NewReader(bytes.NewReader(v.b)))
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: b, version: v.version, flags: v.flags, sum: v.sum}, nil
+}
+
+// storedForm returns what the group keeps in its cache for value.
+func (g *Group) storedForm(value ByteView) lru.Value {
+	value = value.withChecksum()
+	if g.compressAbove > 0 && value.Len() >= g.compressAbove {
+		if cv := compactView(value); cv.compressed {
+			return compressedView{b: cv.b, version: value.version, flags: value.flags, sum: value.sum}
+		}
+	}
+	// 拷贝进 arena 的值不再引用原来的字节，池化缓冲区也就不必先拷贝出来
+	if g.arena != nil && value.Len() >= g.arenaAbove {
+		if v, ok := g.arena.store(value); ok {
+			return v
+		}
+	}
+	return value.detached()
+}
+
+// responseEncodings are the content encodings offered to peers, most
+// preferred first: zstd compresses faster, gzip is understood by older
+// releases.
+var responseEncodings = []string{"zstd", "gzip"}
+
+// responseEncoding returns the encoding of responseEncodings the response
+// to r may be compressed with, "" if r accepts none of them.
+func responseEncoding(r *http.Request) string {
+	accepted := make(map[string]bool) // 编码 -> 是否接受，q=0 表示明确拒绝
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		q, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(params), "q="), 64)
+		accepted[strings.ToLower(strings.TrimSpace(enc))] = params == "" || err != nil || q > 0
+	}
+	for _, enc := range responseEncodings {
+		if ok, listed := accepted[enc]; ok || !listed && accepted["*"] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compressAbove returns the size from which the values of group are
+// compressed in responses to peers, 0 if they aren't.
+func (p *HTTPPool) compressAbove(group *Group) int {
+	n := group.compressAbove
+	if c := p.opts.CompressResponses; c > 0 && (n == 0 || c < n) {
+		n = c
+	}
+	return n
+}
+
+// writeEncoded writes what src holds to w compressed with enc, one of
+// responseEncodings.
+func writeEncoded(w http.ResponseWriter, enc string, src io.Reader) error {
+	w.Header().Set("Content-Encoding", enc)
+	var zw io.WriteCloser
+	if enc == "zstd" {
+		zw, _ = zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	} else {
+		zw, _ = gzip.NewWriterLevel(w, gzip.BestSpeed)
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// decodeBody makes res.Body read the decompressed body of a response
+// compressed with one of responseEncodings, returning the decoder to
+// close once done, nil if there is none.
+func decodeBody(res *http.Response) (io.Closer, error) {
+	switch enc := res.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+		return nil, nil
+	case "gzip":
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		res.Body, res.ContentLength = zr, -1
+		return zr, nil
+	case "zstd":
+		zr, err := zstd.NewReader(res.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		rc := zr.IOReadCloser()
+		res.Body, res.ContentLength = rc, -1
+		return rc, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", enc)
+	}
+}
@@ -0,0 +1,78 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// 读己之写：默认的读可能命中热点缓存、同区副本或本地加载的副本，刚写入的值未必可见；
+// 按 key 的归属节点为准读取时，Set 成功返回后的读一定能看到新值
+
+// A Consistency says how fresh the values Get returns must be.
+type Consistency int
+
+const (
+	// DefaultConsistency, for a single Get, is the group's consistency.
+	DefaultConsistency Consistency = iota
+	// Eventual reads may be answered from copies of the value: the hot
+	// cache, zone replicas, hedged requests or this node's cache when the
+	// owner fails. This is the group's default.
+	Eventual
+	// ReadYourWrites reads are answered by the owner of the key only,
+	// which sees every Set and update once it returns. Failures of the
+	// owner are returned instead of loading the key on this node.
+	ReadYourWrites
+)
+
+// WithConsistency sets the consistency of the group's reads, see
+// WithReadConsistency to change it for a single Get.
+func WithConsistency(c Consistency) Option {
+	return func(g *Group) {
+		g.consistency = c
+	}
+}
+
+// WithReadConsistency sets the consistency of the call instead of the
+// group's.
+func WithReadConsistency(c Consistency) GetOption {
+	return func(o *getOptions) {
+		o.consistency = c
+	}
+}
+
+// ownerReads reports whether the call must be answered by the owner.
+// 被要求本地加载的请求（对冲、同区副本）本身就来自归属节点以外的读
+func (g *Group) ownerReads(o *getOptions) bool {
+	c := o.consistency
+	if c == DefaultConsistency {
+		c = g.consistency
+	}
+	return c == ReadYourWrites && !o.local
+}
+
+// pickOwner returns the peer owning routeKey if the call must be answered
+// by it and it isn't this node.
+func (g *Group) pickOwner(routeKey string, o *getOptions) (PeerGetter, bool) {
+	if g.peers == nil || !g.ownerReads(o) {
+		return nil, false
+	}
+	return g.peers.PickPeer(routeKey)
+}
+
+// getFromOwner reads key from its owner, bypassing this node's caches.
+// 不经过 singleflight：与写入之前开始的加载合并会读到旧值
+func (g *Group) getFromOwner(ctx context.Context, peer PeerGetter, key, routeKey string, info *LoadInfo) (ByteView, error) {
+	g.Stats.Loads.Add(1)
+	start := time.Now()
+	value, err := g.getFromPeer(ctx, peer, key, routeKey, false)
+	info.Peer, info.Source = time.Since(start), SourcePeer
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			g.Stats.PeerErrors.Add(1)
+		}
+		return ByteView{}, err
+	}
+	g.Stats.PeerLoads.Add(1)
+	return value, nil
+}
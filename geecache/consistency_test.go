@@ -0,0 +1,51 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	pb "GeeCache/geecache/geecachepb"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	var ownerUp atomic.Bool
+	owner := peerFunc(func(_ context.Context, in *pb.Request, out *pb.Response) error {
+		if !ownerUp.Load() {
+			return errors.New("owner down")
+		}
+		out.Value = []byte("written")
+		return nil
+	})
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	})
+	g := NewGroup("read-your-writes", getter, WithCacheBytes(2<<10), WithHotCache(0.5))
+	g.RegisterPeers(ownedPicker{owner})
+
+	// 归属节点故障时本地加载的副本留在热点缓存中
+	if v, err := g.Get("k"); err != nil || v.String() != "origin" {
+		t.Fatalf("Get with the owner down = %q, %v", v.String(), err)
+	}
+	ownerUp.Store(true)
+	if v, _ := g.Get("k"); v.String() != "origin" {
+		t.Fatalf("eventual read = %q, want the hot copy", v.String())
+	}
+	if v, err := g.Get("k", WithReadConsistency(ReadYourWrites)); err != nil || v.String() != "written" {
+		t.Fatalf("read-your-writes read = %q, %v", v.String(), err)
+	}
+
+	strict := NewGroup("read-your-writes-group", getter, WithCacheBytes(2<<10), WithConsistency(ReadYourWrites))
+	strict.RegisterPeers(ownedPicker{owner})
+	ownerUp.Store(false)
+	if _, err := strict.Get("k"); err == nil {
+		t.Fatal("owner failure hidden by a local load")
+	}
+	if v, err := strict.Get("k", WithReadConsistency(Eventual)); err != nil || v.String() != "origin" {
+		t.Fatalf("eventual read of a strict group = %q, %v", v.String(), err)
+	}
+	if v, err := strict.Get("own:k"); err != nil || v.String() != "origin" {
+		t.Fatalf("read of an owned key = %q, %v", v.String(), err)
+	}
+}
@@ -1,33 +1,46 @@
 package consistenthash
 
 import (
-	"hash/crc32"
 	"sort"
 	"strconv"
 )
 
-// Hash maps bytes to uint32
-type Hash func(data []byte) uint32
+// Hash maps bytes to uint64. CRC32, XXHash64 and Murmur3 are presets.
+type Hash func(data []byte) uint64
+
+// Ring maps keys to the items added to it. Map, Jump and Rendezvous
+// implement it with different trade-offs.
+type Ring interface {
+	Add(keys ...string)
+	Get(key string) string
+	GetN(key string, n int) []string
+	Nodes() []string
+	Distribution(keysSample []string) map[string]int
+	Shares() map[string]float64
+}
+
+var _ Ring = (*Map)(nil)
 
 // Map constains all hashed keys
 type Map struct {
 	hash     Hash
-	replicas int            //虚拟节点倍数
-	keys     []int          //哈希环
-	hashMap  map[int]string //虚拟节点与真实节点的映射表
+	replicas int               //虚拟节点倍数
+	keys     []uint64          //哈希环，覆盖整个 64 位空间
+	hashMap  map[uint64]string //虚拟节点与真实节点的映射表
 }
 
 // New creates a Map instance
 // Hash函数是作为New函数的一个参数传入的。这里的fn Hash就是依赖注入的一种形式。
 // 具体来说，New函数接受一个Hash类型的函数作为参数，如果没有传入这个参数，则会使用默认的CRC-32校验和函数
+// 虚拟节点多时 CRC-32 分布不够均匀，可以传入 XXHash64 或 Murmur3
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		hashMap:  make(map[uint64]string),
 	}
 	if m.hash == nil {
-		m.hash = crc32.ChecksumIEEE //用于计算数据的 CRC-32 校验和
+		m.hash = CRC32 //用于计算数据的 CRC-32 校验和
 	}
 	return m
 }
@@ -36,12 +49,12 @@ func New(replicas int, fn Hash) *Map {
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
 		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			hash := m.hash([]byte(strconv.Itoa(i) + key))
 			m.keys = append(m.keys, hash)
 			m.hashMap[hash] = key
 		}
 	}
-	sort.Ints(m.keys)
+	sort.Slice(m.keys, func(i, j int) bool { return m.keys[i] < m.keys[j] })
 }
 
 // Get gets the closest item in the hash to the provided key.
@@ -50,7 +63,7 @@ func (m *Map) Get(key string) string {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key)))
+	hash := m.hash([]byte(key))
 	// Binary search for appropriate replica.
 	idx := sort.Search(len(m.keys), func(i int) bool {
 		return m.keys[i] >= hash
@@ -58,3 +71,77 @@ func (m *Map) Get(key string) string {
 
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// GetN returns up to n distinct items following the provided key on the
+// hash, the one Get returns first.
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	var res []string
+	seen := make(map[string]bool, n)
+	// 沿环顺时针走一圈，跳过属于已选真实节点的虚拟节点
+	for i := 0; i < len(m.keys) && len(res) < n; i++ {
+		item := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[item] {
+			seen[item] = true
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// Nodes returns the items added to the hash, sorted.
+func (m *Map) Nodes() []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, item := range m.hashMap {
+		if !seen[item] {
+			seen[item] = true
+			res = append(res, item)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Distribution returns how many of keysSample each item gets, items
+// getting none included.
+func (m *Map) Distribution(keysSample []string) map[string]int {
+	res := make(map[string]int)
+	for _, item := range m.Nodes() {
+		res[item] = 0
+	}
+	for _, key := range keysSample {
+		if item := m.Get(key); item != "" {
+			res[item]++
+		}
+	}
+	return res
+}
+
+// Shares returns the fraction of the hash space each item owns, which is
+// the fraction of keys it gets on average.
+func (m *Map) Shares() map[string]float64 {
+	res := make(map[string]float64)
+	if len(m.keys) == 0 {
+		return res
+	}
+	const space = float64(1 << 64)
+	// 每个虚拟节点负责它与前一个虚拟节点之间的区间，第一个还负责绕回的部分，
+	// 无符号减法自然回绕
+	prev := m.keys[len(m.keys)-1]
+	for i, k := range m.keys {
+		d := float64(k - prev)
+		if i == 0 && k == prev {
+			d = space // 环上只有一个位置
+		}
+		res[m.hashMap[k]] += d / space
+		prev = k
+	}
+	return res
+}
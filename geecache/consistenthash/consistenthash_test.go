@@ -2,13 +2,14 @@ package consistenthash
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 )
 
 func TestHashing(t *testing.T) {
-	hash := New(3, func(key []byte) uint32 {
+	hash := New(3, func(key []byte) uint64 {
 		i, _ := strconv.Atoi(string(key))
-		return uint32(i)
+		return uint64(i)
 	})
 
 	// Given the above hash function, this will give replicas with "hashes":
@@ -40,3 +41,51 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint64 {
+		i, _ := strconv.Atoi(string(key))
+		return uint64(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	for key, want := range map[string]string{"11": "2,4,6", "23": "4,6,2", "27": "2,4,6"} {
+		if got := strings.Join(hash.GetN(key, 5), ","); got != want {
+			t.Errorf("GetN(%s) = %s, want %s", key, got, want)
+		}
+	}
+	if got := hash.GetN("5", 2); len(got) != 2 || got[0] != hash.Get("5") {
+		t.Errorf("GetN(5, 2) = %v, want the owner %s first", got, hash.Get("5"))
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	hash := New(3, func(key []byte) uint64 {
+		i, _ := strconv.Atoi(string(key))
+		return uint64(i)
+	})
+	hash.Add("6", "4", "2")
+	hash.Add("8") // 8, 18, 28
+
+	if got := strings.Join(hash.Nodes(), ","); got != "2,4,6,8" {
+		t.Errorf("Nodes() = %s", got)
+	}
+	d := hash.Distribution([]string{"1", "2", "3", "7", "27", "100"})
+	if d["2"] != 3 || d["4"] != 1 || d["8"] != 2 || d["6"] != 0 || len(d) != 4 {
+		t.Errorf("Distribution() = %v", d)
+	}
+
+	real := New(50, nil)
+	real.Add("a", "b", "c")
+	var total float64
+	for node, share := range real.Shares() {
+		if share < 0.1 || share > 0.6 {
+			t.Errorf("share of %s = %v", node, share)
+		}
+		total += share
+	}
+	if total < 0.999999 || total > 1.000001 {
+		t.Errorf("shares add up to %v", total)
+	}
+}
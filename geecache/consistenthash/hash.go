@@ -0,0 +1,138 @@
+package consistenthash
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/bits"
+)
+
+// 预置的哈希函数：CRC-32 分布较差，虚拟节点容易扎堆，xxHash 与 MurmurHash3
+// 在整个 64 位空间上分布均匀，且都是纯 Go 实现，不引入依赖
+
+// CRC32 is the CRC-32 checksum of data in the high 32 bits, the default
+// Hash. It places keys and items in the same order as the 32-bit checksum.
+func CRC32(data []byte) uint64 {
+	return uint64(crc32.ChecksumIEEE(data)) << 32
+}
+
+// HashByName returns the preset Hash called name: "crc32", "xxhash" or
+// "murmur3".
+func HashByName(name string) (Hash, bool) {
+	switch name {
+	case "crc32":
+		return CRC32, true
+	case "xxhash":
+		return XXHash64, true
+	case "murmur3":
+		return Murmur3, true
+	}
+	return nil, false
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// XXHash64 is the 64-bit xxHash of data with seed 0.
+func XXHash64(data []byte) uint64 {
+	n := len(data)
+	var h uint64
+	if n >= 32 {
+		// 初始状态按规范是带回绕的 prime1+prime2 与 -prime1，常量表达式会溢出，
+		// 所以在变量上运算
+		p1 := xxPrime1
+		v1, v2, v3, v4 := p1+xxPrime2, xxPrime2, uint64(0), -p1
+		for len(data) >= 32 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(data))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(data[8:]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(data[16:]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(data[24:]))
+			data = data[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		for _, v := range [...]uint64{v1, v2, v3, v4} {
+			h ^= xxRound(0, v)
+			h = h*xxPrime1 + xxPrime4
+		}
+	} else {
+		h = xxPrime5
+	}
+	h += uint64(n)
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		data = data[4:]
+	}
+	for _, c := range data {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+const (
+	murmurC1 uint64 = 0x87c37b91114253d5
+	murmurC2 uint64 = 0x4cf5ad432745937f
+)
+
+// Murmur3 is the first half of the x64 128-bit MurmurHash3 of data with
+// seed 0.
+func Murmur3(data []byte) uint64 {
+	n := len(data)
+	var h1, h2 uint64
+	for ; len(data) >= 16; data = data[16:] {
+		k1 := binary.LittleEndian.Uint64(data)
+		k2 := binary.LittleEndian.Uint64(data[8:])
+		h1 ^= bits.RotateLeft64(k1*murmurC1, 31) * murmurC2
+		h1 = (bits.RotateLeft64(h1, 27)+h2)*5 + 0x52dce729
+		h2 ^= bits.RotateLeft64(k2*murmurC2, 33) * murmurC1
+		h2 = (bits.RotateLeft64(h2, 31)+h1)*5 + 0x38495ab5
+	}
+	// 剩余不足 16 字节的尾部
+	var k1, k2 uint64
+	for i := len(data) - 1; i >= 8; i-- {
+		k2 ^= uint64(data[i]) << (8 * (i - 8))
+	}
+	if len(data) > 8 {
+		h2 ^= bits.RotateLeft64(k2*murmurC2, 33) * murmurC1
+	}
+	for i := min(len(data), 8) - 1; i >= 0; i-- {
+		k1 ^= uint64(data[i]) << (8 * i)
+	}
+	if len(data) > 0 {
+		h1 ^= bits.RotateLeft64(k1*murmurC1, 31) * murmurC2
+	}
+	h1 ^= uint64(n)
+	h2 ^= uint64(n)
+	h1 += h2
+	h2 += h1
+	h1, h2 = murmurFmix(h1), murmurFmix(h2)
+	return h1 + h2
+}
+
+func murmurFmix(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
@@ -0,0 +1,43 @@
+package consistenthash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashPresets(t *testing.T) {
+	for _, tt := range []struct {
+		hash Hash
+		in   string
+		want uint64
+	}{
+		{XXHash64, "", 0xef46db3751d8e999},
+		{XXHash64, "abc", 0x44bc2cf5ad770999},
+		{XXHash64, "Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+		{Murmur3, "", 0},
+		{Murmur3, "hello", 0xcbd8a7b341bd9b02},
+		{Murmur3, "The quick brown fox jumps over the lazy dog", 0xe34bbc7bbc071b6c},
+		{CRC32, "abc", 0x352441c2 << 32},
+	} {
+		if got := tt.hash([]byte(tt.in)); got != tt.want {
+			t.Errorf("hash(%q) = %#x, want %#x", tt.in, got, tt.want)
+		}
+	}
+	if _, ok := HashByName("md5"); ok {
+		t.Error("HashByName accepted an unknown hash")
+	}
+
+	// 64 位哈希下虚拟节点分布更均匀
+	for _, name := range []string{"xxhash", "murmur3"} {
+		fn, _ := HashByName(name)
+		m := New(50, fn)
+		for i := 0; i < 5; i++ {
+			m.Add("node" + strconv.Itoa(i))
+		}
+		for node, share := range m.Shares() {
+			if share < 0.12 || share > 0.28 {
+				t.Errorf("%s: share of %s = %v", name, node, share)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package consistenthash
+
+import (
+	"math/bits"
+	"sort"
+)
+
+var _ Ring = (*Jump)(nil)
+
+// Jump is Lamping and Veach's jump consistent hash: lookups take no memory
+// besides the list of items and O(1) expected time, and every item gets
+// the same share of the keys. Items are buckets numbered in the order they
+// were added, so every node must add them in the same order, and only
+// removing the last one moves no more keys than necessary.
+type Jump struct {
+	hash  Hash
+	items []string
+}
+
+// NewJump creates a Jump hashing keys with fn, CRC-32 if nil.
+func NewJump(fn Hash) *Jump {
+	j := &Jump{hash: fn}
+	if j.hash == nil {
+		j.hash = CRC32
+	}
+	return j
+}
+
+// Add appends items to the buckets.
+func (j *Jump) Add(keys ...string) {
+	j.items = append(j.items, keys...)
+}
+
+// Get gets the item key falls into.
+func (j *Jump) Get(key string) string {
+	if len(j.items) == 0 {
+		return ""
+	}
+	return j.items[j.bucket(key)]
+}
+
+// GetN returns up to n distinct items for key: the one Get returns and
+// the items added after it, wrapping around.
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.items) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(j.items))
+	b := j.bucket(key)
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		res = append(res, j.items[(b+i)%len(j.items)])
+	}
+	return res
+}
+
+// bucket is the jump consistent hash of key over len(j.items) buckets.
+func (j *Jump) bucket(key string) int {
+	// 旋转 32 位：CRC32 把校验和放在高 32 位，旋转后得到与 32 位哈希时相同的输入，
+	// 已有集群升级后 key 的归属不变
+	k := bits.RotateLeft64(j.hash([]byte(key)), 32)
+	var b, next int64 = -1, 0
+	for next < int64(len(j.items)) {
+		b = next
+		k = k*2862933555777941757 + 1
+		next = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// Nodes returns the items added, sorted.
+func (j *Jump) Nodes() []string {
+	res := append([]string(nil), j.items...)
+	sort.Strings(res)
+	return res
+}
+
+// Distribution returns how many of keysSample each item gets, items
+// getting none included.
+func (j *Jump) Distribution(keysSample []string) map[string]int {
+	res := make(map[string]int, len(j.items))
+	for _, item := range j.items {
+		res[item] = 0
+	}
+	for _, key := range keysSample {
+		if item := j.Get(key); item != "" {
+			res[item]++
+		}
+	}
+	return res
+}
+
+// Shares returns the fraction of keys each item gets, the same for all.
+func (j *Jump) Shares() map[string]float64 {
+	res := make(map[string]float64, len(j.items))
+	for _, item := range j.items {
+		res[item] += 1 / float64(len(j.items))
+	}
+	return res
+}
@@ -0,0 +1,65 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestJump(t *testing.T) {
+	j := NewJump(nil)
+	if j.Get("k") != "" {
+		t.Fatal("empty Jump returned an item")
+	}
+	j.Add("a", "b", "c")
+	keys := make([]string, 3000)
+	before := make([]string, len(keys))
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		before[i] = j.Get(keys[i])
+	}
+	for item, n := range j.Distribution(keys) {
+		if n < 800 || n > 1200 {
+			t.Errorf("%s got %d of %d keys", item, n, len(keys))
+		}
+	}
+
+	// 追加一个节点只会把键移到新节点上，约占四分之一
+	j.Add("d")
+	moved := 0
+	for i, key := range keys {
+		if after := j.Get(key); after != before[i] {
+			if after != "d" {
+				t.Fatalf("%s moved from %s to %s", key, before[i], after)
+			}
+			moved++
+		}
+	}
+	if moved < 600 || moved > 900 {
+		t.Errorf("%d of %d keys moved", moved, len(keys))
+	}
+
+	if got := j.GetN("key1", 5); len(got) != 4 || got[0] != j.Get("key1") {
+		t.Errorf("GetN = %v", got)
+	}
+}
+
+// TestJumpCRC32 checks that the default hash places keys as the 32-bit
+// CRC-32 of earlier releases did.
+func TestJumpCRC32(t *testing.T) {
+	j := NewJump(nil)
+	j.Add("a", "b", "c", "d", "e")
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		k := uint64(crc32.ChecksumIEEE([]byte(key)))
+		var b, next int64 = -1, 0
+		for next < 5 {
+			b = next
+			k = k*2862933555777941757 + 1
+			next = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+		}
+		if got := j.Get(key); got != j.items[b] {
+			t.Fatalf("key %s placed on %s, earlier releases placed it on %s", key, got, j.items[b])
+		}
+	}
+}
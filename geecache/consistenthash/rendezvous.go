@@ -0,0 +1,123 @@
+package consistenthash
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// Rendezvous is highest random weight hashing: a key belongs to the item
+// scoring highest for it. Keys spread evenly without virtual nodes, and
+// adding or removing an item only moves the keys it gains or loses, in
+// any order. Lookups take O(items) time, so it suits small clusters.
+type Rendezvous struct {
+	hash  Hash
+	items []string
+}
+
+var _ Ring = (*Rendezvous)(nil)
+
+// NewRendezvous creates a Rendezvous hashing keys with fn, CRC-32 if nil.
+func NewRendezvous(fn Hash) *Rendezvous {
+	r := &Rendezvous{hash: fn}
+	if r.hash == nil {
+		r.hash = CRC32
+	}
+	return r
+}
+
+// Add adds items.
+func (r *Rendezvous) Add(keys ...string) {
+	r.items = append(r.items, keys...)
+}
+
+// score is the weight of item for key. 组合后的哈希再经 splitmix64 打散，
+// 弱哈希函数下各节点的得分也近似独立。对 CRC32 而言组合结果与 32 位哈希时的
+// item<<32 | key 相同，升级后 key 的归属不变
+func (r *Rendezvous) score(item string, key uint64) uint64 {
+	x := r.hash([]byte(item)) ^ bits.RotateLeft64(key, 32)
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// Get gets the item scoring highest for key.
+func (r *Rendezvous) Get(key string) string {
+	if len(r.items) == 0 {
+		return ""
+	}
+	h := r.hash([]byte(key))
+	best, bestScore := "", uint64(0)
+	for _, item := range r.items {
+		// 得分相同时按名字决定，结果与添加顺序无关
+		if s := r.score(item, h); best == "" || s > bestScore || s == bestScore && item < best {
+			best, bestScore = item, s
+		}
+	}
+	return best
+}
+
+// GetN returns up to n distinct items for key in decreasing score order,
+// which are the items that would own it in turn if the previous ones
+// were removed.
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if len(r.items) == 0 || n <= 0 {
+		return nil
+	}
+	h := r.hash([]byte(key))
+	type scored struct {
+		item  string
+		score uint64
+	}
+	all := make([]scored, 0, len(r.items))
+	seen := make(map[string]bool, len(r.items))
+	for _, item := range r.items {
+		if !seen[item] {
+			seen[item] = true
+			all = append(all, scored{item, r.score(item, h)})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].item < all[j].item
+	})
+	res := make([]string, 0, min(n, len(all)))
+	for i := 0; i < n && i < len(all); i++ {
+		res = append(res, all[i].item)
+	}
+	return res
+}
+
+// Nodes returns the items added, sorted.
+func (r *Rendezvous) Nodes() []string {
+	res := append([]string(nil), r.items...)
+	sort.Strings(res)
+	return res
+}
+
+// Distribution returns how many of keysSample each item gets, items
+// getting none included.
+func (r *Rendezvous) Distribution(keysSample []string) map[string]int {
+	res := make(map[string]int, len(r.items))
+	for _, item := range r.items {
+		res[item] = 0
+	}
+	for _, key := range keysSample {
+		if item := r.Get(key); item != "" {
+			res[item]++
+		}
+	}
+	return res
+}
+
+// Shares returns the fraction of keys each item gets on average, the same
+// for all.
+func (r *Rendezvous) Shares() map[string]float64 {
+	res := make(map[string]float64, len(r.items))
+	for _, item := range r.items {
+		res[item] = 1 / float64(len(r.items))
+	}
+	return res
+}
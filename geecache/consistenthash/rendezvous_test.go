@@ -0,0 +1,62 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+// TestRendezvousCRC32 checks that the default hash places keys as the
+// 32-bit CRC-32 of earlier releases did.
+func TestRendezvousCRC32(t *testing.T) {
+	r := NewRendezvous(nil)
+	r.Add("a", "b", "c")
+	score := func(item, key string) uint64 {
+		x := uint64(crc32.ChecksumIEEE([]byte(item)))<<32 | uint64(crc32.ChecksumIEEE([]byte(key)))
+		x += 0x9e3779b97f4a7c15
+		x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+		x = (x ^ x>>27) * 0x94d049bb133111eb
+		return x ^ x>>31
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		best := ""
+		for _, item := range []string{"a", "b", "c"} {
+			if best == "" || score(item, key) > score(best, key) {
+				best = item
+			}
+		}
+		if got := r.Get(key); got != best {
+			t.Fatalf("key %s placed on %s, earlier releases placed it on %s", key, got, best)
+		}
+	}
+}
+
+func TestRendezvous(t *testing.T) {
+	r := NewRendezvous(nil)
+	r.Add("a", "b", "c", "d")
+	keys := make([]string, 4000)
+	before := make([]string, len(keys))
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		before[i] = r.Get(keys[i])
+	}
+	for item, n := range r.Distribution(keys) {
+		if n < 850 || n > 1150 {
+			t.Errorf("%s got %d of %d keys", item, n, len(keys))
+		}
+	}
+
+	// 去掉任意一个节点，只有它的键会移动，且与添加顺序无关
+	other := NewRendezvous(nil)
+	other.Add("d", "a", "c")
+	for i, key := range keys {
+		after := other.Get(key)
+		if before[i] != "b" && after != before[i] {
+			t.Fatalf("%s moved from %s to %s", key, before[i], after)
+		}
+		if got := r.GetN(key, 2); got[0] != before[i] || before[i] == "b" && got[1] != after {
+			t.Fatalf("GetN(%s) = %v, owner %s, next %s", key, got, before[i], after)
+		}
+	}
+}
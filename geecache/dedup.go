@@ -0,0 +1,103 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 跨节点去重：冷启动时归属节点回源很慢，其它节点的请求等到超时后会各自回源，
+// 同一个 key 被整个集群重复加载。开启后归属节点在加载进行中时先应答 ErrLoadInFlight，
+// 请求方收到后再次询问归属节点（长轮询），而不是自己回源
+
+// Dedup configures cross-node deduplication of loads, see
+// WithDistributedDedup.
+type Dedup struct {
+	// Wait is how long the owner holds a request from a peer for a key it
+	// is still loading before answering ErrLoadInFlight, 1s if 0. Keep it
+	// well under the peers' request timeout.
+	Wait time.Duration
+	// MaxWait is how long a node keeps asking the owner about a load in
+	// flight before loading the key itself, 30s if 0. The context of the
+	// Get may end the wait sooner.
+	MaxWait time.Duration
+}
+
+// WithDistributedDedup makes the nodes of the cluster wait on the load of
+// a key by its owner rather than each load the key from the origin when
+// the owner is slow, e.g. on a cold start. The owner answers
+// ErrLoadInFlight to requests for a key whose load outlasts Wait, and the
+// requesting node asks again; nodes without the option load the key
+// themselves, as on any error from the owner. Repeated requests are
+// counted in Stats.PeerLoadWaits.
+func WithDistributedDedup(d Dedup) Option {
+	return func(g *Group) {
+		if d.Wait <= 0 {
+			d.Wait = time.Second
+		}
+		if d.MaxWait <= 0 {
+			d.MaxWait = 30 * time.Second
+		}
+		g.dedup = &d
+	}
+}
+
+// getForPeer is GetContext answering a request from a peer. With
+// WithDistributedDedup, a load still running after Wait fails with
+// ErrLoadInFlight and goes on in the background.
+func (g *Group) getForPeer(ctx context.Context, key string, opts ...GetOption) (ByteView, error) {
+	if g.dedup == nil {
+		return g.GetContext(ctx, key, opts...)
+	}
+	if newGetOptions(opts).bypass == bypassNone {
+		if _, ok := g.cached(key); ok {
+			// 命中缓存的请求直接应答，不必另起 goroutine 与计时器
+			return g.GetContext(ctx, key, opts...)
+		}
+	}
+	type result struct {
+		v   ByteView
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// 请求提前应答后加载仍要完成，结果进入缓存供下一次询问
+		v, err := g.GetContext(context.WithoutCancel(ctx), key, opts...)
+		done <- result{v, err}
+	}()
+	timer := time.NewTimer(g.dedup.Wait)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-timer.C:
+		go func() {
+			r := <-done
+			r.v.Release()
+		}()
+		return ByteView{}, fmt.Errorf("%w: %q", ErrLoadInFlight, key)
+	case <-ctx.Done():
+		go func() {
+			r := <-done
+			r.v.Release()
+		}()
+		return ByteView{}, ctx.Err()
+	}
+}
+
+// fetchWaiting is fetchFromPeer asking peer again while it reports the
+// load of key in flight, for up to MaxWait.
+func (g *Group) fetchWaiting(ctx context.Context, peer PeerGetter, key, routeKey string) (ByteView, error) {
+	value, err := g.fetchFromPeer(ctx, peer, key, routeKey)
+	if g.dedup == nil {
+		return value, err
+	}
+	deadline := time.Now().Add(g.dedup.MaxWait)
+	for errors.Is(err, ErrLoadInFlight) && time.Now().Before(deadline) && ctx.Err() == nil {
+		// 归属节点每次都会等待 Wait 再应答，无需在这里退避
+		g.Stats.PeerLoadWaits.Add(1)
+		value, err = g.fetchFromPeer(ctx, peer, key, routeKey)
+	}
+	return value, err
+}
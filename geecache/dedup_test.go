@@ -0,0 +1,74 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDistributedDedup(t *testing.T) {
+	opts := []Option{WithDistributedDedup(Dedup{Wait: 20 * time.Millisecond})}
+	var ownerLoads, otherLoads atomic.Int64
+	NewGroup("dedup", GetterFunc(func(key string) ([]byte, error) {
+		ownerLoads.Add(1)
+		time.Sleep(150 * time.Millisecond) // 比对端的超时更长
+		return []byte("value of " + key), nil
+	}), opts...)
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+	owner := &httpGetter{baseURL: srv.URL + defaultBasePath, client: &http.Client{Timeout: 60 * time.Millisecond}}
+
+	// 两个非归属节点同时冷启动读取同一个 key
+	var nodes []*Group
+	for _, name := range []string{"dedup-a", "dedup-b"} {
+		g := NewGroup(name, GetterFunc(func(key string) ([]byte, error) {
+			otherLoads.Add(1)
+			return []byte("value of " + key), nil
+		}), opts...)
+		g.name = "dedup"
+		g.RegisterPeers(peerFunc(func(ctx context.Context, in *pb.Request, out *pb.Response) error {
+			return owner.Get(ctx, in, out)
+		}))
+		nodes = append(nodes, g)
+	}
+	var wg sync.WaitGroup
+	for _, g := range nodes {
+		wg.Add(1)
+		go func(g *Group) {
+			defer wg.Done()
+			if v, err := g.Get("k"); err != nil || v.String() != "value of k" {
+				t.Errorf("get = %q, %v", v.String(), err)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := ownerLoads.Load(); n != 1 {
+		t.Fatalf("owner loaded the key %d times", n)
+	}
+	if n := otherLoads.Load(); n != 0 {
+		t.Fatalf("other nodes loaded the key %d times", n)
+	}
+	if nodes[0].Stats.PeerLoadWaits.Get() == 0 {
+		t.Fatal("no request asked again")
+	}
+}
+
+func TestDedupCachedKey(t *testing.T) {
+	g := NewGroup("dedup-cached", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithDistributedDedup(Dedup{Wait: time.Nanosecond}))
+	if _, err := g.Get("k"); err != nil {
+		t.Fatal(err)
+	}
+	// 即使 Wait 极短，缓存中已有的 key 也不会应答 ErrLoadInFlight
+	for i := 0; i < 100; i++ {
+		if v, err := g.getForPeer(context.Background(), "k"); err != nil || v.String() != "k" {
+			t.Fatalf("get of a cached key = %q, %v", v.String(), err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package geecache
+
+import "sync"
+
+// 派生 group：值由另一个 group 的值经过变换得到（例如由 images 生成 thumbnails），
+// 源 group 中的 key 失效时，派生 group 中的同名 key 一并失效
+
+// A Transform derives the value of key from the value of the same key in
+// the source group.
+type Transform func(key string, src ByteView) ([]byte, error)
+
+// dependents tracks the groups derived from a group.
+type dependents struct {
+	mu     sync.Mutex
+	groups []*Group
+}
+
+func (d *dependents) add(g *Group) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, dg := range d.groups {
+		if dg == g {
+			return
+		}
+	}
+	d.groups = append(d.groups, g)
+}
+
+func (d *dependents) remove(g *Group) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, dg := range d.groups {
+		if dg == g {
+			d.groups = append(d.groups[:i], d.groups[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *dependents) list() []*Group {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Group(nil), d.groups...)
+}
+
+// NewDerivedGroup creates a group whose values are source's values of the
+// same key passed through transform. Removing a key from source, or
+// flushing it, does the same to the derived group, and in turn to groups
+// derived from it. If source is later replaced by a group of the same
+// name, the derived group reads from and follows the replacement.
+func NewDerivedGroup(name string, source *Group, transform Transform, opts ...Option) *Group {
+	var self *Group
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		src, err := self.source.Load().Get(key)
+		if err != nil {
+			return nil, err
+		}
+		return transform(key, src)
+	})
+	return NewGroup(name, getter, append(opts[:len(opts):len(opts)], func(g *Group) {
+		self = g
+		g.source.Store(source)
+	})...)
+}
+
+// link registers g with the group it depends on and, when g replaces old,
+// moves old's registrations to g. It must be called with mu held.
+func (g *Group) link(old *Group) {
+	if src := g.source.Load(); src != nil {
+		src.dependents.add(g)
+	}
+	if old == nil {
+		return
+	}
+	if src := old.source.Load(); src != nil {
+		src.dependents.remove(old)
+	}
+	// 依赖旧 group 的 group 改为依赖替换它的 group
+	for _, d := range old.dependents.list() {
+		d.source.CompareAndSwap(old, g)
+		g.dependents.add(d)
+	}
+}
@@ -0,0 +1,68 @@
+package geecache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 静态加密：开启后磁盘二级缓存的段文件与快照用 AES-GCM 加密写入，
+// 溢出到磁盘的缓存数据不会以明文泄露。密钥在创建 group 时取一次，可来自配置或 KMS
+
+// A KeyFunc returns the AES key, 16, 24 or 32 bytes long, encrypting what
+// a group writes to disk. It may fetch or unwrap the key from a KMS.
+type KeyFunc func() ([]byte, error)
+
+// StaticKey returns a KeyFunc returning key.
+func StaticKey(key []byte) KeyFunc {
+	return func() ([]byte, error) { return key, nil }
+}
+
+// errNoKey reports an encrypted snapshot read by a group without a key.
+var errNoKey = errors.New("encrypted, but no key is configured")
+
+// WithEncryption makes the group encrypt the segments of its disk tier and
+// its snapshots with AES-GCM, using the key returned by key when the group
+// is created. Creating the group fails if key does.
+func WithEncryption(key KeyFunc) Option {
+	return func(g *Group) {
+		g.encryptKey = key
+	}
+}
+
+// newAEAD returns the AES-GCM cipher of the key returned by key.
+func newAEAD(key KeyFunc) (cipher.AEAD, error) {
+	k, err := key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal appends the encryption of plain, authenticating ad as well, to dst
+// preceded by a random nonce.
+func seal(aead cipher.AEAD, dst, plain, ad []byte) ([]byte, error) {
+	// 随机 nonce：同一密钥下加密 2^32 次以内重复的概率可以忽略
+	n := len(dst)
+	dst = append(dst, make([]byte, aead.NonceSize())...)
+	if _, err := io.ReadFull(rand.Reader, dst[n:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(dst, dst[n:], plain, ad), nil
+}
+
+// open decrypts sealed, as returned by seal.
+func open(aead cipher.AEAD, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed data too short")
+	}
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, data, ad)
+}
@@ -0,0 +1,68 @@
+package geecache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	key := StaticKey(bytes.Repeat([]byte{7}, 32))
+	dir := t.TempDir()
+	tier, err := NewDiskTier(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat("secret-"+key, 10)), nil
+	})
+	g := NewGroup("encrypted", getter, WithCacheBytes(256), WithDiskTier(tier), WithEncryption(key))
+	for i := 0; i < 20; i++ {
+		g.Get("key" + strconv.Itoa(i))
+	}
+	if tier.Len() == 0 {
+		t.Fatal("nothing spilled to disk")
+	}
+	tier.flush()
+	segments, _ := filepath.Glob(filepath.Join(dir, segmentPattern))
+	for _, name := range segments {
+		if data, _ := os.ReadFile(name); bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("key0")) {
+			t.Fatalf("%s holds plaintext", name)
+		}
+	}
+	if v, err := g.Get("key0"); err != nil || v.String() != strings.Repeat("secret-key0", 10) {
+		t.Fatalf("key0 = %q, %v", v.String(), err)
+	}
+	if g.Stats.TierHits.Get() != 1 {
+		t.Fatalf("%d disk hits", g.Stats.TierHits.Get())
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := g.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("secret")) {
+		t.Fatal("snapshot holds plaintext")
+	}
+	restored := NewGroup("encrypted-restored", getter, WithEncryption(key))
+	if n, err := restored.LoadSnapshot(path); err != nil || n == 0 {
+		t.Fatalf("loaded %d entries, %v", n, err)
+	}
+	other := NewGroup("encrypted-other", getter, WithEncryption(StaticKey(bytes.Repeat([]byte{8}, 32))))
+	if _, err := other.LoadSnapshot(path); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("snapshot opened with another key: %v", err)
+	}
+	plain := NewGroup("encrypted-plain", getter)
+	if _, err := plain.LoadSnapshot(path); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("snapshot opened without a key: %v", err)
+	}
+
+	if _, err := CreateGroup("encrypted-bad-key", getter, WithEncryption(StaticKey([]byte("short")))); err == nil {
+		t.Fatal("group created with an invalid key")
+	}
+}
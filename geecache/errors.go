@@ -0,0 +1,146 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 错误模型：导出哨兵错误，调用方用 errors.Is 判断；
+// 服务端把它们映射为 HTTP 状态码，httpGetter 再把状态码还原为同样的错误
+
+var (
+	// ErrNotFound reports that the key doesn't exist. Getters should return
+	// it (possibly wrapped) for missing keys, so that peers can tell a
+	// missing key from a failure.
+	ErrNotFound = errors.New("geecache: key not found")
+
+	// ErrGroupNotFound reports that the group doesn't exist on the node.
+	ErrGroupNotFound = errors.New("geecache: group not found")
+
+	// ErrValueTooLarge reports a value exceeding a size limit, see
+	// WithMaxEntryBytes and HTTPPoolOptions.MaxResponseBytes.
+	ErrValueTooLarge = errors.New("geecache: value too large")
+
+	// ErrPeerUnavailable reports that a peer could not be reached or failed
+	// to answer.
+	ErrPeerUnavailable = errors.New("geecache: peer unavailable")
+
+	// ErrUnauthorized reports a request without acceptable credentials.
+	ErrUnauthorized = errors.New("geecache: unauthorized")
+
+	// ErrForbidden reports credentials that are not allowed the operation.
+	ErrForbidden = errors.New("geecache: forbidden")
+
+	// ErrOverloaded reports a load rejected by admission control, see
+	// WithAdmissionControl. Callers should treat the key as missing for now.
+	ErrOverloaded = errors.New("geecache: overloaded")
+
+	// ErrConfigMismatch reports a group configured differently on the
+	// node asked, see HTTPPool.CheckManifests.
+	ErrConfigMismatch = errors.New("geecache: group configuration mismatch")
+
+	// ErrVersionMismatch reports a Group.CompareAndSet whose key changed
+	// since the expected version was read.
+	ErrVersionMismatch = errors.New("geecache: version mismatch")
+
+	// ErrNotNumeric reports an Increment of a value that is not a decimal
+	// integer.
+	ErrNotNumeric = errors.New("geecache: value is not numeric")
+
+	// ErrLeaseHeld reports a GetLease miss while another caller holds the
+	// lease on the key, see WithLeases. Retry shortly.
+	ErrLeaseHeld = errors.New("geecache: lease held by another caller")
+
+	// ErrLeaseInvalid reports a value refused by a group with leases
+	// because its lease expired or was revoked, or it had none.
+	ErrLeaseInvalid = errors.New("geecache: lease invalid")
+
+	// ErrProtocolMismatch reports a peer speaking a protocol version this
+	// node doesn't accept, see HTTPPoolOptions.MinProtocolVersion.
+	ErrProtocolMismatch = errors.New("geecache: protocol version mismatch")
+
+	// ErrCorrupted reports a value received from a peer that doesn't match
+	// the checksum computed when it was cached, e.g. truncated in transit.
+	ErrCorrupted = errors.New("geecache: value corrupted")
+
+	// ErrLoadInFlight reports a key the peer asked is still loading, see
+	// WithDistributedDedup. Ask again rather than loading it.
+	ErrLoadInFlight = errors.New("geecache: load in flight")
+)
+
+// errorHeader names the sentinel behind an error response, since several
+// of them share a status code.
+const errorHeader = "X-Geecache-Error"
+
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{ErrNotFound, "not-found", http.StatusNotFound},
+	{ErrGroupNotFound, "group-not-found", http.StatusNotFound},
+	{ErrValueTooLarge, "value-too-large", http.StatusRequestEntityTooLarge},
+	{ErrPeerUnavailable, "peer-unavailable", http.StatusBadGateway},
+	{ErrUnauthorized, "unauthorized", http.StatusUnauthorized},
+	{ErrForbidden, "forbidden", http.StatusForbidden},
+	{ErrOverloaded, "overloaded", http.StatusServiceUnavailable},
+	{ErrConfigMismatch, "config-mismatch", http.StatusConflict},
+	{ErrVersionMismatch, "version-mismatch", http.StatusPreconditionFailed},
+	{ErrNotNumeric, "not-numeric", http.StatusUnprocessableEntity},
+	{ErrLeaseHeld, "lease-held", http.StatusConflict},
+	{ErrLeaseInvalid, "lease-invalid", http.StatusConflict},
+	{ErrProtocolMismatch, "protocol-mismatch", http.StatusUpgradeRequired},
+	{ErrCorrupted, "corrupted", http.StatusBadGateway},
+	{ErrLoadInFlight, "load-in-flight", http.StatusAccepted},
+}
+
+// errorStatus returns the HTTP status matching err and the code naming
+// its sentinel, if any.
+func errorStatus(err error) (status int, code string) {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.status, c.code
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, ""
+	}
+	return http.StatusInternalServerError, ""
+}
+
+// writeError answers a failed request with the status matching err.
+func writeError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	if code != "" {
+		w.Header().Set(errorHeader, code)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// errorFromResponse turns a non-200 response from a peer back into an
+// error wrapping the matching sentinel.
+func errorFromResponse(res *http.Response, body []byte) error {
+	code := res.Header.Get(errorHeader)
+	for _, c := range errorCodes {
+		if c.code == code && c.status == res.StatusCode {
+			return &remoteError{msg: strings.TrimSpace(string(body)), err: c.err}
+		}
+	}
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("%w: server returned: %v", ErrPeerUnavailable, res.Status)
+	}
+	return fmt.Errorf("server returned: %v", res.Status)
+}
+
+// remoteError is an error returned by a peer: it keeps the peer's message
+// and matches the sentinel it was mapped from.
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e *remoteError) Error() string { return e.msg }
+func (e *remoteError) Unwrap() error { return e.err }
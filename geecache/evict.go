@@ -0,0 +1,67 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+)
+
+// 淘汰回调：条目离开缓存时通知使用者。回调在后台 goroutine 中执行，分片的锁内只把条目
+// 放入有界队列，用户回调再慢也不会阻塞同一分片上的读写
+
+// defaultEvictionQueue is the queue length WithEvictionHandler uses if
+// given none.
+const defaultEvictionQueue = 1024
+
+// WithEvictionHandler calls fn for every entry leaving the group's cache,
+// whether evicted to make room, expired, removed or cleared, but not for
+// copies kept by WithHotCache. fn runs on workers goroutines, at least
+// one, fed by a queue of up to queueSize entries, 1024 if 0; entries
+// leaving the cache while the queue is full are counted in
+// Stats.EvictionsLost instead of stalling the cache. fn must be safe
+// for concurrent use when workers is above 1.
+func WithEvictionHandler(fn func(key string, value ByteView), workers, queueSize int) Option {
+	return func(g *Group) {
+		if queueSize <= 0 {
+			queueSize = defaultEvictionQueue
+		}
+		q := &evictionQueue{fn: fn, workers: max(workers, 1), ch: make(chan evicted, queueSize), g: g}
+		g.evictions = q
+		g.cacheOpts.onEvict = q.enqueue
+	}
+}
+
+type evicted struct {
+	key   string
+	value lru.Value
+}
+
+// evictionQueue hands evicted entries to the handler's workers.
+type evictionQueue struct {
+	fn      func(key string, value ByteView)
+	workers int
+	ch      chan evicted
+	g       *Group
+}
+
+// enqueue is called with the lock of a shard held, so it never blocks.
+func (q *evictionQueue) enqueue(key string, v lru.Value) {
+	select {
+	case q.ch <- evicted{key, v}:
+	default:
+		q.g.Stats.EvictionsLost.Add(1)
+	}
+}
+
+// run calls the handler for queued entries until the group is replaced.
+func (q *evictionQueue) run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-q.ch:
+			// 压缩过的值在这里才解压，不占用分片的锁
+			if view, ok := viewOf(e.value); ok {
+				q.fn(e.key, view)
+			}
+		}
+	}
+}
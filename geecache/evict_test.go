@@ -0,0 +1,44 @@
+package geecache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEvictionHandler(t *testing.T) {
+	release := make(chan struct{})
+	evicted := make(chan string, 16)
+	g := NewGroup("evictions", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), WithCacheBytes(64), WithEvictionHandler(func(key string, value ByteView) {
+		<-release // 回调卡住也不能阻塞缓存的读写
+		evicted <- key + "=" + value.String()
+	}, 1, 2))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			g.Get("key" + strconv.Itoa(i))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("gets stalled by the eviction handler")
+	}
+	if g.CacheStats().Evictions == 0 || g.Stats.EvictionsLost.Get() == 0 {
+		t.Fatalf("evictions %d, lost %d", g.CacheStats().Evictions, g.Stats.EvictionsLost.Get())
+	}
+
+	close(release)
+	select {
+	case e := <-evicted:
+		if e != "key0=value" {
+			t.Fatalf("first eviction %q", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("eviction handler not called")
+	}
+}
@@ -3,9 +3,13 @@ package geecache
 import (
 	pb "GeeCache/geecache/geecachepb"
 	"GeeCache/geecache/singleflight"
+	"context"
+	"crypto/cipher"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 负责与外部交互，控制缓存存储和获取的主流程
@@ -38,13 +42,171 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 
 // A Group is a cache namespace and associated data loaded spread over
 type Group struct {
-	name      string //缓存的命名空间
-	getter    Getter //存未命中时获取源数据的回调(callback)
-	mainCache cache  //一开始实现的并发缓存
+	name      string        //缓存的命名空间
+	getter    Getter        //存未命中时获取源数据的回调(callback)
+	mainCache *shardedCache //一开始实现的并发缓存，现按 key 分片，存本节点负责的 key
+	hotCache  *shardedCache //其它节点负责的热点 key 的副本，未启用时为 nil
+	hotRatio  float64       //hotCache 占缓存预算的比例
 	peers     PeerPicker
+
+	// Stats are statistics on the group.
+	Stats Stats
 	// use singleflight.Group to make sure that
 	// each key is only fetched once
 	loader *singleflight.Group
+
+	affinity AffinityResolver //可为 nil
+	logger   Logger
+	tracer   Tracer
+
+	compactIdle   time.Duration //超过该时长未访问的值会被压缩，0 表示不压缩
+	maxEntry      int64         //单个条目（key 与值）的大小上限，0 表示不限制
+	passOversize  bool          //超限的值返回给调用方但不缓存，而不是报错
+	shards        int           //初始分片数
+	maxShards     int           //自动拆分的分片数上限，0 表示不自动拆分
+	cacheOpts     cacheOptions
+	sampler       SampleExporter                 //可为 nil
+	sampleBelow   uint64                         //哈希不大于该值的 key 被采样
+	compressAbove int                            //不小于该大小的值压缩存放，0 表示不压缩
+	policies      atomic.Pointer[[]prefixPolicy] //按前缀长度降序排列，运行时可替换
+	admission     *admission                     //可为 nil
+	loadLimit     *loadLimiter                   //可为 nil
+	hedging       *hedger                        //可为 nil
+	dedup         *Dedup                         //跨节点去重，可为 nil
+	leases        *leaseTable                    //可为 nil
+	consistency   Consistency
+	configHash    atomic.Value //配置摘要（string），用于节点间一致性检查
+	configBytes   int64        //WithCacheBytes 设置的缓存大小，计入配置摘要
+	policyMu      sync.Mutex   //串行化 SetPolicy
+	pins          pinSet
+	tier          *DiskTier //可为 nil
+	snapshotPath  string
+	snapshotEvery time.Duration
+	encryptKey    KeyFunc     //可为 nil，见 WithEncryption
+	aead          cipher.AEAD //加密磁盘层与快照，可为 nil
+	hints         *hintQueue  //可为 nil
+	store         Store       //可为 nil
+	writeBehind   *writeQueue //可为 nil，仅在配置了 store 时生效
+	refreshAhead  float64     //剩余寿命不足 TTL 的该比例时提前刷新，0 表示不刷新
+	refreshing    refreshing
+	updateTurns   storeTurns //原地更新按在缓存中生效的顺序写入 store
+	tombstones    tombstones //最近写入或删除的 key，拒绝迁移来的旧值
+	versions      versionClock
+
+	source           atomic.Pointer[Group] //失效传递到本 group 的派生源或下一级 group，可为空
+	dependents       dependents            //由本 group 派生的 group，失效时一并处理
+	onDuplicate      DuplicatePolicy
+	getterMiddleware []GetterMiddleware //创建时包裹 getter
+	loadTimes        latencyHistogram   //回源耗时分布
+	slowLoad         time.Duration      //超过它的回源记入日志，0 表示不记录
+	pooledBuffers    bool               //对端和未缓存的回源结果读入池化缓冲区
+	arenaAbove       int                //不小于该大小的值存放在 arena 中
+	arenaBytes       int64              //WithArena 设置的 arena 大小，0 表示不使用
+	arena            *arena             //可为 nil
+	chunkBytes       int64              //超过该大小的值分块存放，0 表示不分块
+	evictions        *evictionQueue     //淘汰回调的队列，可为 nil
+	manager          *CacheManager      //可为 nil
+	weight           int                //在 manager 中的权重
+	inflight         atomic.Int64       //正在进行的 Get 调用数，替换时用于等待排空
+	stop             chan struct{}      //被替换后关闭，停止后台任务
+}
+
+// An Option configures a Group created by NewGroup.
+type Option func(*Group)
+
+// DefaultCacheBytes is the cache budget of a group created without
+// WithCacheBytes.
+const DefaultCacheBytes = 64 << 20
+
+// WithCacheBytes sets the group's cache budget, DefaultCacheBytes if not
+// given; 0 removes the limit.
+func WithCacheBytes(n int64) Option {
+	return func(g *Group) {
+		g.configBytes = n
+	}
+}
+
+// WithLogger sets the Logger the group reports to instead of the standard logger.
+func WithLogger(l Logger) Option {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// WithTracer makes the group record spans for Get, peer fetches and origin
+// loads with t.
+func WithTracer(t Tracer) Option {
+	return func(g *Group) {
+		g.tracer = t
+	}
+}
+
+// WithMaxEntryBytes makes the group reject values whose entry, key and
+// value together, exceeds n bytes with ErrValueTooLarge instead of caching
+// them, so that a single huge value can't evict the working set. Entries
+// larger than the budget of the cache shard they'd land in are never
+// cached, with or without this option.
+func WithMaxEntryBytes(n int64) Option {
+	return func(g *Group) {
+		g.maxEntry = n
+	}
+}
+
+// WithOversizePassThrough makes the group return values over the
+// WithMaxEntryBytes limit to the caller, uncached, instead of failing.
+func WithOversizePassThrough() Option {
+	return func(g *Group) {
+		g.passOversize = true
+	}
+}
+
+// An AffinityResolver maps a key to the routing key used to pick its
+// owning peer, so that related keys (e.g. all keys of one session) land on
+// the same node. Returning "" routes by the key itself.
+type AffinityResolver func(key string) string
+
+// WithAffinityResolver makes the group route keys by r instead of by their
+// hash. Every node must be configured with the same resolver.
+func WithAffinityResolver(r AffinityResolver) Option {
+	return func(g *Group) {
+		g.affinity = r
+	}
+}
+
+// A GetOption customizes a single Group.Get call.
+type GetOption func(*getOptions)
+
+type getOptions struct {
+	affinity    string
+	info        *LoadInfo
+	local       bool // 不转发给归属节点，见 pb.Request.Local
+	consistency Consistency
+	manifest    bool        // 分块的值返回清单而不重组，见 readManifest
+	bypass      cacheBypass // 见 SkipCache 与 ForceRefresh
+}
+
+// newGetOptions applies opts. It keeps the options of calls without any
+// on the stack of GetContext.
+func newGetOptions(opts []GetOption) getOptions {
+	var o getOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// loadLocally makes the call load the key on this node instead of asking
+// its owner, see pb.Request.Local.
+func loadLocally(o *getOptions) {
+	o.local = true
+}
+
+// WithAffinity routes the call to the peer owning hint instead of the
+// peer owning the key, overriding the group's AffinityResolver.
+func WithAffinity(hint string) GetOption {
+	return func(o *getOptions) {
+		o.affinity = hint
+	}
 }
 
 var (
@@ -52,21 +214,149 @@ var (
 	groups = make(map[string]*Group)
 )
 
-// NewGroup create a new instance of Group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// A DuplicatePolicy decides what creating a group under a name already
+// in use does.
+type DuplicatePolicy int
+
+const (
+	// ReplaceGroup registers the new group in place of the existing one,
+	// which finishes its in-flight calls and then stops its background
+	// work. This is the default.
+	ReplaceGroup DuplicatePolicy = iota
+	// ReuseGroup returns the existing group and discards the new one.
+	ReuseGroup
+	// RejectGroup fails with ErrGroupExists.
+	RejectGroup
+)
+
+// ErrGroupExists is returned by CreateGroup under RejectGroup.
+var ErrGroupExists = errors.New("geecache: group already exists")
+
+// WithDuplicatePolicy sets what happens if a group of the same name has
+// already been created.
+func WithDuplicatePolicy(p DuplicatePolicy) Option {
+	return func(g *Group) {
+		g.onDuplicate = p
+	}
+}
+
+// NewGroup create a new instance of Group, loading values missing from
+// the cache with getter. It panics where CreateGroup would return an error.
+func NewGroup(name string, getter Getter, opts ...Option) *Group {
+	g, err := CreateGroup(name, getter, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// CreateGroup is like NewGroup but reports a nil getter, a duplicate name
+// rejected by RejectGroup and the like as an error.
+func CreateGroup(name string, getter Getter, opts ...Option) (*Group, error) {
 	if getter == nil {
-		panic("nil Getter")
+		return nil, fmt.Errorf("geecache: nil Getter for group %s", name)
+	}
+	g := &Group{
+		name:        name,
+		getter:      getter,
+		loader:      &singleflight.Group{},
+		logger:      defaultLogger,
+		tracer:      noopTracer{},
+		configBytes: DefaultCacheBytes,
+		stop:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.getter = g.timeLoads(chainGetter(g.getter, g.getterMiddleware))
+	if g.encryptKey != nil {
+		// 取不到密钥时不能退回明文写盘，创建失败
+		aead, err := newAEAD(g.encryptKey)
+		if err != nil {
+			return nil, fmt.Errorf("geecache: encryption key of group %s: %w", name, err)
+		}
+		g.aead = aead
+		if g.tier != nil {
+			g.tier.aead = aead
+		}
 	}
+
 	mu.Lock()
 	defer mu.Unlock()
-	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+	old := groups[name]
+	if old != nil {
+		switch g.onDuplicate {
+		case ReuseGroup:
+			return old, nil
+		case RejectGroup:
+			return nil, fmt.Errorf("%w: %s", ErrGroupExists, name)
+		}
+	}
+	if g.arenaBytes > 0 {
+		a, err := newArena(g.arenaBytes)
+		if err != nil {
+			// 映射失败时退回堆上存放，不影响 group 的创建
+			g.logger.Warn("[GeeCache] arena unavailable", "group", name, "err", err)
+			g.cacheOpts.arena = false
+		}
+		g.arena = a
+	}
+	mainBytes, hotBytes := g.splitBudget(g.configBytes)
+	g.mainCache = newShardedCache(mainBytes, g.shards, g.maxShards, g.cacheOpts)
+	if g.hotRatio > 0 {
+		g.hotCache = newShardedCache(hotBytes, 1, 0, g.hotCacheOptions())
+	}
+	g.configHash.Store(g.computeConfigHash())
+	if g.maxShards > len(g.mainCache.shards()) {
+		go g.tuneShardsLoop()
+	}
+	if g.compactIdle > 0 {
+		go g.compactLoop()
+	}
+	if g.snapshotPath != "" {
+		go g.snapshotLoop()
+	}
+	if g.hints != nil && g.hints.interval > 0 {
+		go g.handoffLoop()
+	}
+	if g.evictions != nil {
+		for i := 0; i < g.evictions.workers; i++ {
+			go g.evictions.run(g.stop)
+		}
+	}
+	if g.store == nil {
+		g.writeBehind = nil
+	}
+	if g.writeBehind != nil {
+		for i := 0; i < g.writeBehind.cfg.Workers; i++ {
+			go g.writeBehindLoop()
+		}
 	}
 	groups[name] = g
-	return g
+	g.link(old)
+	if g.manager != nil {
+		g.manager.Add(g, g.weight)
+	}
+	if old != nil {
+		old.logger.Info("group replaced", "group", name)
+		if old.manager != nil {
+			old.manager.Remove(old)
+		}
+		go old.drain()
+	}
+	return g, nil
+}
+
+// drainPoll is how often drain checks for in-flight calls.
+const drainPoll = 10 * time.Millisecond
+
+// drain waits for the calls in flight on a replaced group and stops its
+// background work. 新的调用已经路由到替换后的 group，计数只会减少
+func (g *Group) drain() {
+	for g.inflight.Load() > 0 {
+		time.Sleep(drainPoll)
+	}
+	close(g.stop)
 }
 
 // GetGroup returns the named group previously created with NewGroup, or
@@ -79,17 +369,120 @@ func GetGroup(name string) *Group {
 }
 
 // Get value for a key from cache
-func (g *Group) Get(key string) (ByteView, error) {
+func (g *Group) Get(key string, opts ...GetOption) (ByteView, error) {
+	return g.GetContext(context.Background(), key, opts...)
+}
+
+// GetContext is like Get but carries ctx, and the trace context in it, to
+// peers and into the group's spans.
+func (g *Group) GetContext(ctx context.Context, key string, opts ...GetOption) (value ByteView, err error) {
+	g.inflight.Add(1)
+	defer g.inflight.Add(-1)
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.Get")
+	defer func() { endSpan(span, err) }()
+	if recording(span) {
+		span.SetAttribute("geecache.group", g.name)
+	}
+
+	var o getOptions
+	if len(opts) > 0 {
+		o = newGetOptions(opts)
+	}
+	var info LoadInfo
+	if o.info != nil {
+		start := time.Now()
+		defer func() {
+			info.Total = time.Since(start)
+			info.Bytes = value.Len()
+			*o.info = info
+		}()
+	}
+	if g.chunkBytes > 0 && !o.manifest {
+		defer func() {
+			if err == nil && isManifest(value) {
+				value, err = g.assemble(ctx, key, g.routeKey(key, o.affinity), value, opts)
+			}
+		}()
+	}
+
+	g.Stats.Gets.Add(1)
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	routeKey := g.routeKey(key, o.affinity)
+	if o.bypass != bypassOf(ctx) {
+		// 读取分块等内部调用不继承外层调用的标志
+		ctx = withBypass(ctx, o.bypass)
+	}
+	if o.bypass != bypassNone {
+		g.Stats.CacheBypasses.Add(1)
+		span.SetAttribute("geecache.bypass", true)
+	}
+	if peer, ok := g.pickOwner(routeKey, &o); ok {
+		span.SetAttribute("geecache.hit", false)
+		return g.getFromOwner(ctx, peer, key, routeKey, &info)
+	}
+	if o.bypass != bypassNone {
+		if o.bypass == bypassRefresh {
+			g.Remove(key)
+		}
+		return g.load(ctx, key, routeKey, o.local, &info)
+	}
 
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
+	v, ok := g.pins.get(key)
+	if !ok {
+		if v, ok = g.mainCache.get(key); ok && g.refreshAhead > 0 {
+			g.maybeRefresh(key)
+		}
+	}
+	if !ok && g.hotCache != nil && !g.ownerReads(&o) {
+		v, ok = g.hotCache.get(key)
+	}
+	if !ok && g.tier != nil {
+		if v, ok = g.fromTier(key); ok {
+			g.Stats.TierHits.Add(1)
+		}
+	}
+	if ok {
+		g.Stats.CacheHits.Add(1)
+		if debugEnabled(g.logger) {
+			g.logger.Debug("[GeeCache] hit", "group", g.name)
+		}
+		span.SetAttribute("geecache.hit", true)
+		info.Source = SourceCache
+		if g.sampler != nil {
+			g.sample(key, true, v.Len())
+		}
 		return v, nil
 	}
+	span.SetAttribute("geecache.hit", false)
+	if g.sampler != nil {
+		defer func() { g.sample(key, false, value.Len()) }()
+	}
+
+	return g.load(ctx, key, routeKey, o.local, &info)
+}
+
+// routeKey returns the key used to pick the peer owning key.
+func (g *Group) routeKey(key, hint string) string {
+	if hint != "" {
+		return hint
+	}
+	if g.affinity != nil {
+		if rk := g.affinity(key); rk != "" {
+			return rk
+		}
+	}
+	return key
+}
 
-	return g.load(key)
+// pickReadPeer picks the peer to load routeKey from, which may be a
+// replica rather than the owner, see ReadPeerPicker.
+func (g *Group) pickReadPeer(routeKey string) (PeerGetter, bool) {
+	if rp, ok := g.peers.(ReadPeerPicker); ok {
+		return rp.PickReadPeer(routeKey)
+	}
+	return g.peers.PickPeer(routeKey)
 }
 
 // RegisterPeers registers a PeerPicker for choosing remote peer
@@ -102,54 +495,372 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 }
 
 // 使用 PickPeer() 方法选择节点，若非本机节点，则调用 getFromPeer() 从远程获取。若是本机节点或失败，则回退到 getLocally()
-func (g *Group) load(key string) (value ByteView, err error) {
+// info 记录本次加载的来源和各阶段耗时，并发等待同一次加载的调用者共享同一份记录
+func (g *Group) load(ctx context.Context, key, routeKey string, local bool, info *LoadInfo) (value ByteView, err error) {
+	g.Stats.Loads.Add(1)
+	shared := true
 	// each key is only fetched once (either locally or remotely)
 	// regardless of the number of concurrent callers.
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok { // PickPeer实现对应接口的函数在http中，通过一致性哈希确定节点
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+	setLoadStage(ctx, "load")
+	var share func(interface{}, int)
+	if g.pooledBuffers {
+		share = shareLoad
+	}
+	viewi, err := g.loader.DoShared(flightKey(key, bypassOf(ctx)), func() (interface{}, error) {
+		shared = false
+		g.Stats.LoadsDeduped.Add(1)
+		var res loadResult
+		if g.admission != nil {
+			if !g.admission.admit() {
+				g.Stats.LoadsRejected.Add(1)
+				return res, fmt.Errorf("%w: group %s", ErrOverloaded, g.name)
+			}
+			defer g.admission.begin()()
+		}
+		if g.peers != nil && !local {
+			if peer, ok := g.pickReadPeer(routeKey); ok { // PickPeer实现对应接口的函数在http中，通过一致性哈希确定节点
+				setLoadStage(ctx, "peer")
+				start := time.Now()
+				value, err := g.fetchWaiting(ctx, peer, key, routeKey)
+				res.info.Peer = time.Since(start)
+				if err == nil {
+					g.Stats.PeerLoads.Add(1)
+					if bypassOf(ctx) != bypassSkip && !g.pins.store(key, value) { // 钉住的 key 即使归属其它节点也保存在本地
+						g.maybePopulateHot(key, value)
+					}
+					res.value, res.info.Source = value, SourcePeer
+					return res, nil
+				}
+				if errors.Is(err, ErrNotFound) || errors.Is(err, ErrValueTooLarge) {
+					// 对端已经回源得到确定的结果，本地再加载一次也不会不同
+					res.info.Source = SourcePeer
+					return res, err
 				}
-				log.Println("[GeeCache] Failed to get from peer", err)
+				g.Stats.PeerErrors.Add(1)
+				g.logger.Warn("[GeeCache] Failed to get from peer", "group", g.name, "err", err)
 			}
 		}
 
-		return g.getLocally(key)
-	})
+		setLoadStage(ctx, "loader")
+		start := time.Now()
+		// 替其它节点加载的 key（作为副本、对冲目标或归属节点出错时）只进热点缓存
+		hot := g.hotCache != nil && !g.owns(routeKey)
+		value, err := g.getLocally(ctx, key, hot)
+		res.info.Loader = time.Since(start)
+		res.value, res.info.Source = value, SourceLoader
+		return res, err
+	}, share)
 
+	res := viewi.(loadResult)
+	*info = res.info
+	info.Shared = shared
 	if err == nil {
-		return viewi.(ByteView), nil
+		return res.value, nil
 	}
 
 	return
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+// Remove drops key from this node's cache, and from the groups derived
+// from g. Other nodes are not affected.
+func (g *Group) Remove(key string) bool {
+	removed := g.mainCache.remove(key)
+	g.tombstones.mark(key)
+	if g.leases != nil {
+		g.leases.revoke(key) // 删除前开始的加载不能再把旧值写回
+	}
+	if g.hotCache != nil && g.hotCache.remove(key) {
+		removed = true
+	}
+	if g.pins.invalidate(key, false) {
+		removed = true
+	}
+	if g.tier != nil {
+		g.tier.Delete(key)
+	}
+	for _, d := range g.dependents.list() {
+		d.Remove(key)
+	}
+	return removed
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// Compact releases memory the cache keeps after evicting many entries,
+// e.g. after a Scheduler shrank the group. Go maps never shrink on their
+// own, so long-running nodes with bursty working sets should call it, or
+// use WithAutoCompact, once the burst is over.
+func (g *Group) Compact() {
+	g.mainCache.compact()
+}
+
+// WithEntryOverhead adds n bytes to the accounted size of every entry, so
+// that the cache budget tracks the memory actually used when values are small.
+// lru.DefaultEntryOverhead is a reasonable estimate.
+func WithEntryOverhead(n int64) Option {
+	return func(g *Group) {
+		g.cacheOpts.overhead = n
+	}
+}
+
+// WithSizer makes the group account sizer(key, len(value)) bytes for an
+// entry instead of the key and value lengths plus WithEntryOverhead.
+func WithSizer(sizer func(key string, valueLen int) int64) Option {
+	return func(g *Group) {
+		g.cacheOpts.sizer = sizer
+	}
+}
+
+// An EvictionPolicy selects how a group's cache picks entries to evict.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used entry.
+	EvictLRU EvictionPolicy = iota
+	// EvictSLRU is a segmented LRU, see lru.NewSLRU: entries read only once,
+	// e.g. by a scan, are evicted before those read repeatedly.
+	EvictSLRU
+	// EvictClock approximates LRU with the CLOCK algorithm, see
+	// lru.NewClock, holding the cache lock for less time on reads.
+	EvictClock
+)
+
+// WithEvictionPolicy selects the eviction policy of the group's cache.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(g *Group) {
+		g.cacheOpts.policy = p
+	}
+}
+
+// WithAutoCompact makes the group compact its cache whenever removals or
+// shrinking leave it at under a quarter of its peak entry count.
+func WithAutoCompact() Option {
+	return func(g *Group) {
+		g.cacheOpts.autoCompact = true
+	}
+}
+
+// Clear drops every entry cached by the group and the groups derived from
+// it on this node, e.g. after the origin data was reloaded in bulk. Other
+// nodes are not affected; use the admin API of each node to clear them too.
+func (g *Group) Clear() {
+	g.mainCache.clear()
+	if g.hotCache != nil {
+		g.hotCache.clear()
+	}
+	g.pins.invalidate("", true)
+	if g.tier != nil {
+		g.tier.Clear()
+	}
+	for _, d := range g.dependents.list() {
+		d.Clear()
+	}
+}
+
+// shrink evicts least recently used entries until the group uses at most
+// fraction of its cache budget.
+func (g *Group) shrink(fraction float64) {
+	g.mainCache.shrink(int64(float64(g.mainCache.cacheBytes.Load()) * fraction))
+	if g.hotCache != nil {
+		g.hotCache.shrink(int64(float64(g.hotCache.cacheBytes.Load()) * fraction))
+	}
+}
+
+// SetCacheBytes changes the group's cache budget at run time, split
+// between the main and the hot cache as WithHotCache says. Shrinking it
+// evicts least recently used entries right away; 0 removes the limit.
+func (g *Group) SetCacheBytes(n int64) {
+	mainBytes, hotBytes := g.splitBudget(n)
+	g.mainCache.resize(mainBytes)
+	if g.hotCache != nil {
+		g.hotCache.resize(hotBytes)
+	}
+}
+
+// CacheBytes returns the group's current cache budget, the hot cache's
+// included.
+func (g *Group) CacheBytes() int64 {
+	n := g.mainCache.cacheBytes.Load()
+	if g.hotCache != nil && n > 0 {
+		n += g.hotCache.cacheBytes.Load()
+	}
+	return n
+}
+
+// populateCache caches value, in the hot cache if hot is set, and returns
+// it with the expiry it was cached with.
+func (g *Group) populateCache(key string, value ByteView, hot bool) ByteView {
+	if g.pins.store(key, value) {
+		return value
+	}
+	c := g.mainCache
+	if hot {
+		c = g.hotCache
+	}
+	o := g.entryOptions(key)
+	if ttl := g.copyTTL(key); ttl > 0 {
+		// 写入不会传到不归本节点所有的副本，只能靠过期
+		if expire := time.Now().Add(ttl); o.Expire.IsZero() || expire.Before(o.Expire) {
+			o.Expire = expire
+		}
+	}
+	if !o.Expire.IsZero() {
+		value.expire = o.Expire.UnixNano()
+	}
+	c.add(key, g.storedForm(value), o)
+	return value
+}
+
+// cached returns the copy of key this node holds, pinned or in one of its
+// caches, without loading it.
+func (g *Group) cached(key string) (ByteView, bool) {
+	if v, ok := g.pins.get(key); ok {
+		return v, true
+	}
+	if v, ok := g.mainCache.get(key); ok {
+		return v, true
+	}
+	if g.hotCache != nil {
+		return g.hotCache.get(key)
+	}
+	return ByteView{}, false
+}
+
+// peek answers a peek request from a peer with the copy of key this node
+// holds.
+func (g *Group) peek(key string) (ByteView, error) {
+	v, ok := g.cached(key)
+	if !ok {
+		return ByteView{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	g.Stats.CacheHits.Add(1)
+	return v, nil
+}
+
+// getLocally loads key, caching it in the hot cache if hot is set.
+func (g *Group) getLocally(ctx context.Context, key string, hot bool) (_ ByteView, err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.load")
+	defer func() { endSpan(span, err) }()
+	if g.chunkBytes > 0 && isChunkKey(key) {
+		// 分块只在整个值写入时存放，被淘汰后无法单独加载，读取方会重新加载整个值
+		return ByteView{}, fmt.Errorf("%w: chunk %q evicted", ErrNotFound, key)
+	}
+	if g.loadLimit != nil {
+		stale, ok, err := g.limitLoad(ctx, key)
+		if ok {
+			span.SetAttribute("geecache.stale", true)
+			return stale, nil
+		}
+		if err != nil {
+			return ByteView{}, err
+		}
+		defer g.loadLimit.release()
+	}
+	bypass := bypassOf(ctx)
+	var lease uint64
+	if g.leases != nil && !hot && bypass != bypassSkip {
+		// 本节点的加载也要持有租约，加载期间 key 被删除或写入时不缓存结果
+		if lease = g.versions.next(); !g.leases.grant(key, lease) {
+			lease = 0
+		}
+	}
+	var bytes []byte
+	var flags uint32
+	if g.store != nil {
+		var loaded ByteView
+		loaded, err = g.loadFromStore(ctx, key)
+		bytes, flags = loaded.b, loaded.flags
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
 		return ByteView{}, err
 
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
-	return value, nil
+	// 不缓存的值才能放进池化缓冲区，缓存中的值由缓存持有
+	value := ByteView{b: bytes, version: g.versions.next(), flags: flags}
+	if g.shouldChunk(len(bytes)) && bypass != bypassSkip {
+		manifest, err := g.storeChunks(ctx, key, value)
+		if err != nil {
+			g.Stats.LocalLoadErrs.Add(1)
+			return ByteView{}, err
+		}
+		g.Stats.LocalLoads.Add(1)
+		return g.populateCache(key, manifest, hot), nil
+	}
+	if size := int64(len(key) + len(bytes)); g.maxEntry > 0 && size > g.maxEntry {
+		if !g.passOversize {
+			g.Stats.LocalLoadErrs.Add(1)
+			return ByteView{}, fmt.Errorf("%w: %d bytes for key %q", ErrValueTooLarge, size, key)
+		}
+		g.Stats.LocalLoads.Add(1)
+		return g.pooledView(value), nil
+	}
+	g.Stats.LocalLoads.Add(1)
+	if bypass == bypassSkip {
+		return g.pooledView(value), nil
+	}
+	if g.leases != nil && !hot && !g.leases.redeem(key, lease) {
+		g.Stats.LeasesRejected.Add(1)
+		return g.pooledView(value), nil
+	}
+	value.b = cloneBytes(bytes)
+	return g.populateCache(key, value, hot), nil
 }
 
 // 实现了 PeerGetter 接口的 httpGetter 从访问远程节点，获取缓存值
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key, routeKey string, peek bool) (_ ByteView, err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.getFromPeer")
+	defer func() { endSpan(span, err) }()
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
+		Peek:  peek,
+	}
+	if routeKey != key {
+		// 让对端按同样的路由键判断归属，否则它会按 key 再次转发
+		req.Affinity = routeKey
+	}
+	setBypass(req, bypassOf(ctx))
+	var cached ByteView
+	if g.hotCache != nil && bypassOf(ctx) == bypassNone {
+		if v, ok := g.hotCache.stale(key); ok {
+			cached, req.IfNoneMatch = v, contentTag(v)
+		}
+	}
+	res := responsePool.Get().(*pb.Response)
+	defer func() {
+		res.Reset() // 值已经交给 ByteView，不能随 res 被复用
+		responsePool.Put(res)
+	}()
+	var buf *pooledBuffer
+	if ag, ok := peer.(appendingPeerGetter); ok && g.pooledBuffers {
+		buf = newPooledBuffer()
+		err = ag.getAppend(ctx, req, res, buf.b)
+	} else {
+		err = peer.Get(ctx, req, res) // Get实现对应接口的函数在http中
 	}
-	res := &pb.Response{}
-	err := peer.Get(req, res) // Get实现对应接口的函数在http中
 	if err != nil {
+		if buf != nil {
+			buf.release()
+		}
+		if errors.Is(err, ErrCorrupted) {
+			g.Stats.Corrupted.Add(1)
+		}
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	if res.NotModified {
+		if buf != nil {
+			buf.release()
+		}
+		return g.revalidated(key, cached, res), nil
+	}
+	view := ByteView{b: res.Value, version: res.Version, expire: res.ExpiresMs * int64(time.Millisecond), flags: res.Flags}
+	if buf != nil {
+		// 缓冲区不够大时值读入了新的数组，改由缓冲区持有它
+		buf.b, view.buf = res.Value, buf
+	}
+	return view, nil
 }
+
+// responsePool recycles the responses getFromPeer decodes into.
+var responsePool = sync.Pool{New: func() interface{} { return new(pb.Response) }}
@@ -1,10 +1,22 @@
 package geecache
 
 import (
+	pb "GeeCache/geecache/geecachepb"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestGetter(t *testing.T) {
@@ -25,7 +37,7 @@ var db = map[string]string{
 
 func TestGet(t *testing.T) {
 	loadCounts := make(map[string]int, len(db))
-	gee := NewGroup("scores", 2<<10, GetterFunc(
+	gee := NewGroup("scores", GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
@@ -36,7 +48,7 @@ func TestGet(t *testing.T) {
 				return []byte(v), nil
 			}
 			return nil, fmt.Errorf("%s not exist", key)
-		}))
+		}), WithCacheBytes(2<<10))
 
 	for k, v := range db {
 		if view, err := gee.Get(k); err != nil || view.String() != v {
@@ -54,3 +66,1163 @@ func TestGet(t *testing.T) {
 	//	t.Fatalf(err.Error())
 	//}
 }
+
+// recordingPicker records the routing keys it is asked about and never
+// picks a remote peer.
+type recordingPicker struct {
+	routed []string
+}
+
+func (p *recordingPicker) PickPeer(key string) (PeerGetter, bool) {
+	p.routed = append(p.routed, key)
+	return nil, false
+}
+
+func TestAffinity(t *testing.T) {
+	picker := &recordingPicker{}
+	g := NewGroup("affinity", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10), WithAffinityResolver(func(key string) string {
+		if i := strings.LastIndex(key, ":"); i > 0 {
+			return key[:i]
+		}
+		return ""
+	}))
+	g.RegisterPeers(picker)
+
+	g.Get("session-1:cart")
+	g.Get("plain")
+	g.Get("session-2:cart", WithAffinity("tenant-9"))
+
+	except := []string{"session-1", "plain", "tenant-9"}
+	if !reflect.DeepEqual(picker.routed, except) {
+		t.Fatalf("routed by %v, expect %v", picker.routed, except)
+	}
+}
+
+func TestStdLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), LevelWarn)
+	logger.Info("hidden", "k", 1)
+	logger.Warn("shown", "group", "scores", "err", "boom")
+	if got, want := buf.String(), "WARN shown group=scores err=boom\n"; got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+}
+
+func TestCompactIdle(t *testing.T) {
+	value := strings.Repeat("geecache ", 100)
+	c := &cache{cacheBytes: 10 << 10}
+	c.add("k", ByteView{b: []byte(value)})
+	c.add("small", ByteView{b: []byte("tiny")})
+
+	if n := c.compactIdle(0); n != 1 {
+		t.Fatalf("compressed %d entries, want 1", n)
+	}
+	if used := c.lru.Bytes(); used >= int64(len(value)) {
+		t.Fatalf("cache still uses %d bytes after compression", used)
+	}
+	if v, ok := c.get("k"); !ok || v.String() != value {
+		t.Fatalf("compressed value did not round-trip")
+	}
+	if v, ok := c.get("small"); !ok || v.String() != "tiny" {
+		t.Fatalf("small value changed")
+	}
+}
+
+// peerFunc is a PeerPicker whose only peer answers with fn.
+type peerFunc func(ctx context.Context, in *pb.Request, out *pb.Response) error
+
+func (f peerFunc) PickPeer(string) (PeerGetter, bool) { return f, true }
+func (f peerFunc) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return f(ctx, in, out)
+}
+
+func TestLoadInfo(t *testing.T) {
+	g := NewGroup("attributed", GetterFunc(func(key string) ([]byte, error) {
+		time.Sleep(5 * time.Millisecond)
+		return []byte("from-db"), nil
+	}), WithCacheBytes(2<<10))
+	g.RegisterPeers(peerFunc(func(_ context.Context, in *pb.Request, out *pb.Response) error {
+		if in.Key == "remote" {
+			out.Value = []byte("from-peer")
+			return nil
+		}
+		return fmt.Errorf("peer down")
+	}))
+
+	var info LoadInfo
+	g.Get("remote", WithLoadInfo(&info))
+	if info.Source != SourcePeer || info.Bytes != len("from-peer") || info.Loader != 0 {
+		t.Fatalf("remote: unexpected %+v", info)
+	}
+
+	g.Get("local", WithLoadInfo(&info))
+	if info.Source != SourceLoader || info.Loader < 5*time.Millisecond || info.Total < info.Loader {
+		t.Fatalf("local: unexpected %+v", info)
+	}
+
+	g.Get("local", WithLoadInfo(&info))
+	if info.Source != SourceCache || info.Loader != 0 || info.Bytes != len("from-db") {
+		t.Fatalf("cached: unexpected %+v", info)
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	g := NewGroup("sharded", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(0), WithShards(4), WithShardTuning(8))
+	for i := 0; i < 100; i++ {
+		g.Get(strconv.Itoa(i))
+	}
+	st := g.ShardStats()
+	if len(st.Shards) != 4 || g.CacheStats().Items != 100 {
+		t.Fatalf("unexpected layout %+v", st)
+	}
+
+	// 模拟第一个分片上的锁竞争
+	hot := g.mainCache.shards()[0]
+	hot.mu.Lock()
+	hot.nlock += 2 * minShardLocks
+	hot.ncontended += minShardLocks
+	hot.mu.Unlock()
+	if st := g.ShardStats(); st.Recommended != 5 {
+		t.Fatalf("recommended %d shards, want 5", st.Recommended)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			g.Get(strconv.Itoa(i % 100))
+		}
+	}()
+	if n := g.mainCache.tune(); n != 1 {
+		t.Fatalf("split %d shards, want 1", n)
+	}
+	wg.Wait()
+
+	if n := len(g.mainCache.shards()); n != 5 {
+		t.Fatalf("%d shards after tuning, want 5", n)
+	}
+	loads := g.Stats.LocalLoads.Get()
+	for i := 0; i < 100; i++ {
+		g.Get(strconv.Itoa(i))
+	}
+	if g.Stats.LocalLoads.Get() != loads || g.CacheStats().Items != 100 {
+		t.Fatalf("entries lost by split: %d loads, %+v", g.Stats.LocalLoads.Get()-loads, g.CacheStats())
+	}
+
+	// 与拆分同时进行的前缀删除不能漏掉搬到新分片的条目：
+	// 删除停在第一个分片上时拆分最后一个分片
+	for i := 0; i < 100; i++ {
+		g.Get("p:" + strconv.Itoa(i))
+	}
+	shards := g.mainCache.shards()
+	first, last := shards[0], shards[len(shards)-1]
+	first.mu.Lock()
+	removed := make(chan struct{})
+	go func() {
+		g.RemovePrefix("p:")
+		close(removed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	split := make(chan struct{})
+	go func() {
+		g.mainCache.split(last)
+		close(split)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	first.mu.Unlock()
+	<-removed
+	<-split
+	if n := g.PrefixStats("p:").Items; n != 0 {
+		t.Fatalf("%d keys left after a prefix delete during a split", n)
+	}
+}
+
+// sampleRecorder is a SampleExporter keeping every sample.
+type sampleRecorder struct {
+	mu      sync.Mutex
+	samples []AccessSample
+}
+
+func (r *sampleRecorder) Export(s AccessSample) {
+	r.mu.Lock()
+	r.samples = append(r.samples, s)
+	r.mu.Unlock()
+}
+
+func TestAccessSampling(t *testing.T) {
+	rec := &sampleRecorder{}
+	g := NewGroup("sampled", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(0), WithAccessSampling(0.25, rec))
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 400; i++ {
+			g.Get(strconv.Itoa(i))
+		}
+	}
+	// 按 key 采样：被选中的 key 的两次访问都应被记录，一次未命中一次命中
+	seen := make(map[uint64][]bool)
+	for _, s := range rec.samples {
+		seen[s.KeyHash] = append(seen[s.KeyHash], s.Hit)
+	}
+	if len(seen) < 60 || len(seen) > 140 {
+		t.Fatalf("sampled %d of 400 keys at rate 0.25", len(seen))
+	}
+	for h, hits := range seen {
+		if !reflect.DeepEqual(hits, []bool{false, true}) {
+			t.Fatalf("key %x: accesses %v, want a miss then a hit", h, hits)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "samples.csv")
+	f, err := NewSampleFile(name, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range rec.samples[:4] {
+		f.Export(s)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ := os.ReadFile(name + ".1")
+	current, _ := os.ReadFile(name)
+	lines := strings.Split(strings.TrimSpace(string(rotated)+string(current)), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[0], ",miss,"+strconv.Itoa(int(rec.samples[0].Size))) {
+		t.Fatalf("unexpected sample file contents %q", lines)
+	}
+}
+
+func TestTypedGroup(t *testing.T) {
+	type user struct {
+		Name  string
+		Score int
+	}
+	loads := 0
+	load := func(key string) (user, error) {
+		loads++
+		return user{Name: key, Score: len(key)}, nil
+	}
+	for _, codec := range []Codec[user]{JSONCodec[user]{}, GobCodec[user]{}} {
+		loads = 0
+		g := NewTypedGroup(fmt.Sprintf("typed-%T", codec), codec, load, WithCacheBytes(2<<10))
+		for i := 0; i < 2; i++ {
+			if u, err := g.Get("alice"); err != nil || u != (user{"alice", 5}) {
+				t.Fatalf("%T: got %+v, %v", codec, u, err)
+			}
+		}
+		if loads != 1 {
+			t.Fatalf("%T: loaded %d times", codec, loads)
+		}
+	}
+
+	pg := NewTypedGroup("typed-proto", ProtoCodec[*pb.Request]{}, func(key string) (*pb.Request, error) {
+		return &pb.Request{Group: "g", Key: key}, nil
+	}, WithCacheBytes(2<<10))
+	if req, err := pg.Get("k"); err != nil || req.GetKey() != "k" || req.GetGroup() != "g" {
+		t.Fatalf("proto: got %v, %v", req, err)
+	}
+}
+
+func TestDuplicateGroup(t *testing.T) {
+	getter := func(v string) Getter {
+		return GetterFunc(func(key string) ([]byte, error) { return []byte(v), nil })
+	}
+	first := NewGroup("duplicated", getter("first"), WithCacheBytes(2<<10))
+
+	if g := NewGroup("duplicated", getter("second"), WithCacheBytes(2<<10), WithDuplicatePolicy(ReuseGroup)); g != first {
+		t.Fatal("ReuseGroup created a new group")
+	}
+	if _, err := CreateGroup("duplicated", getter("second"), WithCacheBytes(2<<10), WithDuplicatePolicy(RejectGroup)); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("RejectGroup: err = %v", err)
+	}
+	if g, err := CreateGroup("duplicated", nil); err == nil || GetGroup("duplicated") != first {
+		t.Fatalf("nil getter: %v, %v", g, err)
+	}
+
+	replaced := NewGroup("duplicated", getter("third"), WithCacheBytes(2<<10))
+	if GetGroup("duplicated") != replaced {
+		t.Fatal("ReplaceGroup did not register the new group")
+	}
+	if v, _ := GetGroup("duplicated").Get("k"); v.String() != "third" {
+		t.Fatalf("got %q from the replaced group", v)
+	}
+	select {
+	case <-first.stop:
+	case <-time.After(time.Second):
+		t.Fatal("replaced group was not drained")
+	}
+}
+
+func TestMaxEntryBytes(t *testing.T) {
+	huge := strings.Repeat("x", 4<<10)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		if key == "huge" {
+			return []byte(huge), nil
+		}
+		return []byte("small"), nil
+	})
+
+	strict := NewGroup("max-entry", getter, WithCacheBytes(2<<10), WithMaxEntryBytes(1<<10))
+	strict.Get("a")
+	if _, err := strict.Get("huge"); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("oversize value: err = %v", err)
+	}
+
+	lenient := NewGroup("max-entry-pass", getter, WithCacheBytes(2<<10), WithMaxEntryBytes(1<<10), WithOversizePassThrough())
+	lenient.Get("a")
+	if v, err := lenient.Get("huge"); err != nil || v.Len() != len(huge) {
+		t.Fatalf("passed through value: %d bytes, %v", v.Len(), err)
+	}
+
+	// 即使没有设置上限，超过缓存预算的值也不会挤掉已有条目
+	unlimited := NewGroup("max-entry-none", getter, WithCacheBytes(2<<10))
+	unlimited.Get("a")
+	if v, err := unlimited.Get("huge"); err != nil || v.Len() != len(huge) {
+		t.Fatalf("uncapped group: %d bytes, %v", v.Len(), err)
+	}
+	for _, g := range []*Group{strict, lenient, unlimited} {
+		if st := g.CacheStats(); st.Items != 1 || st.Evictions != 0 {
+			t.Fatalf("%s: working set disturbed: %+v", g.Name(), st)
+		}
+	}
+}
+
+func TestDerivedGroup(t *testing.T) {
+	version := 1
+	images := NewGroup("images", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(fmt.Sprintf("%s-v%d", key, version)), nil
+	}), WithCacheBytes(2<<10))
+	thumbs := NewDerivedGroup("thumbnails", images, func(key string, src ByteView) ([]byte, error) {
+		return []byte("thumb:" + src.String()), nil
+	}, WithCacheBytes(2<<10))
+	tiny := NewDerivedGroup("tiny-thumbnails", thumbs, func(key string, src ByteView) ([]byte, error) {
+		return []byte("tiny:" + src.String()), nil
+	}, WithCacheBytes(2<<10))
+
+	if v, _ := tiny.Get("cat"); v.String() != "tiny:thumb:cat-v1" {
+		t.Fatalf("got %q", v)
+	}
+	version = 2
+	if v, _ := tiny.Get("cat"); v.String() != "tiny:thumb:cat-v1" {
+		t.Fatalf("cached value changed to %q", v)
+	}
+	images.Remove("cat")
+	if v, _ := tiny.Get("cat"); v.String() != "tiny:thumb:cat-v2" {
+		t.Fatalf("invalidation did not propagate, got %q", v)
+	}
+	version = 3
+	images.Clear()
+	if v, _ := thumbs.Get("cat"); v.String() != "thumb:cat-v3" {
+		t.Fatalf("flush did not propagate, got %q", v)
+	}
+
+	// 重复创建与替换不在源 group 中留下多余或过期的登记
+	derive := func(key string, src ByteView) ([]byte, error) { return src.ByteSlice(), nil }
+	NewDerivedGroup("thumbnails", images, derive, WithDuplicatePolicy(ReuseGroup))
+	if n := len(images.dependents.list()); n != 1 {
+		t.Fatalf("%d dependents after reusing the derived group, want 1", n)
+	}
+	thumbs2 := NewDerivedGroup("thumbnails", images, func(key string, src ByteView) ([]byte, error) {
+		return []byte("thumb2:" + src.String()), nil
+	}, WithCacheBytes(2<<10))
+	if deps := images.dependents.list(); len(deps) != 1 || deps[0] != thumbs2 {
+		t.Fatalf("dependents after replacing the derived group: %v", deps)
+	}
+	if deps := thumbs2.dependents.list(); len(deps) != 1 || deps[0] != tiny || tiny.source.Load() != thumbs2 {
+		t.Fatal("groups derived from a replaced group don't follow the replacement")
+	}
+	version = 4
+	images2 := NewGroup("images", images.getter, WithCacheBytes(2<<10))
+	if deps := images2.dependents.list(); len(deps) != 1 || deps[0] != thumbs2 {
+		t.Fatalf("dependents of the replaced source: %v", deps)
+	}
+	images2.Remove("cat")
+	if v, _ := tiny.Get("cat"); v.String() != "tiny:thumb2:cat-v4" {
+		t.Fatalf("got %q through the replaced groups", v)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	g := NewGroup("policies", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10),
+		WithPolicy("", Policy{TTL: time.Hour}),
+		WithPolicy("session:", Policy{Idle: time.Minute}),
+		WithPolicy("session:admin:", Policy{Idle: time.Second, Priority: 2}),
+	)
+	tests := map[string]Policy{
+		"config":            {TTL: time.Hour},
+		"session:42":        {Idle: time.Minute},
+		"session:admin:bob": {Idle: time.Second, Priority: 2},
+	}
+	for key, want := range tests {
+		if got := g.policyFor(key); got != want {
+			t.Fatalf("policyFor(%q) = %+v, want %+v", key, got, want)
+		}
+	}
+
+	g.Get("config")
+	g.Get("session:admin:bob")
+	s := g.mainCache.lockShard("config")
+	o, _ := s.lru.Options("config")
+	s.mu.Unlock()
+	if until := time.Until(o.Expire); until <= 59*time.Minute || until > time.Hour {
+		t.Fatalf("config expires in %v, want about an hour", until)
+	}
+	s = g.mainCache.lockShard("session:admin:bob")
+	o, _ = s.lru.Options("session:admin:bob")
+	s.mu.Unlock()
+	if !o.Expire.IsZero() || o.Idle != time.Second || o.Priority != 2 {
+		t.Fatalf("session:admin:bob options = %+v", o)
+	}
+}
+
+func TestAdmissionControl(t *testing.T) {
+	g := NewGroup("admission", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10), WithAdmissionControl(AdmissionControl{MaxLatency: time.Millisecond, MaxReject: 1}))
+	if _, err := g.Get("cached"); err != nil {
+		t.Fatal(err)
+	}
+	if r := g.RejectRate(); r != 0 {
+		t.Fatalf("idle group rejects %v of loads", r)
+	}
+
+	g.admission.latency.Store(int64(3 * time.Millisecond / 2))
+	if r := g.RejectRate(); r != 0.5*maxReject {
+		t.Fatalf("reject rate = %v, want %v", r, 0.5*maxReject)
+	}
+	g.admission.latency.Store(int64(time.Second))
+	if r := g.RejectRate(); r != maxReject {
+		t.Fatalf("reject rate = %v, want MaxReject clamped to %v", r, maxReject)
+	}
+	rejected := 0
+	for i := 0; i < 100; i++ {
+		if _, err := g.Get("miss" + strconv.Itoa(i)); errors.Is(err, ErrOverloaded) {
+			rejected++
+		}
+	}
+	if rejected == 0 {
+		t.Fatalf("%d of 100 loads on an overloaded group rejected", rejected)
+	}
+	if v, err := g.Get("cached"); err != nil || v.String() != "cached" {
+		t.Fatalf("cache hit rejected: %v", err)
+	}
+	if n := g.Stats.LoadsRejected.Get(); n != int64(rejected) {
+		t.Fatalf("LoadsRejected = %d, want %d", n, rejected)
+	}
+}
+
+func TestSetCacheBytes(t *testing.T) {
+	g := NewGroup("resize", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat("v", 100)), nil
+	}), WithCacheBytes(64<<10), WithShards(4))
+	for i := 0; i < 200; i++ {
+		g.Get("key" + strconv.Itoa(i))
+	}
+	g.SetCacheBytes(4 << 10)
+	if st := g.CacheStats(); st.Bytes > 4<<10 || st.Items == 0 {
+		t.Fatalf("after shrinking: %+v", st)
+	}
+	if g.CacheBytes() != 4<<10 {
+		t.Fatalf("CacheBytes = %d", g.CacheBytes())
+	}
+	g.SetCacheBytes(64 << 10)
+	for i := 0; i < 200; i++ {
+		g.Get("key" + strconv.Itoa(i))
+	}
+	if st := g.CacheStats(); st.Bytes <= 4<<10 {
+		t.Fatalf("cache did not grow back: %+v", st)
+	}
+}
+
+func TestMemoryGuard(t *testing.T) {
+	g := NewGroup("memory-guard", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(8<<10))
+	var used uint64
+	m := &MemoryGuard{Limit: 1000, Interval: time.Hour, usage: func() uint64 { return used }}
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	used = 900
+	m.check()
+	m.check()
+	if got := g.CacheBytes(); got != 8<<10*9/16 {
+		t.Fatalf("budget under pressure = %d, want %d", got, 8<<10*9/16)
+	}
+	used = 750 // 介于两个阈值之间，保持不变
+	m.check()
+	if m.Scale() != 0.5625 {
+		t.Fatalf("scale = %v, want 0.5625", m.Scale())
+	}
+	used = 100
+	m.check()
+	m.check()
+	if got := g.CacheBytes(); got != 8<<10 || m.Scale() != 1 {
+		t.Fatalf("budget after recovery = %d, scale %v", got, m.Scale())
+	}
+}
+
+func TestPin(t *testing.T) {
+	loads := make(map[string]int)
+	g := NewGroup("pins", GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		return []byte(strings.Repeat("v", 10)), nil
+	}), WithCacheBytes(64), WithPinnedBytes(30))
+	if err := g.Pin("config"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		g.Get("key" + strconv.Itoa(i))
+	}
+	if _, err := g.Get("config"); err != nil || loads["config"] != 1 {
+		t.Fatalf("pinned key loaded %d times, %v", loads["config"], err)
+	}
+	if n := g.PinnedBytes(); n != int64(len("config")+10) {
+		t.Fatalf("PinnedBytes = %d", n)
+	}
+	if err := g.Pin("too-much"); !errors.Is(err, ErrPinLimit) {
+		t.Fatalf("pin over the cap: %v", err)
+	}
+
+	g.Remove("config")
+	g.Get("config")
+	g.Get("config")
+	if loads["config"] != 2 || g.PinnedBytes() != int64(len("config")+10) {
+		t.Fatalf("invalidated pinned key: %d loads, %d bytes pinned", loads["config"], g.PinnedBytes())
+	}
+	if !g.Unpin("config") || g.PinnedBytes() != 0 {
+		t.Fatalf("unpin failed")
+	}
+}
+
+func TestDiskTier(t *testing.T) {
+	tier, err := NewDiskTier(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+	loads := 0
+	g := NewGroup("disk-tier", GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(strings.Repeat(key, 10)), nil
+	}), WithCacheBytes(256), WithDiskTier(tier))
+	for i := 0; i < 20; i++ {
+		g.Get("key" + strconv.Itoa(i))
+	}
+	if tier.Len() == 0 {
+		t.Fatalf("nothing spilled to disk")
+	}
+	v, err := g.Get("key0")
+	if err != nil || v.String() != strings.Repeat("key0", 10) {
+		t.Fatalf("key0 = %q, %v", v, err)
+	}
+	if loads != 20 || g.Stats.TierHits.Get() != 1 {
+		t.Fatalf("%d loads, %d disk hits", loads, g.Stats.TierHits.Get())
+	}
+
+	g.Remove("key1")
+	g.Get("key1")
+	if loads != 21 {
+		t.Fatalf("removed key served from disk")
+	}
+	g.Clear()
+	if tier.Len() != 0 {
+		t.Fatalf("%d entries left on disk after Clear", tier.Len())
+	}
+}
+
+func TestDiskTierSegments(t *testing.T) {
+	dir := t.TempDir()
+	tier, err := NewDiskTier(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+	for i := 0; i < 100; i++ {
+		if err := tier.Put("key"+strconv.Itoa(i), []byte("0123456789"), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, segmentPattern))
+	if len(files) > 4 {
+		t.Fatalf("%d segments on disk, want at most 4", len(files))
+	}
+	if _, _, ok, _ := tier.Take("key0"); ok {
+		t.Fatalf("entry of a dropped segment still found")
+	}
+	if v, _, ok, err := tier.Take("key99"); !ok || string(v) != "0123456789" {
+		t.Fatalf("key99 = %q, %v, %v", v, ok, err)
+	}
+	tier.Put("old", []byte("v"), time.Now().Add(-time.Second))
+	if _, _, ok, _ := tier.Take("old"); ok {
+		t.Fatalf("expired entry returned")
+	}
+
+	// 淘汰的条目在后台写盘，写入前后都能取到或删除
+	for i := 0; i < 10; i++ {
+		tier.enqueue("queued"+strconv.Itoa(i), []byte("v"), time.Time{})
+	}
+	tier.Delete("queued0")
+	tier.flush()
+	if _, _, ok, _ := tier.Take("queued0"); ok {
+		t.Fatalf("entry deleted while queued was written")
+	}
+	if v, _, ok, err := tier.Take("queued9"); !ok || string(v) != "v" {
+		t.Fatalf("queued9 = %q, %v, %v", v, ok, err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("value of " + key), nil
+	})
+	g := NewGroup("snapshot", getter, WithCacheBytes(4<<10), WithPolicy("short:", Policy{TTL: time.Nanosecond}))
+	for _, key := range []string{"a", "b", "short:c"} {
+		g.Get(key)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := g.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewGroup("snapshot-restored", getter, WithCacheBytes(4<<10))
+	if n, err := restored.LoadSnapshot(path); err != nil || n != 2 {
+		t.Fatalf("loaded %d entries, %v", n, err)
+	}
+	loads = 0
+	if v, _ := restored.Get("b"); v.String() != "value of b" || loads != 0 {
+		t.Fatalf("b = %q after %d loads", v, loads)
+	}
+
+	// 写出条目时不持有分片锁，缓存照常可用
+	var buf bytes.Buffer
+	g.writeEntries(bufio.NewWriterSize(writerFunc(func(p []byte) (int, error) {
+		g.Get("a")
+		return buf.Write(p)
+	}), 16), func(string) bool { return true })
+
+	data, _ := os.ReadFile(path)
+	data[len(snapshotMagic)+2] ^= 1
+	os.WriteFile(path, data, 0o600)
+	if _, err := restored.LoadSnapshot(path); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("corrupt snapshot: %v", err)
+	}
+}
+
+// writerFunc is an io.Writer calling itself.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// mapStore is a Store keeping values in memory.
+type mapStore struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (s *mapStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return []byte(v), nil
+}
+
+func (s *mapStore) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = string(value)
+	return nil
+}
+
+func (s *mapStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	s := &mapStore{data: map[string]string{"stored": "s"}}
+	var loads int
+	g := NewGroup("store", GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("origin"), nil
+	}), WithCacheBytes(2<<10), WithStore(s))
+	ctx := context.Background()
+
+	if v, err := g.Get("stored"); err != nil || v.String() != "s" || loads != 0 {
+		t.Fatalf("read-through: %q, %v, %d loads", v.String(), err, loads)
+	}
+	if v, err := g.Get("k"); err != nil || v.String() != "origin" || s.data["k"] != "origin" {
+		t.Fatalf("getter fallback: %q, %v, store has %q", v.String(), err, s.data["k"])
+	}
+	if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing key: %v", err)
+	}
+
+	if err := g.Set(ctx, "k", []byte("new")); err != nil || s.data["k"] != "new" {
+		t.Fatalf("write-through: %v, store has %q", err, s.data["k"])
+	}
+	if v, _ := g.Get("k"); v.String() != "new" {
+		t.Fatalf("cached %q after set", v.String())
+	}
+	if err := g.Delete(ctx, "stored"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.data["stored"]; ok {
+		t.Fatal("key still in store after Delete")
+	}
+	if v, _ := g.Get("stored"); v.String() != "origin" {
+		t.Fatalf("deleted key still cached as %q", v.String())
+	}
+}
+
+// flakyStore fails the first fails writes.
+type flakyStore struct {
+	mapStore
+	fails int
+}
+
+func (s *flakyStore) Set(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	if s.fails > 0 {
+		s.fails--
+		s.mu.Unlock()
+		return errors.New("store unavailable")
+	}
+	s.mu.Unlock()
+	return s.mapStore.Set(ctx, key, value)
+}
+
+// flagStore is a FlagStore keeping values in memory.
+type flagStore struct {
+	mapStore
+	flags map[string]uint32
+}
+
+func (s *flagStore) GetFlags(ctx context.Context, key string) ([]byte, uint32, error) {
+	v, err := s.Get(ctx, key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return v, s.flags[key], err
+}
+
+func (s *flagStore) SetFlags(ctx context.Context, key string, value []byte, flags uint32) error {
+	s.mu.Lock()
+	s.flags[key] = flags
+	s.mu.Unlock()
+	return s.Set(ctx, key, value)
+}
+
+func TestFlagStore(t *testing.T) {
+	ctx := context.Background()
+	for _, wb := range []bool{false, true} {
+		s := &flagStore{mapStore: mapStore{data: map[string]string{}}, flags: map[string]uint32{}}
+		opts := []Option{WithCacheBytes(2 << 10), WithStore(s)}
+		if wb {
+			opts = append(opts, WithWriteBehind(WriteBehind{Interval: time.Hour}))
+		}
+		g := NewGroup("flag-store", GetterFunc(func(key string) ([]byte, error) {
+			return nil, ErrNotFound
+		}), opts...)
+		if err := g.Set(ctx, "k", []byte("v"), WithFlags(7)); err != nil {
+			t.Fatal(err)
+		}
+		// 写入 store 之前，值从回写队列中读取
+		g.Remove("k")
+		if v, err := g.Get("k"); err != nil || v.Flags() != 7 {
+			t.Fatalf("write-behind %v: queued value has flags %d, %v", wb, v.Flags(), err)
+		}
+		g.FlushWrites(ctx)
+		// 被逐出后从 store 重新加载的值保留标志位
+		g.Remove("k")
+		if v, err := g.Get("k"); err != nil || v.String() != "v" || v.Flags() != 7 {
+			t.Fatalf("write-behind %v: reloaded %q with flags %d, %v", wb, v.String(), v.Flags(), err)
+		}
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	s := &flakyStore{mapStore: mapStore{data: map[string]string{}}, fails: 2}
+	g := NewGroup("write-behind", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10), WithStore(s), WithWriteBehind(WriteBehind{Interval: time.Hour, RetryDelay: time.Millisecond}))
+	ctx := context.Background()
+
+	g.Set(ctx, "a", []byte("1"))
+	g.Set(ctx, "a", []byte("2"))
+	if g.PendingWrites() != 1 {
+		t.Fatalf("%d pending writes, want 1", g.PendingWrites())
+	}
+	if _, err := s.Get(ctx, "a"); err == nil {
+		t.Fatal("value written before the flush")
+	}
+	g.Remove("a")
+	if v, err := g.Get("a"); err != nil || v.String() != "2" {
+		t.Fatalf("pending value not readable: %q, %v", v.String(), err)
+	}
+
+	if err := g.FlushWrites(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(ctx, "a"); err != nil || string(v) != "2" {
+		t.Fatalf("store has %q, %v after flush", v, err)
+	}
+	if g.Stats.StoreWriteErrs.Get() != 0 {
+		t.Fatal("write dropped although a retry succeeded")
+	}
+}
+
+// slowStore is a mapStore whose writes wait for release.
+type slowStore struct {
+	mapStore
+	started chan string
+	release chan struct{}
+}
+
+func (s *slowStore) Set(ctx context.Context, key string, value []byte) error {
+	s.started <- key
+	<-s.release
+	return s.mapStore.Set(ctx, key, value)
+}
+
+func TestWriteBehindInFlight(t *testing.T) {
+	s := &slowStore{mapStore: mapStore{data: map[string]string{}}, started: make(chan string, 1), release: make(chan struct{})}
+	g := NewGroup("write-behind-inflight", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10), WithStore(s), WithWriteBehind(WriteBehind{Interval: time.Hour}))
+	ctx := context.Background()
+
+	g.Set(ctx, "a", []byte("1"))
+	go g.FlushWrites(ctx)
+	<-s.started
+	// 正在写入的值仍然比 store 中的新
+	g.Remove("a")
+	if v, err := g.Get("a"); err != nil || v.String() != "1" {
+		t.Fatalf("value being written not readable: %q, %v", v.String(), err)
+	}
+
+	deleted := make(chan error)
+	go func() { deleted <- g.Delete(ctx, "a") }()
+	select {
+	case err := <-deleted:
+		t.Fatalf("delete finished before the write in flight: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(s.release)
+	if err := <-deleted; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.mapStore.Get(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("write in flight landed after the delete: %v", err)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var mu sync.Mutex
+	loads := 0
+	g := NewGroup("refresh-ahead", GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads++
+		return []byte(strconv.Itoa(loads)), nil
+	}), WithCacheBytes(2<<10), WithPolicy("", Policy{TTL: 200 * time.Millisecond}), WithRefreshAhead(0.5))
+	loaded := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return loads
+	}
+
+	g.Get("k")
+	g.Get("k")
+	if loaded() != 1 || g.Stats.RefreshAheads.Get() != 0 {
+		t.Fatal("fresh entry refreshed")
+	}
+	time.Sleep(120 * time.Millisecond)
+	if v, _ := g.Get("k"); v.String() != "1" {
+		t.Fatalf("got %q, want the cached value while refreshing", v.String())
+	}
+	for deadline := time.Now().Add(time.Second); loaded() < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("entry not refreshed ahead of expiry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond) // 原来的条目此时已经过期
+	if v, _ := g.Get("k"); v.String() != "2" {
+		t.Fatalf("got %q, want the refreshed value", v.String())
+	}
+	if n := g.Stats.LoadsDeduped.Get(); n != 2 {
+		t.Fatalf("%d loads through singleflight, want 2", n)
+	}
+
+	// 被替换并停止的 group 不再提前刷新
+	time.Sleep(20 * time.Millisecond) // 等上面的 Get 可能触发的刷新结束
+	g.Remove("k")
+	g.Get("k")
+	NewGroup("refresh-ahead", g.getter)
+	<-g.stop
+	base := loaded()
+	time.Sleep(120 * time.Millisecond)
+	g.Get("k")
+	time.Sleep(20 * time.Millisecond)
+	if loaded() != base {
+		t.Fatal("stopped group refreshed an entry")
+	}
+}
+
+func TestCompareAndSet(t *testing.T) {
+	g := NewGroup("cas", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}), WithCacheBytes(2<<10), WithPinnedBytes(1<<10))
+	ctx := context.Background()
+
+	v, _ := g.Get("k")
+	if v.Version() == 0 {
+		t.Fatal("loaded value has no version")
+	}
+	if err := g.CompareAndSet(ctx, "k", []byte("a"), v.Version()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CompareAndSet(ctx, "k", []byte("b"), v.Version()); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("set with a stale version: %v", err)
+	}
+	v2, _ := g.Get("k")
+	if v2.String() != "a" || v2.Version() <= v.Version() {
+		t.Fatalf("got %q version %d after %d", v2.String(), v2.Version(), v.Version())
+	}
+
+	if err := g.CompareAndSet(ctx, "new", []byte("x"), 0); err != nil {
+		t.Fatalf("creating a key: %v", err)
+	}
+	if err := g.CompareAndSet(ctx, "new", []byte("y"), 0); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("creating an existing key: %v", err)
+	}
+
+	if err := g.Pin("k"); err != nil {
+		t.Fatal(err)
+	}
+	g.Set(ctx, "k", []byte("pinned"))
+	v3, _ := g.Get("k")
+	if v3.String() != "pinned" {
+		t.Fatalf("pinned key not updated by Set: %q", v3.String())
+	}
+	if err := g.CompareAndSet(ctx, "k", []byte("c"), v3.Version()); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("k"); v.String() != "c" {
+		t.Fatalf("pinned key = %q after CompareAndSet", v.String())
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	g := NewGroup("increment", GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "loaded":
+			return []byte("10"), nil
+		case "text":
+			return []byte("abc"), nil
+		}
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Increment(ctx, "counter", 2)
+		}()
+	}
+	wg.Wait()
+	if v, _ := g.Get("counter"); v.String() != "100" {
+		t.Fatalf("counter = %q after concurrent increments, want 100", v.String())
+	}
+	if n, err := g.Decrement(ctx, "loaded", 3); err != nil || n != 7 {
+		t.Fatalf("increment of a loaded value = %d, %v", n, err)
+	}
+	if _, err := g.Increment(ctx, "text", 1); !errors.Is(err, ErrNotNumeric) {
+		t.Fatalf("increment of text: %v", err)
+	}
+
+	// 写入 store 的顺序与在缓存中生效的顺序一致，最后写入的是最终值
+	s := &mapStore{data: map[string]string{}}
+	g = NewGroup("increment-store", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10), WithStore(s))
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Increment(ctx, "counter", 1)
+		}()
+	}
+	wg.Wait()
+	if v, _ := s.Get(ctx, "counter"); string(v) != "50" {
+		t.Fatalf("store has %q after concurrent increments, want 50", v)
+	}
+	if len(g.updateTurns.keys) != 0 {
+		t.Fatalf("%d keys left waiting for their turn", len(g.updateTurns.keys))
+	}
+}
+
+func TestAppend(t *testing.T) {
+	g := NewGroup("append", GetterFunc(func(key string) ([]byte, error) {
+		if key == "loaded" {
+			return []byte("b"), nil
+		}
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10))
+	ctx := context.Background()
+	if err := g.Append(ctx, "loaded", []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Prepend(ctx, "loaded", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("loaded"); v.String() != "abc" {
+		t.Fatalf("loaded = %q, want abc", v.String())
+	}
+	g.Append(ctx, "log", []byte("x"))
+	before := g.CacheStats().Bytes
+	for i := 0; i < 2; i++ {
+		g.Append(ctx, "log", []byte("x"))
+	}
+	if v, _ := g.Get("log"); v.String() != "xxx" {
+		t.Fatalf("log = %q, want xxx", v.String())
+	}
+	if n := g.CacheStats().Bytes - before; n != 2 {
+		t.Fatalf("appending 2 bytes grew the cache by %d bytes", n)
+	}
+	// 增长到放不进缓存的值报告失败，而不是悄悄丢掉
+	if err := g.Append(ctx, "log", make([]byte, 4<<10)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("append beyond the cache size: %v", err)
+	}
+}
+
+func TestTouchAndExpire(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroup("touch", GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10), WithPolicy("", Policy{TTL: 50 * time.Millisecond}))
+	ctx := context.Background()
+	if err := g.Touch(ctx, "k", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("touch of an uncached key: %v", err)
+	}
+	g.Get("k")
+	if err := g.Touch(ctx, "k", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := g.TTL(ctx, "k"); err != nil || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("ttl after touch = %v, %v", ttl, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	g.Get("k")
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("%d loads, touching didn't extend the lifetime", n)
+	}
+	if err := g.Expire(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	g.Get("k")
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("%d loads, expired key wasn't loaded again", n)
+	}
+
+	// 远程 key 的 TTL 通过读取询问归属节点，对端不必接受写入
+	remote := NewGroup("touch-remote", g.getter)
+	remote.RegisterPeers(peerFunc(func(_ context.Context, in *pb.Request, out *pb.Response) error {
+		if !in.Peek {
+			return fmt.Errorf("ttl read without peek")
+		}
+		if in.Key == "missing" {
+			return ErrNotFound
+		}
+		out.ExpiresMs = time.Now().Add(time.Minute).UnixMilli()
+		return nil
+	}))
+	if ttl, err := remote.TTL(ctx, "k"); err != nil || ttl <= 59*time.Second || ttl > time.Minute {
+		t.Fatalf("ttl from the owner = %v, %v", ttl, err)
+	}
+	if _, err := remote.TTL(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ttl of a key the owner doesn't have: %v", err)
+	}
+}
+
+func TestSetPolicy(t *testing.T) {
+	g := NewGroup("set-policy", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10), WithPolicy("", Policy{TTL: time.Hour}))
+	hash := LocalManifest()["set-policy"]
+	g.Get("old")
+	g.SetPolicy("", Policy{TTL: time.Minute})
+	g.Get("new")
+	ctx := context.Background()
+	if ttl, _ := g.TTL(ctx, "old"); ttl <= time.Minute {
+		t.Fatalf("ttl of an entry cached before the change = %v", ttl)
+	}
+	if ttl, _ := g.TTL(ctx, "new"); ttl > time.Minute {
+		t.Fatalf("ttl of an entry cached after the change = %v", ttl)
+	}
+	if LocalManifest()["set-policy"] == hash {
+		t.Fatalf("manifest didn't change with the policy")
+	}
+}
+
+func TestGroupOptions(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	if g := NewGroup("options-default", getter); g.CacheBytes() != DefaultCacheBytes {
+		t.Fatalf("default budget = %d, want %d", g.CacheBytes(), DefaultCacheBytes)
+	}
+	g := NewGroup("options", getter, WithCacheBytes(4<<10), WithTTL(time.Minute))
+	if g.CacheBytes() != 4<<10 {
+		t.Fatalf("budget = %d, want %d", g.CacheBytes(), 4<<10)
+	}
+	ctx := context.Background()
+	g.Get("k")
+	if ttl, err := g.TTL(ctx, "k"); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("ttl = %v, %v", ttl, err)
+	}
+}
+
+// BenchmarkGetHit measures Get of cached values from concurrent goroutines.
+func BenchmarkGetHit(b *testing.B) {
+	g := NewGroup("bench-hit", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value:" + key), nil
+	}), WithDuplicatePolicy(ReuseGroup))
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		g.Get(keys[i])
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if _, err := g.Get(keys[i%len(keys)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
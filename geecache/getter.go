@@ -0,0 +1,105 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Getter 中间件：把重试、超时、降级、埋点等与回源相关的通用逻辑从各个
+// GetterFunc 中抽出来，像 net/http 的中间件一样层层包裹
+
+// A GetterMiddleware wraps the Getter a group loads values with.
+type GetterMiddleware func(Getter) Getter
+
+// WithGetterMiddleware wraps the group's Getter with mw. The first
+// middleware given is the outermost; later WithGetterMiddleware options
+// add middleware inside the earlier ones. They apply to every origin load,
+// including the fallback of a Store.
+func WithGetterMiddleware(mw ...GetterMiddleware) Option {
+	return func(g *Group) {
+		g.getterMiddleware = append(g.getterMiddleware, mw...)
+	}
+}
+
+// chainGetter wraps getter with mw, mw[0] outermost.
+func chainGetter(getter Getter, mw []GetterMiddleware) Getter {
+	for i := len(mw) - 1; i >= 0; i-- {
+		getter = mw[i](getter)
+	}
+	return getter
+}
+
+// RetryLoads retries failed loads up to attempts times in total, waiting
+// backoff before the first retry and doubling it before each next one.
+// Missing keys, ErrNotFound, are not retried.
+func RetryLoads(attempts int, backoff time.Duration) GetterMiddleware {
+	return func(next Getter) Getter {
+		return GetterFunc(func(key string) ([]byte, error) {
+			wait := backoff
+			for i := 1; ; i++ {
+				b, err := next.Get(key)
+				if err == nil || errors.Is(err, ErrNotFound) || i >= attempts {
+					return b, err
+				}
+				time.Sleep(wait)
+				wait *= 2
+			}
+		})
+	}
+}
+
+// TimeoutLoads fails loads taking longer than d with an error wrapping
+// context.DeadlineExceeded. Getter has no way to be cancelled, so a load
+// that timed out keeps running in the background until it returns.
+func TimeoutLoads(d time.Duration) GetterMiddleware {
+	return func(next Getter) Getter {
+		return GetterFunc(func(key string) ([]byte, error) {
+			type result struct {
+				b   []byte
+				err error
+			}
+			done := make(chan result, 1) // 超时后迟到的结果直接丢弃
+			go func() {
+				b, err := next.Get(key)
+				done <- result{b, err}
+			}()
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case r := <-done:
+				return r.b, r.err
+			case <-timer.C:
+				return nil, fmt.Errorf("geecache: load of %q took over %v: %w", key, d, context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+// FallbackLoads loads keys from fallback when the wrapped Getter fails
+// with an error other than ErrNotFound, e.g. from a replica of the origin.
+func FallbackLoads(fallback Getter) GetterMiddleware {
+	return func(next Getter) Getter {
+		return GetterFunc(func(key string) ([]byte, error) {
+			b, err := next.Get(key)
+			if err == nil || errors.Is(err, ErrNotFound) {
+				return b, err
+			}
+			return fallback.Get(key)
+		})
+	}
+}
+
+// ObserveLoads calls observe after every load with its duration and
+// result, e.g. to export metrics on the origin.
+func ObserveLoads(observe func(key string, d time.Duration, err error)) GetterMiddleware {
+	return func(next Getter) Getter {
+		return GetterFunc(func(key string) ([]byte, error) {
+			start := time.Now()
+			b, err := next.Get(key)
+			observe(key, time.Since(start), err)
+			return b, err
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetterMiddleware(t *testing.T) {
+	var calls int
+	flaky := GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		switch {
+		case key == "missing":
+			return nil, ErrNotFound
+		case key == "slow":
+			time.Sleep(50 * time.Millisecond)
+		case calls < 3:
+			return nil, errors.New("origin unavailable")
+		}
+		return []byte("origin:" + key), nil
+	})
+	var order []string
+	trace := func(name string) GetterMiddleware {
+		return func(next Getter) Getter {
+			return GetterFunc(func(key string) ([]byte, error) {
+				order = append(order, name)
+				return next.Get(key)
+			})
+		}
+	}
+	var observed int
+	g := NewGroup("getter-middleware", flaky,
+		WithGetterMiddleware(trace("outer"), ObserveLoads(func(string, time.Duration, error) { observed++ })),
+		WithGetterMiddleware(trace("inner"), TimeoutLoads(10*time.Millisecond), RetryLoads(3, time.Millisecond)))
+
+	if v, err := g.Get("k"); err != nil || v.String() != "origin:k" || calls != 3 {
+		t.Fatalf("Get = %q, %v after %d calls, want a value after 3", v.String(), err, calls)
+	}
+	if strings.Join(order, ",") != "outer,inner" || observed != 1 {
+		t.Fatalf("middleware order = %v, observed %d loads", order, observed)
+	}
+	calls = 10
+	if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) || calls != 11 {
+		t.Fatalf("missing key: %v after %d calls, want ErrNotFound without retries", err, calls-10)
+	}
+	if _, err := g.Get("slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("slow load: %v, want a timeout", err)
+	}
+
+	fallback := NewGroup("getter-fallback", GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("origin unavailable")
+	}), WithGetterMiddleware(FallbackLoads(GetterFunc(func(key string) ([]byte, error) {
+		return []byte("replica:" + key), nil
+	}))))
+	if v, err := fallback.Get("k"); err != nil || v.String() != "replica:k" {
+		t.Fatalf("fallback Get = %q, %v", v.String(), err)
+	}
+}
+
+func TestSlowLoadLog(t *testing.T) {
+	var buf bytes.Buffer
+	g := NewGroup("slow-loads", GetterFunc(func(key string) ([]byte, error) {
+		if key == "secret-slow" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10), WithSlowLoadLog(10*time.Millisecond), WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	for _, key := range []string{"fast", "secret-slow"} {
+		if _, err := g.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g.Stats.SlowLoads.Get() != 1 || !strings.Contains(buf.String(), "slow load") {
+		t.Fatalf("slow loads %d, log %q", g.Stats.SlowLoads.Get(), buf.String())
+	}
+	if strings.Contains(buf.String(), "secret-slow") {
+		t.Fatalf("key logged in clear: %q", buf.String())
+	}
+	l := g.LoadLatency()
+	// 20ms 落在 (10ms, 25ms] 的桶里
+	if l.Count != 2 || l.Histogram[4] != 1 || l.Sum < 20*time.Millisecond {
+		t.Fatalf("load latency %+v", l)
+	}
+}
+
+func TestLatencyBucketsChanged(t *testing.T) {
+	saved := append([]time.Duration(nil), LatencyBuckets...)
+	defer func() { LatencyBuckets = saved }()
+	// 调用方改动导出的切片不影响分桶
+	LatencyBuckets[0] = time.Hour
+	LatencyBuckets = append(LatencyBuckets, 2*time.Hour)
+	var h latencyHistogram
+	h.observe(90 * time.Minute)
+	h.observe(time.Microsecond)
+	l := h.snapshot()
+	if len(l.Histogram) != len(latencyBounds)+1 || l.Histogram[len(latencyBounds)] != 1 || l.Histogram[0] != 1 {
+		t.Fatalf("histogram %v", l.Histogram)
+	}
+}
@@ -0,0 +1,133 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 提示移交（hinted handoff）：负责某个 key 的节点暂时不可达时，Set 的值先缓存在本节点并记下提示，
+// 之后定期重试，对端恢复后把值补发给它，短暂故障不会丢失写入的数据
+
+// WithHintedHandoff makes Set keep values whose owner can't be reached on
+// this node, up to maxHints of them, and retry sending them to the owner
+// every interval. When the hints are full, Set fails as it does without
+// this option.
+func WithHintedHandoff(maxHints int, interval time.Duration) Option {
+	return func(g *Group) {
+		g.hints = &hintQueue{max: maxHints, interval: interval, hints: make(map[string]hint)}
+	}
+}
+
+type hint struct {
+	value ByteView
+	seq   uint64 //同一个 key 再次写入后序号变化，重放期间的新值不会被误删
+}
+
+// hintQueue holds the values waiting for their owner, the latest per key.
+type hintQueue struct {
+	max      int
+	interval time.Duration
+
+	mu    sync.Mutex
+	hints map[string]hint
+	seq   uint64
+}
+
+// add records value as a hint, reporting false if q is nil or full.
+func (q *hintQueue) add(key string, value ByteView) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.hints[key]; !ok && len(q.hints) >= q.max {
+		return false
+	}
+	q.seq++
+	q.hints[key] = hint{value: value, seq: q.seq}
+	return true
+}
+
+// drop forgets the hint of key unless it was replaced since it was read.
+func (q *hintQueue) drop(key string, seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if h, ok := q.hints[key]; ok && h.seq == seq {
+		delete(q.hints, key)
+	}
+}
+
+func (q *hintQueue) snapshot() map[string]hint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	res := make(map[string]hint, len(q.hints))
+	for k, h := range q.hints {
+		res[k] = h
+	}
+	return res
+}
+
+// PendingHints returns the number of values waiting to be sent to their owner.
+func (g *Group) PendingHints() int {
+	if g.hints == nil {
+		return 0
+	}
+	g.hints.mu.Lock()
+	defer g.hints.mu.Unlock()
+	return len(g.hints.hints)
+}
+
+func (g *Group) handoffLoop() {
+	ticker := time.NewTicker(g.hints.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), g.hints.interval)
+		g.replayHints(ctx)
+		cancel()
+	}
+}
+
+// replayHints sends the pending hints to the current owners of their keys.
+// A peer that is still unreachable is not tried again for the rest of the
+// round.
+func (g *Group) replayHints(ctx context.Context) {
+	down := make(map[PeerGetter]bool)
+	for key, h := range g.hints.snapshot() {
+		if ctx.Err() != nil {
+			return
+		}
+		var peer PeerGetter
+		ok := false
+		if g.peers != nil {
+			peer, ok = g.peers.PickPeer(g.routeKey(key, ""))
+		}
+		if !ok {
+			// 环发生了变化，本节点已成为该 key 的归属节点，值已经在本地缓存中
+			g.hints.drop(key, h.seq)
+			continue
+		}
+		if down[peer] {
+			continue
+		}
+		err := g.setOnPeer(ctx, peer, &pb.SetRequest{Group: g.name, Key: key, Value: h.value.b, Flags: h.value.flags})
+		switch {
+		case err == nil:
+			g.hints.drop(key, h.seq)
+			g.Stats.HintsReplayed.Add(1)
+		case errors.Is(err, ErrPeerUnavailable):
+			down[peer] = true
+		default:
+			// 对端明确拒绝（如值过大），重试也不会成功
+			g.hints.drop(key, h.seq)
+			g.logger.Warn("[GeeCache] hint rejected by owner", "group", g.name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package geecache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 对冲请求：归属节点超过一段时间（默认取近期远程请求耗时的 p99）仍未响应时，
+// 再向环上的下一个节点询问它已有的副本，谁先返回用谁，以此削减慢节点造成的长尾延迟。
+// 下一个节点不回源也不缓存，否则不归它所有的 key 会在它那里留下无人失效的副本
+
+// Hedging configures hedged peer fetches, see WithHedging.
+type Hedging struct {
+	// Delay is how long to wait for the owner before hedging. If 0 it is
+	// the Quantile of the latency of recent fetches from peers.
+	Delay    time.Duration
+	Quantile float64       // defaults to 0.99
+	MinDelay time.Duration // lower bound of the derived delay, defaults to 1ms
+	// MinSamples is how many fetches must be measured before the delay is
+	// derived from them; until then requests aren't hedged. Defaults to 20.
+	MinSamples int
+}
+
+// WithHedging makes the group send a second request for a key to the peer
+// following its owner when the owner hasn't answered within a delay,
+// taking whichever answer arrives first. The second peer only answers with
+// a copy it already holds, e.g. in its hot cache, without loading or
+// caching the key; when it has none the group keeps waiting for the
+// owner. It requires a PeerPicker
+// implementing ReplicaPicker, such as HTTPPool; hedged requests are
+// counted in Stats.Hedges, those answered first in Stats.HedgeWins.
+func WithHedging(h Hedging) Option {
+	return func(g *Group) {
+		if h.Quantile <= 0 || h.Quantile > 1 {
+			h.Quantile = 0.99
+		}
+		if h.MinDelay <= 0 {
+			h.MinDelay = time.Millisecond
+		}
+		if h.MinSamples <= 0 {
+			h.MinSamples = 20
+		}
+		g.hedging = &hedger{cfg: h, samples: make([]time.Duration, 0, defaultLatencyWindow)}
+	}
+}
+
+// hedger tracks the latency of peer fetches to derive the hedging delay.
+type hedger struct {
+	cfg     Hedging
+	mu      sync.Mutex
+	samples []time.Duration // 近期远程请求耗时的环形缓冲
+	next    int
+	count   uint64
+	delay   time.Duration // 缓存的对冲延迟，0 表示样本不足
+}
+
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < cap(h.samples) {
+		h.samples = append(h.samples, d)
+	} else {
+		h.samples[h.next] = d
+		h.next = (h.next + 1) % len(h.samples)
+	}
+	h.count++
+	// 与自适应超时一样，每 16 个样本才重新排序计算一次
+	if h.cfg.Delay == 0 && len(h.samples) >= h.cfg.MinSamples && (h.delay == 0 || h.count%16 == 0) {
+		h.delay = max(quantiles(h.samples, h.cfg.Quantile)[0], h.cfg.MinDelay)
+	}
+}
+
+// currentDelay returns the hedging delay, 0 if requests aren't hedged yet.
+func (h *hedger) currentDelay() time.Duration {
+	if h.cfg.Delay > 0 {
+		return h.cfg.Delay
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+// fetchFromPeer gets key from peer, its owner, hedging the request when
+// the group is configured to.
+func (g *Group) fetchFromPeer(ctx context.Context, peer PeerGetter, key, routeKey string) (ByteView, error) {
+	h := g.hedging
+	if h == nil {
+		return g.getFromPeer(ctx, peer, key, routeKey, false)
+	}
+	var backup PeerGetter
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		// 归属节点是远程节点，排在第一个，下一个就是对冲的目标；
+		// 按可用区读的是下一个节点时，反过来对冲到归属节点
+		if peers := rp.PickPeers(routeKey, 2); len(peers) == 2 {
+			backup = peers[1]
+			if _, ok := peer.(replicaGetter); ok {
+				backup = peers[0]
+			}
+		}
+	}
+	delay := h.currentDelay()
+	if backup == nil || delay == 0 {
+		start := time.Now()
+		v, err := g.getFromPeer(ctx, peer, key, routeKey, false)
+		if err == nil {
+			h.observe(time.Since(start))
+		}
+		return v, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // 先返回的结果被采用后取消另一个请求
+	type result struct {
+		v     ByteView
+		err   error
+		hedge bool
+	}
+	results := make(chan result, 2)
+	start := time.Now()
+	go func() {
+		v, err := g.getFromPeer(ctx, peer, key, routeKey, false)
+		if err == nil {
+			h.observe(time.Since(start))
+		}
+		results <- result{v, err, false}
+	}()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	var ownerErr error
+	for {
+		select {
+		case <-timer.C:
+			g.Stats.Hedges.Add(1)
+			pending++
+			go func() {
+				v, err := g.getFromPeer(ctx, backup, key, routeKey, true)
+				results <- result{v, err, true}
+			}()
+		case r := <-results:
+			pending--
+			if r.err != nil && !r.hedge {
+				ownerErr = r.err
+			}
+			// 一个失败时等另一个；两个都失败时返回归属节点的错误，
+			// 下一个节点没有副本不代表 key 不存在
+			if r.err != nil && pending > 0 {
+				continue
+			}
+			if r.err == nil && r.hedge {
+				g.Stats.HedgeWins.Add(1)
+			}
+			if r.err != nil {
+				return ByteView{}, ownerErr
+			}
+			return r.v, nil
+		}
+	}
+}
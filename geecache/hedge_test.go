@@ -0,0 +1,119 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// replicaPicker picks owner for every key, followed by backup.
+type replicaPicker struct {
+	owner, backup PeerGetter
+}
+
+func (p replicaPicker) PickPeer(string) (PeerGetter, bool) { return p.owner, true }
+func (p replicaPicker) PickPeers(string, int) []PeerGetter {
+	return []PeerGetter{p.owner, p.backup}
+}
+
+func TestHedging(t *testing.T) {
+	canceled := make(chan struct{})
+	owner := peerFunc(func(ctx context.Context, in *pb.Request, out *pb.Response) error {
+		switch in.Key {
+		case "fast":
+			out.Value = []byte("owner")
+			return nil
+		case "late":
+			time.Sleep(20 * time.Millisecond)
+			out.Value = []byte("owner")
+			return nil
+		}
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	})
+	backup := peerFunc(func(ctx context.Context, in *pb.Request, out *pb.Response) error {
+		if !in.Peek {
+			t.Errorf("hedged request may load the key")
+		}
+		if in.Key == "late" {
+			return ErrNotFound // 没有副本
+		}
+		out.Value = []byte("backup")
+		return nil
+	})
+	g := NewGroup("hedging", GetterFunc(func(key string) ([]byte, error) {
+		t.Errorf("loaded %q locally", key)
+		return nil, ErrNotFound
+	}), WithHedging(Hedging{Delay: 5 * time.Millisecond}))
+	g.RegisterPeers(replicaPicker{owner, backup})
+
+	if v, err := g.Get("fast"); err != nil || v.String() != "owner" || g.Stats.Hedges.Get() != 0 {
+		t.Fatalf("fast owner: %q, %v with %d hedges", v.String(), err, g.Stats.Hedges.Get())
+	}
+	if v, err := g.Get("slow"); err != nil || v.String() != "backup" {
+		t.Fatalf("slow owner: %q, %v", v.String(), err)
+	}
+	if g.Stats.Hedges.Get() != 1 || g.Stats.HedgeWins.Get() != 1 {
+		t.Fatalf("hedges = %d, wins = %d", g.Stats.Hedges.Get(), g.Stats.HedgeWins.Get())
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("request to the owner wasn't canceled")
+	}
+	// 下一个节点没有副本时继续等归属节点
+	if v, err := g.Get("late"); err != nil || v.String() != "owner" {
+		t.Fatalf("backup without a copy: %q, %v", v.String(), err)
+	}
+}
+
+func TestHedgingDelay(t *testing.T) {
+	h := &hedger{cfg: Hedging{Quantile: 0.5, MinDelay: time.Millisecond, MinSamples: 3}, samples: make([]time.Duration, 0, 8)}
+	h.observe(10 * time.Millisecond)
+	if d := h.currentDelay(); d != 0 {
+		t.Fatalf("delay with too few samples = %v", d)
+	}
+	h.observe(20 * time.Millisecond)
+	h.observe(30 * time.Millisecond)
+	if d := h.currentDelay(); d != 20*time.Millisecond {
+		t.Fatalf("delay = %v, want the median 20ms", d)
+	}
+}
+
+func TestPickPeers(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set("http://a", "http://b", "http://c")
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		peers := pool.PickPeers(key, 2)
+		owner, remote := pool.PickPeer(key)
+		if len(peers) != 2 || peers[0] == peers[1] {
+			t.Fatalf("PickPeers(%s) = %v", key, peers)
+		}
+		if remote && peers[0] != owner {
+			t.Fatalf("PickPeers(%s) doesn't start with the owner", key)
+		}
+	}
+
+	// peek 请求只用收到的节点已有的副本应答，既不加载也不转发给归属节点
+	g := NewGroup("hedge-peek", GetterFunc(func(key string) ([]byte, error) {
+		t.Errorf("peek loaded %q", key)
+		return []byte("loaded here"), nil
+	}))
+	for key := "k"; ; key += "k" {
+		if _, remote := pool.PickPeer(key); !remote {
+			continue
+		}
+		req := httptest.NewRequest(http.MethodGet, "/_geecache/hedge-peek/"+key, nil)
+		req.Header.Set(peekHeader, "1")
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound || g.CacheStats().Items != 0 {
+			t.Fatalf("peek without a copy: %d %s, %d items cached", rec.Code, rec.Body, g.CacheStats().Items)
+		}
+		break
+	}
+}
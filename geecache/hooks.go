@@ -0,0 +1,46 @@
+package geecache
+
+import "GeeCache/geecache/lru"
+
+// 生命周期钩子：条目加入、命中、未命中和过期时通知使用者，便于实现审计日志、
+// 二级索引或自定义指标，而不必修改本包
+
+// Hooks are called as the entries of a group's cache go through their
+// lifecycle; any of them may be nil. They run with the lock of the key's
+// shard held, so they must return quickly and must not use the group;
+// hand slow work to a goroutine, or use WithEvictionHandler for entries
+// leaving the cache. Copies kept by WithHotCache are not reported.
+type Hooks struct {
+	OnAdded   func(key string, value ByteView) // value cached, new or replacing another
+	OnHit     func(key string)
+	OnMiss    func(key string)
+	OnExpired func(key string) // found expired by a lookup, which then misses
+}
+
+// WithHooks sets the lifecycle hooks of the group's cache.
+func WithHooks(h Hooks) Option {
+	return func(g *Group) {
+		g.cacheOpts.hooks = &h
+	}
+}
+
+// setHooks connects the hooks of c to its lru, skipping the entries the
+// shard moves around itself.
+func (c *cache) setHooks(h *Hooks) {
+	if h.OnAdded != nil {
+		c.lru.OnAdded = func(key string, v lru.Value) {
+			if view, ok := viewOf(v); ok && !c.internal {
+				h.OnAdded(key, view)
+			}
+		}
+	}
+	if h.OnHit != nil {
+		c.lru.OnHit = func(key string, _ lru.Value) { h.OnHit(key) }
+	}
+	if h.OnMiss != nil {
+		c.lru.OnMiss = h.OnMiss
+	}
+	if h.OnExpired != nil {
+		c.lru.OnExpired = func(key string, _ lru.Value) { h.OnExpired(key) }
+	}
+}
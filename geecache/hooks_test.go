@@ -0,0 +1,41 @@
+package geecache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	count := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[event]++
+	}
+	g := NewGroup("hooks", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v:" + key), nil
+	}), WithCacheBytes(2<<10), WithHooks(Hooks{
+		OnAdded: func(key string, value ByteView) {
+			if value.String() == "v:"+key {
+				count("added")
+			}
+		},
+		OnHit:     func(string) { count("hit") },
+		OnMiss:    func(string) { count("miss") },
+		OnExpired: func(string) { count("expired") },
+	}), WithPolicy("short", Policy{TTL: time.Millisecond}))
+
+	g.Get("a")
+	g.Get("a")
+	g.Get("short")
+	time.Sleep(5 * time.Millisecond)
+	g.Get("short")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if counts["added"] != 3 || counts["hit"] != 1 || counts["miss"] != 3 || counts["expired"] != 1 {
+		t.Fatalf("hook calls %v", counts)
+	}
+}
@@ -0,0 +1,71 @@
+package geecache
+
+import "math/rand"
+
+// 热点缓存：与 groupcache 一样，本节点负责的 key 存在 mainCache，其它节点负责的
+// key 的副本存在 hotCache。两者预算独立，远程 key 的副本再多也挤不掉本节点负责的数据
+
+// hotPopulateOdds is the inverse of the chance a value fetched from a peer
+// is copied into the hot cache, so only keys read often end up there.
+const hotPopulateOdds = 10
+
+// WithHotCache gives ratio, between 0 and 1, of the group's cache budget
+// to a hot cache of values owned by peers: one in ten values fetched from
+// a peer, and values this node loads for keys it doesn't own, e.g. as a
+// zone replica or when the owner fails. The rest of the budget holds the
+// keys this node owns, which hot copies can no longer evict. Copies are
+// dropped by Remove and Clear on this node but not when the owner's value
+// changes, so they should be bounded by a TTL. Expired copies stay until
+// evicted: the next fetch sends the owner their content tag, and the owner
+// doesn't send the value again if it is unchanged. HotCacheStats reports
+// on the hot cache.
+func WithHotCache(ratio float64) Option {
+	return func(g *Group) {
+		g.hotRatio = min(max(ratio, 0), 0.9)
+	}
+}
+
+// splitBudget splits a cache budget between the main and the hot cache.
+func (g *Group) splitBudget(total int64) (main, hot int64) {
+	if g.hotRatio == 0 || total == 0 {
+		return total, total // 不限制时两者都不限制
+	}
+	hot = max(int64(float64(total)*g.hotRatio), 1)
+	return max(total-hot, 1), hot
+}
+
+// hotCacheOptions are the cache options of the hot cache: copies are
+// never spilled to the disk tier, and expired ones are kept for
+// revalidation with the owner, see getFromPeer.
+func (g *Group) hotCacheOptions() cacheOptions {
+	o := g.cacheOpts
+	o.spill, o.onEvict, o.hooks = nil, nil, nil
+	o.keepExpired = true
+	return o
+}
+
+// owns reports whether this node owns routeKey.
+func (g *Group) owns(routeKey string) bool {
+	if g.peers == nil {
+		return true
+	}
+	_, remote := g.peers.PickPeer(routeKey)
+	return !remote
+}
+
+// maybePopulateHot copies a value fetched from a peer into the hot cache
+// once in hotPopulateOdds times.
+func (g *Group) maybePopulateHot(key string, value ByteView) {
+	if g.hotCache != nil && rand.Intn(hotPopulateOdds) == 0 {
+		g.populateCache(key, value, true)
+	}
+}
+
+// HotCacheStats returns stats about the group's hot cache, all zero
+// without WithHotCache.
+func (g *Group) HotCacheStats() CacheStats {
+	if g.hotCache == nil {
+		return CacheStats{}
+	}
+	return g.hotCache.stats()
+}
@@ -0,0 +1,124 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	pb "GeeCache/geecache/geecachepb"
+)
+
+// ownedPicker owns the keys prefixed "own:" and sends the others to peer.
+type ownedPicker struct {
+	peer peerFunc
+}
+
+func (p ownedPicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "own:") {
+		return nil, false
+	}
+	return p.peer, true
+}
+
+func TestHotCache(t *testing.T) {
+	g := NewGroup("hot-cache", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat("v", 40)), nil
+	}), WithCacheBytes(1000), WithHotCache(0.25))
+	g.RegisterPeers(ownedPicker{peerFunc(func(context.Context, *pb.Request, *pb.Response) error {
+		return errors.New("peer down")
+	})})
+	if n := g.CacheBytes(); n != 1000 {
+		t.Fatalf("CacheBytes() = %d, want the whole budget", n)
+	}
+
+	for i := 0; i < 10; i++ {
+		g.Get("own:" + strconv.Itoa(i))
+	}
+	// 归属节点出错时本地加载的远程 key 只占用热点缓存，不会挤掉本节点的 key
+	for i := 0; i < 50; i++ {
+		g.Get("remote:" + strconv.Itoa(i))
+	}
+	if st := g.CacheStats(); st.Items != 10 || st.Evictions != 0 {
+		t.Fatalf("main cache: %+v", st)
+	}
+	hot := g.HotCacheStats()
+	if hot.Items == 0 || hot.Bytes > 250 || hot.Evictions == 0 {
+		t.Fatalf("hot cache: %+v", hot)
+	}
+
+	loads := g.Stats.LocalLoads.Get()
+	g.Get("remote:49")
+	if g.Stats.LocalLoads.Get() != loads {
+		t.Fatal("hot copy not served")
+	}
+	if !g.Remove("remote:49") || g.HotCacheStats().Items != hot.Items-1 {
+		t.Fatal("Remove kept the hot copy")
+	}
+
+	g.SetCacheBytes(400)
+	if n := g.CacheBytes(); n != 400 {
+		t.Fatalf("CacheBytes() = %d after SetCacheBytes(400)", n)
+	}
+	if hot := g.HotCacheStats(); hot.Bytes > 100 {
+		t.Fatalf("hot cache uses %d bytes of its 100", hot.Bytes)
+	}
+}
+
+func TestHotCacheRevalidation(t *testing.T) {
+	doc := strings.Repeat("d", 10<<10)
+	// 两个 group 配置相同，配置摘要才一致
+	opts := []Option{WithHotCache(0.5), WithPolicy("", Policy{TTL: 20 * time.Millisecond})}
+	owner := NewGroup("revalidate", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(doc), nil
+	}), opts...)
+	var wire int64
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rec := &statusRecorder{ResponseWriter: w}
+				next.ServeHTTP(rec, r)
+				wire = rec.bytes
+			})
+		},
+	}}))
+	defer srv.Close()
+
+	// 以另一个名字创建再改名，让两个 group 在同一进程中扮演两个节点
+	g := NewGroup("revalidate-client", GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("loaded locally")
+	}), opts...)
+	g.name = "revalidate"
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	g.RegisterPeers(ownedPicker{peerFunc(getter.Get)})
+	for i := 0; g.HotCacheStats().Items == 0; i++ {
+		if v, err := g.Get("doc"); err != nil || v.String() != doc || i > 1000 {
+			t.Fatalf("get: %d bytes, %v", v.Len(), err)
+		}
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if v, err := g.Get("doc"); err != nil || v.String() != doc {
+		t.Fatalf("revalidated get: %d bytes, %v", v.Len(), err)
+	}
+	if n := g.Stats.PeerNotModified.Get(); n != 1 || wire != 0 {
+		t.Fatalf("%d not modified responses, %d bytes sent", n, wire)
+	}
+	hits := g.Stats.CacheHits.Get()
+	if v, _ := g.Get("doc"); v.String() != doc || g.Stats.CacheHits.Get() != hits+1 {
+		t.Fatal("revalidated copy not cached again")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	owner.Set(context.Background(), "doc", []byte("changed"))
+	if v, err := g.Get("doc"); err != nil || v.String() != "changed" {
+		t.Fatalf("get after change = %q, %v", v.String(), err)
+	}
+	if n := g.Stats.PeerNotModified.Get(); n != 1 {
+		t.Fatalf("changed value reported as not modified")
+	}
+}
@@ -3,14 +3,23 @@ package geecache
 import (
 	"GeeCache/geecache/consistenthash"
 	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/ratelimit"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"google.golang.org/protobuf/proto"
+	"hash/crc32"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 提供被其他节点访问的能力(基于http)
@@ -18,6 +27,34 @@ import (
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+
+	// affinityHeader carries pb.Request.Affinity between peers.
+	affinityHeader = "X-Geecache-Affinity"
+
+	// streamContentType marks responses carrying the raw value instead of
+	// an encoded pb.Response. Peers ask for it in the Accept header.
+	streamContentType = "application/x-geecache-value"
+
+	// versionHeader carries pb.Response.Version with streamed values.
+	versionHeader = "X-Geecache-Version"
+	// expiresHeader and flagsHeader carry pb.Response.ExpiresMs and
+	// pb.Response.Flags with streamed values, if not 0.
+	expiresHeader = "X-Geecache-Expires"
+	flagsHeader   = "X-Geecache-Flags"
+
+	// localHeader carries pb.Request.Local.
+	localHeader = "X-Geecache-Local"
+	// leaseHeader carries pb.Request.Lease.
+	leaseHeader = "X-Geecache-Lease"
+	// prefixHeader carries pb.Request.Prefix on deletes.
+	prefixHeader = "X-Geecache-Prefix"
+	// wholeHeader carries pb.Request.Whole.
+	wholeHeader = "X-Geecache-Whole"
+	// peekHeader carries pb.Request.Peek.
+	peekHeader = "X-Geecache-Peek"
+	// bypassHeader carries pb.Request.SkipCache as "skip" and
+	// pb.Request.ForceRefresh as "refresh".
+	bypassHeader = "X-Geecache-Bypass"
 )
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
@@ -26,127 +63,802 @@ type HTTPPool struct {
 	self        string                 //记录自己的地址，包括主机名/IP 和端口
 	basePath    string                 //作为节点间通讯地址的前缀
 	mu          sync.Mutex             //guards peers and httpGetters
-	peers       *consistenthash.Map    //用来根据具体的 key 选择节点
+	peers       consistenthash.Ring    //用来根据具体的 key 选择节点，Set 整个替换，从不原地修改
 	httpGetters map[string]*httpGetter //keyed by e.g. "http://10.0.0.2:8008", 映射远程节点与对应的httpGetter
+	opts        HTTPPoolOptions
+	client      *http.Client //访问远程节点使用的客户端
+
+	backgroundBucket *ratelimit.Bucket                  //所有后台流量共享的带宽
+	classBuckets     map[TrafficClass]*ratelimit.Bucket //各类后台流量各自的带宽上限
+	limits           atomic.Pointer[requestLimits]      //请求限流，可由 SetRateLimit 替换
+	peerStats        map[string]*peerStats              //每个远程节点的请求统计，Set 时保留
+	unixClients      map[string]*http.Client            //经 unix socket 访问的节点各自的客户端，Set 时保留
+	selves           map[string]bool                    //self 与 Aliases 规范化后的地址
+	divergent        map[string]bool                    //与其它节点配置不一致而拒绝服务的 group，由 mu 保护
+	zones            map[string]string                  //各节点所在的可用区，由 mu 保护
+	migrating        sync.Mutex                         //同一时间只进行一次迁移
+
+	middleware []Middleware
+	handler    http.Handler //middleware 包裹后的 serve
+}
+
+// HTTPPoolOptions are the configurations of a HTTPPool.
+type HTTPPoolOptions struct {
+	// AuthToken is the shared secret every peer must present as
+	// "Authorization: Bearer <token>". httpGetter attaches it automatically.
+	// If blank, requests are not authenticated.
+	AuthToken string
+
+	// TLS, if non-nil, supplies the credentials used when dialing https://
+	// peers. Serve the pool with TLS.ServerConfig() so that both sides pick
+	// up rotated certificates without a restart.
+	TLS *CertReloader
+
+	// Transport, if non-nil, carries the requests to peers instead of
+	// HTTP/1.1 or HTTP/2 over TCP, e.g. the HTTP/3 transport of package
+	// http3peer. It must present the credentials of TLS itself.
+	Transport http.RoundTripper
+
+	// ACL, if non-nil, restricts which client identities may read and
+	// write each group. Peers presenting AuthToken bypass it. When AuthToken is also
+	// set, tokens not mentioned by the ACL are rejected as unauthenticated.
+	ACL ACL
+
+	// PeerAuth and AdminAuth, if non-nil, replace the policies built from
+	// AuthToken, AdminToken and ACL for peer requests and the admin API.
+	PeerAuth  Authorizer
+	AdminAuth Authorizer
+
+	// BackgroundBandwidth caps the bytes per second shared by all
+	// background traffic (rebalancing, warm-sync, replication, backup).
+	// Zero means unlimited.
+	BackgroundBandwidth int64
+
+	// ClassBandwidth optionally caps individual traffic classes on top of
+	// BackgroundBandwidth, in bytes per second.
+	ClassBandwidth map[TrafficClass]int64
+
+	// RateLimit, if non-nil, throttles incoming requests. Requests over
+	// the limit are answered with 429 Too Many Requests.
+	RateLimit *RateLimit
+
+	// PeerTimeout, if non-nil, bounds requests to each peer with a timeout
+	// adapted to that peer's observed latency. Without it requests to peers
+	// have no timeout.
+	PeerTimeout *AdaptiveTimeout
+	// SlowPeerThreshold, if positive, logs a warning when the p99 latency
+	// of requests to a peer exceeds it, and again once it recovers, see
+	// PeerStats.
+	SlowPeerThreshold time.Duration
+
+	// Middleware wraps request handling, outermost first. If nil, the pool
+	// logs every request with AccessLog(slog.Default()).
+	Middleware []Middleware
+
+	// Logger receives the pool's diagnostics. Defaults to the standard logger.
+	Logger Logger
+
+	// AdminToken is the bearer token granting access to the admin API
+	// below /_geecache/admin/. Admin rules of ACL are honoured as well.
+	// With neither configured the admin API refuses every request.
+	AdminToken string
+
+	// EnableDebug mounts expvar-style /debug/vars and pprof profiles below
+	// /_geecache/admin/debug/, behind the admin authorization.
+	EnableDebug bool
+
+	// MaxResponseBytes caps the size of values accepted from peers; larger
+	// ones fail with ErrValueTooLarge. Zero means unlimited.
+	MaxResponseBytes int64
+
+	// CompressResponses, if positive, compresses the values of at least
+	// this many bytes sent to peers that accept it, also for groups
+	// without WithCompression. The encoding is negotiated with
+	// Accept-Encoding; zstd and gzip are offered.
+	CompressResponses int
+
+	// Fallback, if non-nil, serves requests outside /_geecache/, e.g. the
+	// application's own API when it shares the listener with the pool.
+	// Without it such requests are answered with 404 Not Found.
+	Fallback http.Handler
+
+	// Aliases are further addresses this node is known by in peer lists,
+	// e.g. its IP when self uses a host name, or its IPv6 address on a
+	// dual-stack host. PickPeer never picks any of them as a remote peer.
+	Aliases []string
+
+	// RefuseDivergent makes CheckManifests stop serving groups to peers
+	// when they are configured differently on any of them, instead of only
+	// logging a warning. Peers then load those groups on their own.
+	RefuseDivergent bool
+
+	// Zone is the zone, e.g. availability zone or rack, of this node. With
+	// the zones of the peers given to SetZones, reads of a key go to one
+	// of the first ZoneReplicas nodes on the ring from its owner that is
+	// in Zone, if any; ZoneReplicas defaults to 2. Ownership, and thus
+	// writes, are unaffected. Writes don't reach the copies replicas load
+	// for such reads, so with a Zone those copies, and any other copy of a
+	// key a node loads without owning it, expire after at most
+	// ZoneReplicaTTL, 1 minute if 0.
+	Zone           string
+	ZoneReplicas   int
+	ZoneReplicaTTL time.Duration
+
+	// NewRing creates the ring mapping keys to peers, by default
+	// consistenthash.New with 50 virtual nodes per peer. Every node must
+	// use the same kind; with consistenthash.NewJump they must also list
+	// the peers in the same order. consistenthash.NewRendezvous spreads
+	// keys evenly over few peers.
+	NewRing func() consistenthash.Ring
+	// Hash places keys and peers on the default ring, consistenthash.CRC32
+	// if nil. consistenthash.XXHash64 and consistenthash.Murmur3 spread
+	// the virtual nodes more evenly.
+	Hash consistenthash.Hash
+	// MigrateOnChange makes Set stream the entries this node no longer
+	// owns to their new owners in the background, see Migrate.
+	MigrateOnChange bool
+	// MinProtocolVersion is the oldest ProtocolVersion of the peers this
+	// node talks to, 1 if 0. Requests from older peers fail with
+	// ErrProtocolMismatch, as do requests to them, which makes the group
+	// load the key itself. Raise it once every node runs a release
+	// speaking the version.
+	MinProtocolVersion int
+
+	// Tracer records spans for served requests and requests to peers.
+	// Propagator carries the trace context between peers and defaults to
+	// TraceContext.
+	Tracer     Tracer
+	Propagator Propagator
+}
+
+// RateLimit configures token-bucket limits on requests served by a HTTPPool.
+// A zero rate disables the corresponding limit.
+type RateLimit struct {
+	Rate  float64 // requests per second across all clients
+	Burst int
+
+	PerClientRate  float64 // requests per second for each client IP
+	PerClientBurst int
 }
 
 // NewHTTPPool initializes an HTTP pool of peers.
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		client:   http.DefaultClient,
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Logger == nil {
+		p.opts.Logger = defaultLogger
+	}
+	if p.opts.Tracer == nil {
+		p.opts.Tracer = noopTracer{}
+	}
+	if p.opts.Propagator == nil {
+		p.opts.Propagator = TraceContext{}
+	}
+	if p.opts.PeerAuth == nil {
+		p.opts.PeerAuth = peerAuthorizer{token: p.opts.AuthToken, acl: p.opts.ACL}
+	}
+	if p.opts.AdminAuth == nil {
+		p.opts.AdminAuth = adminAuthorizer{token: p.opts.AdminToken, acl: p.opts.ACL}
+	}
+	p.selves = make(map[string]bool)
+	if self != "" {
+		p.selves[p.normalizePeers([]string{self})[0]] = true
+	}
+	for _, addr := range p.normalizePeers(p.opts.Aliases) {
+		p.selves[addr] = true
+	}
+	if p.opts.TLS != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = p.opts.TLS.ClientConfig()
+		p.client = &http.Client{Transport: transport}
+	}
+	if p.opts.Transport != nil {
+		p.client = &http.Client{Transport: p.opts.Transport}
 	}
+	p.backgroundBucket = newBandwidthBucket(p.opts.BackgroundBandwidth)
+	p.classBuckets = make(map[TrafficClass]*ratelimit.Bucket, len(p.opts.ClassBandwidth))
+	for class, bps := range p.opts.ClassBandwidth {
+		p.classBuckets[class] = newBandwidthBucket(bps)
+	}
+	p.SetRateLimit(p.opts.RateLimit)
+	if p.opts.Middleware == nil {
+		p.Use(AccessLog(slog.Default()))
+	} else {
+		p.Use(p.opts.Middleware...)
+	}
+	return p
 }
 
 // Log info with server name
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Sever %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.opts.Logger.Info(fmt.Sprintf(format, v...), "server", p.self)
 }
 
 // ServeHTTP handle all http requests
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r.WithContext(withBasePath(r.Context(), p.basePath)))
+}
+
+// serve is the innermost handler of the middleware chain.
+func (p *HTTPPool) serve(w http.ResponseWriter, r *http.Request) {
+	ctx, span := p.opts.Tracer.Start(p.opts.Propagator.Extract(r.Context(), r.Header), "geecache.HTTPPool.ServeHTTP")
+	defer span.End()
+
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool seving unexcepted path: " + r.URL.Path)
+		// 扫描器等发来的任意路径不应让节点崩溃
+		if p.opts.Fallback != nil {
+			p.opts.Fallback.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if p.isAdminPath(r.URL.Path) {
+		p.serveAdmin(w, r)
+		return
+	}
+	if !p.checkProtocol(w, r) {
+		return
+	}
+	if r.URL.Path == p.basePath+manifestPath {
+		p.serveManifest(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, p.basePath+transferPath) {
+		p.serveTransfer(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, p.basePath+antiEntropyPath) {
+		p.serveAntiEntropy(w, r)
+		return
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
 	// 约定访问路径格式为 /<basepath>/<groupname>/<key>
 	//过 groupname 得到 group 实例,
 	//再使用 group.Get(key) 获取缓存数据。
 	//最终使用 w.Write() 将缓存值作为 httpResponse 的 body 返回。
 
-	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2) //n:分割的次数，即最多将字符串分割成n个子串
-	if len(parts) != 2 {
+	groupName, key, ok := splitPeerPath(p.basePath, r.URL.Path)
+	if !ok {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
-	groupName := parts[0]
-	key := parts[1]
+	e := EndpointPeer
+	if r.Method == http.MethodDelete && key == "" && r.Header.Get(prefixHeader) != "" {
+		// 空前缀会清空整个 group，只接受管理员明确的请求，节点之间不会发送
+		e = EndpointAdmin
+	}
+	if !p.authorize(w, r, e, groupName) {
+		return
+	}
 
 	group := GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group"+groupName, http.StatusNotFound)
+		writeError(w, fmt.Errorf("%w: %s", ErrGroupNotFound, groupName))
+		return
+	}
+	if p.Divergent(groupName) {
+		writeError(w, fmt.Errorf("%w: %s", ErrConfigMismatch, groupName))
 		return
 	}
 
-	view, err := group.Get(key)
+	switch r.Method {
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
+		return
+	case http.MethodPatch:
+		p.serveUpdate(w, r, group, key)
+		return
+	case http.MethodDelete:
+		if r.Header.Get(prefixHeader) != "" {
+			group.RemovePrefix(key)
+		} else {
+			group.Remove(key)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	span.SetAttribute("geecache.group", groupName)
+	group.Stats.ServerRequests.Add(1)
+	if r.Header.Get(leaseHeader) != "" {
+		p.serveLease(w, group, key)
+		return
+	}
+	var view ByteView
+	var err error
+	if r.Header.Get(peekHeader) != "" {
+		view, err = group.peek(key)
+	} else {
+		opts := []GetOption{WithAffinity(r.Header.Get(affinityHeader))}
+		if r.Header.Get(wholeHeader) == "" {
+			opts = append(opts, readManifest)
+		}
+		if r.Header.Get(localHeader) != "" {
+			opts = append(opts, loadLocally)
+		}
+		opt, ok := headerBypass(r.Header.Get(bypassHeader))
+		if !ok {
+			http.Error(w, "bad "+bypassHeader, http.StatusBadRequest)
+			return
+		}
+		if opt != nil {
+			// 每次绕过都要回源，只接受其它节点，对外由 APIOptions.BypassAuth 把关
+			if !p.isPeer(r) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			opts = append(opts, opt)
+		}
+		view, err = group.getForPeer(ctx, key, opts...)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		span.RecordError(err)
+		writeError(w, err)
+		return
+	}
+	defer view.Release()
+
+	if tag := r.Header.Get("If-None-Match"); tag != "" && tag == contentTag(view) {
+		// 对端持有的副本与当前值相同，只发送版本与过期时间
+		writeValueHeaders(w, view)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	compressAbove := p.compressAbove(group)
+	if strings.Contains(r.Header.Get("Accept"), streamContentType) {
+		// 直接把值写入响应，不再额外编码一份 protobuf
+		w.Header().Set("Content-Type", streamContentType)
+		writeValueHeaders(w, view)
+		if compressAbove > 0 && view.Len() >= compressAbove {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if enc := responseEncoding(r); enc != "" {
+				writeEncoded(w, enc, view.Reader())
+				return
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(view.Len()))
+		io.Copy(w, view.Reader())
+		return
 	}
 
 	// Write the value to the response body as a proto message.
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice(), Version: view.Version(), ProtocolVersion: ProtocolVersion,
+		ExpiresMs: expiresMs(view), Flags: view.flags, Checksum: view.checksum()})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/octet-stream")
+	if compressAbove > 0 && len(body) >= compressAbove {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if enc := responseEncoding(r); enc != "" {
+			writeEncoded(w, enc, bytes.NewReader(body))
+			return
+		}
+	}
 	w.Write(body)
 }
 
-// Set updates the pool's list of peers.
+// writeValueHeaders describes view in the headers of a streamed or not
+// modified response.
+func writeValueHeaders(w http.ResponseWriter, view ByteView) {
+	w.Header().Set(versionHeader, strconv.FormatUint(view.Version(), 10))
+	if ms := expiresMs(view); ms != 0 {
+		w.Header().Set(expiresHeader, strconv.FormatInt(ms, 10))
+	}
+	if view.flags != 0 {
+		w.Header().Set(flagsHeader, strconv.FormatUint(uint64(view.flags), 10))
+	}
+	w.Header().Set(checksumHeader, strconv.FormatUint(uint64(view.checksum()), 10))
+}
+
+// readValueHeaders is the counterpart of writeValueHeaders.
+func readValueHeaders(res *http.Response, out *pb.Response) {
+	out.Version, _ = strconv.ParseUint(res.Header.Get(versionHeader), 10, 64)
+	out.ExpiresMs, _ = strconv.ParseInt(res.Header.Get(expiresHeader), 10, 64)
+	flags, _ := strconv.ParseUint(res.Header.Get(flagsHeader), 10, 32)
+	sum, _ := strconv.ParseUint(res.Header.Get(checksumHeader), 10, 32)
+	out.Flags, out.Checksum = uint32(flags), uint32(sum)
+}
+
+// expiresMs returns when view expires in Unix milliseconds, 0 if it
+// doesn't.
+func expiresMs(view ByteView) int64 {
+	return view.expire / int64(time.Millisecond)
+}
+
+// Set updates the pool's list of peers. Addresses are normalized with
+// NormalizePeerAddr, so all nodes agree on the ring however they spell them.
 func (p *HTTPPool) Set(peers ...string) {
+	peers = p.normalizePeers(peers)
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
+	if prev := p.peers; prev != nil && p.opts.MigrateOnChange {
+		defer func() { go p.migrateAfterSet(prev) }()
+	}
+	p.peers = p.newRing()
 	p.peers.Add(peers...)
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	stats := make(map[string]*peerStats, len(peers))
+	unixClients := make(map[string]*http.Client)
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		if stats[peer] = p.peerStats[peer]; stats[peer] == nil {
+			stats[peer] = newPeerStats(p.opts.PeerTimeout)
+			stats[peer].watchSlow(peer, p.opts.SlowPeerThreshold, p.opts.Logger)
+		}
+		h := &httpGetter{
+			baseURL:     peer + p.basePath,
+			authToken:   p.opts.AuthToken,
+			minProtocol: p.minProtocol(),
+			maxBytes:    p.opts.MaxResponseBytes,
+			client:      p.client,
+			stats:       stats[peer],
+			tracer:      p.opts.Tracer,
+			prop:        p.opts.Propagator,
+		}
+		if name, ok := unixSocket(peer); ok {
+			// URL 中的主机名只是占位，连接总是拨向 socket 文件
+			if unixClients[peer] = p.unixClients[peer]; unixClients[peer] == nil {
+				unixClients[peer] = unixClient(name)
+			}
+			h.baseURL, h.client = "http://unix"+p.basePath, unixClients[peer]
+		}
+		p.httpGetters[peer] = h
+	}
+	p.peerStats = stats
+	p.unixClients = unixClients
+}
+
+func (p *HTTPPool) newRing() consistenthash.Ring {
+	if p.opts.NewRing != nil {
+		return p.opts.NewRing()
+	}
+	return consistenthash.New(defaultReplicas, p.opts.Hash)
+}
+
+// PeerStats returns the client-side request statistics of every peer,
+// keyed by normalized peer address.
+func (p *HTTPPool) PeerStats() map[string]PeerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make(map[string]PeerStats, len(p.peerStats))
+	for peer, s := range p.peerStats {
+		res[peer] = s.snapshot()
+	}
+	return res
+}
+
+// allowRequest applies the per-client and global rate limits to r.
+// 先检查单个客户端，避免被拒绝的请求消耗全局令牌
+func (p *HTTPPool) allowRequest(r *http.Request) bool {
+	l := p.limits.Load()
+	if l == nil {
+		return true
+	}
+	if l.clients != nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if !l.clients.Allow(host) {
+			return false
+		}
 	}
+	return l.requests.Allow()
+}
+
+// requestLimits are the buckets enforcing a RateLimit.
+type requestLimits struct {
+	requests *ratelimit.Bucket //全局请求限流，可为 nil
+	clients  *ratelimit.Keyed  //按客户端 IP 限流，可为 nil
+}
+
+// SetRateLimit replaces the limits on incoming requests, nil removing
+// them. The buckets start full, as when the pool was created.
+func (p *HTTPPool) SetRateLimit(rl *RateLimit) {
+	if rl == nil || (rl.Rate <= 0 && rl.PerClientRate <= 0) {
+		p.limits.Store(nil)
+		return
+	}
+	l := &requestLimits{}
+	if rl.Rate > 0 {
+		l.requests = ratelimit.NewBucket(rl.Rate, rl.Burst)
+	}
+	if rl.PerClientRate > 0 {
+		l.clients = ratelimit.NewKeyed(rl.PerClientRate, rl.PerClientBurst)
+	}
+	p.limits.Store(l)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
 }
 
 // PickPeer picks a peer according to key
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
+	if peer := p.peers.Get(key); peer != "" && !p.isSelf(peer) {
+		p.opts.Logger.Debug("Pick peer", "server", p.self, "peer", peer)
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// PickPeers implements ReplicaPicker.
+func (p *HTTPPool) PickPeers(key string, n int) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var res []PeerGetter
+	// 多取一个，以便跳过本节点后仍有 n 个
+	for _, peer := range p.peers.GetN(key, n+1) {
+		if !p.isSelf(peer) && len(res) < n {
+			res = append(res, p.httpGetters[peer])
+		}
+	}
+	return res
+}
+
+// AllPeers implements PeerLister.
+func (p *HTTPPool) AllPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, h := range p.httpGetters {
+		if !p.isSelf(peer) {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
 // 确保HTTPPool类型实现了PeerPicker接口，即实现PickPeer。如果没有实现会报错的
 var _ PeerPicker = (*HTTPPool)(nil)
+var _ PeerLister = (*HTTPPool)(nil)
 
 // HTTP 客户端类 httpGetter
 type httpGetter struct {
-	baseURL string //表示将要访问的远程节点的地址，例如 http://example.com/_geecache/
+	baseURL     string //表示将要访问的远程节点的地址，例如 http://example.com/_geecache/
+	authToken   string //节点间共享的密钥，为空则不携带 Authorization 头
+	minProtocol int    //对端协议版本的下限
+	maxBytes    int64  //响应中值的大小上限，0 表示不限制
+	client      *http.Client
+	stats       *peerStats //可为 nil
+	tracer      Tracer     //可为 nil
+	prop        Propagator //可为 nil
 }
 
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf(
-		"%s%s%s",
-		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
-	)
-	res, err := http.Get(u)
-	if err != nil {
+// Get fetches the value into out.Value, reading it into a single buffer.
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.getAppend(ctx, in, out, nil)
+}
+
+// getAppend is Get reading a streamed value into dst, grown if needed.
+func (h *httpGetter) getAppend(ctx context.Context, in *pb.Request, out *pb.Response, dst []byte) error {
+	return h.fetch(ctx, in, func(res *http.Response) error {
+		if res.StatusCode == http.StatusNotModified {
+			readValueHeaders(res, out)
+			out.NotModified = true
+			return nil
+		}
+		if res.Header.Get("Content-Type") != streamContentType {
+			if err := h.decodeProto(res, out); err != nil {
+				return err
+			}
+		} else {
+			readValueHeaders(res, out)
+			// 已知长度时一次分配到位，避免 io.ReadAll 反复扩容拷贝
+			buf := bytes.NewBuffer(dst[:0])
+			if n := res.ContentLength; n > 0 && (h.maxBytes == 0 || n <= h.maxBytes) {
+				buf.Grow(int(n))
+			}
+			if _, err := io.Copy(buf, h.limit(res.Body)); err != nil {
+				return err
+			}
+			out.Value = buf.Bytes()
+		}
+		v := protocolOf(res.Header)
+		if err := checkWhole(h.baseURL, v, in, out); err != nil {
+			return err
+		}
+		if v < checksumProtocol {
+			return nil // 升级前的节点不发送校验和
+		}
+		return verifyChecksum(out.Value, out.Checksum)
+	})
+}
+
+// GetStream copies the value to w as it arrives instead of buffering it.
+// The checksum can only be verified at the end: on ErrCorrupted, what was
+// written to w must be discarded.
+func (h *httpGetter) GetStream(ctx context.Context, in *pb.Request, w io.Writer) error {
+	return h.fetch(ctx, in, func(res *http.Response) error {
+		if res.Header.Get("Content-Type") != streamContentType {
+			out := &pb.Response{}
+			if err := h.decodeProto(res, out); err != nil {
+				return err
+			}
+			if protocolOf(res.Header) >= checksumProtocol {
+				if err := verifyChecksum(out.Value, out.Checksum); err != nil {
+					return err
+				}
+			}
+			_, err := w.Write(out.Value)
+			return err
+		}
+		sum := crc32.New(castagnoli)
+		if _, err := io.Copy(io.MultiWriter(w, sum), h.limit(res.Body)); err != nil {
+			return err
+		}
+		if protocolOf(res.Header) < checksumProtocol {
+			return nil
+		}
+		if want, _ := strconv.ParseUint(res.Header.Get(checksumHeader), 10, 32); sum.Sum32() != uint32(want) {
+			return fmt.Errorf("%w: checksum %08x, expected %08x", ErrCorrupted, sum.Sum32(), want)
+		}
+		return nil
+	})
+}
+
+// maxPooledBuffer is the capacity above which buffers are not returned to
+// bufferPool, so that one huge value doesn't stay allocated for good.
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds the buffers protobuf responses are read into. Unmarshal
+// copies the value out, so the buffer can be reused right away.
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// decodeProto reads the protobuf-encoded response of peers that don't
+// stream values yet.
+func (h *httpGetter) decodeProto(res *http.Response, out *pb.Response) error {
+	//ioutil.ReadAll 在处理大文件时可能会导致内存消耗过大，因为它会一次性将整个文件内容读入内存，被弃用
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+	if _, err := io.Copy(buf, h.limit(res.Body)); err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	if err := proto.Unmarshal(buf.Bytes(), out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	return nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+// limit fails reads beyond h.maxBytes with ErrValueTooLarge.
+func (h *httpGetter) limit(r io.Reader) io.Reader {
+	if h.maxBytes <= 0 {
+		return r
 	}
+	return &limitedReader{r: r, n: h.maxBytes}
+}
 
-	//ioutil.ReadAll 在处理大文件时可能会导致内存消耗过大，因为它会一次性将整个文件内容读入内存，被弃用
-	bytes, err := io.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("reading response body:%v", err)
+type limitedReader struct {
+	r io.Reader
+	n int64 // bytes still allowed
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrValueTooLarge
+	}
+	// 多读一个字节，才能区分恰好读满和超出上限
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, ErrValueTooLarge
 	}
+	return n, err
+}
 
-	if err = proto.Unmarshal(bytes, out); err != nil {
-		return fmt.Errorf("decoding response body: %v", err)
+// keyURL returns the URL of key in group on the peer.
+func (h *httpGetter) keyURL(group, key string) string {
+	return fmt.Sprintf("%s%s/%s", h.baseURL, url.QueryEscape(group), url.QueryEscape(key))
+}
+
+// fetch sends the request for in and hands a successful response to read.
+func (h *httpGetter) fetch(ctx context.Context, in *pb.Request, read func(*http.Response) error) (err error) {
+	if h.tracer != nil {
+		var span Span
+		ctx, span = h.tracer.Start(ctx, "geecache.httpGetter.Get")
+		defer func() { endSpan(span, err) }()
+		span.SetAttribute("geecache.peer", h.baseURL)
+	}
+	if h.stats != nil {
+		if timeout := h.stats.currentTimeout(); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		start := time.Now()
+		defer func() {
+			h.stats.observe(time.Since(start), err, errors.Is(ctx.Err(), context.DeadlineExceeded))
+		}()
 	}
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.keyURL(in.GetGroup(), in.GetKey()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", streamContentType)
+	req.Header.Set("Accept-Encoding", strings.Join(responseEncodings, ", "))
+	if in.GetAffinity() != "" {
+		req.Header.Set(affinityHeader, in.GetAffinity())
+	}
+	if in.GetLocal() {
+		req.Header.Set(localHeader, "1")
+	}
+	if in.GetLease() {
+		req.Header.Set(leaseHeader, "1")
+	}
+	if in.GetWhole() {
+		req.Header.Set(wholeHeader, "1")
+	}
+	if in.GetPeek() {
+		req.Header.Set(peekHeader, "1")
+	}
+	if in.GetIfNoneMatch() != "" {
+		req.Header.Set("If-None-Match", in.GetIfNoneMatch())
+	}
+	if b := bypassValue(in); b != "" {
+		req.Header.Set(bypassHeader, b)
+	}
+	if h.prop != nil {
+		h.prop.Inject(ctx, req.Header)
+	}
+	res, err := h.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && (res.StatusCode != http.StatusNotModified || in.GetIfNoneMatch() == "") {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return errorFromResponse(res, body)
+	}
+	// 设置了 Accept-Encoding 后 Transport 不再自动解压，需要自己处理；
+	// 大小上限作用在解压后的数据上
+	dec, err := decodeBody(res)
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	if dec != nil {
+		defer dec.Close()
+	}
+	if err := read(res); err != nil {
+		if errors.Is(err, ErrValueTooLarge) {
+			return fmt.Errorf("%w: more than %d bytes from peer", ErrValueTooLarge, h.maxBytes)
+		}
+		return fmt.Errorf("reading response body: %w", err)
+	}
 	return nil
 }
 
 // _ 用来表明定义了这个变量但不使用它，将 nil 转换为 *httpGetter 类型的指针，并将其赋值给该变量。
 // 这样做的目的是，在编译时检查 *httpGetter 类型是否实现了 PeerGetter 接口。
 // *httpGetter 类型需要实现 PeerGetter 接口，即Get，如果没有编译器会报错，从而帮助开发者发现潜在的问题。
-var _ PeerGetter = (*httpGetter)(nil)
+var _ StreamingPeerGetter = (*httpGetter)(nil)
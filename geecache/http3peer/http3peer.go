@@ -0,0 +1,42 @@
+// Package http3peer carries the requests between geecache peers over
+// HTTP/3 (QUIC) instead of TCP. Over lossy or high-latency links, such as
+// between datacenters, a lost packet only stalls the request it belongs
+// to rather than every request on the connection, and new connections are
+// set up in a single round trip.
+//
+// QUIC is always encrypted, so peers are https:// addresses and every node
+// needs TLS credentials:
+//
+//	creds, err := geecache.NewCertReloader("node.crt", "node.key", "ca.crt")
+//	...
+//	pool := geecache.NewHTTPPoolOpts("https://10.0.0.1:8001", &geecache.HTTPPoolOptions{
+//		TLS:       creds,
+//		Transport: http3peer.NewTransport(creds),
+//	})
+//	log.Fatal(http3peer.NewServer(":8001", pool, creds).ListenAndServe())
+//
+// A node may serve HTTP/3 and TCP on the same port number, but a pool
+// only talks to its peers over one of them, so a cluster switches over as
+// a whole.
+package http3peer
+
+import (
+	"GeeCache/geecache"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// NewTransport returns a transport sending requests to peers over HTTP/3,
+// authenticated with creds. Rotated credentials are picked up by new
+// connections. Close it to release its UDP socket.
+func NewTransport(creds *geecache.CertReloader) *http3.Transport {
+	return &http3.Transport{TLSClientConfig: creds.ClientConfig()}
+}
+
+// NewServer returns a server answering HTTP/3 requests on the UDP address
+// addr with h, usually an HTTPPool, authenticated with creds like a TCP
+// server using creds.ServerConfig().
+func NewServer(addr string, h http.Handler, creds *geecache.CertReloader) *http3.Server {
+	return &http3.Server{Addr: addr, Handler: h, TLSConfig: http3.ConfigureTLSConfig(creds.ServerConfig())}
+}
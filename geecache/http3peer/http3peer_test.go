@@ -0,0 +1,111 @@
+package http3peer
+
+import (
+	"GeeCache/geecache"
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCreds returns credentials for 127.0.0.1 signed by a test CA.
+func testCreds(t *testing.T) *geecache.CertReloader {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "http3peer test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "peer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	dir := t.TempDir()
+	write := func(name, typ string, b []byte) string {
+		name = filepath.Join(dir, name)
+		if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	creds, err := geecache.NewCertReloader(write("peer.crt", "CERTIFICATE", der), write("peer.key", "EC PRIVATE KEY", keyDER),
+		write("ca.crt", "CERTIFICATE", caDER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creds
+}
+
+func TestHTTP3(t *testing.T) {
+	geecache.NewGroup("http3", geecache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	creds := testCreds(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no UDP:", err)
+	}
+	self := "https://" + conn.LocalAddr().String()
+	var proto string
+	server := geecache.NewHTTPPoolOpts(self, &geecache.HTTPPoolOptions{TLS: creds, Middleware: []geecache.Middleware{
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proto = r.Proto
+				next.ServeHTTP(w, r)
+			})
+		},
+	}})
+	srv := NewServer(conn.LocalAddr().String(), server, creds)
+	go srv.Serve(conn)
+	defer srv.Close()
+
+	transport := NewTransport(creds)
+	defer transport.Close()
+	client := geecache.NewHTTPPoolOpts("https://127.0.0.1:1", &geecache.HTTPPoolOptions{TLS: creds, Transport: transport, Middleware: []geecache.Middleware{}})
+	client.Set(self)
+	peer, ok := client.PickPeer("k")
+	if !ok {
+		t.Fatal("no peer picked")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out := &pb.Response{}
+	if err := peer.Get(ctx, &pb.Request{Group: "http3", Key: "k"}, out); err != nil || string(out.Value) != "value of k" {
+		t.Fatalf("get over HTTP/3 = %q, %v", out.Value, err)
+	}
+	if proto != "HTTP/3.0" {
+		t.Fatalf("request served over %s", proto)
+	}
+}
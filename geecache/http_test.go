@@ -0,0 +1,1026 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/lru"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, group string, o *HTTPPoolOptions) *httptest.Server {
+	t.Helper()
+	if GetGroup(group) == nil {
+		NewGroup(group, GetterFunc(func(key string) ([]byte, error) {
+			return []byte("v:" + key), nil
+		}), WithCacheBytes(2<<10))
+	}
+	srv := httptest.NewServer(NewHTTPPoolOpts("", o))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPPoolAuthToken(t *testing.T) {
+	srv := newTestPool(t, "auth", &HTTPPoolOptions{AuthToken: "s3cret"})
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, authToken: "s3cret"}
+	res := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "auth", Key: "k"}, res); err != nil {
+		t.Fatalf("authorized get failed: %v", err)
+	}
+	if string(res.Value) != "v:k" {
+		t.Fatalf("got %q, want %q", res.Value, "v:k")
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		getter := &httpGetter{baseURL: srv.URL + defaultBasePath, authToken: token}
+		if err := getter.Get(context.Background(), &pb.Request{Group: "auth", Key: "k"}, &pb.Response{}); err == nil {
+			t.Fatalf("token %q: expected request to be rejected", token)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + defaultBasePath + "auth/k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestHTTPPoolACL(t *testing.T) {
+	for _, name := range []string{"tenant-a", "tenant-b"} {
+		if GetGroup(name) == nil {
+			NewGroup(name, GetterFunc(func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}), WithCacheBytes(2<<10))
+		}
+	}
+	office, err := ParseNetworks("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		AuthToken: "peer-secret",
+		ACL: ACL{
+			"tenant-a": {Read: ACLRule{Tokens: []string{"token-a"}}, Admin: ACLRule{Tokens: []string{"admin-a"}}},
+			"*":        {Read: ACLRule{Networks: office}},
+		},
+	})
+
+	tests := []struct {
+		method, group, token, remote string
+		want                         int
+	}{
+		{http.MethodGet, "tenant-a", "token-a", "192.0.2.1:1234", http.StatusOK},
+		{http.MethodGet, "tenant-b", "token-a", "192.0.2.1:1234", http.StatusForbidden},
+		{http.MethodGet, "tenant-b", "token-a", "10.1.2.3:1234", http.StatusOK},
+		{http.MethodGet, "tenant-a", "peer-secret", "192.0.2.1:1234", http.StatusOK},
+		{http.MethodGet, "tenant-b", "peer-secret", "192.0.2.1:1234", http.StatusOK},
+		{http.MethodGet, "tenant-a", "", "192.0.2.1:1234", http.StatusUnauthorized},
+		{http.MethodGet, "tenant-a", "unknown", "192.0.2.1:1234", http.StatusUnauthorized},
+		// 只读的 token 不能改写值
+		{http.MethodPut, "tenant-a", "token-a", "192.0.2.1:1234", http.StatusForbidden},
+		{http.MethodPut, "tenant-a", "admin-a", "192.0.2.1:1234", http.StatusBadRequest},
+		{http.MethodPatch, "tenant-a", "token-a", "192.0.2.1:1234", http.StatusForbidden},
+		{http.MethodDelete, "tenant-a", "token-a", "192.0.2.1:1234", http.StatusForbidden},
+		{http.MethodDelete, "tenant-a", "admin-a", "192.0.2.1:1234", http.StatusNoContent},
+		{http.MethodDelete, "tenant-a", "peer-secret", "192.0.2.1:1234", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, defaultBasePath+tt.group+"/k", nil)
+		req.RemoteAddr = tt.remote
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with token %q from %s: status = %d, want %d",
+				tt.method, tt.group, tt.token, tt.remote, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestHTTPPoolRateLimit(t *testing.T) {
+	newTestPool(t, "limited", nil)
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		RateLimit: &RateLimit{PerClientRate: 0.001, PerClientBurst: 2},
+	})
+	status := func(remote string) int {
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+"limited/k", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := status("192.0.2.1:1000"); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+	if code := status("192.0.2.1:1001"); code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := status("192.0.2.2:1000"); code != http.StatusOK {
+		t.Fatalf("another client: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestAdaptivePeerTimeout(t *testing.T) {
+	s := newPeerStats(&AdaptiveTimeout{
+		Initial:    time.Second,
+		Min:        5 * time.Millisecond,
+		Max:        500 * time.Millisecond,
+		MinSamples: 10,
+	})
+	if got := s.currentTimeout(); got != time.Second {
+		t.Fatalf("initial timeout = %v, want %v", got, time.Second)
+	}
+	for i := 0; i < 32; i++ {
+		s.observe(10*time.Millisecond, nil, false)
+	}
+	if got := s.currentTimeout(); got != 30*time.Millisecond {
+		t.Fatalf("adapted timeout = %v, want %v", got, 30*time.Millisecond)
+	}
+	s.observe(time.Second, errors.New("deadline"), true)
+	st := s.snapshot()
+	if st.Requests != 33 || st.Errors != 1 || st.Timeouts != 1 || st.P99 != 10*time.Millisecond {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestSlowPeerStats(t *testing.T) {
+	var buf bytes.Buffer
+	s := newPeerStats(nil)
+	s.watchSlow("http://peer:1", 50*time.Millisecond, slog.New(slog.NewTextHandler(&buf, nil)))
+	for i := 0; i < 32; i++ {
+		s.observe(3*time.Millisecond, nil, false)
+	}
+	st := s.snapshot()
+	if st.Slow || buf.Len() != 0 {
+		t.Fatalf("fast peer reported slow: %+v, %s", st, buf.String())
+	}
+	// 3ms 落在 (2.5ms, 5ms] 的桶里
+	if len(st.Histogram) != len(LatencyBuckets)+1 || st.Histogram[2] != 32 {
+		t.Fatalf("histogram %v", st.Histogram)
+	}
+	for i := 0; i < 16; i++ {
+		s.observe(10*time.Second, nil, false)
+	}
+	st = s.snapshot()
+	if !st.Slow || !strings.Contains(buf.String(), "slow peer") || st.Histogram[len(LatencyBuckets)] != 16 {
+		t.Fatalf("slow peer not reported: %+v, %s", st, buf.String())
+	}
+	for i := 0; i < defaultLatencyWindow; i++ {
+		s.observe(3*time.Millisecond, nil, false)
+	}
+	if s.snapshot().Slow || !strings.Contains(buf.String(), "no longer slow") {
+		t.Fatalf("recovery not reported: %s", buf.String())
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	newTestPool(t, "logged", nil)
+	var buf bytes.Buffer
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		Middleware: []Middleware{trace("outer"), AccessLog(slog.New(slog.NewJSONHandler(&buf, nil)))},
+	})
+	pool.Use(trace("inner"))
+
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, defaultBasePath+"logged/secret-key", nil))
+
+	if !reflect.DeepEqual(order, []string{"outer", "inner"}) {
+		t.Fatalf("middleware order = %v", order)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("access log is not JSON: %v (%q)", err, buf.String())
+	}
+	if entry["group"] != "logged" || entry["status"] != float64(http.StatusOK) ||
+		entry["key_hash"] != hashKey("secret-key") || entry["bytes"] != float64(rec.Body.Len()) {
+		t.Fatalf("unexpected access log entry %v", entry)
+	}
+	if strings.Contains(buf.String(), "secret-key") {
+		t.Fatalf("access log leaks the raw key: %s", buf.String())
+	}
+
+	// 路径按处理请求的 pool 的前缀解析
+	buf.Reset()
+	pool.basePath = "/cache/"
+	pool.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cache/logged/secret-key", nil))
+	entry = nil
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["group"] != "logged" || entry["key_hash"] != hashKey("secret-key") {
+		t.Fatalf("unexpected access log entry %v (%v) under another base path", entry, err)
+	}
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	t.spans = append(t.spans, name)
+	t.mu.Unlock()
+	return ctx, noopSpan{}
+}
+
+func TestTracePropagation(t *testing.T) {
+	tracer := &recordingTracer{}
+	NewGroup("traced", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(2<<10), WithTracer(tracer))
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var received string
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		Tracer: tracer,
+		Middleware: []Middleware{func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Get("traceparent")
+				next.ServeHTTP(w, r)
+			})
+		}},
+	})
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	h := http.Header{}
+	h.Set("traceparent", parent)
+	ctx := TraceContext{}.Extract(context.Background(), h)
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, tracer: tracer, prop: TraceContext{}}
+	if err := getter.Get(ctx, &pb.Request{Group: "traced", Key: "k"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if received != parent {
+		t.Fatalf("peer received traceparent %q, want %q", received, parent)
+	}
+	except := []string{"geecache.httpGetter.Get", "geecache.HTTPPool.ServeHTTP", "geecache.Group.Get", "geecache.Group.load"}
+	if !reflect.DeepEqual(tracer.spans, except) {
+		t.Fatalf("spans = %v, want %v", tracer.spans, except)
+	}
+}
+
+func TestNormalizePeerAddr(t *testing.T) {
+	cases := map[string]string{
+		"localhost:8001":              "http://localhost:8001",
+		"HTTP://LocalHost:8001/":      "http://localhost:8001",
+		"http://example.net:80":       "http://example.net",
+		"https://example.net:443":     "https://example.net",
+		"http://[::ffff:10.0.0.1]:80": "http://10.0.0.1",
+		"http://[0:0:0:0:0:0:0:1]:81": "http://[::1]:81",
+		"https://[FE80::1]":           "https://[fe80::1]",
+		"UNIX:///run//geecache.sock":  "unix:///run/geecache.sock",
+	}
+	for in, want := range cases {
+		if got, err := NormalizePeerAddr(in); err != nil || got != want {
+			t.Errorf("NormalizePeerAddr(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"ftp://host", "http://host/path", "http://:80", "unix://host/sock", "unix:relative.sock"} {
+		if _, err := NormalizePeerAddr(in); err == nil {
+			t.Errorf("NormalizePeerAddr(%q) succeeded", in)
+		}
+	}
+}
+
+func TestUnixSocketPeer(t *testing.T) {
+	NewGroup("unix", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	// socket 路径长度有限，t.TempDir 可能太长
+	dir, err := os.MkdirTemp("", "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := "unix://" + dir + "/peer.sock"
+	l, err := ListenPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: NewHTTPPoolOpts(addr, &HTTPPoolOptions{Middleware: []Middleware{}})}
+	go srv.Serve(l)
+	defer srv.Close()
+	if _, err := ListenPeer(addr); err == nil {
+		t.Fatal("listened on a socket in use")
+	}
+
+	client := NewHTTPPoolOpts("http://127.0.0.1:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	client.Set(addr)
+	peer, ok := client.PickPeer("k")
+	if !ok {
+		t.Fatal("no peer picked")
+	}
+	out := &pb.Response{}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "unix", Key: "k"}, out); err != nil || string(out.Value) != "value of k" {
+		t.Fatalf("get over a unix socket = %q, %v", out.Value, err)
+	}
+}
+
+func TestHTTPPoolAliases(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://node-a:8001", &HTTPPoolOptions{Aliases: []string{"10.0.0.1:8001"}})
+	pool.Set("http://10.0.0.1:8001", "HTTP://NODE-A:8001")
+	for i := 0; i < 20; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			t.Fatal("picked this node as a remote peer")
+		}
+	}
+}
+
+func TestHTTPErrorMapping(t *testing.T) {
+	NewGroup("errors", GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return []byte(strings.Repeat("x", 100)), nil
+	}), WithCacheBytes(2<<10), WithMaxEntryBytes(10))
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+
+	cases := []struct {
+		group, key string
+		status     int
+		want       error
+	}{
+		{"errors", "missing", http.StatusNotFound, ErrNotFound},
+		{"errors", "big", http.StatusRequestEntityTooLarge, ErrValueTooLarge},
+		{"nonexistent", "k", http.StatusNotFound, ErrGroupNotFound},
+	}
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	for _, c := range cases {
+		res, err := http.Get(srv.URL + defaultBasePath + c.group + "/" + c.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Errorf("%s/%s: status = %d, want %d", c.group, c.key, res.StatusCode, c.status)
+		}
+		err = getter.Get(context.Background(), &pb.Request{Group: c.group, Key: c.key}, &pb.Response{})
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s/%s: err = %v, want %v", c.group, c.key, err, c.want)
+		}
+	}
+
+	srv.Close()
+	err := getter.Get(context.Background(), &pb.Request{Group: "errors", Key: "k"}, &pb.Response{})
+	if !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("closed peer: err = %v", err)
+	}
+}
+
+func TestHTTPPoolUnexpectedPath(t *testing.T) {
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}})
+	for _, path := range []string{"/", "/wp-login.php", "/_geecache"} {
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, defaultBasePath+"no-key", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("path without key: status = %d, want 400", rec.Code)
+	}
+
+	fallback := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		Middleware: []Middleware{},
+		Fallback: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	})
+	rec = httptest.NewRecorder()
+	fallback.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("fallback not used: status = %d", rec.Code)
+	}
+}
+
+func TestAuthorizers(t *testing.T) {
+	var seen []AuthRequest
+	record := AuthorizerFunc(func(req *AuthRequest) error {
+		seen = append(seen, *req)
+		return ErrForbidden
+	})
+	srv := newTestPool(t, "authorized", &HTTPPoolOptions{
+		PeerAuth:  AnyOf(TokenAuth("peer-secret"), record),
+		AdminAuth: TokenAuth("root"),
+	})
+
+	get := func(path, token string) int {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get("authorized/k", "peer-secret"); code != http.StatusOK {
+		t.Fatalf("peer token: status = %d", code)
+	}
+	if code := get("authorized/k", "other"); code != http.StatusForbidden {
+		t.Fatalf("other token: status = %d", code)
+	}
+	if len(seen) != 1 || seen[0].Endpoint != EndpointPeer || seen[0].Group != "authorized" || seen[0].Identity.Token != "other" {
+		t.Fatalf("authorizer saw %+v", seen)
+	}
+	if code := get(adminPrefix+"stats", "peer-secret"); code != http.StatusForbidden {
+		t.Fatalf("peer token on admin API: status = %d", code)
+	}
+	if code := get(adminPrefix+"stats", "root"); code != http.StatusOK {
+		t.Fatalf("admin token: status = %d", code)
+	}
+
+	api := Protect(CertAuth("frontend"), EndpointPublic, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != `Bearer realm="geecache-public"` {
+		t.Fatalf("public API without certificate: status = %d, header %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestStreamingValues(t *testing.T) {
+	big := strings.Repeat("0123456789", 100<<10) // 1 MB
+	NewGroup("streamed", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(big), nil
+	}), WithCacheBytes(0))
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+	in := &pb.Request{Group: "streamed", Key: "k"}
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), in, out); err != nil || string(out.Value) != big {
+		t.Fatalf("get: %d bytes, %v", len(out.Value), err)
+	}
+	var buf bytes.Buffer
+	if err := getter.GetStream(context.Background(), in, &buf); err != nil || buf.String() != big {
+		t.Fatalf("stream: %d bytes, %v", buf.Len(), err)
+	}
+
+	limited := &httpGetter{baseURL: srv.URL + defaultBasePath, maxBytes: int64(len(big)) - 1}
+	if err := limited.Get(context.Background(), in, out); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("limited get: err = %v", err)
+	}
+	limited.maxBytes = int64(len(big))
+	if err := limited.Get(context.Background(), in, out); err != nil {
+		t.Fatalf("get of exactly maxBytes: %v", err)
+	}
+
+	// 未携带 Accept 的旧版本节点仍然得到 protobuf 编码的响应
+	res, err := http.Get(srv.URL + defaultBasePath + "streamed/k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if err := proto.Unmarshal(body, out); err != nil || string(out.Value) != big {
+		t.Fatalf("proto response: %v", err)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	doc := strings.Repeat(`{"name":"geecache","tags":["a","b"]},`, 1000)
+	g := NewGroup("compressed", GetterFunc(func(key string) ([]byte, error) {
+		if key == "small" {
+			return []byte("tiny"), nil
+		}
+		return []byte(doc), nil
+	}), WithCacheBytes(0), WithCompression(1<<10))
+
+	for i := 0; i < 2; i++ {
+		if v, err := g.Get("doc"); err != nil || v.String() != doc {
+			t.Fatalf("get %d: %v", i, err)
+		}
+	}
+	if st := g.CacheStats(); st.Bytes >= int64(len(doc))/4 {
+		t.Fatalf("%d bytes cached for a %d bytes document", st.Bytes, len(doc))
+	}
+
+	var wire int64
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rec := &statusRecorder{ResponseWriter: w}
+				next.ServeHTTP(rec, r)
+				wire = rec.bytes
+			})
+		},
+	}}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, maxBytes: int64(len(doc))}
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "compressed", Key: "doc"}, out); err != nil || string(out.Value) != doc {
+		t.Fatalf("get over the wire: %v", err)
+	}
+	if wire >= int64(len(doc))/4 {
+		t.Fatalf("%d bytes sent for a %d bytes document", wire, len(doc))
+	}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "compressed", Key: "small"}, out); err != nil || string(out.Value) != "tiny" {
+		t.Fatalf("get of a small value: %v", err)
+	}
+	getter.maxBytes = int64(len(doc)) - 1
+	if err := getter.Get(context.Background(), &pb.Request{Group: "compressed", Key: "doc"}, out); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("limit applied before decompression: err = %v", err)
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	doc := strings.Repeat("compressible ", 1000)
+	NewGroup("compressed-responses", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(doc), nil
+	}), WithCacheBytes(0))
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}, CompressResponses: 1 << 10}))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "compressed-responses", Key: "doc"}, out); err != nil || string(out.Value) != doc {
+		t.Fatalf("get over the wire: %v", err)
+	}
+	for accept, want := range map[string]string{
+		"gzip":               "gzip",
+		"deflate, GZIP;q=.5": "gzip",
+		"gzip;q=0":           "",
+		"zstd, gzip":         "zstd",
+		"*":                  "zstd",
+		"*, zstd;q=0":        "gzip",
+		"*, gzip;q=0.0":      "zstd",
+		"identity":           "",
+	} {
+		// 不要求流式响应时返回的 protobuf 同样压缩
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"compressed-responses/doc", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		res, err := srv.Client().Transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if got := res.Header.Get("Content-Encoding"); got != want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", accept, got, want)
+		}
+		// 同一个 URL 的响应随 Accept-Encoding 变化，中间的缓存要区分
+		if res.Header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: Vary = %q", accept, res.Header.Get("Vary"))
+		}
+	}
+	for _, enc := range []string{"gzip", "zstd"} {
+		res := &http.Response{Header: http.Header{"Content-Encoding": {enc}}}
+		var buf bytes.Buffer
+		w := httptest.NewRecorder()
+		writeEncoded(w, enc, strings.NewReader(doc))
+		res.Body = io.NopCloser(w.Body)
+		dec, err := decodeBody(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(&buf, res.Body)
+		dec.Close()
+		if buf.String() != doc {
+			t.Fatalf("%s round trip: %d bytes", enc, buf.Len())
+		}
+	}
+}
+
+func TestCheckManifests(t *testing.T) {
+	newTestPool(t, "manifest", nil)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultBasePath+manifestPath {
+			http.NotFound(w, r)
+			return
+		}
+		m := LocalManifest()
+		m["manifest"] = "0000000000000000"
+		m["peer-only"] = "1111111111111111"
+		json.NewEncoder(w).Encode(m)
+	}))
+	defer peer.Close()
+
+	pool := NewHTTPPoolOpts("http://self:8001", &HTTPPoolOptions{Middleware: []Middleware{}, RefuseDivergent: true})
+	pool.Set("http://self:8001", peer.URL)
+	mismatches, err := pool.CheckManifests(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := GetGroup("manifest").configHash.Load().(string)
+	want := []ManifestMismatch{
+		{Peer: peer.URL, Group: "manifest", Local: local, Remote: "0000000000000000"},
+		{Peer: peer.URL, Group: "peer-only", Remote: "1111111111111111"},
+	}
+	if !reflect.DeepEqual(mismatches, want) {
+		t.Fatalf("mismatches = %+v, want %+v", mismatches, want)
+	}
+
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, defaultBasePath+"manifest/k", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("divergent group served: status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, defaultBasePath+manifestPath, nil))
+	var served Manifest
+	if err := json.NewDecoder(rec.Body).Decode(&served); err != nil || served["manifest"] != local {
+		t.Fatalf("served manifest %v, %v", served, err)
+	}
+}
+
+// BenchmarkPeerGetProto measures fetching values from a peer answering in
+// the legacy protobuf encoding, from concurrent goroutines.
+func BenchmarkPeerGetProto(b *testing.B) {
+	body, _ := proto.Marshal(&pb.Response{Value: bytes.Repeat([]byte("v"), 4<<10)})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	defer srv.Close()
+	g := NewGroup("bench-proto", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(0), WithDuplicatePolicy(ReuseGroup))
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, client: srv.Client()}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := g.getFromPeer(context.Background(), peer, "k", "k", false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestPlanRebalance(t *testing.T) {
+	g := NewGroup("rebalance", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), WithCacheBytes(64<<10))
+	for i := 0; i < 100; i++ {
+		g.Get("key" + strconv.Itoa(i))
+	}
+	pool := NewHTTPPoolOpts("http://a:1", &HTTPPoolOptions{
+		Middleware:     []Middleware{},
+		ClassBandwidth: map[TrafficClass]int64{TrafficRebalance: 1000},
+	})
+	pool.Set("http://a:1")
+
+	if plan := pool.PlanRebalance("http://a:1"); plan.Keys != 0 || plan.Kept < 100 {
+		t.Fatalf("unchanged peer set moves %d entries, keeps %d", plan.Keys, plan.Kept)
+	}
+	plan := pool.PlanRebalance("http://a:1", "http://b:1")
+	if len(plan.Moves) != 1 || plan.Moves[0].To != "http://b:1" || plan.Keys == 0 || plan.Kept == 0 {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if want := time.Duration(plan.Bytes) * time.Second / 1000; plan.Estimation != want {
+		t.Fatalf("estimation = %v, want %v", plan.Estimation, want)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	g := NewGroup("warmup", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), WithCacheBytes(64<<10))
+	for i := 0; i < 100; i++ {
+		g.Get("key" + strconv.Itoa(i))
+	}
+	srv := httptest.NewUnstartedServer(nil)
+	// 节点地址要在创建 HTTPPool 时确定，所以先拿到监听地址再启动
+	old := NewHTTPPoolOpts("http://"+srv.Listener.Addr().String(), &HTTPPoolOptions{Middleware: []Middleware{}})
+	srv.Config.Handler = old
+	srv.Start()
+	defer srv.Close()
+	old.Set(srv.URL)
+	ring := consistenthash.New(defaultReplicas, nil)
+	ring.Add(srv.URL, "http://b:1")
+	var moved int
+	for i := 0; i < 100; i++ {
+		if ring.Get("key"+strconv.Itoa(i)) == "http://b:1" {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatal("no entries move to the new node")
+	}
+
+	joined := NewHTTPPoolOpts("http://b:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	joined.Set(srv.URL, "http://b:1")
+	n, err := joined.WarmUp(context.Background(), "warmup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != moved {
+		t.Fatalf("warmed %d entries, want %d", n, moved)
+	}
+
+	res, err := http.Get(srv.URL + defaultBasePath + transferPath + "warmup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("transfer without a ring: status %d", res.StatusCode)
+	}
+}
+
+func TestHintedHandoff(t *testing.T) {
+	g := NewGroup("handoff", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10), WithHintedHandoff(1, 0))
+	owner := NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}})
+	var down atomic.Bool
+	var puts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodPut {
+			puts.Add(1)
+		}
+		owner.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	pool := NewHTTPPoolOpts("http://self:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set(srv.URL)
+	g.RegisterPeers(pool)
+
+	ctx := context.Background()
+	if err := g.Set(ctx, "a", []byte("1")); err != nil || puts.Load() != 1 {
+		t.Fatalf("set with the owner up: err %v, %d puts", err, puts.Load())
+	}
+
+	down.Store(true)
+	if err := g.Set(ctx, "b", []byte("2")); err != nil {
+		t.Fatalf("set with the owner down: %v", err)
+	}
+	if v, err := g.Get("b"); err != nil || v.String() != "2" {
+		t.Fatalf("hinted value = %q, %v", v.String(), err)
+	}
+	if err := g.Set(ctx, "c", []byte("3")); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("set beyond the hint limit: %v", err)
+	}
+	g.replayHints(ctx)
+	if g.PendingHints() != 1 {
+		t.Fatal("hint dropped while the owner is down")
+	}
+
+	down.Store(false)
+	g.replayHints(ctx)
+	if g.PendingHints() != 0 || g.Stats.HintsReplayed.Get() != 1 || puts.Load() != 2 {
+		t.Fatalf("after replay: %d pending, %d replayed, %d puts", g.PendingHints(), g.Stats.HintsReplayed.Get(), puts.Load())
+	}
+}
+
+func TestCompareAndSetOnPeer(t *testing.T) {
+	g := NewGroup("cas-peer", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}), WithCacheBytes(2<<10))
+	put := func(h http.Handler, expected uint64) int {
+		body, _ := proto.Marshal(&pb.SetRequest{Group: "cas-peer", Key: "k", Value: []byte("v"), Compare: true, ExpectedVersion: expected})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, defaultBasePath+"cas-peer/k", bytes.NewReader(body)))
+		return rec.Code
+	}
+	owner := NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}})
+	if code := put(owner, 0); code != http.StatusNoContent {
+		t.Fatalf("creating the key: status %d", code)
+	}
+	if code := put(owner, 0); code != http.StatusPreconditionFailed {
+		t.Fatalf("creating an existing key: status %d", code)
+	}
+
+	// 同一进程中的 group 是共享的，用假的归属节点检查请求和错误的传递
+	var got pb.SetRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		proto.Unmarshal(body, &got)
+		writeError(w, ErrVersionMismatch)
+	}))
+	defer srv.Close()
+	pool := NewHTTPPoolOpts("http://self:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set(srv.URL)
+	g.RegisterPeers(pool)
+	err := g.CompareAndSet(context.Background(), "k", []byte("a"), 42)
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("stale version on the owner: %v", err)
+	}
+	if !got.Compare || got.ExpectedVersion != 42 || string(got.Value) != "a" {
+		t.Fatalf("owner received %v", &got)
+	}
+}
+
+func TestIncrementOnPeer(t *testing.T) {
+	s := &mapStore{data: map[string]string{}}
+	NewGroup("increment-peer", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10), WithStore(s))
+	owner := NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}})
+	srv := httptest.NewServer(owner)
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	for i, want := range []string{"5", "10"} {
+		out := &pb.Response{}
+		err := getter.Update(context.Background(), &pb.UpdateRequest{Group: "increment-peer", Key: "n", Op: opIncrement, Delta: 5}, out)
+		if err != nil || string(out.Value) != want || out.Version == 0 {
+			t.Fatalf("update %d: %q version %d, %v", i, out.Value, out.Version, err)
+		}
+	}
+	// 追加只返回版本，不返回整个值
+	out := &pb.Response{}
+	if err := getter.Update(context.Background(), &pb.UpdateRequest{Group: "increment-peer", Key: "log", Op: opAppend, Data: []byte("x")}, out); err != nil || len(out.Value) != 0 || out.Version == 0 {
+		t.Fatalf("append: %q version %d, %v", out.Value, out.Version, err)
+	}
+	// peek 只读取归属节点已有的副本
+	out = &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "increment-peer", Key: "n", Peek: true}, out); err != nil || string(out.Value) != "10" {
+		t.Fatalf("peek: %q, %v", out.Value, err)
+	}
+	// 归属节点写入 store
+	if v, _ := s.Get(context.Background(), "n"); string(v) != "10" {
+		t.Fatalf("owner's store has %q, want 10", v)
+	}
+	out = &pb.Response{}
+	if err := getter.Update(context.Background(), &pb.UpdateRequest{Group: "increment-peer", Key: "n", Op: opTouch, TtlMs: 1000}, out); err != nil || out.Version == 0 {
+		t.Fatalf("touch: version %d, %v", out.Version, err)
+	}
+	out = &pb.Response{}
+	if err := getter.Update(context.Background(), &pb.UpdateRequest{Group: "increment-peer", Key: "n", Op: opTTL}, out); err != nil || out.TtlMs <= 0 || out.TtlMs > 1000 {
+		t.Fatalf("ttl: %d ms, %v", out.TtlMs, err)
+	}
+	err := getter.Update(context.Background(), &pb.UpdateRequest{Group: "increment-peer", Key: "missing", Op: opTouch}, &pb.Response{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("touch of a missing key: %v", err)
+	}
+}
+
+func TestJumpRing(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{
+		Middleware: []Middleware{},
+		NewRing:    func() consistenthash.Ring { return consistenthash.NewJump(nil) },
+	})
+	pool.Set("http://a", "http://b", "http://c")
+	remote := 0
+	for i := 0; i < 300; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			remote++
+		}
+	}
+	if remote < 150 || remote > 250 {
+		t.Fatalf("%d of 300 keys owned by the other 2 of 3 peers", remote)
+	}
+	if r := pool.RingReport(nil); r.Imbalance != 1 || len(r.Shares) != 3 {
+		t.Fatalf("jump ring report = %+v", r)
+	}
+}
+
+func TestProtocolNegotiation(t *testing.T) {
+	srv := newTestPool(t, "protocol", &HTTPPoolOptions{Middleware: []Middleware{}, MinProtocolVersion: ProtocolVersion})
+	ctx := context.Background()
+
+	// 升级前的节点不带版本头，视为版本 1，被拒绝
+	res, err := http.Get(srv.URL + defaultBasePath + "protocol/k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUpgradeRequired || res.Header.Get(protocolHeader) != strconv.Itoa(ProtocolVersion) {
+		t.Fatalf("old peer: status %d, protocol %q", res.StatusCode, res.Header.Get(protocolHeader))
+	}
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, minProtocol: ProtocolVersion, stats: newPeerStats(nil)}
+	out := &pb.Response{}
+	if err := getter.Get(ctx, &pb.Request{Group: "protocol", Key: "k"}, out); err != nil || string(out.Value) != "v:k" {
+		t.Fatalf("current peer: %q, %v", out.Value, err)
+	}
+	if v := getter.stats.snapshot().Protocol; v != ProtocolVersion {
+		t.Fatalf("recorded protocol %d", v)
+	}
+
+	// 对端是升级前的版本时，按下限决定是否与它通信
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("old")})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	defer old.Close()
+	getter = &httpGetter{baseURL: old.URL + defaultBasePath, minProtocol: ProtocolVersion}
+	if err := getter.Get(ctx, &pb.Request{Group: "protocol", Key: "k"}, &pb.Response{}); !errors.Is(err, ErrProtocolMismatch) {
+		t.Fatalf("old peer answered: err = %v", err)
+	}
+	getter.minProtocol = 1
+	if err := getter.Get(ctx, &pb.Request{Group: "protocol", Key: "k"}, out); err != nil || string(out.Value) != "old" {
+		t.Fatalf("old peer allowed: %q, %v", out.Value, err)
+	}
+}
+
+func TestValueMetadata(t *testing.T) {
+	g := NewGroup("metadata", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}), WithCacheBytes(2<<10), WithPolicy("", Policy{TTL: time.Hour}))
+	if err := g.Set(context.Background(), "k", []byte("v"), WithFlags(7)); err != nil {
+		t.Fatal(err)
+	}
+	v, err := g.Get("k")
+	if err != nil || v.Flags() != 7 || v.TTL() <= 59*time.Minute || v.TTL() > time.Hour {
+		t.Fatalf("local get: flags %d, ttl %v, %v", v.Flags(), v.TTL(), err)
+	}
+	if loaded, _ := g.Get("loaded"); loaded.Flags() != 0 || loaded.Expires().IsZero() {
+		t.Fatalf("loaded value: flags %d, expires %v", loaded.Flags(), loaded.Expires())
+	}
+
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	remote, err := g.getFromPeer(context.Background(), getter, "k", "k", false)
+	if err != nil || remote.Flags() != 7 || remote.Expires().Sub(v.Expires()).Abs() > time.Millisecond {
+		t.Fatalf("streamed: flags %d, expires %v, %v", remote.Flags(), remote.Expires(), err)
+	}
+	// 旧版本节点收到的 protobuf 响应同样带有元数据
+	res, err := http.Get(srv.URL + defaultBasePath + "metadata/k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	out := &pb.Response{}
+	if err := proto.Unmarshal(body, out); err != nil || out.Flags != 7 || out.ExpiresMs != v.Expires().UnixMilli() {
+		t.Fatalf("proto response: %v, %v", out, err)
+	}
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	writeEntry(bw, "k", v, lru.EntryOptions{})
+	bw.Flush()
+	if e, err := readEntry(&buf); err != nil || e.flags != 7 || string(e.value) != "v" {
+		t.Fatalf("entry read back: %+v, %v", e, err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	srv := newTestPool(t, "checksum", &HTTPPoolOptions{Middleware: []Middleware{}})
+	ctx := context.Background()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	out := &pb.Response{}
+	if err := getter.Get(ctx, &pb.Request{Group: "checksum", Key: "k"}, out); err != nil || out.Checksum != checksum([]byte("v:k")) {
+		t.Fatalf("get: checksum %08x, %v", out.Checksum, err)
+	}
+
+	// 传输中被截断的值
+	truncated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(protocolHeader, strconv.Itoa(ProtocolVersion))
+		w.Header().Set("Content-Type", streamContentType)
+		w.Header().Set(checksumHeader, strconv.FormatUint(uint64(checksum([]byte("value"))), 10))
+		io.WriteString(w, "val")
+	}))
+	defer truncated.Close()
+	getter = &httpGetter{baseURL: truncated.URL + defaultBasePath}
+	if err := getter.Get(ctx, &pb.Request{Group: "checksum", Key: "k"}, out); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("truncated value: %q, %v", out.Value, err)
+	}
+	if err := getter.GetStream(ctx, &pb.Request{Group: "checksum", Key: "k"}, io.Discard); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("truncated stream: %v", err)
+	}
+
+	// 归属节点返回损坏的值时回退到本地加载，并计入统计
+	g := NewGroup("checksum-client", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}), WithCacheBytes(2<<10))
+	pool := NewHTTPPoolOpts("http://self:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set(truncated.URL)
+	g.RegisterPeers(pool)
+	if v, err := g.Get("k"); err != nil || v.String() != "local" || g.Stats.Corrupted.Get() != 1 {
+		t.Fatalf("get = %q, %d corrupted, %v", v.String(), g.Stats.Corrupted.Get(), err)
+	}
+}
@@ -0,0 +1,27 @@
+// Package keyspace maps the keys of the text protocol servers,
+// memcachedserver and redisserver, to geecache groups.
+package keyspace
+
+import (
+	"GeeCache/geecache"
+	"slices"
+	"strings"
+)
+
+// Resolve returns the group and key named by key: with separator ":",
+// the key "users:42" is the key "42" of the group "users" when "users" is
+// one of groups, and a key of group def otherwise. It reports false if
+// key names no group and def is nil.
+func Resolve(def *geecache.Group, separator string, groups []string, key string) (*geecache.Group, string, bool) {
+	if separator != "" {
+		if name, rest, ok := strings.Cut(key, separator); ok && slices.Contains(groups, name) {
+			if g := geecache.GetGroup(name); g != nil {
+				return g, rest, true
+			}
+		}
+	}
+	if def == nil {
+		return nil, "", false
+	}
+	return def, key, true
+}
@@ -0,0 +1,152 @@
+// Package resp reads and writes the subset of RESP, the Redis protocol,
+// spoken by the Redis store, the Redis invalidation subscriber and
+// redisserver.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrLineTooLong reports a line that doesn't fit in the buffer of the
+// reader.
+var ErrLineTooLong = errors.New("resp: line too long")
+
+// Error is an error reply of the server; the connection stays usable.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// ProtocolError is a malformed command, after which the connection can't
+// be read any further.
+type ProtocolError string
+
+func (e ProtocolError) Error() string { return "Protocol error: " + string(e) }
+
+// ReadLine reads a line without its trailing "\r\n" or "\n".
+func ReadLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", ErrLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// readBulk reads the n bytes of a bulk string and the "\r\n" after them.
+func readBulk(r *bufio.Reader, n int) ([]byte, error) {
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+// ReadReply reads a reply of the server: a string, int64, []byte,
+// []interface{} or nil, or an Error. Bulk strings and arrays longer than
+// max are refused, max <= 0 for no bound.
+func ReadReply(r *bufio.Reader, max int) (interface{}, error) {
+	line, err := ReadLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 1 {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, rest := line[0], line[1:]
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, Error(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$', '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || max > 0 && n > max {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if kind == '$' {
+			return readBulk(r, n)
+		}
+		// 数组的长度来自对端，按收到的元素逐个增长
+		a := make([]interface{}, 0, min(n, 16))
+		for i := 0; i < n; i++ {
+			v, err := ReadReply(r, max)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("redis: unsupported reply %q", line)
+}
+
+// ReadCommand reads a command sent by a client as an array of at most
+// maxArgs bulk strings of at most max bytes, or as an inline command line
+// like those typed into telnet. Malformed commands are ProtocolErrors.
+func ReadCommand(r *bufio.Reader, maxArgs, max int) ([]string, error) {
+	line, err := ReadLine(r)
+	if err == ErrLineTooLong {
+		return nil, ProtocolError("too big inline request")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, ProtocolError("invalid multibulk length")
+	}
+	args := make([]string, 0, min(n, 16))
+	for i := 0; i < n; i++ {
+		line, err := ReadLine(r)
+		if err == ErrLineTooLong || err == nil && !strings.HasPrefix(line, "$") {
+			return nil, ProtocolError("expected '$'")
+		}
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > max {
+			return nil, ProtocolError("invalid bulk length")
+		}
+		b, err := readBulk(r, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, string(b))
+	}
+	return args, nil
+}
+
+// WriteCommand sends a command, each of args a string or []byte, as an
+// array of bulk strings and flushes w.
+func WriteCommand(w *bufio.Writer, args ...interface{}) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		var b []byte
+		switch a := a.(type) {
+		case string:
+			b = []byte(a)
+		case []byte:
+			b = a
+		}
+		fmt.Fprintf(w, "$%d\r\n", len(b))
+		w.Write(b)
+		w.WriteString("\r\n")
+	}
+	return w.Flush()
+}
@@ -0,0 +1,100 @@
+// Package tcpserver holds the listener and connection bookkeeping shared
+// by the TCP servers of geecache: the peer protocol of TCPPool and the
+// text protocols of memcachedserver and redisserver.
+package tcpserver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Conns tracks the listeners and connections of a server, so that Close
+// can stop them all. The zero value is ready to use.
+type Conns struct {
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	closed    bool
+}
+
+// Serve accepts connections on l until Close, serving each of them with
+// serve in its own goroutine and closing it once serve returns. It
+// returns errClosed after Close.
+func (s *Conns) Serve(l net.Listener, serve func(net.Conn), errClosed error) error {
+	if !s.track(l, nil, true) {
+		l.Close()
+		return errClosed
+	}
+	defer s.track(l, nil, false)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if s.Closed() {
+				return errClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		if !s.track(nil, c, true) {
+			c.Close()
+			return errClosed
+		}
+		go func() {
+			defer s.track(nil, c, false)
+			defer c.Close()
+			serve(c)
+		}()
+	}
+}
+
+// Close stops the listeners and closes the open connections.
+func (s *Conns) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return nil
+}
+
+// Closed reports whether Close was called.
+func (s *Conns) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// track adds or removes a listener or connection, reporting false when
+// adding to a closed server.
+func (s *Conns) track(l net.Listener, c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add && s.closed {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+		s.conns = make(map[net.Conn]bool)
+	}
+	switch {
+	case l != nil && add:
+		s.listeners[l] = true
+	case l != nil:
+		delete(s.listeners, l)
+	case add:
+		s.conns[c] = true
+	default:
+		delete(s.conns, c)
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+// Package invalidate applies invalidation messages published on a Redis
+// channel or a NATS subject to the local groups, so that services which
+// change the origin of a cache, in any language, can drop the stale
+// values from every node without talking to geecache.
+//
+// Every node runs its own Subscriber: the broker fans the messages out,
+// and each node only drops its own copies. A message is a JSON object
+// naming the group and one of key, prefix or tag:
+//
+//	{"group": "users", "key": "user:42:profile"}
+//	{"group": "users", "prefix": "user:42:"}
+//	{"group": "users", "tag": "team:7"}
+//
+// Pub/sub delivers at most once: messages published while a node is
+// disconnected from the broker are lost, so pair the bridge with TTLs.
+package invalidate
+
+import (
+	"GeeCache/geecache"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// maxMessage bounds the size of a message read from the broker.
+const maxMessage = 1 << 20
+
+// Message is an invalidation received from the broker.
+type Message struct {
+	Group  string `json:"group"`
+	Key    string `json:"key,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+}
+
+// Options configures a Subscriber. The zero value is usable.
+type Options struct {
+	// User, Password and Token authenticate to the broker: Redis takes
+	// the password, with the user for an ACL user; NATS takes the user
+	// and password or the token.
+	User     string
+	Password string
+	Token    string
+	// Tag returns the keys of group carrying tag. Groups don't track tags
+	// themselves, so messages naming a tag are dropped if it is nil.
+	Tag func(group, tag string) []string
+	// DialTimeout bounds connecting to the broker, 5s if 0.
+	DialTimeout time.Duration
+	// RetryDelay is the wait before connecting again after the
+	// connection to the broker is lost, 1s if 0.
+	RetryDelay time.Duration
+	Logger     geecache.Logger // defaults to the standard logger
+}
+
+// A Subscriber receives invalidation messages from a broker and applies
+// them to the groups of this process.
+type Subscriber struct {
+	name string // for logs, e.g. "redis 10.0.0.5:6379 invalidations"
+	opts Options
+	dial func(ctx context.Context) (receiver, error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// receiver is a subscription to a broker.
+type receiver interface {
+	// next returns the payload of the next message.
+	next() ([]byte, error)
+	io.Closer
+}
+
+func newSubscriber(name string, o *Options, dial func(ctx context.Context, o *Options) (receiver, error)) *Subscriber {
+	s := &Subscriber{name: name}
+	if o != nil {
+		s.opts = *o
+	}
+	if s.opts.DialTimeout <= 0 {
+		s.opts.DialTimeout = 5 * time.Second
+	}
+	if s.opts.RetryDelay <= 0 {
+		s.opts.RetryDelay = time.Second
+	}
+	if s.opts.Logger == nil {
+		s.opts.Logger = geecache.NewStdLogger(log.Default(), geecache.LevelInfo)
+	}
+	s.dial = func(ctx context.Context) (receiver, error) { return dial(ctx, &s.opts) }
+	return s
+}
+
+// Start subscribes in the background, connecting again whenever the
+// connection is lost, until Stop.
+func (s *Subscriber) Start() {
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.done = make(chan struct{})
+	go s.run()
+}
+
+// Stop ends the subscription and waits for the message being applied.
+func (s *Subscriber) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+func (s *Subscriber) run() {
+	defer close(s.done)
+	for {
+		err := s.session()
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.opts.Logger.Warn("invalidation subscription lost", "source", s.name, "err", err)
+		select {
+		case <-time.After(s.opts.RetryDelay):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// session subscribes once and applies the messages until the connection
+// fails or Stop is called.
+func (s *Subscriber) session() error {
+	ctx, cancel := context.WithTimeout(s.ctx, s.opts.DialTimeout)
+	r, err := s.dial(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// Stop 时关闭连接，打断阻塞中的读取
+	stop := context.AfterFunc(s.ctx, func() { r.Close() })
+	defer stop()
+	s.opts.Logger.Info("subscribed to invalidations", "source", s.name)
+	for {
+		payload, err := r.next()
+		if err != nil {
+			return err
+		}
+		var m Message
+		if err := json.Unmarshal(payload, &m); err != nil {
+			s.opts.Logger.Warn("malformed invalidation", "source", s.name, "err", err)
+			continue
+		}
+		if err := s.Apply(m); err != nil {
+			s.opts.Logger.Warn("invalidation not applied", "source", s.name, "group", m.Group, "err", err)
+		}
+	}
+}
+
+// Apply drops the values m invalidates from this process's group.
+func (s *Subscriber) Apply(m Message) error {
+	g := geecache.GetGroup(m.Group)
+	if g == nil {
+		return fmt.Errorf("%w: %s", geecache.ErrGroupNotFound, m.Group)
+	}
+	switch {
+	case m.Key != "":
+		g.Remove(m.Key)
+	case m.Prefix != "":
+		g.RemovePrefix(m.Prefix)
+	case m.Tag != "":
+		if s.opts.Tag == nil {
+			return fmt.Errorf("no Tag resolver for tag %q", m.Tag)
+		}
+		for _, key := range s.opts.Tag(m.Group, m.Tag) {
+			g.Remove(key)
+		}
+	default:
+		return errors.New("message names no key, prefix or tag")
+	}
+	return nil
+}
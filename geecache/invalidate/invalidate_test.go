@@ -0,0 +1,126 @@
+package invalidate
+
+import (
+	"GeeCache/geecache"
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBroker accepts one subscriber, lets handshake answer its requests
+// and then sends it every message of the test, framed by frame.
+func fakeBroker(t *testing.T, handshake func(c net.Conn, r *bufio.Reader) error, frame func(payload string) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if err := handshake(c, bufio.NewReader(c)); err != nil {
+			t.Error(err)
+			return
+		}
+		for _, m := range []string{
+			`not json`,
+			`{"group": "nobody", "key": "a"}`,
+			`{"group": "%s", "key": "a"}`,
+			`{"group": "%s", "prefix": "user:1:"}`,
+			`{"group": "%s", "tag": "team"}`,
+		} {
+			if strings.Contains(m, "%s") {
+				m = fmt.Sprintf(m, t.Name())
+			}
+			fmt.Fprint(c, frame(m))
+		}
+		// 等订阅方断开
+		c.Read(make([]byte, 1))
+	}()
+	return l.Addr().String()
+}
+
+// expect reads a line and fails unless it starts with prefix.
+func expect(r *bufio.Reader, prefix string) error {
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("got %q, %v, want %s", line, err, prefix)
+	}
+	return nil
+}
+
+func testSubscriber(t *testing.T, newSubscriber func(o *Options) *Subscriber) {
+	g := geecache.NewGroup(t.Name(), geecache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), geecache.WithPrefixIndex(':'))
+	for _, key := range []string{"a", "b", "user:1:x", "user:1:y", "t1", "t2"} {
+		if _, err := g.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := newSubscriber(&Options{
+		Tag:    func(group, tag string) []string { return []string{"t1", "t2"} },
+		Logger: geecache.NewStdLogger(nil, geecache.LevelError+1),
+	})
+	s.Start()
+	defer s.Stop()
+	for deadline := time.Now().Add(5 * time.Second); g.PrefixStats("").Items != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d keys left, want only b", g.PrefixStats("").Items)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if g.PrefixStats("b").Items != 1 {
+		t.Fatal("b was dropped")
+	}
+}
+
+func TestRedis(t *testing.T) {
+	addr := fakeBroker(t, func(c net.Conn, r *bufio.Reader) error {
+		for _, want := range []string{"*3", "$4", "AUTH", "$4", "user", "$6", "secret"} {
+			if err := expect(r, want); err != nil {
+				return err
+			}
+		}
+		fmt.Fprint(c, "+OK\r\n")
+		for _, want := range []string{"*2", "$9", "SUBSCRIBE", "$5", "inval"} {
+			if err := expect(r, want); err != nil {
+				return err
+			}
+		}
+		fmt.Fprint(c, "*3\r\n$9\r\nsubscribe\r\n$5\r\ninval\r\n:1\r\n")
+		return nil
+	}, func(payload string) string {
+		return fmt.Sprintf("*3\r\n$7\r\nmessage\r\n$5\r\ninval\r\n$%d\r\n%s\r\n", len(payload), payload)
+	})
+	testSubscriber(t, func(o *Options) *Subscriber {
+		o.User, o.Password = "user", "secret"
+		return NewRedis(addr, "inval", o)
+	})
+}
+
+func TestNATS(t *testing.T) {
+	addr := fakeBroker(t, func(c net.Conn, r *bufio.Reader) error {
+		fmt.Fprint(c, "INFO {\"server_id\":\"fake\"}\r\n")
+		for _, want := range []string{`CONNECT {"verbose":false,"pedantic":false,"name":"geecache","auth_token":"secret"}`, "SUB inval.> 1", "PING"} {
+			if err := expect(r, want); err != nil {
+				return err
+			}
+		}
+		// 订阅方必须回应服务器的 PING
+		fmt.Fprint(c, "+OK\r\nPONG\r\nPING\r\n")
+		return expect(r, "PONG")
+	}, func(payload string) string {
+		return fmt.Sprintf("MSG inval.users 1 %d\r\n%s\r\n", len(payload), payload)
+	})
+	testSubscriber(t, func(o *Options) *Subscriber {
+		o.Token = "secret"
+		return NewNATS(addr, "inval.>", o)
+	})
+}
@@ -0,0 +1,111 @@
+package invalidate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NATS 的客户端协议是文本行：连接后服务器先发 INFO，客户端回 CONNECT 与 SUB，
+// 之后服务器以 "MSG <subject> <sid> [reply-to] <#bytes>" 推送消息，并定期 PING
+
+// NewNATS returns a Subscriber to the NATS subject at addr (host:port),
+// which may contain wildcards. o may be nil.
+func NewNATS(addr, subject string, o *Options) *Subscriber {
+	return newSubscriber("nats "+addr+" "+subject, o, func(ctx context.Context, o *Options) (receiver, error) {
+		return subscribeNATS(ctx, addr, subject, o)
+	})
+}
+
+type natsReceiver struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func subscribeNATS(ctx context.Context, addr, subject string, o *Options) (receiver, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &natsReceiver{Conn: nc, r: bufio.NewReader(nc)}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	line, err := c.line()
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		c.Close()
+		return nil, fmt.Errorf("nats: expected INFO, got %q: %v", line, err)
+	}
+	connect, _ := json.Marshal(struct {
+		Verbose  bool   `json:"verbose"`
+		Pedantic bool   `json:"pedantic"`
+		Name     string `json:"name"`
+		User     string `json:"user,omitempty"`
+		Pass     string `json:"pass,omitempty"`
+		Token    string `json:"auth_token,omitempty"`
+	}{Name: "geecache", User: o.User, Pass: o.Password, Token: o.Token})
+	// 以 PING 结束：收到 PONG 说明 CONNECT 与 SUB 都已被接受
+	fmt.Fprintf(c, "CONNECT %s\r\nSUB %s 1\r\nPING\r\n", connect, subject)
+	for {
+		line, err := c.line()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			c.Close()
+			return nil, fmt.Errorf("nats: %s", line)
+		}
+	}
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// next implements receiver.
+func (c *natsReceiver) next() ([]byte, error) {
+	for {
+		line, err := c.line()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case line == "PING":
+			// 不回应的客户端会被服务器断开
+			if _, err := io.WriteString(c, "PONG\r\n"); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "MSG "):
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if len(fields) < 4 || err != nil || n < 0 || n > maxMessage {
+				return nil, fmt.Errorf("nats: malformed message %q", line)
+			}
+			b := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, b); err != nil {
+				return nil, err
+			}
+			return b[:n], nil
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, fmt.Errorf("nats: %s", line)
+		}
+	}
+}
+
+// line reads a protocol line without its CRLF.
+func (c *natsReceiver) line() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
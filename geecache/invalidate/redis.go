@@ -0,0 +1,93 @@
+package invalidate
+
+import (
+	"GeeCache/geecache/internal/resp"
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// 只需要 AUTH 与 SUBSCRIBE，与 store 包一样使用 internal/resp
+
+// NewRedis returns a Subscriber to the Redis channel at addr (host:port).
+// o may be nil.
+func NewRedis(addr, channel string, o *Options) *Subscriber {
+	return newSubscriber("redis "+addr+" "+channel, o, func(ctx context.Context, o *Options) (receiver, error) {
+		return subscribeRedis(ctx, addr, channel, o)
+	})
+}
+
+type redisReceiver struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func subscribeRedis(ctx context.Context, addr, channel string, o *Options) (receiver, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisReceiver{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	if o.Password != "" {
+		args := []interface{}{"AUTH", o.Password}
+		if o.User != "" {
+			args = []interface{}{"AUTH", o.User, o.Password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	reply, err := c.do("SUBSCRIBE", channel)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if a, ok := reply.([]interface{}); !ok || len(a) != 3 || !isBulk(a[0], "subscribe") {
+		c.Close()
+		return nil, fmt.Errorf("redis: unexpected reply to SUBSCRIBE %v", reply)
+	}
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// next implements receiver.
+func (c *redisReceiver) next() ([]byte, error) {
+	for {
+		reply, err := c.reply()
+		if err != nil {
+			return nil, err
+		}
+		// 订阅状态下只会收到 ["message", channel, payload]
+		if a, ok := reply.([]interface{}); ok && len(a) == 3 && isBulk(a[0], "message") {
+			if payload, ok := a[2].([]byte); ok {
+				return payload, nil
+			}
+		}
+	}
+}
+
+func isBulk(v interface{}, s string) bool {
+	b, ok := v.([]byte)
+	return ok && string(b) == s
+}
+
+// do sends a command and reads the reply.
+func (c *redisReceiver) do(args ...interface{}) (interface{}, error) {
+	if err := resp.WriteCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// reply reads a reply: a string, []byte, int64, []interface{} or nil.
+func (c *redisReceiver) reply() (interface{}, error) {
+	return resp.ReadReply(c.r, maxMessage)
+}
@@ -0,0 +1,201 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 租约：未命中时由归属节点发放一个短期令牌，只有持有有效令牌的一方才能填充缓存。
+// 删除或写入会撤销令牌，这样在此之前开始的加载即使更晚完成，也不会把旧值写回去
+
+// WithLeases makes the owner of a key grant a lease, valid for ttl, on a
+// miss, and only accept values filling the cache from the lease holder.
+// Removing or writing the key revokes its lease, so that a load started
+// before will not cache a stale value when it completes later; the
+// group's own loads take a lease as well. Set is refused with
+// ErrLeaseInvalid: values must come from GetLease and SetLeased, or from
+// the Getter. CompareAndSet and updates are unaffected.
+func WithLeases(ttl time.Duration) Option {
+	return func(g *Group) {
+		g.leases = &leaseTable{ttl: ttl, held: make(map[string]lease)}
+	}
+}
+
+type lease struct {
+	token  uint64
+	expire time.Time
+}
+
+// leaseTable holds the leases granted on the keys this node owns.
+type leaseTable struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	held map[string]lease
+}
+
+// maxLeases is how many leases may be outstanding before expired ones
+// are swept.
+const maxLeases = 1024
+
+// grant leases key with token unless a valid lease is held on it.
+func (t *leaseTable) grant(key string, token uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if l, ok := t.held[key]; ok && now.Before(l.expire) {
+		return false
+	}
+	if len(t.held) >= maxLeases {
+		// 持有者没有归还的租约只能等过期后清理
+		for k, l := range t.held {
+			if !now.Before(l.expire) {
+				delete(t.held, k)
+			}
+		}
+	}
+	t.held[key] = lease{token: token, expire: now.Add(t.ttl)}
+	return true
+}
+
+// redeem ends the lease on key, reporting whether token was valid.
+func (t *leaseTable) redeem(key string, token uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.held[key]
+	if !ok || l.token != token {
+		return false
+	}
+	delete(t.held, key)
+	return token != 0 && time.Now().Before(l.expire)
+}
+
+// revoke ends the lease on key, if any.
+func (t *leaseTable) revoke(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.held, key)
+}
+
+// revokePrefix ends the leases on the keys starting with prefix.
+func (t *leaseTable) revokePrefix(prefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k := range t.held {
+		if strings.HasPrefix(k, prefix) {
+			delete(t.held, k)
+		}
+	}
+}
+
+// GetLease returns the value of key cached on its owner without loading
+// it. On a miss the value is empty and lease is a token for SetLeased:
+// the caller loads the value from its source and fills the cache with it.
+// While the lease is held, other callers get ErrLeaseHeld and should retry
+// shortly, by when the holder has likely filled the cache. The group must
+// be created WithLeases on every node.
+func (g *Group) GetLease(ctx context.Context, key string) (value ByteView, lease uint64, err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.GetLease")
+	defer func() { endSpan(span, err) }()
+	span.SetAttribute("geecache.group", g.name)
+	if key == "" {
+		return ByteView{}, 0, fmt.Errorf("key is required")
+	}
+	g.Stats.Gets.Add(1)
+	routeKey := g.routeKey(key, "")
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(routeKey); ok {
+			in := &pb.Request{Group: g.name, Key: key, Lease: true}
+			if routeKey != key {
+				in.Affinity = routeKey
+			}
+			out := &pb.Response{}
+			if err := peer.Get(ctx, in, out); err != nil {
+				return ByteView{}, 0, err
+			}
+			if out.Lease == 0 {
+				g.Stats.CacheHits.Add(1)
+			}
+			return ByteView{b: out.Value, version: out.Version}, out.Lease, nil
+		}
+	}
+	return g.leaseLocally(key)
+}
+
+// leaseLocally looks key up in the cache of its owner, this node,
+// granting a lease on a miss.
+func (g *Group) leaseLocally(key string) (ByteView, uint64, error) {
+	if g.leases == nil {
+		return ByteView{}, 0, fmt.Errorf("geecache: group %s has no leases", g.name)
+	}
+	if v, ok := g.pins.get(key); ok {
+		g.Stats.CacheHits.Add(1)
+		return v, 0, nil
+	}
+	if v, ok := g.mainCache.get(key); ok {
+		g.Stats.CacheHits.Add(1)
+		return v, 0, nil
+	}
+	token := g.versions.next()
+	if !g.leases.grant(key, token) {
+		return ByteView{}, 0, fmt.Errorf("%w: %q", ErrLeaseHeld, key)
+	}
+	return ByteView{}, token, nil
+}
+
+// serveLease answers a GetLease from a peer with a protobuf response,
+// which carries the lease.
+func (p *HTTPPool) serveLease(w http.ResponseWriter, group *Group, key string) {
+	view, lease, err := group.leaseLocally(key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice(), Version: view.Version(), Lease: lease, ProtocolVersion: ProtocolVersion,
+		Checksum: view.checksum()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+// SetLeased fills the cache of the owner of key with value under the lease
+// GetLease granted, failing with ErrLeaseInvalid if the lease expired or
+// was revoked since: the value may be stale, and the caller should simply
+// not cache it. Unlike Set it never writes to the group's store.
+func (g *Group) SetLeased(ctx context.Context, key string, value []byte, lease uint64) (err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.SetLeased")
+	defer func() { endSpan(span, err) }()
+	span.SetAttribute("geecache.group", g.name)
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	view := ByteView{b: cloneBytes(value)}
+	if size := int64(len(key) + view.Len()); g.maxEntry > 0 && size > g.maxEntry {
+		return fmt.Errorf("%w: %d bytes for key %q", ErrValueTooLarge, size, key)
+	}
+	g.Stats.Sets.Add(1)
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(g.routeKey(key, "")); ok {
+			return g.setOnPeer(ctx, peer, &pb.SetRequest{Group: g.name, Key: key, Value: view.b, Lease: lease})
+		}
+	}
+	return g.setLeasedLocally(key, view, lease)
+}
+
+// setLeasedLocally caches value on the owner of key if lease is valid.
+func (g *Group) setLeasedLocally(key string, value ByteView, lease uint64) error {
+	if g.leases == nil || !g.leases.redeem(key, lease) {
+		g.Stats.LeasesRejected.Add(1)
+		return fmt.Errorf("%w: %q", ErrLeaseInvalid, key)
+	}
+	g.setLocally(key, value)
+	return nil
+}
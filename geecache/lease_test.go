@@ -0,0 +1,105 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLeases(t *testing.T) {
+	ctx := context.Background()
+	g := NewGroup("leases", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}), WithCacheBytes(2<<10), WithLeases(time.Second))
+
+	_, lease, err := g.GetLease(ctx, "k")
+	if err != nil || lease == 0 {
+		t.Fatalf("miss: lease %d, %v", lease, err)
+	}
+	if _, _, err := g.GetLease(ctx, "k"); !errors.Is(err, ErrLeaseHeld) {
+		t.Fatalf("second miss: %v", err)
+	}
+	if err := g.Set(ctx, "k", []byte("v")); !errors.Is(err, ErrLeaseInvalid) {
+		t.Fatalf("Set without a lease: %v", err)
+	}
+
+	// 删除撤销了租约，之前读到的值可能已经过时
+	g.Remove("k")
+	if err := g.SetLeased(ctx, "k", []byte("stale"), lease); !errors.Is(err, ErrLeaseInvalid) {
+		t.Fatalf("SetLeased after Remove: %v", err)
+	}
+	_, lease, _ = g.GetLease(ctx, "k")
+	if err := g.SetLeased(ctx, "k", []byte("fresh"), lease); err != nil {
+		t.Fatal(err)
+	}
+	if v, lease, err := g.GetLease(ctx, "k"); err != nil || lease != 0 || v.String() != "fresh" {
+		t.Fatalf("hit: %q, lease %d, %v", v.String(), lease, err)
+	}
+	if err := g.SetLeased(ctx, "k", []byte("again"), lease); !errors.Is(err, ErrLeaseInvalid) {
+		t.Fatalf("lease used twice: %v", err)
+	}
+	if n := g.Stats.LeasesRejected.Get(); n != 3 {
+		t.Fatalf("%d values rejected, want 3", n)
+	}
+}
+
+func TestLeaseRevokesLoad(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("lease-load", GetterFunc(func(key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("old"), nil
+	}), WithCacheBytes(2<<10), WithLeases(time.Second))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if v, err := g.Get("k"); err != nil || v.String() != "old" {
+			t.Errorf("Get = %q, %v", v.String(), err)
+		}
+	}()
+	<-started
+	g.Remove("k") // 加载期间删除，加载结果不能再进缓存
+	close(release)
+	<-done
+	if st := g.CacheStats(); st.Items != 0 {
+		t.Fatalf("value loaded before Remove was cached: %+v", st)
+	}
+}
+
+func TestLeaseOnPeer(t *testing.T) {
+	ctx := context.Background()
+	NewGroup("lease-peer", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10), WithLeases(time.Second))
+	owner := NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}})
+	srv := httptest.NewServer(owner)
+	defer srv.Close()
+
+	// 同一进程中的 group 是共享的，另建一个 group 通过 HTTP 访问归属节点
+	g := NewGroup("lease-peer-client", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithCacheBytes(2<<10), WithLeases(time.Second))
+	g.name = "lease-peer"
+	pool := NewHTTPPoolOpts("http://self:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set(srv.URL)
+	g.RegisterPeers(pool)
+
+	_, lease, err := g.GetLease(ctx, "k")
+	if err != nil || lease == 0 {
+		t.Fatalf("miss: lease %d, %v", lease, err)
+	}
+	if _, _, err := g.GetLease(ctx, "k"); !errors.Is(err, ErrLeaseHeld) {
+		t.Fatalf("second miss: %v", err)
+	}
+	if err := g.SetLeased(ctx, "k", []byte("v"), lease+1); !errors.Is(err, ErrLeaseInvalid) {
+		t.Fatalf("wrong lease: %v", err)
+	}
+	if err := g.SetLeased(ctx, "k", []byte("v"), lease); err != nil {
+		t.Fatal(err)
+	}
+	if v, lease, err := g.GetLease(ctx, "k"); err != nil || lease != 0 || v.String() != "v" {
+		t.Fatalf("hit: %q, lease %d, %v", v.String(), lease, err)
+	}
+}
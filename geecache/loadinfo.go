@@ -0,0 +1,51 @@
+package geecache
+
+import "time"
+
+// 记录一次 Get 的值从哪里来、各阶段耗时多少，便于应用定位延迟的来源
+
+// A LoadSource tells where the value returned by Get came from.
+type LoadSource int
+
+const (
+	SourceCache  LoadSource = iota // this node's cache
+	SourcePeer                     // the peer owning the key
+	SourceLoader                   // the group's Getter
+)
+
+func (s LoadSource) String() string {
+	switch s {
+	case SourceCache:
+		return "cache"
+	case SourcePeer:
+		return "peer"
+	case SourceLoader:
+		return "loader"
+	}
+	return "unknown"
+}
+
+// LoadInfo describes how a Get call was served.
+type LoadInfo struct {
+	Source LoadSource
+	Total  time.Duration // duration of the whole call
+	Peer   time.Duration // spent asking the owning peer, including a failed attempt
+	Loader time.Duration // spent in the Getter
+	Bytes  int           // length of the returned value
+	// Shared is set when the call waited for a load started by a concurrent
+	// call for the same key; Peer and Loader are then those of that load.
+	Shared bool
+}
+
+// WithLoadInfo makes Get fill info in before returning, also on error.
+func WithLoadInfo(info *LoadInfo) GetOption {
+	return func(o *getOptions) {
+		o.info = info
+	}
+}
+
+// loadResult is what a load shares with the concurrent callers it serves.
+type loadResult struct {
+	value ByteView
+	info  LoadInfo
+}
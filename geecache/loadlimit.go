@@ -0,0 +1,109 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 回源并发限制：同时进行的本地加载数有上限，超出的加载排队等待片刻，
+// 队列也满了就直接失败（或返回过期的旧值），避免大量 goroutine 压垮已经变慢的数据源
+
+// LoadLimit bounds the loads a group runs at once, from its Store or its
+// Getter. Unlike AdmissionControl it is a hard limit.
+type LoadLimit struct {
+	MaxLoads int // concurrent loads
+	// MaxQueue is how many loads may wait for one of the MaxLoads to
+	// finish; further loads fail right away. 0 disables waiting.
+	MaxQueue int
+	// QueueTimeout is how long a load waits at most, 0 for as long as the
+	// context of the Get allows.
+	QueueTimeout time.Duration
+	// ServeStale answers loads that can't run with the expired value of
+	// the key, if it is still cached, instead of ErrOverloaded. Expired
+	// entries then stay cached until they're evicted to make room.
+	ServeStale bool
+}
+
+// WithLoadLimit bounds the group's concurrent loads, failing those over
+// the limit with ErrOverloaded. Loads over the limit are counted in
+// Stats.LoadsRejected, stale values served in Stats.StaleHits.
+func WithLoadLimit(l LoadLimit) Option {
+	return func(g *Group) {
+		if l.MaxLoads < 1 {
+			l.MaxLoads = 1
+		}
+		g.loadLimit = &loadLimiter{cfg: l, slots: make(chan struct{}, l.MaxLoads)}
+		g.cacheOpts.keepExpired = l.ServeStale
+	}
+}
+
+type loadLimiter struct {
+	cfg     LoadLimit
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+// acquire takes a slot for a load, waiting in the queue if there's room.
+// release must be called once the load is done.
+func (l *loadLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.waiting.Add(1) > int64(l.cfg.MaxQueue) {
+		l.waiting.Add(-1)
+		return ErrOverloaded
+	}
+	defer l.waiting.Add(-1)
+	var timeout <-chan time.Time
+	if l.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(l.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrOverloaded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *loadLimiter) release() {
+	<-l.slots
+}
+
+// limitLoad takes a load slot for key. If none is available it returns
+// the expired value of key with ok set, when the limit allows it, or the
+// error to fail the load with.
+func (g *Group) limitLoad(ctx context.Context, key string) (stale ByteView, ok bool, err error) {
+	err = g.loadLimit.acquire(ctx)
+	if err == nil {
+		return ByteView{}, false, nil
+	}
+	g.Stats.LoadsRejected.Add(1)
+	if g.loadLimit.cfg.ServeStale && bypassOf(ctx) == bypassNone {
+		if v, found := g.mainCache.stale(key); found {
+			g.Stats.StaleHits.Add(1)
+			return v, true, err
+		}
+	}
+	if err == ErrOverloaded {
+		err = fmt.Errorf("%w: group %s has %d loads running", ErrOverloaded, g.name, g.loadLimit.cfg.MaxLoads)
+	}
+	return ByteView{}, false, err
+}
+
+// Loading returns how many loads the group runs and how many wait for
+// their turn, both 0 without WithLoadLimit.
+func (g *Group) Loading() (running, waiting int) {
+	if g.loadLimit == nil {
+		return 0, 0
+	}
+	return len(g.loadLimit.slots), int(g.loadLimit.waiting.Load())
+}
@@ -0,0 +1,93 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadLimit(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	started := 0
+	g := NewGroup("load-limit", GetterFunc(func(key string) ([]byte, error) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+		<-release
+		return []byte("v:" + key), nil
+	}), WithLoadLimit(LoadLimit{MaxLoads: 2, MaxQueue: 1, QueueTimeout: time.Hour}))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i, key := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			_, errs[i] = g.Get(key)
+		}(i, key)
+	}
+	// 两个在加载，一个在排队，第四个直接失败
+	deadline := time.Now().Add(time.Second)
+	for {
+		if running, waiting := g.Loading(); running == 2 && waiting == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("loads didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := g.Get("d"); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("load over the queue: %v, want ErrOverloaded", err)
+	}
+	close(release)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("load %d: %v", i, err)
+		}
+	}
+	if started != 3 || g.Stats.LoadsRejected.Get() != 1 {
+		t.Fatalf("%d loads ran, %d rejected", started, g.Stats.LoadsRejected.Get())
+	}
+	if _, err := g.Get("e"); err != nil {
+		t.Fatalf("load under the limit: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g.loadLimit.slots <- struct{}{} // 占满剩下的名额
+	g.loadLimit.slots <- struct{}{}
+	if _, err := g.GetContext(ctx, "f"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("queued load of a canceled Get: %v", err)
+	}
+}
+
+func TestLoadLimitServeStale(t *testing.T) {
+	block := make(chan struct{})
+	loading := make(chan struct{}, 1)
+	g := NewGroup("load-limit-stale", GetterFunc(func(key string) ([]byte, error) {
+		if key == "busy" {
+			loading <- struct{}{}
+			<-block
+		}
+		return []byte("v:" + key), nil
+	}), WithLoadLimit(LoadLimit{MaxLoads: 1, ServeStale: true}), WithPolicy("short:", Policy{TTL: 10 * time.Millisecond}))
+	if _, err := g.Get("short:k"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	go g.Get("busy")
+	<-loading
+	v, err := g.Get("short:k")
+	if err != nil || v.String() != "v:short:k" || g.Stats.StaleHits.Get() != 1 {
+		t.Fatalf("Get while overloaded = %q, %v with %d stale hits", v.String(), err, g.Stats.StaleHits.Get())
+	}
+	if _, err := g.Get("short:never-cached"); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Get of an uncached key while overloaded: %v", err)
+	}
+	close(block)
+}
@@ -0,0 +1,75 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 回源耗时统计：记录每个 group 调用 Getter 的耗时分布，并把超过阈值的慢加载记入日志，
+// 用来区分是缓存本身慢还是数据源慢
+
+// WithSlowLoadLog logs the loads from the group's Getter taking longer
+// than threshold, with a hash of the key rather than the key itself,
+// which may be sensitive. They are counted in Stats.SlowLoads. The
+// duration of every load is recorded regardless, see LoadLatency.
+func WithSlowLoadLog(threshold time.Duration) Option {
+	return func(g *Group) {
+		g.slowLoad = threshold
+	}
+}
+
+// LoadLatency is the distribution of the durations of a group's loads
+// from its Getter, failed ones included.
+type LoadLatency struct {
+	Count uint64        `json:"count"`
+	Sum   time.Duration `json:"sum"`
+	// Histogram[i] counts the loads taking at most LatencyBuckets[i] and
+	// more than the bound before, the last one those taking longer than
+	// every bound.
+	Histogram []uint64 `json:"histogram"`
+}
+
+// latencyHistogram records durations without locking.
+type latencyHistogram struct {
+	buckets [len(latencyBounds) + 1]atomic.Uint64
+	sum     atomic.Int64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.buckets[latencyBucket(d)].Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *latencyHistogram) snapshot() LoadLatency {
+	l := LoadLatency{Sum: time.Duration(h.sum.Load()), Histogram: make([]uint64, len(h.buckets))}
+	for i := range h.buckets {
+		l.Histogram[i] = h.buckets[i].Load()
+		l.Count += l.Histogram[i]
+	}
+	return l
+}
+
+// LoadLatency returns the distribution of the durations of the group's
+// loads from its Getter.
+func (g *Group) LoadLatency() LoadLatency {
+	return g.loadTimes.snapshot()
+}
+
+// timeLoads wraps the group's Getter, with its middleware, to record the
+// duration of every load and log the slow ones.
+func (g *Group) timeLoads(next Getter) Getter {
+	return GetterFunc(func(key string) ([]byte, error) {
+		start := time.Now()
+		b, err := next.Get(key)
+		d := time.Since(start)
+		g.loadTimes.observe(d)
+		if g.slowLoad > 0 && d > g.slowLoad {
+			g.Stats.SlowLoads.Add(1)
+			g.logger.Warn("[GeeCache] slow load", "group", g.name,
+				"key_hash", fmt.Sprintf("%016x", consistenthash.XXHash64([]byte(key))), "duration", d, "err", err)
+		}
+		return b, err
+	})
+}
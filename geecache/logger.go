@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Logger is the logging interface used by Group and HTTPPool. args are
+// alternating keys and values. *slog.Logger satisfies it, and adapters for
+// zap, zerolog etc. are a few lines each.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// 编译期检查 *slog.Logger 可以直接作为 Logger 使用
+var _ Logger = (*slog.Logger)(nil)
+
+// LogLevel is the minimum level a logger created by NewStdLogger emits.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// NewStdLogger returns a Logger writing "LEVEL msg key=value ..." lines to
+// l, dropping messages below level.
+func NewStdLogger(l *log.Logger, level LogLevel) Logger {
+	return &stdLogger{l: l, level: level}
+}
+
+// defaultLogger is used when no Logger is configured. 命中等高频日志属于 Debug 级别，默认不输出
+var defaultLogger = NewStdLogger(log.Default(), LevelInfo)
+
+type stdLogger struct {
+	l     *log.Logger
+	level LogLevel
+}
+
+func (s *stdLogger) Debug(msg string, args ...any) { s.log(LevelDebug, msg, args) }
+func (s *stdLogger) Info(msg string, args ...any)  { s.log(LevelInfo, msg, args) }
+func (s *stdLogger) Warn(msg string, args ...any)  { s.log(LevelWarn, msg, args) }
+func (s *stdLogger) Error(msg string, args ...any) { s.log(LevelError, msg, args) }
+
+// debugEnabled reports whether l may emit debug messages, so that hot
+// paths can skip building their arguments, which allocates. Loggers other
+// than those of NewStdLogger and *slog.Logger are assumed to.
+func debugEnabled(l Logger) bool {
+	switch l := l.(type) {
+	case *stdLogger:
+		return l.level <= LevelDebug
+	case *slog.Logger:
+		return l.Enabled(context.Background(), slog.LevelDebug)
+	}
+	return true
+}
+
+func (s *stdLogger) log(level LogLevel, msg string, args []any) {
+	if level < s.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+		}
+	}
+	s.l.Output(3, b.String())
+}
@@ -0,0 +1,13 @@
+package lru
+
+// CLOCK（二次机会）淘汰：命中时只设置访问标记，不移动链表节点，缩短读多写少
+// 场景下持锁的时间；淘汰时从队尾开始检查，带标记的节点清除标记后移到队头
+
+// NewClock returns a cache evicting with the CLOCK (second chance)
+// algorithm, an approximation of LRU whose Get only marks the entry as
+// referenced instead of reordering the list.
+func NewClock(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	c := New(maxBytes, onEvicted, 1)
+	c.clock = true
+	return c
+}
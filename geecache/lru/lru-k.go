@@ -1,31 +1,130 @@
 package lru
 
-import "container/list"
+import (
+	"time"
+)
 
 // lru 缓存淘汰策略
 // Cache is a LRU cache. It is not safe for concurrent access.
 type Cache struct {
 	maxBytes int64 //允许使用的最大内存
 	useBytes int64 //当前已使用的内存
-	ll       *list.List
-	mp       map[string]*list.Element //键是字符串，值是双向链表中对应节点的指针
+	s        slab
+	ll       list
+	mp       map[uint64]nodeID //键是 key 的哈希，值是条目在 s 中的下标，哈希冲突的条目经 entry.hnext 相连
 	// optional and executed when an entry is purged.
-	OnEvicted    func(key string, value Value)
-	historyCache HistoryCache // 历史队列，只有访问次数达到k次后才会加入到缓存中
+	OnEvicted func(key string, value Value)
+	// OnCapacityEvicted, if non-nil, is also called, before OnEvicted, for
+	// the entries evicted by RemoveCacheOldest to make room, but not for
+	// removed or expired ones.
+	OnCapacityEvicted func(key string, value Value, o EntryOptions)
+	historyCache      HistoryCache // 历史队列，只有访问次数达到k次后才会加入到缓存中
+	now               func() time.Time
+	peak              int // 上次 Compact 以来缓存与历史队列节点数的最大值
+
+	// OnAdded, if non-nil, is called after Add and AddWith stored a value,
+	// new or replacing another.
+	OnAdded func(key string, value Value)
+	// OnHit and OnMiss, if non-nil, are called by Get when it finds a
+	// value and when it doesn't.
+	OnHit  func(key string, value Value)
+	OnMiss func(key string)
+	// OnExpired, if non-nil, is called by Get when it finds the entry of
+	// key expired, before it counts as a miss and, unless KeepExpired is
+	// set, is removed, calling OnEvicted.
+	OnExpired func(key string, value Value)
+	// OnReplaced, if non-nil, is called by Add and AddWith with the value
+	// they replace; it doesn't count as an eviction.
+	OnReplaced func(key string, old Value)
+
+	// EntryOverhead is added to the size of every entry to account for
+	// the bookkeeping memory the cache allocates per entry, see
+	// DefaultEntryOverhead. Sizer, if non-nil, replaces the size
+	// computation altogether. Both must be set before the first Add.
+	EntryOverhead int64
+	Sizer         func(key string, value Value) int64
+
+	// KeepExpired makes Get leave expired entries in place, reporting a
+	// miss, so that GetStale can still return them until they are
+	// replaced or evicted to make room.
+	KeepExpired bool
+
+	// 分段 LRU（见 NewSLRU）：ll 为保护段，probation 为试用段；其它策略下 probation 为 nil
+	probation      *list
+	protectedRatio float64
+	protectedMax   int64
+	protectedBytes int64
+
+	clock bool // CLOCK 淘汰，见 NewClock
+
+	prefixes *prefixIndex // 见 IndexPrefixes，可为 nil
+}
+
+// DefaultEntryOverhead estimates the memory the cache spends per entry on
+// 64-bit platforms besides the key and value bytes: its slot in the slab
+// (104), its share of the index map (~24) and the boxed value header (~32).
+const DefaultEntryOverhead = 160
+
+// size returns the bytes accounted for an entry.
+func (c *Cache) size(key string, value Value) int64 {
+	if c.Sizer != nil {
+		return c.Sizer(key, value)
+	}
+	return int64(len(key)) + int64(value.Len()) + c.EntryOverhead
 }
 
 type HistoryCache struct {
 	k        int // k次访问后加入缓存
 	maxBytes int64
 	useBytes int64
-	ll       *list.List // 历史队列是以FIFO为淘汰策略
-	mp       map[string]*list.Element
-	cnt      map[string]int // 对每个节点访问次数的统计
+	ll       list // 历史队列是以FIFO为淘汰策略
+	mp       map[uint64]nodeID
 }
 
 type entry struct {
 	key   string
 	value Value
+	atime int64 // 最近一次访问的时间(UnixNano)，历史队列中的节点为入队或最近一次访问的时间
+
+	expire    int64 // 过期时间(UnixNano)，0 表示不过期
+	idle      int64 // 空闲超过该时长(ns)即过期，0 表示不限
+	chances   int   // 淘汰时还能被跳过的次数，见 EntryOptions.Priority
+	probation bool  // 位于 SLRU 的试用段
+	reference bool  // CLOCK 的访问标记
+	hits      int   // 位于历史队列时的访问次数，达到 k 次后加入缓存
+
+	hash       uint64 // key 的哈希，即索引 map 中的键
+	prev, next nodeID // 所在队列中的前后节点；空闲时 next 串起空闲链表
+	hnext      nodeID // 索引 map 中哈希相同的下一个条目
+}
+
+// EntryOptions control the lifetime of a single entry.
+type EntryOptions struct {
+	Expire time.Time     // the entry expires at Expire, zero for never
+	Idle   time.Duration // the entry expires when not accessed for Idle
+	// Priority is how many times the entry survives reaching the tail of
+	// the LRU list: instead of being evicted it is moved back to the front.
+	Priority int
+}
+
+func (e *entry) setOptions(o EntryOptions) {
+	e.expire, e.idle, e.chances = 0, int64(o.Idle), o.Priority
+	if !o.Expire.IsZero() {
+		e.expire = o.Expire.UnixNano()
+	}
+}
+
+func (e *entry) options() EntryOptions {
+	o := EntryOptions{Idle: time.Duration(e.idle), Priority: e.chances}
+	if e.expire != 0 {
+		o.Expire = time.Unix(0, e.expire)
+	}
+	return o
+}
+
+// expired reports whether e is past its TTL or idle timeout at now.
+func (e *entry) expired(now int64) bool {
+	return (e.expire != 0 && now >= e.expire) || (e.idle != 0 && now-e.atime >= e.idle)
 }
 
 // Value use Len to count how many bytes it takes
@@ -37,109 +136,393 @@ type Value interface {
 func New(maxBytes int64, onEvicted func(string, Value), k int) *Cache {
 	return &Cache{
 		maxBytes:  maxBytes,
-		ll:        list.New(),
-		mp:        make(map[string]*list.Element),
+		s:         newSlab(),
+		mp:        make(map[uint64]nodeID),
 		OnEvicted: onEvicted,
+		now:       time.Now,
 		//将某个函数传递给 New 函数，并赋给 OnEvicted 字段，你可以在缓存中的条目被移除时执行自定义的操作，
 		//比如释放资源、记录日志等，可以让 Cache 结构体更加通用和可扩展。
 
 		historyCache: HistoryCache{
 			k:        k, // 可以改为New()传入参，一般用2次命中率和适应性综合考虑最优
 			maxBytes: maxBytes,
-			ll:       list.New(),
-			mp:       make(map[string]*list.Element),
-			cnt:      make(map[string]int),
+			mp:       make(map[uint64]nodeID),
 		},
 	}
 }
 
 // Get look ups a key's value
 func (c *Cache) Get(key string) (value Value, ok bool) {
-	if _, ok = c.mp[key]; ok {
+	value, ok = c.get(key)
+	if ok && c.OnHit != nil {
+		c.OnHit(key, value)
+	} else if !ok && c.OnMiss != nil {
+		c.OnMiss(key)
+	}
+	return value, ok
+}
+
+func (c *Cache) get(key string) (value Value, ok bool) {
+	// 命中时只算一次哈希、查一次 map，也不分配内存
+	h := c.s.hash(key)
+	if id := c.s.find(c.mp, h, key); id != 0 {
 		// 缓存命中了就挪到前面
-		ele := c.mp[key]
-		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
+		kv := c.s.at(id)
+		now := c.now().UnixNano()
+		if kv.expired(now) {
+			if c.OnExpired != nil {
+				c.OnExpired(key, kv.value)
+			}
+			if !c.KeepExpired {
+				c.Remove(key)
+			}
+			return nil, false
+		}
+		c.touch(id)
+		kv.atime = now
 		return kv.value, true
+	}
+	// 缓存未命中，去历史队列查看，如果访问次数达到k次需要加入到缓存中
+	id := c.s.find(c.historyCache.mp, h, key)
+	if id == 0 {
+		// 历史队列也没有就直接返回
+		return nil, false
+	}
+	// 有就根据访问次数看是否要加到缓存中,没达到次数也要将该节点挪到最后,即最晚被FIFO淘汰
+	kv := c.s.at(id)
+	now := c.now().UnixNano()
+	if kv.expired(now) {
+		if c.OnExpired != nil {
+			c.OnExpired(key, kv.value)
+		}
+		c.Remove(key)
+		return nil, false
+	}
+	kv.atime = now
+	kv.hits++
+	value = kv.value // 晋升时可能淘汰掉该条目本身，先取出值
+	if kv.hits >= c.historyCache.k {
+		c.promote(id)
 	} else {
-		// 缓存未命中，去历史队列查看，如果访问次数达到k次需要加入到缓存中
-		if _, ok = c.historyCache.mp[key]; ok {
-			// 有就根据访问次数看是否要加到缓存中,没达到次数也要将该节点挪到最后,即最晚被FIFO淘汰
-			c.historyCache.cnt[key]++
-			ele := c.historyCache.mp[key]
-			kv := ele.Value.(*entry)
-
-			if c.historyCache.cnt[key] >= c.historyCache.k {
-				c.AddToCache(key, value)
-				// 加入缓存后，将该节点从历史队列中删除
-				c.historyCache.ll.Remove(ele)
-				c.historyCache.useBytes -= int64(kv.value.Len()) + int64(len(kv.key))
-				delete(c.historyCache.mp, kv.key)
-				delete(c.historyCache.cnt, kv.key)
-			} else {
-				c.historyCache.ll.MoveToBack(ele)
-			}
+		c.s.moveToBack(&c.historyCache.ll, id)
+	}
+	return value, true
+}
 
-			return kv.value, true
-		} else {
-			// 历史队列也没有就直接返回
-			return
+// promote moves an entry of the history queue that was accessed k times
+// into the cache, keeping its slot.
+func (c *Cache) promote(id nodeID) {
+	kv := c.s.at(id)
+	c.s.unlink(&c.historyCache.ll, id)
+	c.historyCache.useBytes -= c.size(kv.key, kv.value)
+	c.s.unindex(c.historyCache.mp, id)
+	kv.hits = 0
+	c.insert(id)
+}
+
+// touch records an access to a cached entry: it moves to the front, or
+// to the protected segment with SLRU, or gets marked with CLOCK.
+func (c *Cache) touch(id nodeID) {
+	kv := c.s.at(id)
+	if c.clock {
+		kv.reference = true
+		return
+	}
+	if !kv.probation {
+		c.s.moveToFront(&c.ll, id)
+		return
+	}
+	c.s.unlink(c.probation, id)
+	kv.probation = false
+	c.s.pushFront(&c.ll, id)
+	c.protectedBytes += c.size(kv.key, kv.value)
+	c.demote()
+}
+
+// lookup returns the entry of key in the cache or the history queue, 0 if
+// there is none.
+func (c *Cache) lookup(key string) nodeID {
+	h := c.s.hash(key)
+	if id := c.s.find(c.mp, h, key); id != 0 {
+		return id
+	}
+	return c.s.find(c.historyCache.mp, h, key)
+}
+
+// Peek returns key's value like Get, but without updating its recency,
+// its LRU-K access count or its idle timeout, so that inspecting the cache
+// doesn't change what it evicts.
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	id := c.lookup(key)
+	if id == 0 {
+		return nil, false
+	}
+	kv := c.s.at(id)
+	if kv.expired(c.now().UnixNano()) {
+		return nil, false
+	}
+	return kv.value, true
+}
+
+// GetStale returns key's value even if it expired, which only stays
+// cached with KeepExpired, without touching it like Peek.
+func (c *Cache) GetStale(key string) (value Value, ok bool) {
+	id := c.s.find(c.mp, c.s.hash(key), key)
+	if id == 0 {
+		return nil, false
+	}
+	return c.s.at(id).value, true
+}
+
+// Contains reports whether key has a value, without touching it like Peek.
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
+// Iterate calls fn for every entry that hasn't expired, without touching
+// them, until fn returns false: first the cache entries from the most to
+// the least recently used (with SLRU the protected segment first), then the entries of the history queue in the
+// order they are evicted from it. fn must not modify the cache.
+func (c *Cache) Iterate(fn func(key string, value Value) bool) {
+	now := c.now().UnixNano()
+	if !c.iterate(c.ll, now, fn) {
+		return
+	}
+	if c.probation != nil && !c.iterate(*c.probation, now, fn) {
+		return
+	}
+	c.iterate(c.historyCache.ll, now, fn)
+}
+
+// iterate walks l for Iterate, reporting whether fn asked to go on.
+func (c *Cache) iterate(l list, now int64, fn func(key string, value Value) bool) bool {
+	for id := l.head; id != 0; {
+		kv := c.s.at(id)
+		if !kv.expired(now) && !fn(kv.key, kv.value) {
+			return false
 		}
+		id = kv.next
+	}
+	return true
+}
+
+// Keys returns the keys in the order of Iterate.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len()+c.historyCache.ll.Len())
+	c.Iterate(func(key string, _ Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// GetOldest returns the least recently used cache entry, the next one to
+// be evicted, and when it was last accessed, without touching it.
+func (c *Cache) GetOldest() (key string, value Value, atime time.Time, ok bool) {
+	id := c.ll.tail
+	if c.probation != nil && c.probation.Len() > 0 {
+		id = c.probation.tail
+	}
+	if id == 0 {
+		return "", nil, time.Time{}, false
+	}
+	kv := c.s.at(id)
+	return kv.key, kv.value, time.Unix(0, kv.atime), true
+}
+
+// GetBytes is like Get for a key held in a byte slice. It doesn't convert
+// key to a string, so looking up binary keys doesn't allocate.
+func (c *Cache) GetBytes(key []byte) (value Value, ok bool) {
+	// 哈希直接对字节计算，比较时编译器对 string(b) 不做拷贝
+	if id := c.s.findBytes(c.mp, key); id != 0 {
+		return c.Get(c.s.at(id).key)
 	}
+	if id := c.s.findBytes(c.historyCache.mp, key); id != 0 {
+		return c.Get(c.s.at(id).key)
+	}
+	return nil, false
+}
+
+// AddBytes is like Add for a key held in a byte slice. The key is copied
+// only when it is not in the cache yet; key may be reused afterwards.
+func (c *Cache) AddBytes(key []byte, value Value) {
+	c.add(c.internKey(key), value, nil)
+}
 
-	return
+// RemoveBytes is like Remove for a key held in a byte slice.
+func (c *Cache) RemoveBytes(key []byte) bool {
+	return c.Remove(c.internKey(key))
 }
 
-// Add adds a value to the cache.
+// internKey returns the string stored for key if the cache has one,
+// saving the copy a conversion would make.
+func (c *Cache) internKey(key []byte) string {
+	if id := c.s.findBytes(c.mp, key); id != 0 {
+		return c.s.at(id).key
+	}
+	if id := c.s.findBytes(c.historyCache.mp, key); id != 0 {
+		return c.s.at(id).key
+	}
+	return string(key)
+}
+
+// Add adds a value to the cache. Replacing the value of a cached key keeps
+// its EntryOptions.
 func (c *Cache) Add(key string, value Value) {
-	if _, ok := c.mp[key]; ok {
+	c.add(key, value, nil)
+}
+
+// AddWith adds a value to the cache with the given lifetime options.
+func (c *Cache) AddWith(key string, value Value, o EntryOptions) {
+	c.add(key, value, &o)
+}
+
+func (c *Cache) add(key string, value Value, o *EntryOptions) {
+	c.store(key, value, o)
+	if c.OnAdded != nil {
+		c.OnAdded(key, value)
+	}
+}
+
+// Options returns the EntryOptions of a cached key without counting as an
+// access, with Priority holding the chances left.
+func (c *Cache) Options(key string) (EntryOptions, bool) {
+	id := c.lookup(key)
+	if id == 0 {
+		return EntryOptions{}, false
+	}
+	return c.s.at(id).options(), true
+}
+
+// SetOptions replaces the EntryOptions of a cached key that hasn't
+// expired, without counting as an access, and reports whether it did.
+func (c *Cache) SetOptions(key string, o EntryOptions) bool {
+	id := c.lookup(key)
+	if id == 0 {
+		return false
+	}
+	kv := c.s.at(id)
+	if kv.expired(c.now().UnixNano()) {
+		return false
+	}
+	kv.setOptions(o)
+	return true
+}
+
+func (c *Cache) store(key string, value Value, o *EntryOptions) {
+	h := c.s.hash(key)
+	if id := c.s.find(c.mp, h, key); id != 0 {
 		// 缓存命中了就挪到前面，更新value
-		ele := c.mp[key]
-		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
-		c.useBytes += int64(value.Len()) - int64(kv.value.Len())
+		kv := c.s.at(id)
+		c.s.moveToFront(c.listOf(kv), id)
+		delta := c.size(key, value) - c.size(key, kv.value)
+		c.useBytes += delta
+		if c.probation != nil && !kv.probation {
+			c.protectedBytes += delta
+		}
+		c.replaced(key, kv.value)
 		kv.value = value
-	} else {
-		// 缓存未命中，则去历史队列查看是否存在
-		if _, ok = c.historyCache.mp[key]; !ok {
-			// 没有就新增
-			ele := c.historyCache.ll.PushBack(&entry{key, value})
-			c.historyCache.cnt[key]++
-			c.historyCache.mp[key] = ele
-			c.historyCache.useBytes += int64(len(key)) + int64(value.Len())
-
-			// 判断历史队列内存是否用完，历史队列的淘汰策略为FIFO
-			if c.historyCache.maxBytes != 0 && c.historyCache.maxBytes < c.historyCache.useBytes {
-				c.RemoveHistoryCacheOldest()
-			}
-		} else {
-			// 有就更新value，并移到队尾
-			c.historyCache.cnt[key]++
-			ele := c.historyCache.mp[key]
-			c.historyCache.ll.MoveToBack(ele)
-			kv := ele.Value.(*entry)
-			c.historyCache.useBytes += int64(value.Len()) - int64(kv.value.Len())
-			kv.value = value
+		kv.atime = c.now().UnixNano()
+		if o != nil {
+			kv.setOptions(*o)
+		}
+		// 值变大时（如追加）同样要保证不超过容量
+		c.demote()
+		for c.maxBytes != 0 && c.Len() > 0 && c.useBytes > c.maxBytes {
+			c.RemoveCacheOldest()
+		}
+		return
+	}
+	if c.historyCache.k <= 1 {
+		// 访问一次就加入缓存时不必经过历史队列，省去一次入队出队和两次 map 写入
+		id := c.s.alloc(h, key, value)
+		if o != nil {
+			c.s.at(id).setOptions(*o)
+		}
+		c.insert(id)
+		return
+	}
+	// 缓存未命中，则去历史队列查看是否存在
+	hc := &c.historyCache
+	id := c.s.find(hc.mp, h, key)
+	if id == 0 {
+		// 没有就新增
+		id = c.s.alloc(h, key, value)
+		kv := c.s.at(id)
+		kv.hits = 1
+		kv.atime = c.now().UnixNano()
+		if o != nil {
+			kv.setOptions(*o)
 		}
+		c.s.pushBack(&hc.ll, id)
+		c.s.index(hc.mp, id)
+		hc.useBytes += c.size(key, value)
+		c.notePeak()
 
-		// 判断是否达到加入缓存标准
-		if c.historyCache.cnt[key] >= c.historyCache.k {
-			c.AddToCache(key, value)
-			ele := c.historyCache.mp[key]
-			kv := ele.Value.(*entry)
-			// 加入缓存后，将该节点从历史队列中删除
-			c.historyCache.ll.Remove(ele)
-			c.historyCache.useBytes -= int64(kv.value.Len()) + int64(len(kv.key))
-			delete(c.historyCache.mp, kv.key)
-			delete(c.historyCache.cnt, kv.key)
+		// 判断历史队列内存是否用完，历史队列的淘汰策略为FIFO
+		if hc.maxBytes != 0 && hc.maxBytes < hc.useBytes {
+			c.RemoveHistoryCacheOldest()
+			if hc.ll.Len() == 0 {
+				return // 被淘汰的正是新条目
+			}
 		}
+	} else {
+		// 有就更新value，并移到队尾
+		c.s.moveToBack(&hc.ll, id)
+		kv := c.s.at(id)
+		kv.hits++
+		kv.atime = c.now().UnixNano()
+		hc.useBytes += c.size(key, value) - c.size(key, kv.value)
+		c.replaced(key, kv.value)
+		kv.value = value
+		if o != nil {
+			kv.setOptions(*o)
+		}
+		for hc.maxBytes != 0 && hc.ll.Len() > 1 && hc.maxBytes < hc.useBytes {
+			c.RemoveHistoryCacheOldest()
+		}
+	}
+
+	// 判断是否达到加入缓存标准
+	if c.s.at(id).hits >= hc.k {
+		c.promote(id)
+	}
+}
+
+func (c *Cache) replaced(key string, old Value) {
+	if c.OnReplaced != nil {
+		c.OnReplaced(key, old)
 	}
 }
 
 func (c *Cache) AddToCache(key string, value Value) {
-	ele := c.ll.PushFront(&entry{key, value})
-	c.mp[key] = ele
-	c.useBytes += int64(len(key)) + int64(value.Len())
+	c.addToCache(key, value, EntryOptions{})
+}
+
+func (c *Cache) addToCache(key string, value Value, o EntryOptions) {
+	id := c.s.alloc(c.s.hash(key), key, value)
+	c.s.at(id).setOptions(o)
+	c.insert(id)
+}
+
+// insert adds the entry id, not in any list yet, to the cache.
+func (c *Cache) insert(id nodeID) {
+	kv := c.s.at(id)
+	kv.atime = c.now().UnixNano()
+	if c.probation != nil {
+		// 新条目先进入试用段，再次访问才晋升到保护段
+		kv.probation = true
+		c.s.pushFront(c.probation, id)
+	} else {
+		c.s.pushFront(&c.ll, id)
+	}
+	c.s.index(c.mp, id)
+	c.useBytes += c.size(kv.key, kv.value)
+	if c.prefixes != nil {
+		c.prefixes.add(kv.key)
+	}
+	c.notePeak()
 
 	//保证内存不超过最大值 ps:maxBytes为0表示无限制
 	for c.maxBytes != 0 && c.maxBytes < c.useBytes {
@@ -147,35 +530,245 @@ func (c *Cache) AddToCache(key string, value Value) {
 	}
 }
 
-// RemoveCacheOldest removes the oldest item
+// RemoveCacheOldest removes the oldest item. Entries with a Priority left
+// are moved to the front instead, using up one of their chances.
 func (c *Cache) RemoveCacheOldest() {
-	ele := c.ll.Back()
-	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.mp, kv.key)
-		c.useBytes -= int64(kv.value.Len()) + int64(len(kv.key))
+	l := &c.ll
+	if c.probation != nil && c.probation.Len() > 0 {
+		l = c.probation // SLRU 优先淘汰试用段
+	}
+	id := l.tail
+	for id != 0 {
+		kv := c.s.at(id)
+		if kv.reference {
+			kv.reference = false // 给最近访问过的节点第二次机会
+		} else if kv.chances > 0 {
+			kv.chances--
+		} else {
+			break
+		}
+		c.s.moveToFront(l, id)
+		id = l.tail
+	}
+	if id != 0 {
+		var o EntryOptions
+		if c.OnCapacityEvicted != nil {
+			o = c.s.at(id).options()
+		}
+		key, value := c.drop(id)
+		if c.OnCapacityEvicted != nil {
+			c.OnCapacityEvicted(key, value, o)
+		}
 		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+			c.OnEvicted(key, value)
 		}
 	}
 }
 
+// drop removes the cached entry id and frees its slot, returning its key
+// and value.
+func (c *Cache) drop(id nodeID) (key string, value Value) {
+	kv := c.s.at(id)
+	key, value = kv.key, kv.value
+	c.unlink(id)
+	c.s.unindex(c.mp, id)
+	c.useBytes -= c.size(key, value)
+	if c.prefixes != nil {
+		c.prefixes.remove(key)
+	}
+	c.s.release(id)
+	return key, value
+}
+
+// dropHistory is drop for an entry of the history queue.
+func (c *Cache) dropHistory(id nodeID) (key string, value Value) {
+	kv := c.s.at(id)
+	key, value = kv.key, kv.value
+	c.s.unlink(&c.historyCache.ll, id)
+	c.s.unindex(c.historyCache.mp, id)
+	c.historyCache.useBytes -= c.size(key, value)
+	c.s.release(id)
+	return key, value
+}
+
 func (c *Cache) RemoveHistoryCacheOldest() {
-	ele := c.historyCache.ll.Front()
-	if ele != nil {
-		c.historyCache.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.historyCache.mp, kv.key)
-		delete(c.historyCache.cnt, kv.key)
-		c.historyCache.useBytes -= int64(kv.value.Len()) + int64(len(kv.key))
+	if id := c.historyCache.ll.head; id != 0 {
+		key, value := c.dropHistory(id)
 		if c.OnEvicted != nil {
+			c.OnEvicted(key, value)
+		}
+	}
+}
+
+// Remove removes key from the cache and the history queue, calling
+// OnEvicted if it was present. It reports whether key was found.
+func (c *Cache) Remove(key string) bool {
+	h := c.s.hash(key)
+	var value Value
+	if id := c.s.find(c.mp, h, key); id != 0 {
+		key, value = c.drop(id)
+	} else if id := c.s.find(c.historyCache.mp, h, key); id != 0 {
+		key, value = c.dropHistory(id)
+	} else {
+		return false
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	return true
+}
+
+func (c *Cache) notePeak() {
+	if n := c.Len() + c.historyCache.ll.Len(); n > c.peak {
+		c.peak = n
+	}
+}
+
+// minCompactPeak is the size below which compacting isn't worth it.
+const minCompactPeak = 1024
+
+// Sparse reports whether the cache holds less than a quarter of the
+// entries it held at its peak since the last Compact, so that Compact
+// would release a significant amount of memory.
+func (c *Cache) Sparse() bool {
+	return c.peak >= minCompactPeak && 4*(c.Len()+c.historyCache.ll.Len()) < c.peak
+}
+
+// Grow pre-sizes the cache's map for n more entries, so that adding many
+// at once, e.g. when loading a snapshot, doesn't rehash it repeatedly.
+func (c *Cache) Grow(n int) {
+	if n <= 0 {
+		return
+	}
+	mp := make(map[uint64]nodeID, len(c.mp)+n)
+	for k, v := range c.mp {
+		mp[k] = v
+	}
+	c.mp = mp
+}
+
+// Compact rebuilds the cache's storage. Go maps never shrink, nor does the
+// slab, so after a mass eviction they keep the memory sized for the peak;
+// rebuilding them lets the garbage collector reclaim it.
+func (c *Cache) Compact() {
+	// 按队列顺序把条目拷贝到新的 slab 中，哈希种子不变，索引无需重算
+	s := slab{seed: c.s.seed}
+	h := &c.historyCache
+	mp := make(map[uint64]nodeID, c.Len())
+	c.ll = c.s.copyList(&s, c.ll, mp)
+	if c.probation != nil {
+		*c.probation = c.s.copyList(&s, *c.probation, mp)
+	}
+	hmp := make(map[uint64]nodeID, h.ll.Len())
+	h.ll = c.s.copyList(&s, h.ll, hmp)
+	c.s, c.mp, h.mp = s, mp, hmp
+	c.peak = c.Len() + h.ll.Len()
+}
+
+// Purge removes every entry from the cache and the history queue, calling
+// OnEvicted for each of them.
+func (c *Cache) Purge() {
+	if c.OnEvicted != nil {
+		if c.probation != nil {
+			for id := c.probation.tail; id != 0; id = c.s.at(id).prev {
+				kv := c.s.at(id)
+				c.OnEvicted(kv.key, kv.value)
+			}
+		}
+		for id := c.ll.tail; id != 0; id = c.s.at(id).prev {
+			kv := c.s.at(id)
 			c.OnEvicted(kv.key, kv.value)
 		}
+		for id := c.historyCache.ll.head; id != 0; id = c.s.at(id).next {
+			kv := c.s.at(id)
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+	// 重新分配而不是逐个删除，slab 和 map 占用的内存随之释放
+	c.s = slab{seed: c.s.seed}
+	c.ll, c.mp, c.useBytes = list{}, make(map[uint64]nodeID), 0
+	if c.probation != nil {
+		*c.probation, c.protectedBytes = list{}, 0
+	}
+	h := &c.historyCache
+	h.ll, h.mp, h.useBytes = list{}, make(map[uint64]nodeID), 0
+	if c.prefixes != nil {
+		c.prefixes.keys = make(map[string]map[string]struct{})
+	}
+	c.peak = 0
+}
+
+// Resize changes the limit of the cache, and of the history queue, to
+// maxBytes, evicting entries right away if they no longer fit. 0 removes
+// the limit.
+func (c *Cache) Resize(maxBytes int64) {
+	c.maxBytes, c.historyCache.maxBytes = maxBytes, maxBytes
+	if c.probation != nil {
+		c.protectedMax = int64(float64(maxBytes) * c.protectedRatio)
+		c.demote()
+	}
+	for maxBytes != 0 && c.Len() > 0 && c.useBytes > maxBytes {
+		c.RemoveCacheOldest()
+	}
+	for maxBytes != 0 && c.historyCache.ll.Len() > 0 && c.historyCache.useBytes > maxBytes {
+		c.RemoveHistoryCacheOldest()
 	}
 }
 
 // Len is the number of cache entries
 func (c *Cache) Len() int {
+	if c.probation != nil {
+		return c.ll.Len() + c.probation.Len()
+	}
 	return c.ll.Len()
 }
+
+// Bytes returns the bytes accounted for the cache entries, including
+// EntryOverhead, history queue excluded.
+func (c *Cache) Bytes() int64 {
+	return c.useBytes
+}
+
+// WalkIdle visits the cache entries not accessed within idle, least
+// recently used first, until visit returns false. A non-nil Value returned
+// by visit replaces the entry's value without changing its recency.
+func (c *Cache) WalkIdle(idle time.Duration, visit func(key string, value Value) (Value, bool)) {
+	deadline := c.now().Add(-idle).UnixNano()
+	if c.probation == nil || c.walkIdle(c.probation, deadline, visit) {
+		c.walkIdle(&c.ll, deadline, visit)
+	}
+	c.demote()
+	for c.maxBytes != 0 && c.maxBytes < c.useBytes {
+		c.RemoveCacheOldest()
+	}
+}
+
+// walkIdle walks l for WalkIdle, reporting whether visit asked to go on.
+func (c *Cache) walkIdle(l *list, deadline int64, visit func(key string, value Value) (Value, bool)) bool {
+	// 队列按访问时间有序，从队尾向前遍历，遇到未空闲的节点即可停止
+	for id := l.tail; id != 0; {
+		kv := c.s.at(id)
+		prev := kv.prev
+		if kv.atime > deadline {
+			if !c.clock {
+				return true
+			}
+			id = prev // CLOCK 下队列并不按访问时间有序
+			continue
+		}
+		replacement, cont := visit(kv.key, kv.value)
+		if replacement != nil {
+			delta := c.size(kv.key, replacement) - c.size(kv.key, kv.value)
+			c.useBytes += delta
+			if l == &c.ll && c.probation != nil {
+				c.protectedBytes += delta
+			}
+			kv.value = replacement
+		}
+		if !cont {
+			return false
+		}
+		id = prev
+	}
+	return true
+}
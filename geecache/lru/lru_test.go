@@ -2,7 +2,10 @@ package lru
 
 import (
 	"reflect"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 )
 
 type String string
@@ -56,3 +59,443 @@ func TestOnEvicted(t *testing.T) {
 	}
 
 }
+
+func TestHooks(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var events []string
+	lru := New(int64(0), func(key string, value Value) {
+		events = append(events, "evicted "+key)
+	}, 1)
+	lru.now = func() time.Time { return now }
+	lru.OnAdded = func(key string, value Value) { events = append(events, "added "+key) }
+	lru.OnHit = func(key string, value Value) { events = append(events, "hit "+key) }
+	lru.OnMiss = func(key string) { events = append(events, "miss "+key) }
+	lru.OnExpired = func(key string, value Value) { events = append(events, "expired "+key) }
+	lru.OnReplaced = func(key string, old Value) { events = append(events, "replaced "+key+"="+string(old.(String))) }
+
+	lru.AddWith("k", String("v"), EntryOptions{Expire: now.Add(time.Second)})
+	lru.Add("k", String("w"))
+	lru.Get("k")
+	lru.Get("other")
+	now = now.Add(time.Second)
+	lru.Get("k")
+	except := []string{"added k", "replaced k=v", "added k", "hit k", "miss other", "expired k", "evicted k", "miss k"}
+	if !reflect.DeepEqual(except, events) {
+		t.Fatalf("events %v, expect %v", events, except)
+	}
+}
+
+func TestWalkIdle(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lru := New(int64(0), nil, 1)
+	lru.now = func() time.Time { return now }
+	lru.Add("old", String("123456"))
+	now = now.Add(time.Minute)
+	lru.Add("new", String("123456"))
+
+	var visited []string
+	lru.WalkIdle(30*time.Second, func(key string, value Value) (Value, bool) {
+		visited = append(visited, key)
+		return String("1"), true
+	})
+	if !reflect.DeepEqual(visited, []string{"old"}) {
+		t.Fatalf("visited %v, expect only the idle entry", visited)
+	}
+	if v, ok := lru.Get("old"); !ok || v.(String) != "1" {
+		t.Fatalf("idle entry was not replaced, got %v", v)
+	}
+	if lru.Bytes() != int64(len("old1")+len("new123456")) {
+		t.Fatalf("bytes = %d after replacement", lru.Bytes())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil, 2) // LRU-2：首次写入只进入历史队列
+	lru.Add("key1", String("123"))
+	if !lru.Remove("key1") {
+		t.Fatalf("remove key1 from history failed")
+	}
+	lru.Add("key2", String("456"))
+	lru.Add("key2", String("456"))
+	if !lru.Remove("key2") || lru.Len() != 0 || lru.Bytes() != 0 {
+		t.Fatalf("remove key2 from cache failed")
+	}
+	if lru.Remove("key3") {
+		t.Fatalf("remove of missing key3 reported success")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	lru := New(int64(0), nil, 1)
+	for i := 0; i < 2000; i++ {
+		lru.Add(strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 1800; i++ {
+		lru.Remove(strconv.Itoa(i))
+	}
+	if !lru.Sparse() {
+		t.Fatalf("cache with 200 of 2000 entries left is not sparse")
+	}
+	lru.Compact()
+	if lru.Sparse() || lru.Len() != 200 {
+		t.Fatalf("compact lost entries or kept the peak: len = %d", lru.Len())
+	}
+	if v, ok := lru.Get("1999"); !ok || v.(String) != "v" {
+		t.Fatalf("cache hit 1999 after compact failed")
+	}
+	lru.RemoveCacheOldest()
+	if _, ok := lru.Get("1800"); ok {
+		t.Fatalf("recency order lost by compact")
+	}
+}
+
+func TestSlab(t *testing.T) {
+	// 删除腾出的位置被新条目复用，slab 不随写入次数增长
+	lru := New(int64(0), nil, 2)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i % 100)
+		lru.Add(key, String("v"))
+		lru.Add(key, String("v"))
+		if i%3 == 0 {
+			lru.Remove(key)
+		}
+	}
+	if lru.s.used > 100 {
+		t.Fatalf("%d slots used for at most 100 entries", lru.s.used)
+	}
+
+	// 哈希冲突的条目串在同一个索引项上
+	s, ix := newSlab(), make(map[uint64]nodeID)
+	ids := []nodeID{s.alloc(1, "a", String("1")), s.alloc(1, "b", String("2")), s.alloc(1, "c", String("3"))}
+	for _, id := range ids {
+		s.index(ix, id)
+	}
+	s.unindex(ix, ids[1])
+	if s.find(ix, 1, "a") != ids[0] || s.find(ix, 1, "b") != 0 || s.find(ix, 1, "c") != ids[2] {
+		t.Fatalf("lookup after removing a colliding entry failed")
+	}
+	s.unindex(ix, ids[2])
+	s.unindex(ix, ids[0])
+	if len(ix) != 0 {
+		t.Fatalf("index not empty: %v", ix)
+	}
+}
+
+func TestEntryOverhead(t *testing.T) {
+	lru := New(int64(0), nil, 1)
+	lru.EntryOverhead = 100
+	lru.Add("key1", String("123"))
+	if lru.Bytes() != 4+3+100 {
+		t.Fatalf("bytes = %d, want %d", lru.Bytes(), 4+3+100)
+	}
+	lru.Add("key1", String("12345"))
+	lru.Remove("key1")
+	if lru.Bytes() != 0 {
+		t.Fatalf("bytes after remove = %d", lru.Bytes())
+	}
+
+	sized := New(int64(250), nil, 1)
+	sized.Sizer = func(key string, value Value) int64 { return 100 }
+	sized.Add("k1", String("v"))
+	sized.Add("k2", String("v"))
+	sized.Add("k3", String("v"))
+	if sized.Len() != 2 || sized.Bytes() != 200 {
+		t.Fatalf("len = %d, bytes = %d with a 100 bytes Sizer", sized.Len(), sized.Bytes())
+	}
+}
+
+func TestEntryOptions(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lru := New(int64(0), nil, 1)
+	lru.now = func() time.Time { return now }
+	lru.AddWith("ttl", String("1"), EntryOptions{Expire: now.Add(time.Minute)})
+	lru.AddWith("idle", String("2"), EntryOptions{Idle: 20 * time.Second})
+
+	now = now.Add(15 * time.Second)
+	lru.Get("idle")
+	now = now.Add(15 * time.Second)
+	if _, ok := lru.Get("idle"); !ok {
+		t.Fatalf("idle entry expired although it was read")
+	}
+	now = now.Add(time.Minute)
+	for _, key := range []string{"ttl", "idle"} {
+		if _, ok := lru.Get(key); ok {
+			t.Fatalf("%s entry did not expire", key)
+		}
+	}
+	if lru.Len() != 0 || lru.Bytes() != 0 {
+		t.Fatalf("expired entries still accounted: %d entries, %d bytes", lru.Len(), lru.Bytes())
+	}
+}
+
+func TestPriority(t *testing.T) {
+	lru := New(int64(len("k1v1")*2), nil, 1)
+	lru.AddWith("k1", String("v1"), EntryOptions{Priority: 1})
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3")) // k1 有一次豁免，被淘汰的是 k2
+	if _, ok := lru.Get("k1"); !ok {
+		t.Fatalf("prioritized entry was evicted")
+	}
+	if _, ok := lru.Get("k2"); ok {
+		t.Fatalf("k2 should have been evicted")
+	}
+	if o, _ := lru.Options("k1"); o.Priority != 0 {
+		t.Fatalf("chances left = %d, want 0", o.Priority)
+	}
+	lru.Add("k1", String("v1")) // 更新值保留原有选项
+	lru.Add("k4", String("v4"))
+	lru.Add("k5", String("v5"))
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatalf("entry without chances left survived")
+	}
+}
+
+func TestResize(t *testing.T) {
+	lru := New(int64(0), nil, 1)
+	for i := 0; i < 10; i++ {
+		lru.Add("k"+strconv.Itoa(i), String("v"))
+	}
+	lru.Resize(int64(len("k0v") * 4))
+	if lru.Len() != 4 {
+		t.Fatalf("len = %d after shrinking to 4 entries", lru.Len())
+	}
+	if _, ok := lru.Get("k9"); !ok {
+		t.Fatalf("most recent entry was evicted")
+	}
+	lru.Resize(0)
+	lru.Add("k10", String("v"))
+	if lru.Len() != 5 {
+		t.Fatalf("len = %d after removing the limit", lru.Len())
+	}
+}
+
+func TestBytesKeys(t *testing.T) {
+	lru := New(int64(0), nil, 1)
+	key := []byte{0, 0xff, 'k'}
+	lru.AddBytes(key, String("v1"))
+	key[2] = 'x' // 调用方可以复用 key
+	if _, ok := lru.Get(string([]byte{0, 0xff, 'k'})); !ok {
+		t.Fatalf("key was not copied")
+	}
+	key[2] = 'k'
+	if allocs := testing.AllocsPerRun(100, func() {
+		if _, ok := lru.GetBytes(key); !ok {
+			t.Fatalf("GetBytes missed")
+		}
+		lru.AddBytes(key, String("v2"))
+	}); allocs != 0 {
+		t.Fatalf("GetBytes and AddBytes of a cached key allocate %v times", allocs)
+	}
+	if !lru.RemoveBytes(key) || lru.Len() != 0 {
+		t.Fatalf("RemoveBytes failed")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	lru := New(int64(len("k1v1")*2), nil, 2)
+	lru.Add("k1", String("v1"))
+	if v, ok := lru.Peek("k1"); !ok || v.(String) != "v1" {
+		t.Fatalf("peek into history queue failed")
+	}
+	if lru.Len() != 0 {
+		t.Fatalf("Peek counted as an access")
+	}
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k2", String("v2"))
+	lru.Peek("k1") // 不应影响淘汰顺序
+	lru.Add("k3", String("v3"))
+	lru.Add("k3", String("v3"))
+	if lru.Contains("k1") || !lru.Contains("k2") || !lru.Contains("k3") {
+		t.Fatalf("Peek changed eviction order")
+	}
+}
+
+func TestPeekIdleHistory(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lru := New(int64(0), nil, 2)
+	lru.now = func() time.Time { return now }
+	lru.AddWith("k", String("v"), EntryOptions{Idle: time.Minute})
+	// 历史队列中的条目按入队时间计算空闲
+	if !lru.Contains("k") || len(lru.Keys()) != 1 {
+		t.Fatalf("idle entry of the history queue reported expired")
+	}
+	now = now.Add(time.Minute)
+	if lru.Contains("k") || len(lru.Keys()) != 0 {
+		t.Fatalf("history entry idle for a minute still reported")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lru := New(int64(0), nil, 1)
+	lru.now = func() time.Time { return now }
+	lru.Add("k1", String("v1"))
+	now = now.Add(time.Second)
+	lru.Add("k2", String("v2"))
+	lru.AddWith("k3", String("v3"), EntryOptions{Expire: now})
+	lru.Add("k4", String("v4"))
+	lru.Get("k2")
+
+	if keys := lru.Keys(); !reflect.DeepEqual(keys, []string{"k2", "k4", "k1"}) {
+		t.Fatalf("keys = %v", keys)
+	}
+	var visited int
+	lru.Iterate(func(string, Value) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("Iterate went on after fn returned false")
+	}
+	key, _, atime, ok := lru.GetOldest()
+	if !ok || key != "k1" || !atime.Equal(time.Unix(1000, 0)) {
+		t.Fatalf("oldest = %q accessed at %v", key, atime)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	var evicted []string
+	lru := New(int64(0), func(key string, _ Value) { evicted = append(evicted, key) }, 2)
+	lru.Add("k1", String("v1"))
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2")) // 只在历史队列中
+	lru.Purge()
+	if !reflect.DeepEqual(evicted, []string{"k1", "k2"}) {
+		t.Fatalf("evicted %v", evicted)
+	}
+	if lru.Len() != 0 || lru.Bytes() != 0 || lru.Contains("k2") {
+		t.Fatalf("entries left after purge")
+	}
+	lru.Add("k3", String("v3"))
+	lru.Add("k3", String("v3"))
+	if !lru.Contains("k3") {
+		t.Fatalf("cache unusable after purge")
+	}
+}
+
+func TestSLRU(t *testing.T) {
+	lru := NewSLRU(int64(20), 0.5, nil) // 保护段可容纳两个 5 字节的条目
+	lru.Add("hot1", String("v"))
+	lru.Add("hot2", String("v"))
+	lru.Get("hot1") // 晋升到保护段
+	lru.Get("hot2")
+	for i := 0; i < 10; i++ { // 一次性扫描只冲刷试用段
+		lru.Add("s"+strconv.Itoa(i), String("v"))
+	}
+	if !lru.Contains("hot1") || !lru.Contains("hot2") {
+		t.Fatalf("scan evicted protected entries: %v", lru.Keys())
+	}
+	if lru.Bytes() > 20 {
+		t.Fatalf("bytes = %d over the limit", lru.Bytes())
+	}
+
+	lru.Add("hot3", String("v"))
+	lru.Get("hot3") // 保护段超出份额，hot1 降回试用段
+	if keys := lru.Keys(); !reflect.DeepEqual(keys[:2], []string{"hot3", "hot2"}) {
+		t.Fatalf("protected segment = %v", keys)
+	}
+	if !lru.Remove("hot1") || lru.Remove("hot1") {
+		t.Fatalf("remove of a demoted entry failed")
+	}
+}
+
+func TestClock(t *testing.T) {
+	lru := NewClock(int64(len("k1v1")*3), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	lru.Get("k1") // 只设置标记，不移动节点
+	if key, _, _, _ := lru.GetOldest(); key != "k1" {
+		t.Fatalf("Get reordered the list, oldest = %q", key)
+	}
+	lru.Add("k4", String("v4"))
+	if !lru.Contains("k1") || lru.Contains("k2") {
+		t.Fatalf("referenced entry not given a second chance: %v", lru.Keys())
+	}
+	lru.Add("k5", String("v5"))
+	if lru.Contains("k3") || !lru.Contains("k1") {
+		t.Fatalf("keys = %v", lru.Keys())
+	}
+}
+
+func TestGrowInPlace(t *testing.T) {
+	lru := New(int64(len("k1v1k2v2")), nil, 1)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k2", String("v2-longer"))
+	if lru.Bytes() > int64(len("k1v1k2v2")) {
+		t.Fatalf("cache holds %d bytes after growing an entry", lru.Bytes())
+	}
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatalf("growing k2 didn't evict k1")
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	lru := New(int64(0), nil, 1)
+	lru.AddWith("k", String("v"), EntryOptions{Expire: time.Now().Add(time.Hour), Priority: 2})
+	if lru.SetOptions("missing", EntryOptions{}) {
+		t.Fatalf("set the options of a missing key")
+	}
+	if !lru.SetOptions("k", EntryOptions{Expire: time.Now().Add(-time.Second)}) {
+		t.Fatalf("didn't set the options of k")
+	}
+	if _, ok := lru.Get("k"); ok {
+		t.Fatalf("k didn't expire")
+	}
+	if lru.SetOptions("k", EntryOptions{}) {
+		t.Fatalf("set the options of an expired key")
+	}
+}
+
+// BenchmarkGetHit measures Get of cached values, which must not allocate.
+func BenchmarkGetHit(b *testing.B) {
+	for _, k := range []int{1, 2} {
+		b.Run("k="+strconv.Itoa(k), func(b *testing.B) {
+			c := New(0, nil, k)
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = "key" + strconv.Itoa(i)
+				for j := 0; j < k; j++ {
+					c.Add(keys[i], String("value"))
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := c.Get(keys[i%len(keys)]); !ok {
+					b.Fatal("miss")
+				}
+			}
+		})
+	}
+}
+
+func TestRemovePrefix(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		lru := NewSLRU(0, 0, nil)
+		lru.Add("user:1:name", String("a"))
+		if indexed {
+			lru.IndexPrefixes(':')
+		}
+		lru.Add("user:1:mail", String("bb"))
+		lru.Add("user:12:name", String("c"))
+		lru.Add("post:1", String("d"))
+		lru.Get("user:1:name") // 晋升到保护段
+		if n, bytes := lru.PrefixStats("user:1:"); n != 2 || bytes != int64(len("user:1:name")+1+len("user:1:mail")+2) {
+			t.Fatalf("indexed %v: PrefixStats = %d, %d", indexed, n, bytes)
+		}
+		if n, _ := lru.PrefixStats("user:1"); n != 3 {
+			t.Fatalf("indexed %v: %d keys start with user:1", indexed, n)
+		}
+		keys := lru.RemovePrefix("user:1:")
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, []string{"user:1:mail", "user:1:name"}) || lru.Len() != 2 {
+			t.Fatalf("indexed %v: removed %q, %d left", indexed, keys, lru.Len())
+		}
+		if n, _ := lru.PrefixStats("user:"); n != 1 {
+			t.Fatalf("indexed %v: %d keys left under user:", indexed, n)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package lru
+
+import "strings"
+
+// 前缀索引：按分隔符把 key 划分成命名空间，如 "user:123:profile" 属于 "user:" 与
+// "user:123:"。开启后按这样的前缀删除或统计只访问该前缀下的条目，不必遍历整个缓存
+
+// prefixIndex maps the namespace prefixes of the cached keys, those
+// ending with sep, to the keys.
+type prefixIndex struct {
+	sep  byte
+	keys map[string]map[string]struct{}
+}
+
+func (ix *prefixIndex) add(key string) {
+	for i := 0; i < len(key); i++ {
+		if key[i] != ix.sep {
+			continue
+		}
+		set := ix.keys[key[:i+1]]
+		if set == nil {
+			set = make(map[string]struct{})
+			ix.keys[key[:i+1]] = set
+		}
+		set[key] = struct{}{}
+	}
+}
+
+func (ix *prefixIndex) remove(key string) {
+	for i := 0; i < len(key); i++ {
+		if key[i] != ix.sep {
+			continue
+		}
+		if set := ix.keys[key[:i+1]]; set != nil {
+			delete(set, key)
+			if len(set) == 0 {
+				delete(ix.keys, key[:i+1])
+			}
+		}
+	}
+}
+
+// IndexPrefixes makes the cache index its keys by their namespace
+// prefixes, those ending with sep, so that RemovePrefix and PrefixStats
+// of such a prefix visit only the entries under it. Other prefixes are
+// still served by scanning every entry.
+func (c *Cache) IndexPrefixes(sep byte) {
+	c.prefixes = &prefixIndex{sep: sep, keys: make(map[string]map[string]struct{})}
+	for _, l := range []*list{c.probation, &c.ll} {
+		if l == nil {
+			continue
+		}
+		for id := l.head; id != 0; id = c.s.at(id).next {
+			c.prefixes.add(c.s.at(id).key)
+		}
+	}
+}
+
+// prefixKeys returns the keys of the cached entries starting with prefix.
+func (c *Cache) prefixKeys(prefix string) []string {
+	var keys []string
+	if ix := c.prefixes; ix != nil && prefix != "" && prefix[len(prefix)-1] == ix.sep {
+		for key := range ix.keys[prefix] {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	for _, l := range []*list{c.probation, &c.ll} {
+		if l == nil {
+			continue
+		}
+		for id := l.head; id != 0; id = c.s.at(id).next {
+			if key := c.s.at(id).key; strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// RemovePrefix removes the entries whose key starts with prefix from the
+// cache and the history queue, calling OnEvicted for each, and returns
+// the keys removed from the cache.
+func (c *Cache) RemovePrefix(prefix string) []string {
+	keys := c.prefixKeys(prefix)
+	for _, key := range keys {
+		c.Remove(key)
+	}
+	if c.historyCache.k > 1 {
+		// 历史队列中的值尚未提供给读取方，数量也有限，直接遍历
+		for id := c.historyCache.ll.head; id != 0; {
+			kv := c.s.at(id)
+			next := kv.next
+			if strings.HasPrefix(kv.key, prefix) {
+				key, value := c.dropHistory(id)
+				if c.OnEvicted != nil {
+					c.OnEvicted(key, value)
+				}
+			}
+			id = next
+		}
+	}
+	return keys
+}
+
+// PrefixStats returns the number of cached entries whose key starts with
+// prefix and the bytes accounted for them, history queue excluded.
+func (c *Cache) PrefixStats(prefix string) (n int, bytes int64) {
+	h := c.s.hash
+	for _, key := range c.prefixKeys(prefix) {
+		if id := c.s.find(c.mp, h(key), key); id != 0 {
+			n++
+			bytes += c.size(key, c.s.at(id).value)
+		}
+	}
+	return n, bytes
+}
@@ -0,0 +1,200 @@
+package lru
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+// 基于下标的存储：条目放在成块分配的切片中，链表用 int32 下标相连，索引 map 以 key 的
+// 哈希为键、下标为值，链表与索引都不含指针。百万级条目时不再有数百万个链表节点对象和
+// 指向它们的指针，GC 的标记开销随之下降。条目本身仍持有 key 字符串和 Value 两个指针，
+// GC 扫描各块时仍要访问它们：key 没有驻留到字节数组中
+
+// nodeID is the index of an entry in a slab, 0 meaning none.
+type nodeID int32
+
+const (
+	firstChunkBits = 4
+	firstChunk     = 1 << firstChunkBits // 第一块的条目数，之后每块翻倍
+)
+
+// slab holds the entries of a Cache in chunks that are never moved, so
+// that pointers to entries stay valid while others are allocated.
+type slab struct {
+	chunks [][]entry
+	used   nodeID // 分配过的最大下标
+	free   nodeID // 空闲条目组成的链表，经 entry.next 相连
+	seed   maphash.Seed
+}
+
+func newSlab() slab {
+	return slab{seed: maphash.MakeSeed()}
+}
+
+// at returns the entry id.
+func (s *slab) at(id nodeID) *entry {
+	// 第 c 块存放下标 firstChunk<<c-firstChunk+1 起的 firstChunk<<c 个条目
+	i := uint32(id) + firstChunk - 1
+	c := bits.Len32(i) - firstChunkBits - 1
+	return &s.chunks[c][i-firstChunk<<c]
+}
+
+// alloc returns a new entry holding key, whose hash is h, and value.
+func (s *slab) alloc(h uint64, key string, value Value) nodeID {
+	id := s.newID()
+	*s.at(id) = entry{key: key, value: value, hash: h}
+	return id
+}
+
+// newID returns a free slot, reusing released ones first.
+func (s *slab) newID() nodeID {
+	if id := s.free; id != 0 {
+		s.free = s.at(id).next
+		return id
+	}
+	s.used++
+	if i := uint32(s.used) + firstChunk - 1; bits.Len32(i)-firstChunkBits-1 == len(s.chunks) {
+		s.chunks = append(s.chunks, make([]entry, firstChunk<<len(s.chunks)))
+	}
+	return s.used
+}
+
+// copyList copies the entries of l, in order, into dst and indexes them
+// in ix, returning the new list.
+func (s *slab) copyList(dst *slab, l list, ix map[uint64]nodeID) list {
+	var nl list
+	for id := l.head; id != 0; id = s.at(id).next {
+		nid := dst.newID()
+		kv := dst.at(nid)
+		*kv = *s.at(id)
+		kv.hnext = 0
+		dst.pushBack(&nl, nid)
+		dst.index(ix, nid)
+	}
+	return nl
+}
+
+// release frees id, dropping its key and value for the garbage collector.
+func (s *slab) release(id nodeID) {
+	*s.at(id) = entry{next: s.free}
+	s.free = id
+}
+
+func (s *slab) hash(key string) uint64 {
+	return maphash.String(s.seed, key)
+}
+
+// findBytes is find for a key held in a byte slice.
+func (s *slab) findBytes(ix map[uint64]nodeID, key []byte) nodeID {
+	for id := ix[maphash.Bytes(s.seed, key)]; id != 0; id = s.at(id).hnext {
+		if s.at(id).key == string(key) {
+			return id
+		}
+	}
+	return 0
+}
+
+// find returns the entry of key in ix, 0 if there is none.
+func (s *slab) find(ix map[uint64]nodeID, h uint64, key string) nodeID {
+	for id := ix[h]; id != 0; id = s.at(id).hnext {
+		if s.at(id).key == key {
+			return id
+		}
+	}
+	return 0
+}
+
+// index adds id to ix.
+func (s *slab) index(ix map[uint64]nodeID, id nodeID) {
+	kv := s.at(id)
+	kv.hnext = ix[kv.hash]
+	ix[kv.hash] = id
+}
+
+// unindex removes id from ix.
+func (s *slab) unindex(ix map[uint64]nodeID, id nodeID) {
+	kv := s.at(id)
+	head := ix[kv.hash]
+	if head == id {
+		if kv.hnext != 0 {
+			ix[kv.hash] = kv.hnext
+		} else {
+			delete(ix, kv.hash)
+		}
+		kv.hnext = 0
+		return
+	}
+	// 哈希冲突极少，链表通常只有一个节点
+	for p := head; p != 0; p = s.at(p).hnext {
+		if prev := s.at(p); prev.hnext == id {
+			prev.hnext, kv.hnext = kv.hnext, 0
+			return
+		}
+	}
+}
+
+// list is a doubly linked list of the entries of a slab.
+type list struct {
+	head, tail nodeID // head 是最前面（最近使用）的条目
+	n          int
+}
+
+// Len returns the number of entries in l.
+func (l *list) Len() int {
+	return l.n
+}
+
+func (s *slab) pushFront(l *list, id nodeID) {
+	kv := s.at(id)
+	kv.prev, kv.next = 0, l.head
+	if l.head != 0 {
+		s.at(l.head).prev = id
+	} else {
+		l.tail = id
+	}
+	l.head = id
+	l.n++
+}
+
+func (s *slab) pushBack(l *list, id nodeID) {
+	kv := s.at(id)
+	kv.prev, kv.next = l.tail, 0
+	if l.tail != 0 {
+		s.at(l.tail).next = id
+	} else {
+		l.head = id
+	}
+	l.tail = id
+	l.n++
+}
+
+// unlink removes id from l, leaving it allocated.
+func (s *slab) unlink(l *list, id nodeID) {
+	kv := s.at(id)
+	if kv.prev != 0 {
+		s.at(kv.prev).next = kv.next
+	} else {
+		l.head = kv.next
+	}
+	if kv.next != 0 {
+		s.at(kv.next).prev = kv.prev
+	} else {
+		l.tail = kv.prev
+	}
+	kv.prev, kv.next = 0, 0
+	l.n--
+}
+
+func (s *slab) moveToFront(l *list, id nodeID) {
+	if l.head != id {
+		s.unlink(l, id)
+		s.pushFront(l, id)
+	}
+}
+
+func (s *slab) moveToBack(l *list, id nodeID) {
+	if l.tail != id {
+		s.unlink(l, id)
+		s.pushBack(l, id)
+	}
+}
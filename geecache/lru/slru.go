@@ -0,0 +1,57 @@
+package lru
+
+// 分段 LRU：新条目进入试用段，只有再次被访问才晋升到保护段；保护段超出份额时，
+// 最久未访问的条目降回试用段。一次性扫描只会冲刷试用段，热点数据留在保护段中，
+// 与 LRU-K 相比不需要维护历史队列
+
+// DefaultProtectedRatio is the share of the cache NewSLRU gives the
+// protected segment when asked for a ratio outside (0, 1).
+const DefaultProtectedRatio = 0.8
+
+// NewSLRU returns a segmented LRU cache: entries are admitted into a
+// probation segment and promoted to the protected segment, which holds up
+// to protectedRatio of maxBytes, when accessed again. Evictions take the
+// least recently used probationary entry first.
+func NewSLRU(maxBytes int64, protectedRatio float64, onEvicted func(string, Value)) *Cache {
+	if protectedRatio <= 0 || protectedRatio >= 1 {
+		protectedRatio = DefaultProtectedRatio
+	}
+	c := New(maxBytes, onEvicted, 1)
+	c.probation = new(list)
+	c.protectedRatio = protectedRatio
+	c.protectedMax = int64(float64(maxBytes) * protectedRatio)
+	return c
+}
+
+// listOf returns the list holding kv.
+func (c *Cache) listOf(kv *entry) *list {
+	if kv.probation {
+		return c.probation
+	}
+	return &c.ll
+}
+
+// demote moves the least recently used protected entries back to the
+// probation segment while the protected segment is over its share.
+func (c *Cache) demote() {
+	if c.probation == nil || c.protectedMax == 0 {
+		return
+	}
+	for c.protectedBytes > c.protectedMax && c.ll.Len() > 1 {
+		id := c.ll.tail
+		kv := c.s.at(id)
+		c.s.unlink(&c.ll, id)
+		kv.probation = true
+		c.s.pushFront(c.probation, id)
+		c.protectedBytes -= c.size(kv.key, kv.value)
+	}
+}
+
+// unlink removes a cached entry from its list, leaving c.mp alone.
+func (c *Cache) unlink(id nodeID) {
+	kv := c.s.at(id)
+	c.s.unlink(c.listOf(kv), id)
+	if c.probation != nil && !kv.probation {
+		c.protectedBytes -= c.size(kv.key, kv.value)
+	}
+}
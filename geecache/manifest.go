@@ -0,0 +1,162 @@
+package geecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 配置一致性检查：节点之间交换各自注册的 group 及其配置摘要，发现同名 group
+// 在不同节点上大小、策略或压缩设置不一致时告警，或者拒绝为其他节点提供该 group
+
+// manifestPath is served below the base path, next to the peer paths
+// <group>/<key> which always contain a slash.
+const manifestPath = "_manifest"
+
+// Manifest maps the names of the groups registered on a node to a digest of
+// their configuration.
+type Manifest map[string]string
+
+// LocalManifest returns the manifest of the groups registered on this node.
+func LocalManifest() Manifest {
+	m := make(Manifest)
+	for _, g := range allGroups() {
+		m[g.name] = g.configHash.Load().(string)
+	}
+	return m
+}
+
+// computeConfigHash digests the settings that must agree across nodes for
+// them to cache a group consistently. Settings that only affect one node's
+// performance, such as sharding, are left out.
+func (g *Group) computeConfigHash() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "bytes=%d max-entry=%d pass-oversize=%t compress=%d overhead=%d sizer=%t chunk=%d\n",
+		g.configBytes, g.maxEntry, g.passOversize, g.compressAbove, g.cacheOpts.overhead, g.cacheOpts.sizer != nil, g.chunkBytes)
+	policies := append([]prefixPolicy(nil), g.policyList()...)
+	sort.Slice(policies, func(i, j int) bool { return policies[i].prefix < policies[j].prefix })
+	for _, p := range policies {
+		fmt.Fprintf(&b, "policy %q ttl=%d idle=%d priority=%d\n", p.prefix, p.TTL, p.Idle, p.Priority)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ManifestMismatch describes a group configured differently on a peer.
+// Local or Remote is empty when the group is missing on that side.
+type ManifestMismatch struct {
+	Peer   string
+	Group  string
+	Local  string
+	Remote string
+}
+
+// CheckManifests fetches the manifests of all peers and compares them with
+// this node's, logging a warning for each difference. With
+// HTTPPoolOptions.RefuseDivergent, groups configured differently on any
+// peer are no longer served to peers until the next check finds them
+// consistent again. Call it once the peers are set and reachable.
+func (p *HTTPPool) CheckManifests(ctx context.Context) ([]ManifestMismatch, error) {
+	p.mu.Lock()
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if !p.selves[peer] {
+			getters[peer] = getter
+		}
+	}
+	p.mu.Unlock()
+
+	local := LocalManifest()
+	var mismatches []ManifestMismatch
+	var firstErr error
+	for peer, getter := range getters {
+		remote, err := getter.manifest(ctx)
+		if err != nil {
+			p.opts.Logger.Warn("fetching peer manifest failed", "peer", peer, "err", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("peer %s: %w", peer, err)
+			}
+			continue
+		}
+		mismatches = append(mismatches, compareManifests(peer, local, remote)...)
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		a, b := mismatches[i], mismatches[j]
+		return a.Group < b.Group || a.Group == b.Group && a.Peer < b.Peer
+	})
+
+	divergent := make(map[string]bool)
+	for _, m := range mismatches {
+		p.opts.Logger.Warn("group configuration differs from peer",
+			"group", m.Group, "peer", m.Peer, "local", m.Local, "remote", m.Remote)
+		if m.Local != "" && m.Remote != "" {
+			divergent[m.Group] = true
+		}
+	}
+	if p.opts.RefuseDivergent {
+		p.mu.Lock()
+		p.divergent = divergent
+		p.mu.Unlock()
+	}
+	return mismatches, firstErr
+}
+
+func compareManifests(peer string, local, remote Manifest) []ManifestMismatch {
+	var res []ManifestMismatch
+	for name, hash := range local {
+		if hash != remote[name] {
+			res = append(res, ManifestMismatch{Peer: peer, Group: name, Local: hash, Remote: remote[name]})
+		}
+	}
+	for name, hash := range remote {
+		if _, ok := local[name]; !ok {
+			res = append(res, ManifestMismatch{Peer: peer, Group: name, Remote: hash})
+		}
+	}
+	return res
+}
+
+// Divergent reports whether group was found configured differently on a
+// peer and must not be served, see RefuseDivergent. A TCPPool serving the
+// same groups takes it as TCPPoolOptions.Divergent.
+func (p *HTTPPool) Divergent(group string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.divergent[group]
+}
+
+// serveManifest answers a peer's request for this node's manifest.
+func (p *HTTPPool) serveManifest(w http.ResponseWriter, r *http.Request) {
+	if !p.authorize(w, r, EndpointPeer, "") {
+		return
+	}
+	writeJSON(w, http.StatusOK, LocalManifest())
+}
+
+// manifest fetches the peer's manifest.
+func (h *httpGetter) manifest(ctx context.Context) (Manifest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+manifestPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return nil, errorFromResponse(res, body)
+	}
+	var m Manifest
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,408 @@
+// Package memcachedserver serves geecache groups over the memcached text
+// protocol, so that existing memcached clients can use the cache.
+//
+// The supported commands are get, gets, set, cas, delete, touch, incr,
+// decr, append, prepend, version and quit. Flags are stored with the
+// value, see geecache.WithFlags; append, prepend, incr and decr keep those
+// of the value they change. Values reloaded from the group's store keep
+// their flags only if it is a geecache.FlagStore. The cas unique of a
+// value is its geecache version. Keys the group can't load count as 0 for
+// incr and decr, and decr goes below 0 rather than stopping there. A key
+// exists for append, prepend and delete if the group has or can load a
+// value for it.
+package memcachedserver
+
+import (
+	"GeeCache/geecache"
+	"GeeCache/geecache/internal/keyspace"
+	"GeeCache/geecache/internal/tcpserver"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxValueSize is the largest value accepted when
+// Server.MaxValueSize is 0, the default item size limit of memcached.
+const DefaultMaxValueSize = 1 << 20
+
+// 与 memcached 相同：超过 30 天的过期时间表示 Unix 时间戳，而不是相对秒数
+const maxRelativeExptime = 30 * 24 * 60 * 60
+
+// maxKeyLength is the longest key the protocol allows.
+const maxKeyLength = 250
+
+// Server answers memcached requests with the values of geecache groups.
+type Server struct {
+	// Group serves the keys of requests.
+	Group *geecache.Group
+	// Separator, if set, lets keys name their group: with ":", the key
+	// "users:42" is the key "42" of the group "users" when "users" is one
+	// of Groups, and a key of Group otherwise.
+	Separator string
+	// Groups names the groups keys may name with Separator. Other groups
+	// of the process can't be reached.
+	Groups []string
+	// MaxValueSize bounds the values set by clients, DefaultMaxValueSize
+	// if 0.
+	MaxValueSize int
+	// IdleTimeout closes connections without requests for that long, 0
+	// for never.
+	IdleTimeout time.Duration
+	// Logger receives connection errors, nothing is logged if nil.
+	Logger geecache.Logger
+
+	conns tcpserver.Conns
+}
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("memcachedserver: server closed")
+
+// ListenAndServe listens on the TCP address addr and serves it.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close, serving each of them in its
+// own goroutine.
+func (s *Server) Serve(l net.Listener) error {
+	return s.conns.Serve(l, s.serveConn, ErrServerClosed)
+}
+
+// Close stops the listeners and closes the open connections.
+func (s *Server) Close() error {
+	return s.conns.Close()
+}
+
+// errQuit ends a connection after the quit command.
+var errQuit = errors.New("quit")
+
+// clientError is answered with CLIENT_ERROR; the connection is closed
+// afterwards if the request can't be skipped.
+type clientError struct {
+	msg   string
+	fatal bool
+}
+
+func (e *clientError) Error() string { return e.msg }
+
+func (s *Server) serveConn(c net.Conn) {
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	for {
+		if s.IdleTimeout > 0 {
+			c.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		line, err := readLine(r)
+		if err != nil {
+			if err != io.EOF && !s.conns.Closed() && s.Logger != nil {
+				s.Logger.Debug("[memcached] read failed", "remote", c.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+		err = s.handle(context.Background(), r, w, strings.Fields(line))
+		var ce *clientError
+		switch {
+		case err == errQuit:
+			w.Flush()
+			return
+		case errors.As(err, &ce):
+			fmt.Fprintf(w, "CLIENT_ERROR %s\r\n", ce.msg)
+			if ce.fatal {
+				w.Flush()
+				return
+			}
+		case err != nil:
+			fmt.Fprintf(w, "SERVER_ERROR %s\r\n", strings.ReplaceAll(err.Error(), "\r\n", " "))
+		}
+		// 客户端可能流水线发送多个请求，读缓冲区空了再一起写出
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readLine reads a command line without its trailing "\r\n" or "\n".
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", &clientError{msg: "line too long", fatal: true}
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// handle executes one command, writing its reply to w.
+func (s *Server) handle(ctx context.Context, r *bufio.Reader, w *bufio.Writer, args []string) error {
+	if len(args) == 0 {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	switch cmd := args[0]; cmd {
+	case "get", "gets":
+		return s.get(ctx, w, args[1:], cmd == "gets")
+	case "set", "cas", "append", "prepend":
+		return s.store(ctx, r, w, cmd, args[1:])
+	case "delete":
+		return s.delete(ctx, w, args[1:])
+	case "touch":
+		return s.touch(ctx, w, args[1:])
+	case "incr", "decr":
+		return s.incr(ctx, w, args[1:], cmd == "decr")
+	case "version":
+		_, err := w.WriteString("VERSION geecache\r\n")
+		return err
+	case "quit":
+		return errQuit
+	}
+	_, err := w.WriteString("ERROR\r\n")
+	return err
+}
+
+// resolve returns the group and key a request key refers to.
+func (s *Server) resolve(key string) (*geecache.Group, string, error) {
+	if len(key) > maxKeyLength {
+		return nil, "", &clientError{msg: "key too long"}
+	}
+	g, key, ok := keyspace.Resolve(s.Group, s.Separator, s.Groups, key)
+	if !ok {
+		return nil, "", &clientError{msg: "no group for key"}
+	}
+	return g, key, nil
+}
+
+func (s *Server) get(ctx context.Context, w *bufio.Writer, keys []string, cas bool) error {
+	if len(keys) == 0 {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	for _, key := range keys {
+		if _, _, err := s.resolve(key); err != nil {
+			return err // 回复开始之前先检查所有的 key
+		}
+	}
+	for _, key := range keys {
+		g, k, _ := s.resolve(key)
+		v, err := g.GetContext(ctx, k)
+		if errors.Is(err, geecache.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if cas {
+			fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, v.Flags(), v.Len(), v.Version())
+		} else {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, v.Flags(), v.Len())
+		}
+		v.WriteTo(w)
+		v.Release()
+		w.WriteString("\r\n")
+	}
+	_, err := w.WriteString("END\r\n")
+	return err
+}
+
+// store handles "<cmd> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]".
+func (s *Server) store(ctx context.Context, r *bufio.Reader, w *bufio.Writer, cmd string, args []string) error {
+	n := 4
+	if cmd == "cas" {
+		n = 5
+	}
+	if len(args) < n || len(args) > n+1 || (len(args) == n+1 && args[n] != "noreply") {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	size, err := strconv.Atoi(args[3])
+	max := s.MaxValueSize
+	if max <= 0 {
+		max = DefaultMaxValueSize
+	}
+	if err != nil || size < 0 {
+		return &clientError{msg: "bad data chunk", fatal: true}
+	}
+	if size > max {
+		// 读出并丢弃数据块，连接仍可继续使用
+		if _, err := io.CopyN(io.Discard, r, int64(size)+2); err != nil {
+			return err
+		}
+		return &clientError{msg: "object too large for cache"}
+	}
+	value := make([]byte, size+2)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return err
+	}
+	if string(value[size:]) != "\r\n" {
+		return &clientError{msg: "bad data chunk", fatal: true}
+	}
+	value = value[:size]
+	flags, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, expErr := strconv.ParseInt(args[2], 10, 64)
+	if flagsErr != nil || expErr != nil {
+		return &clientError{msg: "bad command line format"}
+	}
+	g, key, err := s.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	reply := "STORED"
+	if cmd == "append" || cmd == "prepend" {
+		// 与 memcached 相同，只能追加到已有的值
+		found, err := exists(ctx, g, key)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return writeReply(w, args, "NOT_STORED")
+		}
+	}
+	switch cmd {
+	case "set":
+		err = g.Set(ctx, key, value, geecache.WithFlags(uint32(flags)))
+	case "cas":
+		var expected uint64
+		if expected, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			return &clientError{msg: "bad command line format"}
+		}
+		err = g.CompareAndSet(ctx, key, value, expected, geecache.WithFlags(uint32(flags)))
+		if errors.Is(err, geecache.ErrVersionMismatch) {
+			err, reply = nil, "EXISTS"
+		}
+	case "append":
+		err = g.Append(ctx, key, value)
+	case "prepend":
+		err = g.Prepend(ctx, key, value)
+	}
+	if err == nil && reply == "STORED" && exptime != 0 && (cmd == "set" || cmd == "cas") {
+		// 值太大没有缓存时没有过期时间可改
+		if err = expire(ctx, g, key, exptime); errors.Is(err, geecache.ErrNotFound) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return writeReply(w, args, reply)
+}
+
+func (s *Server) delete(ctx context.Context, w *bufio.Writer, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	g, key, err := s.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	found, err := exists(ctx, g, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return writeReply(w, args, "NOT_FOUND")
+	}
+	if err := g.Delete(ctx, key); err != nil {
+		return err
+	}
+	return writeReply(w, args, "DELETED")
+}
+
+// exists reports whether g has a value for key, loading it if needed.
+func exists(ctx context.Context, g *geecache.Group, key string) (bool, error) {
+	v, err := g.GetContext(ctx, key)
+	if errors.Is(err, geecache.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	v.Release()
+	return true, nil
+}
+
+func (s *Server) touch(ctx context.Context, w *bufio.Writer, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return &clientError{msg: "bad command line format"}
+	}
+	g, key, err := s.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	err = expire(ctx, g, key, exptime)
+	if errors.Is(err, geecache.ErrNotFound) {
+		return writeReply(w, args, "NOT_FOUND")
+	}
+	if err != nil {
+		return err
+	}
+	return writeReply(w, args, "TOUCHED")
+}
+
+func (s *Server) incr(ctx context.Context, w *bufio.Writer, args []string, decr bool) error {
+	if len(args) < 2 || len(args) > 3 {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || delta < 0 {
+		return &clientError{msg: "invalid numeric delta argument"}
+	}
+	g, key, err := s.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	if decr {
+		delta = -delta
+	}
+	n, err := g.Increment(ctx, key, delta)
+	if errors.Is(err, geecache.ErrNotNumeric) {
+		return &clientError{msg: "cannot increment or decrement non-numeric value"}
+	}
+	if err != nil {
+		return err
+	}
+	return writeReply(w, args, strconv.FormatInt(n, 10))
+}
+
+// expire applies a memcached exptime to key: seconds from now, a Unix
+// time if over 30 days, 0 for never, and negative for already expired.
+func expire(ctx context.Context, g *geecache.Group, key string, exptime int64) error {
+	ttl := time.Duration(exptime) * time.Second
+	if exptime > maxRelativeExptime {
+		ttl = time.Until(time.Unix(exptime, 0))
+		if ttl <= 0 {
+			exptime = -1
+		}
+	}
+	if exptime < 0 {
+		return g.Expire(ctx, key)
+	}
+	return g.Touch(ctx, key, ttl)
+}
+
+// writeReply writes reply unless the request ends with noreply.
+func writeReply(w *bufio.Writer, args []string, reply string) error {
+	if args[len(args)-1] == "noreply" {
+		return nil
+	}
+	_, err := w.WriteString(reply + "\r\n")
+	return err
+}
@@ -0,0 +1,109 @@
+package memcachedserver
+
+import (
+	"GeeCache/geecache"
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func startServer(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestServer(t *testing.T) {
+	g := geecache.NewGroup("memcached", geecache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "db" {
+			return []byte("from db"), nil
+		}
+		return nil, geecache.ErrNotFound
+	}), geecache.WithCacheBytes(2<<10))
+	c := startServer(t, &Server{Group: g, MaxValueSize: 16})
+	r := bufio.NewReader(c)
+	do := func(req string, lines int) string {
+		t.Helper()
+		fmt.Fprint(c, req)
+		var res []string
+		for i := 0; i < lines; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%q: %v", req, err)
+			}
+			res = append(res, strings.TrimSuffix(line, "\r\n"))
+		}
+		return strings.Join(res, "|")
+	}
+
+	for _, tt := range []struct {
+		req   string
+		lines int
+		want  string
+	}{
+		{"get db missing\r\n", 3, "VALUE db 0 7|from db|END"},
+		{"set k 5 0 2\r\nv1\r\nget k\r\n", 4, "STORED|VALUE k 5 2|v1|END"},
+		{"append k 0 0 1\r\n!\r\nget k\r\n", 4, "STORED|VALUE k 5 3|v1!|END"},
+		{"set k 0 0 2 noreply\r\nv2\r\nget k\r\n", 3, "VALUE k 0 2|v2|END"},
+		{"append k 0 0 1\r\n!\r\nget k\r\n", 4, "STORED|VALUE k 0 3|v2!|END"},
+		{"cas k 0 0 2 1\r\nv3\r\n", 1, "EXISTS"},
+		{"incr n 5\r\ndecr n 2\r\n", 2, "5|3"},
+		{"incr k 1\r\n", 1, "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		{"set big 0 0 17\r\n01234567890123456\r\nget big\r\n", 2, "CLIENT_ERROR object too large for cache|END"},
+		{"touch k 100\r\ntouch missing 100\r\n", 2, "TOUCHED|NOT_FOUND"},
+		{"append missing 0 0 1\r\n!\r\nprepend missing 0 0 1\r\n!\r\nget missing\r\n", 3, "NOT_STORED|NOT_STORED|END"},
+		{"delete k\r\nget k\r\ndelete k\r\n", 3, "DELETED|END|NOT_FOUND"},
+		{"bogus\r\n", 1, "ERROR"},
+	} {
+		if got := do(tt.req, tt.lines); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.req, got, tt.want)
+		}
+	}
+
+	// gets 返回的 cas 值可用于 cas 命令
+	var size, cas uint64
+	fmt.Fprint(c, "set k 0 0 1\r\na\r\ngets k\r\n")
+	r.ReadString('\n')
+	line, _ := r.ReadString('\n')
+	if _, err := fmt.Sscanf(line, "VALUE k 0 %d %d", &size, &cas); err != nil {
+		t.Fatalf("gets: %q", line)
+	}
+	r.ReadString('\n')
+	r.ReadString('\n')
+	if got := do(fmt.Sprintf("cas k 0 0 1 %d\r\nb\r\n", cas), 1); got != "STORED" {
+		t.Fatalf("cas with the gets unique = %q", got)
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	getter := geecache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	g := geecache.NewGroup("memcached-default", getter, geecache.WithCacheBytes(2<<10))
+	geecache.NewGroup("memcached-users", getter, geecache.WithCacheBytes(2<<10))
+	geecache.NewGroup("memcached-secret", getter, geecache.WithCacheBytes(2<<10))
+	c := startServer(t, &Server{Group: g, Separator: ":", Groups: []string{"memcached-users"}})
+	r := bufio.NewReader(c)
+	// 未列出的 group 不可达，整个 key 属于默认 group
+	fmt.Fprint(c, "get memcached-users:42 memcached-secret:42\r\n")
+	var lines []string
+	for i := 0; i < 5; i++ {
+		line, _ := r.ReadString('\n')
+		lines = append(lines, strings.TrimSuffix(line, "\r\n"))
+	}
+	want := "VALUE memcached-users:42 0 2|42|VALUE memcached-secret:42 0 19|memcached-secret:42|END"
+	if got := strings.Join(lines, "|"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package geecache
+
+import (
+	"errors"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// 内存压力自适应：进程内存接近上限（GOMEMLIMIT）时按比例收缩所有 group 的缓存预算，
+// 压力解除后逐步恢复，避免流量尖峰时进程被 OOM kill
+
+// A MemoryGuard scales the cache budget of every group down while the
+// process nears its memory limit, and back up once memory is available
+// again. The zero values of the fields select the defaults.
+type MemoryGuard struct {
+	Limit    int64         // memory limit in bytes, defaults to GOMEMLIMIT
+	High     float64       // shrink above this fraction of Limit, defaults to 0.85
+	Low      float64       // grow back below this fraction of Limit, defaults to 0.7
+	Step     float64       // fraction the budgets shrink by per check, defaults to 0.25
+	MinScale float64       // budgets never shrink below this fraction, defaults to 0.1
+	Interval time.Duration // how often memory is checked, defaults to 1s
+	Logger   Logger        // defaults to the standard logger
+
+	mu    sync.Mutex
+	scale float64
+	base  map[*Group]int64 // 收缩前各 group 的预算
+	stop  chan struct{}
+	usage func() uint64 // for tests
+}
+
+// ErrNoMemoryLimit is returned by MemoryGuard.Start when neither Limit nor
+// GOMEMLIMIT is set.
+var ErrNoMemoryLimit = errors.New("geecache: no memory limit set")
+
+// Start begins checking memory in a background goroutine.
+func (m *MemoryGuard) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return nil
+	}
+	if m.Limit <= 0 {
+		// 参数为负时只读取当前设置
+		if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+			m.Limit = limit
+		}
+	}
+	if m.Limit <= 0 {
+		return ErrNoMemoryLimit
+	}
+	if m.High <= 0 {
+		m.High = 0.85
+	}
+	if m.Low <= 0 || m.Low >= m.High {
+		m.Low = m.High * 0.8
+	}
+	if m.Step <= 0 || m.Step >= 1 {
+		m.Step = 0.25
+	}
+	if m.MinScale <= 0 {
+		m.MinScale = 0.1
+	}
+	if m.Interval <= 0 {
+		m.Interval = time.Second
+	}
+	if m.Logger == nil {
+		m.Logger = defaultLogger
+	}
+	if m.usage == nil {
+		m.usage = memoryUsage
+	}
+	if m.scale == 0 {
+		m.scale = 1
+	}
+	m.stop = make(chan struct{})
+	go m.loop(m.stop)
+	return nil
+}
+
+// Stop stops checking memory and restores the groups' budgets.
+func (m *MemoryGuard) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.stop = nil
+	m.apply(1)
+}
+
+// Scale returns the fraction of their budgets the groups are currently
+// limited to, 1 when there is no memory pressure.
+func (m *MemoryGuard) Scale() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scale == 0 {
+		return 1
+	}
+	return m.scale
+}
+
+func (m *MemoryGuard) loop(stop chan struct{}) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+// check adjusts the budgets to the current memory usage.
+func (m *MemoryGuard) check() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop == nil {
+		return
+	}
+	used := float64(m.usage()) / float64(m.Limit)
+	scale := m.scale
+	switch {
+	case used > m.High:
+		scale = math.Max(scale*(1-m.Step), m.MinScale)
+	case used < m.Low:
+		scale = math.Min(scale/(1-m.Step), 1)
+	}
+	if scale != m.scale {
+		m.Logger.Info("memory pressure: scaling cache budgets", "used", used, "scale", scale)
+		m.apply(scale)
+	}
+}
+
+// apply must be called with m.mu held.
+func (m *MemoryGuard) apply(scale float64) {
+	m.scale = scale
+	if m.base == nil {
+		m.base = make(map[*Group]int64)
+	}
+	for _, g := range allGroups() {
+		base, ok := m.base[g]
+		if !ok {
+			if base = g.CacheBytes(); base == 0 {
+				continue // 不限大小的 group 无从按比例收缩
+			}
+			m.base[g] = base
+		}
+		n := int64(float64(base) * scale)
+		if n < 1 {
+			n = 1
+		}
+		g.SetCacheBytes(n)
+	}
+	if scale == 1 {
+		m.base = nil // 恢复后重新记录，期间可能有 group 被替换或调整
+	}
+}
+
+// allGroups returns the registered groups.
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	res := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, g)
+	}
+	return res
+}
+
+// memoryUsage returns the memory the Go runtime counts against GOMEMLIMIT.
+func memoryUsage() uint64 {
+	// runtime/metrics 不会像 ReadMemStats 那样暂停所有 goroutine
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
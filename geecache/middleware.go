@@ -0,0 +1,136 @@
+package geecache
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 可插拔的中间件链，包裹 HTTPPool 对请求的处理
+
+// Middleware wraps the handler serving peer requests, like net/http middleware.
+type Middleware func(http.Handler) http.Handler
+
+// Use appends mw to the pool's middleware chain. The first middleware
+// added is the outermost. Use must not be called while the pool is serving.
+func (p *HTTPPool) Use(mw ...Middleware) {
+	p.middleware = append(p.middleware, mw...)
+	p.buildHandler()
+}
+
+func (p *HTTPPool) buildHandler() {
+	var h http.Handler = http.HandlerFunc(p.serve)
+	h = p.rateLimit(h)
+	for i := len(p.middleware) - 1; i >= 0; i-- {
+		h = p.middleware[i](h)
+	}
+	p.handler = h
+}
+
+// rateLimit enforces HTTPPoolOptions.RateLimit, or the limits set later
+// by SetRateLimit.
+func (p *HTTPPool) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.allowRequest(r) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AccessLog returns a middleware that logs every request to logger with
+// its method, group, key hash, status, response size and duration. Keys
+// are logged as a hash so that cache contents don't leak into logs.
+// Pass a logger backed by slog.NewJSONHandler for JSON output.
+func AccessLog(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			group, key, _ := splitPeerPath(basePathOf(r.Context()), r.URL.Path)
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "geecache request",
+				slog.String("method", r.Method),
+				slog.String("group", group),
+				slog.String("key_hash", hashKey(key)),
+				slog.Int("status", rec.status),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote", r.RemoteAddr),
+			)
+		})
+	}
+}
+
+type basePathKey struct{}
+
+// withBasePath records the base path of the pool serving a request, so
+// that middleware can parse the paths of any pool.
+func withBasePath(ctx context.Context, basePath string) context.Context {
+	return context.WithValue(ctx, basePathKey{}, basePath)
+}
+
+// basePathOf returns the base path recorded by withBasePath, or
+// defaultBasePath for requests not served by an HTTPPool.
+func basePathOf(ctx context.Context) string {
+	if p, ok := ctx.Value(basePathKey{}).(string); ok {
+		return p
+	}
+	return defaultBasePath
+}
+
+// statusRecorder captures the status code and body size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// splitPeerPath splits /<basepath>/<group>/<key>.
+func splitPeerPath(basePath, path string) (group, key string, ok bool) {
+	if !strings.HasPrefix(path, basePath) {
+		return "", "", false
+	}
+	parts := strings.SplitN(path[len(basePath):], "/", 2) //n:分割的次数，即最多将字符串分割成n个子串
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// hashKey returns a short, stable, non-reversible representation of key.
+func hashKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,288 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	"GeeCache/geecache/lru"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 扩缩容时的数据迁移：节点列表变化后，本节点把不再归它所有的条目主动推送给新的
+// 归属节点，而不是等新节点在请求到来时逐个未命中、一齐回源
+
+// MigrationReport describes the entries a migration handed over.
+type MigrationReport struct {
+	Moves  []RebalanceMove `json:"moves"`
+	Keys   int64           `json:"keys"`   // entries the new owners received
+	Bytes  int64           `json:"bytes"`  // their size
+	Failed int64           `json:"failed"` // entries whose new owner couldn't be reached
+}
+
+func (r *MigrationReport) add(o MigrationReport) {
+	for _, m := range o.Moves {
+		i := sort.Search(len(r.Moves), func(i int) bool { return r.Moves[i].To >= m.To })
+		if i < len(r.Moves) && r.Moves[i].To == m.To {
+			r.Moves[i].Keys += m.Keys
+			r.Moves[i].Bytes += m.Bytes
+			continue
+		}
+		r.Moves = append(r.Moves, RebalanceMove{})
+		copy(r.Moves[i+1:], r.Moves[i:])
+		r.Moves[i] = m
+	}
+	r.Keys += o.Keys
+	r.Bytes += o.Bytes
+	r.Failed += o.Failed
+}
+
+// tombstoneTTL is how long a group remembers a key was written or
+// removed, and so refuses migrated values of it: about as long as a
+// migration takes.
+const tombstoneTTL = 5 * time.Minute
+
+// maxTombstones is how many keys a group may remember before expired ones
+// are swept.
+const maxTombstones = 1 << 16
+
+// tombstones remembers the keys, and prefixes, written or removed on this
+// node lately: a migration from their previous owner may have read the
+// value before, and must not bring it back. The zero value is ready.
+type tombstones struct {
+	mu       sync.Mutex
+	keys     map[string]time.Time
+	prefixes map[string]time.Time
+}
+
+// mark records that key changed now.
+func (t *tombstones) mark(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.keys == nil {
+		t.keys = make(map[string]time.Time)
+	}
+	t.keys[key] = t.sweep(t.keys)
+}
+
+// markPrefix records that the keys starting with prefix changed now.
+func (t *tombstones) markPrefix(prefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prefixes == nil {
+		t.prefixes = make(map[string]time.Time)
+	}
+	t.prefixes[prefix] = t.sweep(t.prefixes)
+}
+
+// sweep drops the expired marks of m if it is full, and returns now.
+func (t *tombstones) sweep(m map[string]time.Time) time.Time {
+	now := time.Now()
+	if len(m) >= maxTombstones {
+		for k, at := range m {
+			if now.Sub(at) >= tombstoneTTL {
+				delete(m, k)
+			}
+		}
+	}
+	return now
+}
+
+// has reports whether key changed within tombstoneTTL.
+func (t *tombstones) has(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if at, ok := t.keys[key]; ok && now.Sub(at) < tombstoneTTL {
+		return true
+	}
+	for prefix, at := range t.prefixes {
+		if strings.HasPrefix(key, prefix) && now.Sub(at) < tombstoneTTL {
+			return true
+		}
+	}
+	return false
+}
+
+// maxTransferBytes bounds the entries pushed to groups whose cache size
+// isn't limited.
+const maxTransferBytes = 1 << 30
+
+// migrant is an entry on its way to its new owner.
+type migrant struct {
+	key   string
+	value ByteView
+	opts  lru.EntryOptions
+}
+
+// Migrate streams the cached entries that this node owned on the ring
+// made of previous, and another peer owns on the current one, to their
+// new owners, then drops them from this node. Peers that can't be reached
+// keep nothing and are reported in the error; their entries stay cached
+// here. HTTPPoolOptions.MigrateOnChange calls it whenever Set changes the
+// peers.
+func (p *HTTPPool) Migrate(ctx context.Context, previous ...string) (MigrationReport, error) {
+	prev := p.newRing()
+	prev.Add(p.normalizePeers(previous)...)
+	return p.migrate(ctx, prev)
+}
+
+// migrate moves the entries this node owned on prev to their current owners.
+func (p *HTTPPool) migrate(ctx context.Context, prev consistenthash.Ring) (MigrationReport, error) {
+	// 同一时间只进行一次迁移，连续变更时后一次基于前一次迁移后的缓存
+	p.migrating.Lock()
+	defer p.migrating.Unlock()
+	p.mu.Lock()
+	current := p.peers
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		getters[peer] = getter
+	}
+	p.mu.Unlock()
+
+	var report MigrationReport
+	var firstErr error
+	if current == nil {
+		return report, nil
+	}
+	for _, g := range allGroups() {
+		r, err := p.migrateGroup(ctx, g, prev, current, getters)
+		report.add(r)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return report, firstErr
+}
+
+// migrateGroup moves the entries of g this node owned on prev to their
+// owners on current.
+func (p *HTTPPool) migrateGroup(ctx context.Context, g *Group, prev, current consistenthash.Ring, getters map[string]*httpGetter) (MigrationReport, error) {
+	// 先收集再发送，网络传输期间不持有分片的锁
+	byPeer := make(map[string][]migrant)
+	g.mainCache.iterate(func(key string, v lru.Value, o lru.EntryOptions) bool {
+		rk := g.routeKey(key, "")
+		from, to := prev.Get(rk), current.Get(rk)
+		if from == to || !p.isSelf(from) || p.isSelf(to) || getters[to] == nil {
+			return true
+		}
+		if value, ok := viewOf(v); ok {
+			byPeer[to] = append(byPeer[to], migrant{key, value, o})
+		}
+		return true
+	})
+
+	var report MigrationReport
+	var firstErr error
+	for peer, entries := range byPeer {
+		if err := getters[peer].push(ctx, p, g, entries); err != nil {
+			report.Failed += int64(len(entries))
+			p.opts.Logger.Warn("migrating entries failed", "peer", peer, "group", g.name, "err", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("peer %s: %w", peer, err)
+			}
+			continue
+		}
+		m := RebalanceMove{To: peer}
+		for _, e := range entries {
+			m.Keys++
+			m.Bytes += int64(len(e.key) + e.value.Len())
+			g.mainCache.remove(e.key)
+		}
+		report.add(MigrationReport{Moves: []RebalanceMove{m}, Keys: m.Keys, Bytes: m.Bytes})
+	}
+	return report, firstErr
+}
+
+// migrateAfterSet runs the migration MigrateOnChange asks for once Set
+// replaced prev.
+func (p *HTTPPool) migrateAfterSet(prev consistenthash.Ring) {
+	report, err := p.migrate(context.Background(), prev)
+	if err != nil {
+		p.opts.Logger.Warn("migration incomplete", "failed", report.Failed, "err", err)
+	}
+	if report.Keys > 0 {
+		p.opts.Logger.Info("entries migrated to new owners", "keys", report.Keys, "bytes", report.Bytes)
+	}
+}
+
+// push sends entries of g to the peer with POST _transfer/<group>,
+// throttled as TrafficRebalance.
+func (h *httpGetter) push(ctx context.Context, p *HTTPPool, g *Group, entries []migrant) error {
+	pr, pw := io.Pipe()
+	go func() {
+		bw := bufio.NewWriter(p.ThrottleWriter(ctx, TrafficRebalance, pw))
+		for _, e := range entries {
+			writeEntry(bw, e.key, e.value, e.opts)
+		}
+		bw.WriteByte(0)
+		pw.CloseWithError(bw.Flush())
+	}()
+	defer pr.Close()
+
+	u := h.baseURL + transferPath + url.PathEscape(g.name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res, err := h.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return errorFromResponse(res, body)
+	}
+	return nil
+}
+
+// receiveTransfer answers POST _transfer/<group>, caching the entries of
+// the body that aren't cached yet: a value cached since this node became
+// their owner is at least as recent as the migrated one, and a key written
+// or removed lately may have been read by the sender before. The body may
+// hold no more than the group's caches do, and no entry more than
+// WithMaxEntryBytes allows.
+func (p *HTTPPool) receiveTransfer(w http.ResponseWriter, r *http.Request, group *Group) {
+	limit := int64(maxTransferBytes)
+	if n := group.mainCache.cacheBytes.Load(); n > 0 {
+		// 超出缓存容量的部分反正留不下，另留一些给编码开销
+		limit = n + 1<<20
+		if group.hotCache != nil {
+			limit += group.hotCache.cacheBytes.Load()
+		}
+	}
+	field := uint64(maxEntryField)
+	if group.maxEntry > 0 {
+		field = uint64(group.maxEntry)
+	}
+	lr := &io.LimitedReader{R: r.Body, N: limit + 1}
+	br := bufio.NewReader(lr)
+	now := time.Now().UnixNano()
+	for {
+		e, err := readEntryMax(br, field)
+		if err == io.EOF {
+			break
+		}
+		if lr.N == 0 {
+			writeError(w, fmt.Errorf("%w: transfer over %d bytes", ErrValueTooLarge, limit))
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := group.mainCache.options(e.key); ok || group.tombstones.has(e.key) {
+			continue
+		}
+		group.addEntry(e, now)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
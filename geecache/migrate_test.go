@@ -0,0 +1,114 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestMigrateGroup(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin:" + key), nil
+	})
+	target := NewGroup("migrate", getter, WithCacheBytes(64<<10))
+	var targetPool *HTTPPool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targetPool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	targetPool = NewHTTPPoolOpts(srv.URL, &HTTPPoolOptions{Middleware: []Middleware{}})
+	targetPool.Set(srv.URL, "http://old:1")
+
+	// 同一进程中的 group 是共享的，原归属节点用另一个 group 冒充同名 group
+	source := NewGroup("migrate-source", getter, WithCacheBytes(64<<10))
+	source.name = target.name
+	pool := NewHTTPPoolOpts("http://old:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	prev := pool.newRing()
+	prev.Add("http://old:1")
+	pool.Set(srv.URL, "http://old:1")
+
+	var moved, kept []string
+	for i := 0; i < 40; i++ {
+		key := "key" + strconv.Itoa(i)
+		source.populateCache(key, ByteView{b: []byte("cached:" + key)}, false)
+		if peer, ok := pool.PickPeer(key); ok && peer != nil {
+			moved = append(moved, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	if len(moved) == 0 || len(kept) == 0 {
+		t.Fatalf("moved %d, kept %d keys", len(moved), len(kept))
+	}
+	// 新归属节点上已经有的值更新，不会被迁移来的旧值覆盖
+	target.populateCache(moved[0], ByteView{b: []byte("fresh")}, false)
+	// 新归属节点上刚删除的 key，迁移来的旧值不能把它恢复
+	target.Remove(moved[1])
+
+	pool.mu.Lock()
+	current, getters := pool.peers, pool.httpGetters
+	pool.mu.Unlock()
+	report, err := pool.migrateGroup(context.Background(), source, prev, current, getters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Keys != int64(len(moved)) || len(report.Moves) != 1 || report.Moves[0].To != srv.URL {
+		t.Fatalf("report %+v, want %d keys moved to %s", report, len(moved), srv.URL)
+	}
+	if _, ok := target.mainCache.get(moved[1]); ok {
+		t.Fatalf("migration brought back the removed %s", moved[1])
+	}
+	for _, key := range moved[2:] {
+		if v, ok := target.mainCache.get(key); !ok || v.String() != "cached:"+key {
+			t.Fatalf("%s not migrated: %q", key, v.String())
+		}
+		if _, ok := source.mainCache.get(key); ok {
+			t.Fatalf("%s still cached on the old owner", key)
+		}
+	}
+	if v, _ := target.mainCache.get(moved[0]); v.String() != "fresh" {
+		t.Fatalf("migration overwrote %s with %q", moved[0], v.String())
+	}
+	for _, key := range kept {
+		if _, ok := source.mainCache.get(key); !ok {
+			t.Fatalf("%s dropped though its owner didn't change", key)
+		}
+	}
+}
+
+func TestReceiveTransferLimits(t *testing.T) {
+	g := NewGroup("transfer-limits", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithCacheBytes(64<<10), WithMaxEntryBytes(1<<10))
+	pool := NewHTTPPoolOpts("http://self:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	post := func(values ...[]byte) int {
+		var buf bytes.Buffer
+		bw := bufio.NewWriter(&buf)
+		for i, v := range values {
+			writeEntry(bw, "k"+strconv.Itoa(i), ByteView{b: v}, lru.EntryOptions{})
+		}
+		bw.WriteByte(0)
+		bw.Flush()
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(http.MethodPost, defaultBasePath+transferPath+g.name, &buf))
+		return w.Code
+	}
+	if code := post([]byte("small")); code != http.StatusNoContent {
+		t.Fatalf("small entry: status %d", code)
+	}
+	if code := post(make([]byte, 2<<10)); code != http.StatusBadRequest {
+		t.Fatalf("entry over the max entry size: status %d", code)
+	}
+	values := make([][]byte, 1200)
+	for i := range values {
+		values[i] = make([]byte, 1000)
+	}
+	if code := post(values...); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body over the cache size: status %d", code)
+	}
+}
@@ -0,0 +1,123 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// 节点地址规范化：各节点的配置写法可能不同（大小写、默认端口、IPv6 写法），
+// 规范化后一致性哈希环在所有节点上相同，PickPeer 也能正确识别自己
+
+// NormalizePeerAddr returns the canonical form of a peer base URL such as
+// "http://10.0.0.2:8008": the scheme defaults to http and is lower-cased,
+// as is the host name; IP addresses are written in their shortest form,
+// IPv6 ones in brackets; default ports and trailing slashes are dropped.
+//
+// A peer on the same host may also be reached over a unix socket, named
+// "unix:///path/to/socket" with an absolute path.
+func NormalizePeerAddr(addr string) (string, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(u.Scheme, "unix") {
+		if u.Host != "" || !path.IsAbs(u.Path) || u.RawQuery != "" || u.Fragment != "" {
+			return "", fmt.Errorf("peer %q: unix sockets are named unix:///absolute/path", addr)
+		}
+		return "unix://" + path.Clean(u.Path), nil
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("peer %q: unsupported scheme %q", addr, u.Scheme)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.Trim(u.Path, "/") != "" {
+		return "", fmt.Errorf("peer %q: only scheme, host and port are allowed", addr)
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if host == "" {
+		return "", fmt.Errorf("peer %q: missing host", addr)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String() // 同一个地址的不同写法，如 ::ffff:10.0.0.1 与 10.0.0.1
+	}
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port == "" {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return u.Scheme + "://" + host, nil
+	}
+	return u.Scheme + "://" + net.JoinHostPort(host, port), nil
+}
+
+// normalizePeers normalizes addrs, keeping those that fail to parse as
+// they are so that a typo doesn't silently shrink the ring.
+func (p *HTTPPool) normalizePeers(addrs []string) []string {
+	res := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		n, err := NormalizePeerAddr(addr)
+		if err != nil {
+			p.opts.Logger.Warn("invalid peer address", "peer", addr, "err", err)
+			n = addr
+		}
+		res = append(res, n)
+	}
+	return res
+}
+
+// unixSocket returns the path of the socket of a normalized unix peer
+// address.
+func unixSocket(peer string) (string, bool) {
+	return strings.CutPrefix(peer, "unix://")
+}
+
+// unixClient returns a client sending every request to the socket at
+// name, whatever the host of the URL. TLS is not used: the permissions of
+// the socket file restrict who may connect.
+func unixClient(name string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", name)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// ListenPeer listens on addr, a host:port or a peer address such as
+// "unix:///run/geecache.sock". A socket file left behind by a previous
+// process is removed first.
+func ListenPeer(addr string) (net.Listener, error) {
+	n, err := NormalizePeerAddr(addr)
+	if err != nil || !strings.HasPrefix(n, "unix://") {
+		// 普通的 host:port 监听地址不一定是合法的节点地址，如 ":8001"
+		if u, err := url.Parse(addr); err == nil && u.Host != "" {
+			addr = u.Host
+		}
+		return net.Listen("tcp", addr)
+	}
+	name, _ := unixSocket(n)
+	if fi, err := os.Lstat(name); err == nil && fi.Mode().Type() == fs.ModeSocket {
+		if c, err := net.Dial("unix", name); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("listen unix %s: socket in use", name)
+		}
+		os.Remove(name)
+	}
+	return net.Listen("unix", name)
+}
+
+// isSelf reports whether the normalized peer address is this node.
+func (p *HTTPPool) isSelf(peer string) bool {
+	return p.selves[peer]
+}
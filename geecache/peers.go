@@ -1,6 +1,10 @@
 package geecache
 
-import pb "GeeCache/geecache/geecachepb"
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"io"
+)
 
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
@@ -9,8 +13,33 @@ type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// ReplicaPicker is implemented by PeerPickers able to name the peers
+// following the owner of a key, which requests may be hedged to.
+type ReplicaPicker interface {
+	PeerPicker
+	// PickPeers returns up to n remote peers in the order they would own
+	// key, the owner first unless it is this node.
+	PickPeers(key string, n int) []PeerGetter
+}
+
+// PeerLister is implemented by PeerPickers able to list every remote peer,
+// which requests concerning all keys, e.g. Group.InvalidatePrefix, are
+// sent to.
+type PeerLister interface {
+	PeerPicker
+	// AllPeers returns the peers other than this node.
+	AllPeers() []PeerGetter
+}
+
 // PeerGetter is the interface that must be implemented by a peer.
 // PeerGetter 就对应于上述流程中的 HTTP 客户端。
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error //用于从对应 group 查找缓存值
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error //用于从对应 group 查找缓存值
+}
+
+// StreamingPeerGetter is implemented by peers able to copy a value to w
+// as it arrives, without holding it in memory.
+type StreamingPeerGetter interface {
+	PeerGetter
+	GetStream(ctx context.Context, in *pb.Request, w io.Writer) error
 }
@@ -0,0 +1,210 @@
+package geecache
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 客户端（httpGetter）侧的请求统计：记录每个远程节点最近的请求耗时分布，
+// 并据此自适应地调整超时时间，而不是使用固定值
+
+const (
+	defaultLatencyWindow = 256
+	defaultMinSamples    = 20
+)
+
+// AdaptiveTimeout derives the timeout of peer requests from the observed
+// latency of each peer: Multiplier × p99, clamped to [Min, Max].
+type AdaptiveTimeout struct {
+	Initial    time.Duration // used until MinSamples requests completed
+	Min, Max   time.Duration
+	Multiplier float64 // defaults to 3
+	MinSamples int     // defaults to 20
+	Window     int     // number of recent samples kept, defaults to 256
+}
+
+// LatencyBuckets are the upper bounds of the buckets of
+// PeerStats.Histogram and LoadLatency.Histogram. It is a copy: changing
+// it doesn't change the buckets.
+var LatencyBuckets = append([]time.Duration(nil), latencyBounds[:]...)
+
+var latencyBounds = [...]time.Duration{
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+}
+
+// latencyBucket returns the histogram bucket of d.
+func latencyBucket(d time.Duration) int {
+	return sort.Search(len(latencyBounds), func(i int) bool { return d <= latencyBounds[i] })
+}
+
+// PeerStats is a snapshot of the client-side statistics of one peer.
+type PeerStats struct {
+	Requests uint64
+	Errors   uint64 // failed requests, including timeouts
+	Timeouts uint64
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Timeout  time.Duration // timeout currently applied, 0 if none
+	Protocol int           // ProtocolVersion of the last answer, 0 before any
+	// Histogram counts the successful requests since the peer was added
+	// by latency: Histogram[i] those taking at most LatencyBuckets[i] and
+	// more than the bound before, the last one those taking longer than
+	// every bound.
+	Histogram []uint64
+	// Slow is whether P99 exceeds HTTPPoolOptions.SlowPeerThreshold.
+	Slow bool
+}
+
+// peerStats records the outcome of requests sent to one peer.
+type peerStats struct {
+	mu       sync.Mutex
+	cfg      *AdaptiveTimeout
+	samples  []time.Duration // ring buffer of recent latencies
+	next     int
+	requests uint64
+	errors   uint64
+	timeouts uint64
+	timeout  time.Duration // cached, recomputed every few samples
+	protocol int
+	buckets  []uint64 // 自加入以来的耗时分布，不随窗口滚动
+
+	// 慢节点检测：p99 超过 slowAbove 时记录一条日志，恢复后再记录一条
+	peer      string
+	slowAbove time.Duration
+	logger    Logger
+	slow      bool
+}
+
+func newPeerStats(cfg *AdaptiveTimeout) *peerStats {
+	window := defaultLatencyWindow
+	if cfg != nil && cfg.Window > 0 {
+		window = cfg.Window
+	}
+	s := &peerStats{cfg: cfg, samples: make([]time.Duration, 0, window), buckets: make([]uint64, len(latencyBounds)+1)}
+	if cfg != nil {
+		s.timeout = cfg.Initial
+	}
+	return s
+}
+
+// watchSlow makes s log when the p99 latency of peer exceeds threshold
+// and when it recovers.
+func (s *peerStats) watchSlow(peer string, threshold time.Duration, logger Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peer, s.slowAbove, s.logger = peer, threshold, logger
+	if threshold <= 0 {
+		s.slow = false
+	}
+}
+
+func (s *peerStats) observe(d time.Duration, err error, timedOut bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if err != nil {
+		s.errors++
+		if timedOut {
+			s.timeouts++
+		}
+	}
+	// 超时的请求耗时被截断，不能代表真实延迟；其它失败通常很快返回，同样不计入
+	if err == nil {
+		s.buckets[latencyBucket(d)]++
+		if len(s.samples) < cap(s.samples) {
+			s.samples = append(s.samples, d)
+		} else {
+			s.samples[s.next] = d
+			s.next = (s.next + 1) % len(s.samples)
+		}
+	}
+	// 排序有开销，每 16 次请求才重新计算一次超时
+	if s.cfg != nil && s.requests%16 == 0 {
+		s.timeout = s.computeTimeout()
+	}
+	if s.slowAbove > 0 && s.requests%16 == 0 && len(s.samples) >= defaultMinSamples {
+		p99 := quantiles(s.samples, 0.99)[0]
+		if slow := p99 > s.slowAbove; slow != s.slow {
+			s.slow = slow
+			if slow {
+				s.logger.Warn("slow peer", "peer", s.peer, "p99", p99, "threshold", s.slowAbove)
+			} else {
+				s.logger.Info("peer no longer slow", "peer", s.peer, "p99", p99)
+			}
+		}
+	}
+}
+
+func (s *peerStats) setProtocol(v int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.protocol = v
+}
+
+// currentTimeout returns the timeout for the next request, 0 meaning none.
+func (s *peerStats) currentTimeout() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.timeout
+}
+
+// computeTimeout must be called with s.mu held.
+func (s *peerStats) computeTimeout() time.Duration {
+	cfg := s.cfg
+	minSamples := cfg.MinSamples
+	if minSamples <= 0 {
+		minSamples = defaultMinSamples
+	}
+	if len(s.samples) < minSamples {
+		return cfg.Initial
+	}
+	multiplier := cfg.Multiplier
+	if multiplier <= 0 {
+		multiplier = 3
+	}
+	t := time.Duration(float64(quantiles(s.samples, 0.99)[0]) * multiplier)
+	if cfg.Min > 0 && t < cfg.Min {
+		t = cfg.Min
+	}
+	if cfg.Max > 0 && t > cfg.Max {
+		t = cfg.Max
+	}
+	return t
+}
+
+func (s *peerStats) snapshot() PeerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := PeerStats{
+		Requests: s.requests,
+		Errors:   s.errors,
+		Timeouts: s.timeouts,
+		Timeout:  s.timeout,
+		Protocol: s.protocol,
+		Slow:     s.slow,
+	}
+	st.Histogram = append([]uint64(nil), s.buckets...)
+	if len(s.samples) > 0 {
+		q := quantiles(s.samples, 0.5, 0.9, 0.99)
+		st.P50, st.P90, st.P99 = q[0], q[1], q[2]
+	}
+	return st
+}
+
+// quantiles returns the requested quantiles of samples without modifying it.
+func quantiles(samples []time.Duration, qs ...float64) []time.Duration {
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	res := make([]time.Duration, len(qs))
+	for i, q := range qs {
+		idx := int(q * float64(len(sorted)-1))
+		res[i] = sorted[idx]
+	}
+	return res
+}
@@ -0,0 +1,207 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 钉住的条目：关键的配置数据不参与 LRU 淘汰，单独计量并受上限约束
+
+// ErrPinLimit reports that pinning a key would exceed the group's pinned
+// bytes cap, see WithPinnedBytes.
+var ErrPinLimit = errors.New("geecache: pinned bytes limit exceeded")
+
+// pinSet holds the pinned keys of a group, outside of its LRU cache. A nil
+// value means the key is pinned but its value was invalidated, to be
+// loaded again by the next Get.
+type pinSet struct {
+	mu     sync.Mutex
+	values map[string]*ByteView
+	bytes  int64
+	max    int64
+	count  atomic.Int64 // len(values)，无钉住的 key 时 Get 不必加锁
+}
+
+// WithPinnedBytes allows pinning up to n bytes of keys and values with
+// Group.Pin. Pinned bytes are not part of the cache budget.
+func WithPinnedBytes(n int64) Option {
+	return func(g *Group) {
+		g.pins.max = n
+	}
+}
+
+// Pin loads key and keeps it on this node regardless of the eviction
+// policy, until Unpin. Remove and Clear still invalidate the value, which
+// is then loaded again and kept pinned.
+func (g *Group) Pin(key string) error {
+	value, err := g.Get(key)
+	if err != nil {
+		return err
+	}
+	p := &g.pins
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.values[key]; ok && old != nil {
+		return nil
+	}
+	size := int64(len(key) + value.Len())
+	if p.bytes+size > p.max {
+		return fmt.Errorf("%w: pinning %q needs %d bytes, %d of %d in use", ErrPinLimit, key, size, p.bytes, p.max)
+	}
+	if p.values == nil {
+		p.values = make(map[string]*ByteView)
+	}
+	if _, ok := p.values[key]; !ok {
+		p.count.Add(1)
+	}
+	p.values[key] = &value
+	p.bytes += size
+	g.mainCache.remove(key) // 不重复占用缓存预算
+	return nil
+}
+
+// Unpin returns key to the LRU cache, and reports whether it was pinned.
+func (g *Group) Unpin(key string) bool {
+	p := &g.pins
+	p.mu.Lock()
+	value, ok := p.values[key]
+	if ok {
+		delete(p.values, key)
+		p.count.Add(-1)
+		if value != nil {
+			p.bytes -= int64(len(key) + value.Len())
+		}
+	}
+	p.mu.Unlock()
+	if value != nil {
+		g.mainCache.add(key, g.storedForm(*value), g.entryOptions(key))
+	}
+	return ok
+}
+
+// PinnedBytes returns the bytes of the keys and values pinned in the group.
+func (g *Group) PinnedBytes() int64 {
+	g.pins.mu.Lock()
+	defer g.pins.mu.Unlock()
+	return g.pins.bytes
+}
+
+// get returns the value of a pinned key.
+func (p *pinSet) get(key string) (ByteView, bool) {
+	if p.count.Load() == 0 {
+		return ByteView{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v := p.values[key]; v != nil {
+		return *v, true
+	}
+	return ByteView{}, false
+}
+
+// store keeps value if key is pinned, and reports whether it did. A value
+// that no longer fits under the cap leaves the key unpinned.
+func (p *pinSet) store(key string, value ByteView) bool {
+	if p.count.Load() == 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.values[key]
+	if !ok || v != nil {
+		return ok
+	}
+	size := int64(len(key) + value.Len())
+	if p.bytes+size > p.max {
+		delete(p.values, key)
+		p.count.Add(-1)
+		return false
+	}
+	value = value.detached()
+	p.values[key] = &value
+	p.bytes += size
+	return true
+}
+
+// swap replaces the value of key if it is pinned and cond, if not nil,
+// accepts the version of the current value (0 if none). pinned reports
+// whether key is pinned; a value that doesn't fit under the cap leaves it
+// unpinned.
+func (p *pinSet) swap(key string, value ByteView, cond func(current uint64) bool) (stored, pinned bool) {
+	pinned, err := p.update(key, func(current ByteView, _ bool) (ByteView, error) {
+		if cond != nil && !cond(current.version) {
+			return ByteView{}, ErrVersionMismatch
+		}
+		return value, nil
+	})
+	return pinned && err == nil, pinned
+}
+
+// update replaces the value of key, if it is pinned, with what fn returns
+// for the current one; ok is false if the value was invalidated. pinned
+// reports whether key is pinned; a value that doesn't fit under the cap
+// leaves it unpinned, with the error of fn, if any, dropped.
+func (p *pinSet) update(key string, fn func(current ByteView, ok bool) (ByteView, error)) (pinned bool, err error) {
+	if p.count.Load() == 0 {
+		return false, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.values[key]
+	if !ok {
+		return false, nil
+	}
+	var current ByteView
+	var size int64
+	if v != nil {
+		current, size = *v, int64(len(key)+v.Len())
+	}
+	value, err := fn(current, v != nil)
+	if err != nil {
+		return true, err
+	}
+	newSize := int64(len(key) + value.Len())
+	if p.bytes-size+newSize > p.max {
+		delete(p.values, key)
+		p.count.Add(-1)
+		p.bytes -= size
+		return false, nil
+	}
+	p.values[key] = &value
+	p.bytes += newSize - size
+	return true, nil
+}
+
+// invalidatePrefix drops the values of the keys starting with prefix,
+// keeping them pinned, and returns how many it dropped.
+func (p *pinSet) invalidatePrefix(prefix string) (n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, v := range p.values {
+		if v != nil && strings.HasPrefix(k, prefix) {
+			p.values[k] = nil
+			p.bytes -= int64(len(k) + v.Len())
+			n++
+		}
+	}
+	return n
+}
+
+// invalidate drops the value of key, or of every key if all is set,
+// keeping them pinned. It reports whether a value was dropped.
+func (p *pinSet) invalidate(key string, all bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dropped := false
+	for k, v := range p.values {
+		if v != nil && (all || k == key) {
+			p.values[k] = nil
+			p.bytes -= int64(len(k) + v.Len())
+			dropped = true
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,97 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 按 key 前缀（命名空间）区分的过期策略：同一个 group 中的不同数据可以有不同的
+// 生命周期，例如 "session:" 按空闲时间过期，"config:" 按固定 TTL 过期
+
+// Policy is the lifetime policy of the entries of a namespace.
+type Policy struct {
+	TTL  time.Duration // entries expire TTL after they were cached, 0 for never
+	Idle time.Duration // entries expire when not read for Idle, 0 for never
+	// Priority is how many times an entry is spared when it reaches the
+	// tail of the LRU list, moving it back to the front instead; entries
+	// with a higher priority thus outlive colder ones under memory pressure.
+	Priority int
+}
+
+type prefixPolicy struct {
+	prefix string
+	Policy
+}
+
+// WithPolicy applies p to the keys starting with prefix. The policy of the
+// longest matching prefix wins; the empty prefix sets the group default.
+// Policies are resolved when an entry is cached, so changing them doesn't
+// affect entries already in the cache.
+func WithPolicy(prefix string, p Policy) Option {
+	return func(g *Group) {
+		g.putPolicy(prefix, p)
+	}
+}
+
+// WithTTL makes the group's entries expire ttl after they were cached,
+// like WithPolicy("", Policy{TTL: ttl}).
+func WithTTL(ttl time.Duration) Option {
+	return WithPolicy("", Policy{TTL: ttl})
+}
+
+// SetPolicy changes the policy of prefix at run time, like WithPolicy.
+// Entries already cached keep the lifetime they were given.
+func (g *Group) SetPolicy(prefix string, p Policy) {
+	g.policyMu.Lock()
+	defer g.policyMu.Unlock()
+	g.putPolicy(prefix, p)
+	g.configHash.Store(g.computeConfigHash())
+}
+
+// putPolicy replaces the policy list with a copy holding p for prefix, so
+// that readers never lock.
+func (g *Group) putPolicy(prefix string, p Policy) {
+	policies := append([]prefixPolicy(nil), g.policyList()...)
+	found := false
+	for i := range policies {
+		if policies[i].prefix == prefix {
+			policies[i].Policy, found = p, true
+		}
+	}
+	if !found {
+		policies = append(policies, prefixPolicy{prefix: prefix, Policy: p})
+		sort.SliceStable(policies, func(i, j int) bool {
+			return len(policies[i].prefix) > len(policies[j].prefix)
+		})
+	}
+	g.policies.Store(&policies)
+}
+
+func (g *Group) policyList() []prefixPolicy {
+	if p := g.policies.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// policyFor returns the policy of key, the zero Policy if none matches.
+func (g *Group) policyFor(key string) Policy {
+	for _, p := range g.policyList() {
+		if strings.HasPrefix(key, p.prefix) {
+			return p.Policy
+		}
+	}
+	return Policy{}
+}
+
+// entryOptions resolves the lifetime of key when it is being cached.
+func (g *Group) entryOptions(key string) lru.EntryOptions {
+	p := g.policyFor(key)
+	o := lru.EntryOptions{Idle: p.Idle, Priority: p.Priority}
+	if p.TTL > 0 {
+		o.Expire = time.Now().Add(p.TTL)
+	}
+	return o
+}
@@ -0,0 +1,95 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// 池化缓冲区：从对端取回的值读入 sync.Pool 管理的缓冲区，调用方用完后 Release 归还，
+// 省去高吞吐下每个请求的分配和随之而来的 GC 压力。归还后缓冲区会被其它请求复用，
+// 仍持有旧视图的代码会读到别的值，因此需要显式开启
+
+// WithPooledBuffers makes the group read the values it fetches from peers,
+// and the values loaded from its Getter it doesn't cache, into pooled
+// buffers. Callers of Get should call ByteView.Release once done with the
+// value, and must neither use it nor anything sharing its bytes, such as
+// its slices, afterwards. Values never released are garbage collected as
+// usual, and Release does nothing for values served from the cache.
+func WithPooledBuffers() Option {
+	return func(g *Group) {
+		g.pooledBuffers = true
+	}
+}
+
+// pooledBuffer holds the bytes of views read with WithPooledBuffers.
+type pooledBuffer struct {
+	b    []byte
+	refs atomic.Int32 // 共享同一次加载结果的调用者各持有一个引用
+}
+
+var valuePool = sync.Pool{New: func() interface{} { return new(pooledBuffer) }}
+
+// newPooledBuffer returns an empty buffer with one reference.
+func newPooledBuffer() *pooledBuffer {
+	p := valuePool.Get().(*pooledBuffer)
+	p.b = p.b[:0]
+	p.refs.Store(1)
+	return p
+}
+
+func (p *pooledBuffer) release() {
+	switch refs := p.refs.Add(-1); {
+	case refs < 0:
+		panic("geecache: ByteView released more than once")
+	case refs == 0 && cap(p.b) <= maxPooledBuffer:
+		valuePool.Put(p)
+	}
+}
+
+// appendingPeerGetter is implemented by peers able to read a value into
+// a buffer they are given, for WithPooledBuffers.
+type appendingPeerGetter interface {
+	getAppend(ctx context.Context, in *pb.Request, out *pb.Response, dst []byte) error
+}
+
+// Release hands the buffer of a value read with WithPooledBuffers back
+// for reuse. v must not be used afterwards, nor released again. It does
+// nothing for other values.
+func (v ByteView) Release() {
+	if v.buf != nil {
+		v.buf.release()
+	}
+}
+
+// detached returns v with bytes of its own if they are in a pooled
+// buffer, for keeping v past its Release.
+func (v ByteView) detached() ByteView {
+	if v.buf != nil {
+		v.b, v.buf = cloneBytes(v.b), nil
+	}
+	return v
+}
+
+// pooledView returns value with a copy of its bytes, which the Getter may
+// reuse, in a pooled buffer with WithPooledBuffers and in a new slice
+// otherwise.
+func (g *Group) pooledView(value ByteView) ByteView {
+	if !g.pooledBuffers {
+		value.b = cloneBytes(value.b)
+		return value
+	}
+	buf := newPooledBuffer()
+	buf.b = append(buf.b, value.b...)
+	value.b, value.buf = buf.b, buf
+	return value
+}
+
+// shareLoad gives every caller sharing a load one reference to the pooled
+// buffer of its value, see singleflight.Group.DoShared.
+func shareLoad(v interface{}, callers int) {
+	if buf := v.(loadResult).value.buf; buf != nil {
+		buf.refs.Store(int32(callers))
+	}
+}
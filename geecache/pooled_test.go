@@ -0,0 +1,83 @@
+package geecache
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPooledBuffers(t *testing.T) {
+	release := make(chan struct{})
+	NewGroup("pooled", GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			<-release
+		}
+		return []byte("owner:" + key), nil
+	}), WithCacheBytes(0))
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+
+	// 同一进程中的 group 是共享的，用另一个 group 冒充非归属节点上的同名 group
+	g := NewGroup("pooled-client", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat("x", 64)), nil
+	}), WithCacheBytes(2<<10), WithMaxEntryBytes(32), WithOversizePassThrough(), WithPooledBuffers())
+	g.name = "pooled"
+	pool := NewHTTPPoolOpts("http://self:1", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set(srv.URL)
+	g.RegisterPeers(pool)
+
+	v, err := g.Get("k")
+	if err != nil || v.String() != "owner:k" || v.buf == nil {
+		t.Fatalf("get = %q, pooled %v, %v", v.String(), v.buf != nil, err)
+	}
+	v.Release()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("second Release didn't panic")
+			}
+		}()
+		v.Release()
+	}()
+
+	// 并发等待同一次加载的调用者各持有一个引用
+	var wg sync.WaitGroup
+	views := make([]ByteView, 3)
+	for i := range views {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			views[i], _ = g.Get("slow")
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	buf := views[0].buf
+	if buf == nil || buf.refs.Load() != int32(len(views)) {
+		t.Fatalf("shared load: %v", buf)
+	}
+	for _, v := range views {
+		if v.buf != buf || v.String() != "owner:slow" {
+			t.Fatalf("shared load returned %q", v.String())
+		}
+		v.Release()
+	}
+	if n := buf.refs.Load(); n != 0 {
+		t.Fatalf("%d references left", n)
+	}
+
+	// 未缓存的回源结果同样放在池化缓冲区中，缓存中的值则不是
+	pool.Set()
+	if v, err := g.Get("big"); err != nil || v.Len() != 64 || v.buf == nil {
+		t.Fatalf("oversize load: %d bytes, pooled %v, %v", v.Len(), v.buf != nil, err)
+	}
+	g.maxEntry = 0
+	for i := 0; i < 2; i++ {
+		if v, err := g.Get("cached"); err != nil || v.buf != nil {
+			t.Fatalf("cached value pooled %v, %v", v.buf != nil, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"errors"
+	"sync"
+)
+
+// 按前缀失效：key 常按命名空间组织，如 "user:123:profile"、"user:123:orders"，
+// 用户数据变化时需要一次性失效 "user:123:" 下的所有 key。这些 key 分散在各个节点上，
+// 所以集群范围的失效会发给每一个节点
+
+// prefixProtocol is the protocol version from which peers honor prefix
+// deletes.
+const prefixProtocol = 4
+
+// WithPrefixIndex makes the cache index its keys by their namespace
+// prefixes, those ending with sep, e.g. "user:" and "user:123:" for
+// "user:123:profile" with sep ':'. RemovePrefix and PrefixStats of such a
+// prefix then visit only the entries under it instead of every entry, at
+// the cost of some memory per key and namespace.
+func WithPrefixIndex(sep byte) Option {
+	return func(g *Group) {
+		g.cacheOpts.prefixIndex = true
+		g.cacheOpts.prefixSep = sep
+	}
+}
+
+// RemovePrefix drops every key starting with prefix from this node, like
+// Remove does for one key, and returns how many cached values it dropped.
+// An empty prefix drops every key.
+func (g *Group) RemovePrefix(prefix string) int {
+	n := g.mainCache.removePrefix(prefix)
+	g.tombstones.markPrefix(prefix)
+	if g.leases != nil {
+		g.leases.revokePrefix(prefix) // 删除前开始的加载不能再把旧值写回
+	}
+	if g.hotCache != nil {
+		n += g.hotCache.removePrefix(prefix)
+	}
+	n += g.pins.invalidatePrefix(prefix)
+	if g.tier != nil {
+		g.tier.DeletePrefix(prefix)
+	}
+	for _, d := range g.dependents.list() {
+		d.RemovePrefix(prefix)
+	}
+	return n
+}
+
+// InvalidatePrefix drops every key starting with prefix from the cache of
+// every node: keys of a namespace are spread over the cluster, so the
+// request goes to all the peers listed by a PeerLister, in parallel. The
+// Store, if any, is left alone. The error joins those of the peers that
+// failed; the other peers have dropped the keys. Peers speaking a
+// protocol before version 4 drop only the key equal to prefix, and fail
+// with ErrProtocolMismatch.
+func (g *Group) InvalidatePrefix(ctx context.Context, prefix string) error {
+	if prefix == "" {
+		return errors.New("prefix is required")
+	}
+	g.RemovePrefix(prefix)
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	peers := lister.AllPeers()
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		setter, ok := peer.(PeerSetter)
+		if !ok {
+			errs[i] = ErrReadOnlyPeer
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = setter.Delete(ctx, &pb.Request{Group: g.name, Key: prefix, Prefix: true})
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// PrefixStats describes the cached keys starting with a prefix on one
+// node, see Group.PrefixStats.
+type PrefixStats struct {
+	Items int64 `json:"items"`
+	Bytes int64 `json:"bytes"` // as accounted against the cache budget
+}
+
+// PrefixStats counts the values cached on this node for the keys starting
+// with prefix, hot copies of other nodes' keys included.
+func (g *Group) PrefixStats(prefix string) PrefixStats {
+	n, bytes := g.mainCache.prefixStats(prefix)
+	if g.hotCache != nil {
+		hn, hb := g.hotCache.prefixStats(prefix)
+		n, bytes = n+hn, bytes+hb
+	}
+	return PrefixStats{Items: int64(n), Bytes: bytes}
+}
@@ -0,0 +1,112 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestInvalidatePrefix(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	})
+	keys := []string{"user:1:profile", "user:1:orders", "user:12:profile", "post:1"}
+	remote := NewGroup("prefix", getter, WithPrefixIndex(':'))
+	local := NewGroup("prefix-a", getter, WithPrefixIndex(':'))
+	local.name = "prefix"
+	for _, g := range []*Group{remote, local} {
+		for _, key := range keys {
+			if _, err := g.Get(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if s := local.PrefixStats("user:1:"); s.Items != 2 || s.Bytes <= 0 {
+		t.Fatalf("stats of user:1: = %+v", s)
+	}
+	if s := local.PrefixStats("user:1"); s.Items != 3 {
+		t.Fatalf("stats of user:1 = %+v, want the keys of both users", s)
+	}
+
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Middleware: []Middleware{}}))
+	defer srv.Close()
+	pool := NewHTTPPoolOpts("http://self:8001", &HTTPPoolOptions{Middleware: []Middleware{}})
+	pool.Set("http://self:8001", srv.URL)
+	local.RegisterPeers(pool)
+
+	if err := local.InvalidatePrefix(context.Background(), "user:1:"); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*Group{remote, local} {
+		if s := g.PrefixStats("user:1:"); s.Items != 0 {
+			t.Fatalf("%d keys of user:1: left", s.Items)
+		}
+		if s := g.PrefixStats(""); s.Items != 2 {
+			t.Fatalf("%d keys left in all, want user:12:profile and post:1", s.Items)
+		}
+	}
+	if err := local.InvalidatePrefix(context.Background(), ""); err == nil {
+		t.Fatal("invalidated an empty prefix")
+	}
+
+	// 旧版本的节点只会删除与前缀相同的 key，失效必须报告失败
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(protocolHeader, "3")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer old.Close()
+	pool.Set("http://self:8001", old.URL)
+	if err := local.InvalidatePrefix(context.Background(), "post:"); !errors.Is(err, ErrProtocolMismatch) {
+		t.Fatalf("invalidation on an old peer: %v", err)
+	}
+	oldPeer := &httpGetter{baseURL: old.URL + defaultBasePath}
+	if err := oldPeer.Delete(context.Background(), &pb.Request{Group: "prefix", Key: "post:1"}); err != nil {
+		t.Fatalf("delete of one key on an old peer: %v", err)
+	}
+}
+
+func TestEmptyPrefixDelete(t *testing.T) {
+	g := NewGroup("prefix-empty", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	if _, err := g.Get("k"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{AuthToken: "peer", AdminToken: "root", Middleware: []Middleware{}}))
+	defer srv.Close()
+	del := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+defaultBasePath+"prefix-empty/", nil)
+		req.Header.Set(prefixHeader, "1")
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// 空前缀会清空整个 group，节点的 token 不够
+	if code := del("peer"); code != http.StatusForbidden {
+		t.Fatalf("empty prefix with the peer token: status = %d", code)
+	}
+	if _, ok := g.cached("k"); !ok {
+		t.Fatal("empty prefix with the peer token cleared the group")
+	}
+	if code := del("root"); code != http.StatusNoContent {
+		t.Fatalf("empty prefix with the admin token: status = %d", code)
+	}
+	if _, ok := g.cached("k"); ok {
+		t.Fatal("empty prefix from an admin left the group")
+	}
+
+	body, _ := proto.Marshal(&pb.Request{Group: "prefix-empty", Prefix: true, ProtocolVersion: ProtocolVersion})
+	if _, err := NewTCPPool("", nil).serveDelete(body); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("empty prefix over tcp: %v", err)
+	}
+}
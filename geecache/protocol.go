@@ -0,0 +1,108 @@
+package geecache
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// 协议版本检查：节点间的每个请求和响应都带上发送方的协议版本（HTTPPool 放在头部，
+// TCPPool 放在 protocol_version 字段），滚动升级期间新版本的节点据此照顾旧版本的对端，
+// 或者明确拒绝对方，而不是把对方的请求解析错
+
+// ProtocolVersion is the version of the protocol peers speak, raised
+// whenever a release changes the meaning of requests or responses in a
+// way older releases would misread. Releases before versioning speak
+// version 1. Responses of version 3 carry the checksum of their value.
+//
+// Version 4 nodes honor prefix deletes, pb.Request.Prefix, requests for
+// whole values, pb.Request.Whole, and peeks, pb.Request.Peek. Older nodes
+// ignore these fields: they drop only the key equal to the prefix, so
+// InvalidatePrefix fails for them with ErrProtocolMismatch; they answer
+// chunked values with their manifest, which package client refuses with
+// ErrProtocolMismatch too; and they answer a peek, as used by Group.TTL,
+// like a Get, loading the key if they don't cache it.
+const ProtocolVersion = 4
+
+// protocolHeader carries the protocol version of the sender of peer
+// requests and responses.
+const protocolHeader = "X-Geecache-Protocol"
+
+// protocolOf returns the protocol version in h, 1 if it has none, and 0
+// if it is malformed.
+func protocolOf(h http.Header) int {
+	s := h.Get(protocolHeader)
+	if s == "" {
+		return 1
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 1 {
+		return 0
+	}
+	return v
+}
+
+// minProtocol returns the oldest protocol version this node talks to.
+func (p *HTTPPool) minProtocol() int {
+	return min(max(p.opts.MinProtocolVersion, 1), ProtocolVersion)
+}
+
+// checkProtocol refuses requests from peers speaking a protocol older
+// than HTTPPoolOptions.MinProtocolVersion, and tells the peer this node's
+// version. Newer peers are accepted: it is up to them to refuse this node
+// with their own MinProtocolVersion, or to keep to what it understands.
+func (p *HTTPPool) checkProtocol(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set(protocolHeader, strconv.Itoa(ProtocolVersion))
+	if v := protocolOf(r.Header); v < p.minProtocol() {
+		writeError(w, fmt.Errorf("%w: peer speaks version %d, %s requires %d to %d",
+			ErrProtocolMismatch, v, p.self, p.minProtocol(), ProtocolVersion))
+		return false
+	}
+	return true
+}
+
+// fieldProtocol returns the version in a protocol_version field, 1 for
+// senders before versioning.
+func fieldProtocol(v uint32) int {
+	return max(int(v), 1)
+}
+
+// checkPeerProtocol fails with ErrProtocolMismatch if peer, which may be
+// unnamed, speaks version v, older than min.
+func checkPeerProtocol(peer string, v, min int) error {
+	if v >= min {
+		return nil
+	}
+	if peer != "" {
+		peer = " " + peer
+	}
+	return fmt.Errorf("%w: peer%s speaks version %d, this node requires %d to %d",
+		ErrProtocolMismatch, peer, v, min, ProtocolVersion)
+}
+
+// roundTrip sends a request to the peer, adding the credentials and
+// protocol version, and fails with ErrProtocolMismatch if the peer
+// answers with a protocol older than this node accepts.
+func (h *httpGetter) roundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set(protocolHeader, strconv.Itoa(ProtocolVersion))
+	if h.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.authToken)
+	}
+	client := h.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnavailable, err)
+	}
+	v := protocolOf(res.Header)
+	if h.stats != nil {
+		h.stats.setProtocol(v)
+	}
+	if err := checkPeerProtocol(h.baseURL, v, h.minProtocol); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,255 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// 令牌桶限流：以固定速率往桶里放令牌，桶满则丢弃，每次操作消耗令牌
+
+// A Bucket is a token bucket refilled at rate tokens per second and holding
+// at most burst tokens. A Bucket is safe for concurrent use. A nil *Bucket
+// never limits.
+type Bucket struct {
+	mu     sync.Mutex // guards tokens and last
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket.
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Burst returns the capacity of the bucket.
+func (b *Bucket) Burst() int {
+	if b == nil {
+		return 0
+	}
+	return int(b.burst)
+}
+
+// refill adds the tokens accumulated since the last call. b.mu must be held.
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// Allow reports whether one token is available, consuming it if so.
+func (b *Bucket) Allow() bool {
+	return b.AllowN(time.Now(), 1)
+}
+
+// AllowN reports whether n tokens are available at now, consuming them if so.
+func (b *Bucket) AllowN(now time.Time, n int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// WaitN blocks until n tokens can be consumed or ctx is done. n may exceed
+// the burst size, in which case the caller waits for the deficit to refill.
+func (b *Bucket) WaitN(ctx context.Context, n int) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.refill(now)
+	// 先预支令牌（允许为负），再按欠下的数量计算需要等待的时间
+	b.tokens -= float64(n)
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// 归还没用上的令牌
+		b.mu.Lock()
+		b.tokens += float64(n)
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	buckets []*Bucket
+	chunk   int
+}
+
+// NewReader returns a Reader that consumes one token per byte read from r
+// from every bucket, blocking while any of them is exhausted.
+func NewReader(ctx context.Context, r io.Reader, buckets ...*Bucket) io.Reader {
+	return &reader{ctx: ctx, r: r, buckets: buckets, chunk: chunkSize(buckets)}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := waitAll(r.ctx, r.buckets, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type writer struct {
+	ctx     context.Context
+	w       io.Writer
+	buckets []*Bucket
+	chunk   int
+}
+
+// NewWriter returns a Writer that consumes one token per byte written to w
+// from every bucket, blocking while any of them is exhausted.
+func NewWriter(ctx context.Context, w io.Writer, buckets ...*Bucket) io.Writer {
+	return &writer{ctx: ctx, w: w, buckets: buckets, chunk: chunkSize(buckets)}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > w.chunk {
+			n = w.chunk
+		}
+		if err := waitAll(w.ctx, w.buckets, n); err != nil {
+			return written, err
+		}
+		m, err := w.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func waitAll(ctx context.Context, buckets []*Bucket, n int) error {
+	for _, b := range buckets {
+		if err := b.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkSize keeps single operations within the smallest burst so that a
+// large write is spread out instead of being released all at once.
+func chunkSize(buckets []*Bucket) int {
+	chunk := 32 << 10
+	for _, b := range buckets {
+		if burst := b.Burst(); burst > 0 && burst < chunk {
+			chunk = burst
+		}
+	}
+	return chunk
+}
+
+// Keyed keeps an independent Bucket per key, e.g. per client address.
+// Buckets that have been idle long enough to refill completely are
+// forgotten, so the number of tracked keys stays bounded by recent traffic.
+type Keyed struct {
+	rate  float64
+	burst int
+
+	mu        sync.Mutex // guards buckets and lastSweep
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// NewKeyed creates a Keyed limiter whose buckets refill at rate tokens per
+// second and hold at most burst tokens.
+func NewKeyed(rate float64, burst int) *Keyed {
+	return &Keyed{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*Bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether key may perform one more operation now.
+func (k *Keyed) Allow(key string) bool {
+	now := time.Now()
+	k.mu.Lock()
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	if idle := k.refillTime(); now.Sub(k.lastSweep) > idle {
+		k.sweep(now, idle)
+	}
+	k.mu.Unlock()
+	return b.AllowN(now, 1)
+}
+
+// refillTime is how long an empty bucket takes to become full again.
+func (k *Keyed) refillTime() time.Duration {
+	d := time.Duration(float64(k.burst) / k.rate * float64(time.Second))
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+// sweep drops buckets untouched for longer than idle. k.mu must be held.
+func (k *Keyed) sweep(now time.Time, idle time.Duration) {
+	for key, b := range k.buckets {
+		b.mu.Lock()
+		stale := now.Sub(b.last) > idle
+		b.mu.Unlock()
+		if stale {
+			delete(k.buckets, key)
+		}
+	}
+	k.lastSweep = now
+}
+
+// Len returns the number of keys currently tracked.
+func (k *Keyed) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.buckets)
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestAllowN(t *testing.T) {
+	b := NewBucket(10, 5)
+	now := time.Now()
+	if !b.AllowN(now, 5) {
+		t.Fatalf("a full bucket should allow its burst")
+	}
+	if b.AllowN(now, 1) {
+		t.Fatalf("an empty bucket should not allow")
+	}
+	if !b.AllowN(now.Add(100*time.Millisecond), 1) {
+		t.Fatalf("one token should be refilled after 100ms at 10/s")
+	}
+}
+
+func TestWriterThrottles(t *testing.T) {
+	// 1000 B/s with a 100 B burst: writing 300 B needs ~200ms of refill.
+	b := NewBucket(1000, 100)
+	var buf bytes.Buffer
+	w := NewWriter(context.Background(), &buf, b)
+
+	start := time.Now()
+	if _, err := w.Write(make([]byte, 300)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("write finished after %v, expected throttling", elapsed)
+	}
+	if buf.Len() != 300 {
+		t.Fatalf("wrote %d bytes, want 300", buf.Len())
+	}
+}
+
+func TestReaderCancel(t *testing.T) {
+	b := NewBucket(1, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	r := NewReader(ctx, bytes.NewReader(make([]byte, 10)), b)
+	if _, err := io.ReadAll(r); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	k := NewKeyed(1, 2)
+	for i := 0; i < 2; i++ {
+		if !k.Allow("a") {
+			t.Fatalf("request %d of client a should be allowed", i)
+		}
+	}
+	if k.Allow("a") {
+		t.Fatalf("client a should be limited after its burst")
+	}
+	if !k.Allow("b") {
+		t.Fatalf("client b must not share client a's bucket")
+	}
+	if k.Len() != 2 {
+		t.Fatalf("tracking %d clients, want 2", k.Len())
+	}
+}
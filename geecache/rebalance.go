@@ -0,0 +1,107 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	"GeeCache/geecache/lru"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 扩缩容评估：在真正修改节点列表之前，计算本节点缓存的 key 中有多少会换到
+// 其它节点，以及按配置的重平衡带宽搬运它们大约需要多久
+
+// RebalanceMove is the data one node would hand over to another.
+type RebalanceMove struct {
+	To    string `json:"to"`
+	Keys  int64  `json:"keys"`
+	Bytes int64  `json:"bytes"`
+}
+
+// RebalancePlan describes the effect of a peer set change on the entries
+// cached by this node. Since every node only knows its own entries, the
+// plans of all nodes together describe the whole cluster.
+type RebalancePlan struct {
+	Node       string          `json:"node"`
+	Moves      []RebalanceMove `json:"moves"`
+	Keys       int64           `json:"keys"`       // entries changing owner
+	Bytes      int64           `json:"bytes"`      // their size
+	Kept       int64           `json:"kept"`       // entries keeping their owner
+	Bandwidth  int64           `json:"bandwidth"`  // bytes per second, 0 if unlimited
+	Estimation time.Duration   `json:"estimation"` // time to move Bytes at Bandwidth
+}
+
+// rebalanceBandwidth returns the bytes per second rebalancing may use, 0
+// if it is not throttled.
+func (p *HTTPPool) rebalanceBandwidth() int64 {
+	bw := p.opts.BackgroundBandwidth
+	if c := p.opts.ClassBandwidth[TrafficRebalance]; c > 0 && (bw == 0 || c < bw) {
+		bw = c
+	}
+	return bw
+}
+
+// PlanRebalance reports which of the entries cached by this node would
+// change owner if the peer set became peers. Nothing is changed.
+func (p *HTTPPool) PlanRebalance(peers ...string) RebalancePlan {
+	peers = p.normalizePeers(peers)
+	next := p.newRing()
+	next.Add(peers...)
+
+	p.mu.Lock()
+	current := p.peers
+	p.mu.Unlock()
+	owner := func(ring consistenthash.Ring, key string) string {
+		if ring == nil {
+			return p.self
+		}
+		if peer := ring.Get(key); peer != "" && !p.isSelf(peer) {
+			return peer
+		}
+		return p.self
+	}
+
+	plan := RebalancePlan{Node: p.self, Bandwidth: p.rebalanceBandwidth()}
+	moves := make(map[string]*RebalanceMove)
+	for _, g := range allGroups() {
+		g.mainCache.iterate(func(key string, v lru.Value, _ lru.EntryOptions) bool {
+			rk := g.routeKey(key, "")
+			from, to := owner(current, rk), owner(next, rk)
+			if from == to {
+				plan.Kept++
+				return true
+			}
+			m := moves[to]
+			if m == nil {
+				m = &RebalanceMove{To: to}
+				moves[to] = m
+			}
+			size := int64(len(key) + v.Len())
+			m.Keys++
+			m.Bytes += size
+			plan.Keys++
+			plan.Bytes += size
+			return true
+		})
+	}
+	for _, m := range moves {
+		plan.Moves = append(plan.Moves, *m)
+	}
+	sort.Slice(plan.Moves, func(i, j int) bool { return plan.Moves[i].To < plan.Moves[j].To })
+	if bw := plan.Bandwidth; bw > 0 {
+		// 分开计算整秒和余数，避免溢出或浮点误差
+		plan.Estimation = time.Duration(plan.Bytes/bw)*time.Second + time.Duration(plan.Bytes%bw)*time.Second/time.Duration(bw)
+	}
+	return plan
+}
+
+// serveRebalancePlan answers GET rebalance?peers=<addr>,<addr>,...
+func (p *HTTPPool) serveRebalancePlan(w http.ResponseWriter, r *http.Request) {
+	list := r.URL.Query().Get("peers")
+	if list == "" {
+		writeJSON(w, http.StatusBadRequest, adminResult{Error: "peers is required"})
+		return
+	}
+	writeJSON(w, http.StatusOK, p.PlanRebalance(strings.Split(list, ",")...))
+}
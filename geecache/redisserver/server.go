@@ -0,0 +1,363 @@
+// Package redisserver serves geecache groups over RESP, the Redis
+// protocol, so that Redis clients and tools like redis-cli can read and
+// write the cache.
+//
+// The supported commands are GET, SET (with EX, PX and NX), DEL, EXPIRE,
+// TTL, MGET, PING, ECHO, COMMAND and QUIT. DEL counts every key it is
+// given as deleted, since groups don't report whether the key existed.
+package redisserver
+
+import (
+	"GeeCache/geecache"
+	"GeeCache/geecache/internal/keyspace"
+	"GeeCache/geecache/internal/resp"
+	"GeeCache/geecache/internal/tcpserver"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxValueSize is the largest bulk string accepted when
+// Server.MaxValueSize is 0.
+const DefaultMaxValueSize = 1 << 20
+
+// maxArgs bounds the number of arguments of a command.
+const maxArgs = 1 << 16
+
+// Server answers Redis requests with the values of geecache groups.
+type Server struct {
+	// Group serves the keys of requests. Separator and Groups let keys
+	// name other groups, as for memcachedserver.Server.
+	Group     *geecache.Group
+	Separator string
+	Groups    []string
+	// MaxValueSize bounds the arguments sent by clients,
+	// DefaultMaxValueSize if 0.
+	MaxValueSize int
+	// IdleTimeout closes connections without requests for that long, 0
+	// for never.
+	IdleTimeout time.Duration
+	// Logger receives connection errors, nothing is logged if nil.
+	Logger geecache.Logger
+
+	conns tcpserver.Conns
+}
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("redisserver: server closed")
+
+// ListenAndServe listens on the TCP address addr and serves it.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close, serving each of them in its
+// own goroutine.
+func (s *Server) Serve(l net.Listener) error {
+	return s.conns.Serve(l, s.serveConn, ErrServerClosed)
+}
+
+// Close stops the listeners and closes the open connections.
+func (s *Server) Close() error {
+	return s.conns.Close()
+}
+
+// errQuit ends a connection after QUIT.
+var errQuit = errors.New("quit")
+
+func (s *Server) serveConn(c net.Conn) {
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	for {
+		if s.IdleTimeout > 0 {
+			c.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		args, err := s.readCommand(r)
+		var pe resp.ProtocolError
+		if errors.As(err, &pe) {
+			fmt.Fprintf(w, "-ERR %s\r\n", pe.Error())
+			w.Flush()
+			return
+		}
+		if err != nil {
+			if err != io.EOF && !s.conns.Closed() && s.Logger != nil {
+				s.Logger.Debug("[redis] read failed", "remote", c.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := s.handle(context.Background(), w, args); err == errQuit {
+			w.Flush()
+			return
+		}
+		// 客户端可能流水线发送多个请求，读缓冲区空了再一起写出
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads a command of at most MaxValueSize bytes per argument.
+func (s *Server) readCommand(r *bufio.Reader) ([]string, error) {
+	max := s.MaxValueSize
+	if max <= 0 {
+		max = DefaultMaxValueSize
+	}
+	return resp.ReadCommand(r, maxArgs, max)
+}
+
+// handle executes one command, writing its reply to w.
+func (s *Server) handle(ctx context.Context, w *bufio.Writer, args []string) error {
+	cmd := strings.ToUpper(args[0])
+	arity := map[string]int{
+		"GET": 2, "SET": -3, "DEL": -2, "EXPIRE": 3, "TTL": 2, "MGET": -2,
+		"PING": -1, "ECHO": 2, "COMMAND": -1, "QUIT": -1,
+	}[cmd]
+	switch {
+	case arity == 0:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return nil
+	case (arity > 0 && len(args) != arity) || (arity < 0 && len(args) < -arity):
+		writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+		return nil
+	}
+	var err error
+	switch cmd {
+	case "GET":
+		err = s.get(ctx, w, args[1])
+	case "SET":
+		err = s.set(ctx, w, args[1:])
+	case "DEL":
+		err = s.del(ctx, w, args[1:])
+	case "EXPIRE":
+		err = s.expire(ctx, w, args[1], args[2])
+	case "TTL":
+		err = s.ttl(ctx, w, args[1])
+	case "MGET":
+		err = s.mget(ctx, w, args[1:])
+	case "PING":
+		if len(args) > 1 {
+			writeBulk(w, []byte(args[1]))
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+	case "ECHO":
+		writeBulk(w, []byte(args[1]))
+	case "COMMAND":
+		// redis-cli 启动时会发送 COMMAND DOCS，回复空数组即可
+		w.WriteString("*0\r\n")
+	case "QUIT":
+		w.WriteString("+OK\r\n")
+		return errQuit
+	}
+	if err != nil {
+		writeError(w, "ERR "+err.Error())
+	}
+	return nil
+}
+
+// resolve returns the group and key a request key refers to.
+func (s *Server) resolve(key string) (*geecache.Group, string, error) {
+	g, key, ok := keyspace.Resolve(s.Group, s.Separator, s.Groups, key)
+	if !ok {
+		return nil, "", errors.New("no group for key")
+	}
+	return g, key, nil
+}
+
+func (s *Server) get(ctx context.Context, w *bufio.Writer, key string) error {
+	g, k, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	v, err := g.GetContext(ctx, k)
+	if errors.Is(err, geecache.ErrNotFound) {
+		w.WriteString("$-1\r\n")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	writeBulk(w, v.ByteSlice())
+	v.Release()
+	return nil
+}
+
+func (s *Server) mget(ctx context.Context, w *bufio.Writer, keys []string) error {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		g, k, err := s.resolve(key)
+		if err != nil {
+			return err
+		}
+		v, err := g.GetContext(ctx, k)
+		if errors.Is(err, geecache.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		values[i] = v.ByteSlice()
+		v.Release()
+	}
+	fmt.Fprintf(w, "*%d\r\n", len(values))
+	for _, v := range values {
+		if v == nil {
+			w.WriteString("$-1\r\n")
+		} else {
+			writeBulk(w, v)
+		}
+	}
+	return nil
+}
+
+// set handles SET key value [EX seconds | PX milliseconds] [NX].
+func (s *Server) set(ctx context.Context, w *bufio.Writer, args []string) error {
+	var ttl time.Duration
+	nx := false
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "EX", "PX":
+			if i+1 == len(args) || ttl != 0 {
+				return errors.New("syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errors.New("invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			return errors.New("syntax error")
+		}
+	}
+	g, key, err := s.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	value := []byte(args[1])
+	if nx {
+		// 能从数据源加载的 key 也已存在；版本 0 再排除检查之后才缓存的值
+		v, getErr := g.GetContext(ctx, key)
+		if getErr == nil {
+			v.Release()
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+		if !errors.Is(getErr, geecache.ErrNotFound) {
+			return getErr
+		}
+		err = g.CompareAndSet(ctx, key, value, 0)
+		if errors.Is(err, geecache.ErrVersionMismatch) {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+	} else {
+		err = g.Set(ctx, key, value)
+	}
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		// 值太大没有缓存时没有过期时间可改
+		if err := g.Touch(ctx, key, ttl); err != nil && !errors.Is(err, geecache.ErrNotFound) {
+			return err
+		}
+	}
+	w.WriteString("+OK\r\n")
+	return nil
+}
+
+func (s *Server) del(ctx context.Context, w *bufio.Writer, keys []string) error {
+	for _, key := range keys {
+		g, k, err := s.resolve(key)
+		if err != nil {
+			return err
+		}
+		if err := g.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, ":%d\r\n", len(keys))
+	return nil
+}
+
+func (s *Server) expire(ctx context.Context, w *bufio.Writer, key, seconds string) error {
+	n, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return errors.New("value is not an integer or out of range")
+	}
+	g, k, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		// 与 Redis 相同：非正数的过期时间立即删除 key
+		if _, err := g.TTL(ctx, k); errors.Is(err, geecache.ErrNotFound) {
+			w.WriteString(":0\r\n")
+			return nil
+		}
+		err = g.Expire(ctx, k)
+	} else {
+		err = g.Touch(ctx, k, time.Duration(n)*time.Second)
+	}
+	if errors.Is(err, geecache.ErrNotFound) {
+		w.WriteString(":0\r\n")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteString(":1\r\n")
+	return nil
+}
+
+func (s *Server) ttl(ctx context.Context, w *bufio.Writer, key string) error {
+	g, k, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	ttl, err := g.TTL(ctx, k)
+	switch {
+	case errors.Is(err, geecache.ErrNotFound):
+		w.WriteString(":-2\r\n")
+	case err != nil:
+		return err
+	case ttl == 0:
+		w.WriteString(":-1\r\n")
+	default:
+		// 向上取整，与 Redis 一样刚设置 EXPIRE 10 的 key 返回 10
+		fmt.Fprintf(w, ":%d\r\n", (ttl+time.Second-1)/time.Second)
+	}
+	return nil
+}
+
+func writeBulk(w *bufio.Writer, b []byte) {
+	fmt.Fprintf(w, "$%d\r\n", len(b))
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
@@ -0,0 +1,84 @@
+package redisserver
+
+import (
+	"GeeCache/geecache"
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	g := geecache.NewGroup("redis", geecache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "db" {
+			return []byte("from db"), nil
+		}
+		return nil, geecache.ErrNotFound
+	}), geecache.WithCacheBytes(2<<10))
+	s := &Server{Group: g}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	defer s.Close()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(c)
+	do := func(lines int, args ...string) string {
+		t.Helper()
+		fmt.Fprintf(c, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(c, "$%d\r\n%s\r\n", len(a), a)
+		}
+		var res []string
+		for i := 0; i < lines; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%q: %v", args, err)
+			}
+			res = append(res, strings.TrimSuffix(line, "\r\n"))
+		}
+		return strings.Join(res, "|")
+	}
+
+	for _, tt := range []struct {
+		args  []string
+		lines int
+		want  string
+	}{
+		{[]string{"PING"}, 1, "+PONG"},
+		{[]string{"get", "db"}, 2, "$7|from db"},
+		{[]string{"GET", "missing"}, 1, "$-1"},
+		{[]string{"SET", "k", "v1"}, 1, "+OK"},
+		{[]string{"SET", "k", "v2", "NX"}, 1, "$-1"},
+		{[]string{"SET", "db", "v2", "NX"}, 1, "$-1"},
+		{[]string{"SET", "new", "v", "NX"}, 1, "+OK"},
+		{[]string{"TTL", "k"}, 1, ":-1"},
+		{[]string{"SET", "k", "v3", "EX", "100"}, 1, "+OK"},
+		{[]string{"TTL", "k"}, 1, ":100"},
+		{[]string{"EXPIRE", "k", "10"}, 1, ":1"},
+		{[]string{"TTL", "k"}, 1, ":10"},
+		{[]string{"EXPIRE", "missing", "10"}, 1, ":0"},
+		{[]string{"TTL", "missing"}, 1, ":-2"},
+		{[]string{"MGET", "k", "missing", "db"}, 6, "*3|$2|v3|$-1|$7|from db"},
+		{[]string{"DEL", "k"}, 1, ":1"},
+		{[]string{"GET", "k"}, 1, "$-1"},
+		{[]string{"SET", "k", "v", "EX", "0"}, 1, "-ERR invalid expire time in 'set' command"},
+		{[]string{"GET"}, 1, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"FLUSHALL"}, 1, "-ERR unknown command 'FLUSHALL'"},
+	} {
+		if got := do(tt.lines, tt.args...); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	// telnet 风格的内联命令
+	fmt.Fprint(c, "ECHO hi\r\n")
+	if line, _ := r.ReadString('\n'); line != "$2\r\n" {
+		t.Fatalf("inline ECHO = %q", line)
+	}
+}
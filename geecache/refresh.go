@@ -0,0 +1,84 @@
+package geecache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 提前刷新（refresh-ahead）：热点 key 在 TTL 快到期时被访问，就在后台重新加载，
+// 使其在过期前被替换，调用方不会遇到过期导致的未命中
+
+// WithRefreshAhead makes a cache hit on an entry within fraction of its
+// TTL of expiring reload it from the Getter in the background; e.g. 0.2
+// refreshes entries read during the last fifth of their lifetime. Only
+// entries with a TTL, see WithPolicy, are refreshed.
+func WithRefreshAhead(fraction float64) Option {
+	return func(g *Group) {
+		g.refreshAhead = fraction
+	}
+}
+
+// refreshing tracks the keys being reloaded ahead of expiry.
+type refreshing struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// start reports whether key isn't being refreshed already, marking it so.
+func (r *refreshing) start(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys[key] {
+		return false
+	}
+	if r.keys == nil {
+		r.keys = make(map[string]bool)
+	}
+	r.keys[key] = true
+	return true
+}
+
+func (r *refreshing) done(key string) {
+	r.mu.Lock()
+	delete(r.keys, key)
+	r.mu.Unlock()
+}
+
+// maybeRefresh schedules a reload of the cached key if it's about to expire.
+func (g *Group) maybeRefresh(key string) {
+	ttl := g.policyFor(key).TTL
+	if ttl <= 0 {
+		return
+	}
+	o, ok := g.mainCache.options(key)
+	if !ok || o.Expire.IsZero() {
+		return
+	}
+	if time.Until(o.Expire) > time.Duration(float64(ttl)*g.refreshAhead) || g.stopped() || !g.refreshing.start(key) {
+		return
+	}
+	g.Stats.RefreshAheads.Add(1)
+	go func() {
+		defer g.refreshing.done(key)
+		// 与普通加载一样经过 singleflight、准入控制和并发加载上限
+		var info LoadInfo
+		v, err := g.load(context.Background(), key, g.routeKey(key, ""), true, &info)
+		if err != nil {
+			// 旧值仍在缓存中直到过期，下次访问会再次尝试
+			g.logger.Warn("[GeeCache] refresh ahead failed", "group", g.name, "err", err)
+			return
+		}
+		v.Release()
+	}()
+}
+
+// stopped reports whether the group was replaced and drained.
+func (g *Group) stopped() bool {
+	select {
+	case <-g.stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,27 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	pb "GeeCache/geecache/geecachepb"
+	"fmt"
+	"time"
+)
+
+// 条件请求：热点缓存中的副本过期后留到被淘汰为止，再次读取时带上它的内容标签
+// （If-None-Match）去问对端，值没有变化时对端只回 304，不必再传一遍可能很大的值
+
+// contentTag identifies the bytes of v, as an HTTP entity tag.
+func contentTag(v ByteView) string {
+	// 64 位哈希加上 CRC-32C，两者同时碰撞的概率可以忽略
+	return fmt.Sprintf(`"%016x%08x"`, consistenthash.XXHash64(v.b), v.checksum())
+}
+
+// revalidated returns the hot copy cached, which the peer reported as
+// unchanged in res, with the version and expiry res gives it, and caches
+// it again.
+func (g *Group) revalidated(key string, cached ByteView, res *pb.Response) ByteView {
+	g.Stats.PeerNotModified.Add(1)
+	view := ByteView{b: cached.b, version: res.Version, expire: res.ExpiresMs * int64(time.Millisecond), flags: res.Flags, sum: cached.sum}
+	g.populateCache(key, view, true)
+	return view
+}
@@ -0,0 +1,67 @@
+package geecache
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+)
+
+// 哈希环的分布情况：各节点分到的哈希空间比例，以及一组样本 key 的实际落点，
+// 便于运维在负载倾斜酿成事故之前发现问题
+
+// maxRingSample bounds the bytes of sample keys the ring endpoint reads.
+const maxRingSample = 16 << 20
+
+// A RingReport describes how the ring of a HTTPPool spreads keys.
+type RingReport struct {
+	Nodes  []string           `json:"nodes"`
+	Shares map[string]float64 `json:"shares"` // fraction of the hash space owned
+	// Imbalance is the largest share over the mean share, 1 for a
+	// perfectly even ring.
+	Imbalance float64        `json:"imbalance"`
+	Keys      map[string]int `json:"keys,omitempty"` // sample keys owned
+}
+
+// RingReport reports the share of keys each node owns, and how many of
+// keysSample, which may be nil, each gets.
+func (p *HTTPPool) RingReport(keysSample []string) RingReport {
+	// Set 换上新的环而不修改旧的，取到的环在锁外计算也不会变，
+	// 大量样本 key 不会长时间挡住 PickPeer
+	p.mu.Lock()
+	ring := p.peers
+	p.mu.Unlock()
+	if ring == nil {
+		return RingReport{Nodes: []string{}, Shares: map[string]float64{}}
+	}
+	r := RingReport{Nodes: ring.Nodes(), Shares: ring.Shares()}
+	for _, share := range r.Shares {
+		if imbalance := share * float64(len(r.Nodes)); imbalance > r.Imbalance {
+			r.Imbalance = imbalance
+		}
+	}
+	if keysSample != nil {
+		r.Keys = ring.Distribution(keysSample)
+	}
+	return r
+}
+
+// serveRing answers the ring admin endpoint: GET reports the shares of
+// the nodes, POST additionally places the keys of the body, one per line.
+func (p *HTTPPool) serveRing(w http.ResponseWriter, r *http.Request) {
+	var sample []string
+	if r.Method == http.MethodPost {
+		sc := bufio.NewScanner(io.LimitReader(r.Body, maxRingSample))
+		sc.Buffer(nil, maxRingSample)
+		sample = []string{}
+		for sc.Scan() {
+			if key := sc.Text(); key != "" {
+				sample = append(sample, key)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			writeJSON(w, http.StatusBadRequest, adminResult{Error: err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, p.RingReport(sample))
+}
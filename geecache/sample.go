@@ -0,0 +1,236 @@
+package geecache
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 访问采样：按比例记录访问（key 的哈希、时间、是否命中、大小），
+// 作为模拟器和容量规划的输入，开销远小于完整的访问日志
+
+// An AccessSample records one sampled Get.
+type AccessSample struct {
+	KeyHash uint64
+	Time    time.Time
+	Hit     bool
+	Size    int
+}
+
+// A SampleExporter receives sampled accesses. Export is called on the Get
+// path and must not block.
+type SampleExporter interface {
+	Export(s AccessSample)
+}
+
+// WithAccessSampling records a fraction rate (0 < rate <= 1) of the
+// group's keys to exp. Keys are picked by hash rather than accesses at
+// random, so every access to a sampled key is recorded and reuse
+// distances in the trace stay faithful to the full workload.
+func WithAccessSampling(rate float64, exp SampleExporter) Option {
+	return func(g *Group) {
+		if rate <= 0 || exp == nil {
+			return
+		}
+		g.sampleBelow = math.MaxUint64
+		if rate < 1 {
+			g.sampleBelow = uint64(rate * math.MaxUint64)
+		}
+		g.sampler = exp
+	}
+}
+
+// sample reports the access to key if it is sampled.
+func (g *Group) sample(key string, hit bool, size int) {
+	h := hashKey64(key)
+	if h > g.sampleBelow {
+		return
+	}
+	g.sampler.Export(AccessSample{KeyHash: h, Time: time.Now(), Hit: hit, Size: size})
+}
+
+// hashKey64 is the 64-bit FNV-1a hash of key, inlined to avoid allocating.
+func hashKey64(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// sampleQueue is the number of samples a SampleFile buffers for its writer.
+const sampleQueue = 4096
+
+// SampleFile is a SampleExporter appending samples to a file as lines of
+// "<unix nanoseconds>,<key hash in hex>,<hit|miss>,<size>". When the file
+// grows beyond maxBytes it is renamed to name+".1", replacing the previous
+// one, and a new file is started.
+//
+// Samples are written by a background goroutine, so that Export never
+// waits for the disk; samples arriving while it is sampleQueue samples
+// behind are dropped and counted by Dropped.
+type SampleFile struct {
+	name     string
+	maxBytes int64
+
+	samples   chan AccessSample
+	flushes   chan chan error
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Int64
+
+	// 以下字段只由写入协程访问，done 关闭后由 Close 读取
+	f       *os.File
+	w       *bufio.Writer
+	written int64
+	err     error // first write error, samples are dropped afterwards
+}
+
+// NewSampleFile opens name for appending samples.
+func NewSampleFile(name string, maxBytes int64) (*SampleFile, error) {
+	s := &SampleFile{
+		name:     name,
+		maxBytes: maxBytes,
+		samples:  make(chan AccessSample, sampleQueue),
+		flushes:  make(chan chan error),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	go s.writeLoop()
+	return s, nil
+}
+
+func (s *SampleFile) open() error {
+	f, err := os.OpenFile(s.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.w, s.written = f, bufio.NewWriter(f), fi.Size()
+	return nil
+}
+
+// Export implements SampleExporter.
+func (s *SampleFile) Export(a AccessSample) {
+	select {
+	case s.samples <- a:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of samples dropped because the writer fell
+// behind or the file was closed.
+func (s *SampleFile) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// writeLoop writes queued samples until Close.
+func (s *SampleFile) writeLoop() {
+	defer close(s.done)
+	for {
+		select {
+		case a := <-s.samples:
+			s.write(a)
+		case ch := <-s.flushes:
+			// 先写完已排队的样本
+			s.drain()
+			if s.err == nil {
+				s.err = s.w.Flush()
+			}
+			ch <- s.err
+		case <-s.stop:
+			s.drain()
+			if s.err != nil {
+				s.f.Close()
+				return
+			}
+			s.err = s.closeFile()
+			return
+		}
+	}
+}
+
+// drain writes the samples queued so far.
+func (s *SampleFile) drain() {
+	for {
+		select {
+		case a := <-s.samples:
+			s.write(a)
+		default:
+			return
+		}
+	}
+}
+
+func (s *SampleFile) write(a AccessSample) {
+	if s.err != nil {
+		s.dropped.Add(1)
+		return
+	}
+	result := "miss"
+	if a.Hit {
+		result = "hit"
+	}
+	n, err := fmt.Fprintf(s.w, "%d,%016x,%s,%d\n", a.Time.UnixNano(), a.KeyHash, result, a.Size)
+	s.written += int64(n)
+	if err == nil && s.maxBytes > 0 && s.written >= s.maxBytes {
+		err = s.rotate()
+	}
+	s.err = err
+}
+
+func (s *SampleFile) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	if err := os.Rename(s.name, s.name+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *SampleFile) closeFile() error {
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// Flush writes the samples exported so far to the file.
+func (s *SampleFile) Flush() error {
+	ch := make(chan error, 1)
+	select {
+	case s.flushes <- ch:
+		return <-ch
+	case <-s.done:
+		return os.ErrClosed
+	}
+}
+
+// Close writes the samples exported so far and closes the file. It
+// returns the first error met while exporting, if any. Samples exported
+// after Close are dropped.
+func (s *SampleFile) Close() error {
+	err := os.ErrClosed
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		err = s.err
+	})
+	return err
+}
@@ -0,0 +1,244 @@
+package geecache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 定时任务：按类 cron 的时间表清空或收缩指定 group，适用于数据源按固定窗口批量重新发布的场景
+
+// A Schedule is a parsed cron expression with minute resolution.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of allowed values
+	domStar, dowStar              bool
+}
+
+var scheduleAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseSchedule parses a standard five-field cron expression
+// "minute hour day-of-month month day-of-week" supporting *, lists (1,5),
+// ranges (1-5) and steps (*/15, 0-30/10), or one of @hourly, @daily,
+// @weekly and @monthly. As in cron, when both day fields are restricted a
+// time matching either of them matches.
+func ParseSchedule(spec string) (*Schedule, error) {
+	if alias, ok := scheduleAliases[strings.TrimSpace(spec)]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	s := &Schedule{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	var err error
+	for i, f := range []struct {
+		dst      *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	} {
+		if *f.dst, err = parseScheduleField(fields[i], f.min, f.max); err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 { // 7 和 0 都表示周日
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rng = part[:i]
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("bad range %q", part)
+				}
+			} else if step > 1 {
+				hi = max // "5/15" 表示从 5 开始每 15 一次
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range [%d, %d]", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches reports whether t, truncated to the minute, is in the schedule.
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// Next returns the first minute strictly after t matching the schedule, or
+// the zero time if there is none within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(5, 0, 0); t.Before(end); t = t.Add(time.Minute) {
+		if s.Matches(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// A Scheduler runs jobs, such as flushing or shrinking groups, on cron
+// schedules in local time.
+type Scheduler struct {
+	mu     sync.Mutex // guards jobs and stop
+	jobs   []scheduledJob
+	stop   chan struct{}
+	logger Logger
+}
+
+type scheduledJob struct {
+	spec     string
+	schedule *Schedule
+	run      func()
+}
+
+// NewScheduler creates a Scheduler reporting to logger, or to the standard
+// logger if logger is nil. Call Start to begin running jobs.
+func NewScheduler(logger Logger) *Scheduler {
+	if logger == nil {
+		logger = defaultLogger
+	}
+	return &Scheduler{logger: logger}
+}
+
+// AddFunc runs fn at every minute matching spec.
+func (s *Scheduler) AddFunc(spec string, fn func()) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.jobs = append(s.jobs, scheduledJob{spec: spec, schedule: schedule, run: fn})
+	s.mu.Unlock()
+	return nil
+}
+
+// FlushGroup drops every cached entry of the named group at each minute
+// matching spec. The group is looked up when the job runs, so it may be
+// created after the job is added.
+func (s *Scheduler) FlushGroup(spec, group string) error {
+	return s.AddFunc(spec, func() {
+		g := GetGroup(group)
+		if g == nil {
+			s.logger.Warn("scheduled flush of unknown group", "group", group)
+			return
+		}
+		g.Clear()
+		s.logger.Info("scheduled flush", "group", group)
+	})
+}
+
+// ShrinkGroup evicts the least recently used entries of the named group
+// until it uses at most fraction of its cache budget, at each minute
+// matching spec.
+func (s *Scheduler) ShrinkGroup(spec, group string, fraction float64) error {
+	if fraction < 0 || fraction > 1 {
+		return fmt.Errorf("shrink fraction %v out of range [0, 1]", fraction)
+	}
+	return s.AddFunc(spec, func() {
+		g := GetGroup(group)
+		if g == nil {
+			s.logger.Warn("scheduled shrink of unknown group", "group", group)
+			return
+		}
+		g.shrink(fraction)
+		s.logger.Info("scheduled shrink", "group", group, "fraction", fraction)
+	})
+}
+
+// Start begins running jobs in a background goroutine. Jobs due in the
+// same minute run sequentially.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	go s.loop(s.stop)
+}
+
+// Stop stops running jobs. A job already running is not interrupted.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *Scheduler) loop(stop chan struct{}) {
+	for {
+		now := time.Now()
+		// 对齐到下一个整分钟
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case t := <-timer.C:
+			s.runDue(t)
+		}
+	}
+}
+
+func (s *Scheduler) runDue(t time.Time) {
+	s.mu.Lock()
+	jobs := append([]scheduledJob(nil), s.jobs...)
+	s.mu.Unlock()
+	for _, job := range jobs {
+		if job.schedule.Matches(t) {
+			job.run()
+		}
+	}
+}
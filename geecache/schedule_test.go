@@ -0,0 +1,62 @@
+package geecache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	base := time.Date(2024, time.May, 10, 13, 7, 30, 0, time.UTC) // a Friday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, time.May, 10, 13, 15, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.May, 11, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1-5", time.Date(2024, time.May, 13, 2, 30, 0, 0, time.UTC)},
+		{"0 3 1 * *", time.Date(2024, time.June, 1, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 0", time.Date(2024, time.May, 12, 0, 0, 0, 0, time.UTC)}, // day-of-month OR Sunday
+		{"0 12 * * 7", time.Date(2024, time.May, 12, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", tt.spec, err)
+		}
+		if got := s.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) should fail", spec)
+		}
+	}
+}
+
+func TestSchedulerFlushAndShrink(t *testing.T) {
+	g := NewGroup("scheduled", GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 90), nil
+	}), WithCacheBytes(1000))
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		g.Get(k)
+	}
+
+	s := NewScheduler(nil)
+	if err := s.ShrinkGroup("0 * * * *", "scheduled", 0.2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FlushGroup("30 * * * *", "scheduled"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.runDue(time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local))
+	if n := g.CacheStats().Items; n != 2 {
+		t.Fatalf("after shrink to 20%% of 1000 bytes: %d entries, want 2", n)
+	}
+	s.runDue(time.Date(2024, 1, 1, 10, 30, 0, 0, time.Local))
+	if _, ok := g.mainCache.get("k4"); ok {
+		t.Fatalf("k4 still cached after flush")
+	}
+}
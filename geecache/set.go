@@ -0,0 +1,273 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+)
+
+// 写入：调用方已经有了值时直接放进负责该 key 的节点的缓存，而不必等下一次未命中时回源
+
+// PeerSetter is implemented by peers that accept values pushed into their
+// cache, and requests to drop them.
+type PeerSetter interface {
+	Set(ctx context.Context, in *pb.SetRequest) error
+	Delete(ctx context.Context, in *pb.Request) error
+}
+
+// ErrReadOnlyPeer reports that the peer owning a key doesn't accept writes.
+var ErrReadOnlyPeer = errors.New("geecache: peer does not accept writes")
+
+// A SetOption customizes a single Group.Set or Group.CompareAndSet call.
+type SetOption func(*setOptions)
+
+type setOptions struct {
+	flags uint32
+}
+
+// WithFlags stores flags with the value, like the flags of memcached, for
+// callers to record e.g. its content type or codec. The cache doesn't
+// interpret them; ByteView.Flags returns them.
+func WithFlags(flags uint32) SetOption {
+	return func(o *setOptions) {
+		o.flags = flags
+	}
+}
+
+// newView returns a copy of value to set with opts.
+func newView(value []byte, opts []SetOption) ByteView {
+	var o setOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return ByteView{b: cloneBytes(value), flags: o.flags}
+}
+
+// Set caches value for key on the node owning it, replacing the cached
+// value if any. With WithStore the value is written to the store first, or
+// queued for writing with WithWriteBehind; the origin behind the Getter is
+// never written. Groups derived from g
+// drop their copy of key on this node.
+//
+// With WithHintedHandoff, when the owner can't be reached the value is
+// cached on this node instead and replayed to the owner once it's back.
+// Groups with WithLeases refuse Set with ErrLeaseInvalid, see SetLeased.
+func (g *Group) Set(ctx context.Context, key string, value []byte, opts ...SetOption) (err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.Set")
+	defer func() { endSpan(span, err) }()
+	span.SetAttribute("geecache.group", g.name)
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	view := newView(value, opts)
+	chunked := g.shouldChunk(view.Len())
+	if size := int64(len(key) + view.Len()); g.maxEntry > 0 && size > g.maxEntry && !chunked {
+		return fmt.Errorf("%w: %d bytes for key %q", ErrValueTooLarge, size, key)
+	}
+	g.Stats.Sets.Add(1)
+	if g.leases != nil {
+		g.Stats.LeasesRejected.Add(1)
+		return fmt.Errorf("%w: %q set without a lease", ErrLeaseInvalid, key)
+	}
+	if err := g.writeStore(ctx, key, view); err != nil {
+		return err
+	}
+	if chunked {
+		// 分块写到各自的归属节点，原 key 下只写入清单
+		if view, err = g.storeChunks(ctx, key, view); err != nil {
+			return err
+		}
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(g.routeKey(key, "")); ok {
+			err := g.setOnPeer(ctx, peer, &pb.SetRequest{Group: g.name, Key: key, Value: view.b, Flags: view.flags})
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, ErrPeerUnavailable) || !g.hints.add(key, view) {
+				return err
+			}
+			g.Stats.HintsStored.Add(1)
+			g.logger.Warn("[GeeCache] owner unreachable, value kept as a hint", "group", g.name, "err", err)
+		}
+	}
+	g.setLocally(key, view)
+	return nil
+}
+
+// writeStore writes value to the group's store, if any, or queues it with
+// WithWriteBehind.
+func (g *Group) writeStore(ctx context.Context, key string, value ByteView) error {
+	if g.store == nil || g.writeBehind != nil && g.writeBehind.add(key, value) {
+		return nil
+	}
+	if g.writeBehind != nil {
+		// 队列已满时同步写入，但不能与该 key 正在进行的写入并发
+		g.writeBehind.begin(key, inflightWrite{value: value})
+		defer g.writeBehind.end(key)
+	}
+	if err := g.saveStore(ctx, key, value); err != nil {
+		return fmt.Errorf("writing to store: %w", err)
+	}
+	return nil
+}
+
+// setOnPeer sends in to the owner of its key. The copy this node may have
+// kept, e.g. from an earlier hint, is dropped: the owner assigned the new
+// value a version this node doesn't know.
+func (g *Group) setOnPeer(ctx context.Context, peer PeerGetter, in *pb.SetRequest) error {
+	setter, ok := peer.(PeerSetter)
+	if !ok {
+		return ErrReadOnlyPeer
+	}
+	if err := setter.Set(ctx, in); err != nil {
+		return err
+	}
+	g.Remove(in.Key)
+	return nil
+}
+
+// setLocally caches value on this node, whoever owns key, as a new version.
+func (g *Group) setLocally(key string, value ByteView) {
+	value.version = g.versions.next()
+	if _, pinned := g.pins.swap(key, value, nil); !pinned {
+		g.mainCache.add(key, g.storedForm(value), g.entryOptions(key))
+	}
+	g.invalidateCopies(key)
+}
+
+// invalidateCopies drops what was derived from the previous value of key,
+// including the lease granted on a miss.
+func (g *Group) invalidateCopies(key string) {
+	g.tombstones.mark(key)
+	if g.leases != nil {
+		g.leases.revoke(key)
+	}
+	if g.tier != nil {
+		g.tier.Delete(key)
+	}
+	for _, d := range g.dependents.list() {
+		d.Remove(key)
+	}
+}
+
+// serveSet answers PUT <group>/<key> from a peer. The value is cached here
+// without checking ownership: the sender picked this node.
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	body := io.Reader(r.Body)
+	if group.maxEntry > 0 {
+		// 请求中除了值还有 group 名、key 等少量字段
+		body = http.MaxBytesReader(w, r.Body, group.maxEntry+1<<10)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", ErrValueTooLarge, err))
+		return
+	}
+	in := &pb.SetRequest{}
+	if err := proto.Unmarshal(data, in); err != nil || in.Group != group.name || in.Key != key {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := group.setFromPeer(in); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setFromPeer caches the value of a set request received from a peer.
+func (g *Group) setFromPeer(in *pb.SetRequest) error {
+	if size := int64(len(in.Key) + len(in.Value)); g.maxEntry > 0 && size > g.maxEntry {
+		return fmt.Errorf("%w: %d bytes for key %q", ErrValueTooLarge, size, in.Key)
+	}
+	g.Stats.Sets.Add(1)
+	value := ByteView{b: in.Value, flags: in.Flags}
+	switch {
+	case in.Compare:
+		if !g.casLocally(in.Key, value, in.ExpectedVersion) {
+			return fmt.Errorf("%w: %q", ErrVersionMismatch, in.Key)
+		}
+	case in.Lease != 0 || g.leases != nil:
+		return g.setLeasedLocally(in.Key, value, in.Lease)
+	default:
+		g.setLocally(in.Key, value)
+	}
+	return nil
+}
+
+// Set sends in to the peer with a PUT request.
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	in.ProtocolVersion = ProtocolVersion
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return h.send(ctx, http.MethodPut, in.GetGroup(), in.GetKey(), body, nil, nil, 0)
+}
+
+// Delete asks the peer to drop the key of in from its cache, or every key
+// starting with it if in.Prefix is set, which fails with
+// ErrProtocolMismatch for peers too old to know it.
+func (h *httpGetter) Delete(ctx context.Context, in *pb.Request) error {
+	var header http.Header
+	var minProtocol int
+	if in.GetPrefix() {
+		header = http.Header{prefixHeader: {"1"}}
+		minProtocol = prefixProtocol
+	}
+	return h.send(ctx, http.MethodDelete, in.GetGroup(), in.GetKey(), nil, header, nil, minProtocol)
+}
+
+// send makes a write request for key with the extra header, which may be
+// nil. It decodes the response into out, or expects no content back if
+// out is nil. A peer answering with a protocol older than minProtocol
+// didn't understand the request: send then fails with ErrProtocolMismatch.
+func (h *httpGetter) send(ctx context.Context, method, group, key string, body []byte, header http.Header, out *pb.Response, minProtocol int) (err error) {
+	if h.tracer != nil {
+		var span Span
+		ctx, span = h.tracer.Start(ctx, "geecache.httpGetter."+method)
+		defer func() { endSpan(span, err) }()
+		span.SetAttribute("geecache.peer", h.baseURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.keyURL(group, key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if h.prop != nil {
+		h.prop.Inject(ctx, req.Header)
+	}
+	res, err := h.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := checkPeerProtocol(h.baseURL, protocolOf(res.Header), minProtocol); err != nil {
+		return err
+	}
+	want := http.StatusNoContent
+	if out != nil {
+		want = http.StatusOK
+	}
+	if res.StatusCode != want {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return errorFromResponse(res, msg)
+	}
+	if out != nil {
+		return h.decodeProto(res, out)
+	}
+	return nil
+}
+
+var _ PeerSetter = (*httpGetter)(nil)
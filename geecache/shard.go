@@ -0,0 +1,486 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 分片缓存：按 key 的哈希把缓存分成多个各自加锁的分片，降低多核下的锁竞争。
+// 每个分片负责一段哈希区间，开启自动调整后，竞争激烈的分片会被一分为二
+
+const (
+	hashSpace = 1 << 32
+
+	// 一个调整周期内至少这么多次加锁才评估分片，避免少量请求造成误判
+	minShardLocks = 1000
+	// 超过该比例的加锁需要等待时，认为分片过热
+	hotShardRatio = 0.05
+)
+
+// shardTuneInterval is how often shards are evaluated for splitting.
+var shardTuneInterval = 10 * time.Second
+
+// shardedCache spreads entries over shards by key hash. The shard layout
+// is immutable and replaced as a whole when a shard is split.
+type shardedCache struct {
+	cacheBytes atomic.Int64 // 可在运行时调整，见 Group.SetCacheBytes
+	maxShards  int          // 自动调整的分片数上限，0 表示不调整
+	opts       cacheOptions
+	table      atomic.Pointer[shardTable]
+	splitMu    sync.RWMutex // serializes splits and guards prev; read-held by walks, see walk
+	prev       map[*cache][2]int64
+}
+
+type shardTable struct {
+	lows   []uint32 // lows[i] is the lowest hash served by shards[i]
+	highs  []uint64 // highs[i] is one past the highest
+	shards []*cache
+}
+
+func newShardedCache(cacheBytes int64, n, maxShards int, opts cacheOptions) *shardedCache {
+	if n < 1 {
+		n = 1
+	}
+	c := &shardedCache{maxShards: maxShards, opts: opts}
+	c.cacheBytes.Store(cacheBytes)
+	t := &shardTable{}
+	for i := 0; i < n; i++ {
+		lo, hi := uint64(i)*hashSpace/uint64(n), uint64(i+1)*hashSpace/uint64(n)
+		t.lows = append(t.lows, uint32(lo))
+		t.highs = append(t.highs, hi)
+		t.shards = append(t.shards, c.newShard(lo, hi))
+	}
+	c.table.Store(t)
+	return c
+}
+
+// newShard returns an empty shard for the hash range [lo, hi).
+func (c *shardedCache) newShard(lo, hi uint64) *cache {
+	return &cache{cacheBytes: c.budget(lo, hi), cacheOptions: c.opts}
+}
+
+// budget returns the share of cacheBytes of the hash range [lo, hi).
+func (c *shardedCache) budget(lo, hi uint64) int64 {
+	total := c.cacheBytes.Load()
+	if total == 0 {
+		return 0
+	}
+	if b := int64(float64(total) * float64(hi-lo) / hashSpace); b > 0 {
+		return b
+	}
+	return 1
+}
+
+// hashKey32 is the 32-bit FNV-1a hash of key, inlined to avoid allocating.
+func hashKey32(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (t *shardTable) shardFor(h uint32) *cache {
+	i := sort.Search(len(t.lows), func(i int) bool { return t.lows[i] > h }) - 1
+	return t.shards[i]
+}
+
+// lockShard locks and returns the shard currently serving key.
+func (c *shardedCache) lockShard(key string) *cache {
+	h := hashKey32(key)
+	for {
+		s := c.table.Load().shardFor(h)
+		s.lock()
+		if !s.retired {
+			return s
+		}
+		s.mu.Unlock() // 拿锁期间分片被拆分了，按新的布局重新查找
+	}
+}
+
+func (c *shardedCache) shards() []*cache {
+	return c.table.Load().shards
+}
+
+func (c *shardedCache) add(key string, value lru.Value, o lru.EntryOptions) {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	s.addWith(key, value, o)
+}
+
+// grow pre-sizes the shards for n more entries spread evenly over them.
+func (c *shardedCache) grow(n int) {
+	shards := c.shards()
+	for _, s := range shards {
+		s.mu.Lock()
+		s.grow(n / len(shards))
+		s.mu.Unlock()
+	}
+}
+
+func (c *shardedCache) get(key string) (ByteView, bool) {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	return s.get(key)
+}
+
+func (c *shardedCache) stale(key string) (ByteView, bool) {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	return s.stale(key)
+}
+
+// compareAndSwap caches value for key if the version of the cached value,
+// 0 if there is none, is expected.
+func (c *shardedCache) compareAndSwap(key string, expected uint64, value lru.Value, o lru.EntryOptions) bool {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	var current uint64
+	if s.lru != nil {
+		if v, ok := s.lru.Peek(key); ok {
+			current = versionOf(v)
+		}
+	}
+	if current != expected {
+		releaseArena(value)
+		return false
+	}
+	s.addWith(key, value, o)
+	return true
+}
+
+// update replaces the value of key with what fn returns for the current
+// one, ok being false if key isn't cached, all under the shard lock so
+// that concurrent read-modify-write operations don't lose updates. An
+// existing entry keeps its lifetime; a new one gets o. kept reports that
+// the new value is still cached, i.e. didn't outgrow the shard.
+func (c *shardedCache) update(key string, o lru.EntryOptions, fn func(current ByteView, ok bool) (lru.Value, error)) (kept bool, err error) {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	var current ByteView
+	ok := false
+	if s.lru != nil {
+		if v, found := s.lru.Peek(key); found {
+			current, ok = viewOf(v)
+		}
+	}
+	value, err := fn(current, ok)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		o, _ = s.lru.Options(key)
+	}
+	s.addWith(key, value, o)
+	// 超过分片容量的值加入后立即被淘汰
+	if s.lru == nil {
+		return false, nil
+	}
+	_, kept = s.lru.Peek(key)
+	return kept, nil
+}
+
+// setExpire changes when key expires, zero meaning never, and returns the
+// version of its value if it is cached.
+func (c *shardedCache) setExpire(key string, expire time.Time) (version uint64, ok bool) {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	if s.lru == nil {
+		return 0, false
+	}
+	v, ok := s.lru.Peek(key)
+	if !ok {
+		return 0, false
+	}
+	o, _ := s.lru.Options(key)
+	o.Expire = expire
+	s.lru.SetOptions(key, o)
+	return versionOf(v), true
+}
+
+// options returns the lifetime settings of key, if cached.
+func (c *shardedCache) options(key string) (lru.EntryOptions, bool) {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	if s.lru == nil {
+		return lru.EntryOptions{}, false
+	}
+	return s.lru.Options(key)
+}
+
+func (c *shardedCache) remove(key string) bool {
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	return s.remove(key)
+}
+
+// walk calls fn for every shard with splits held off: a split running
+// meanwhile would move entries into shards the walk never sees.
+func (c *shardedCache) walk(fn func(s *cache)) {
+	c.splitMu.RLock()
+	defer c.splitMu.RUnlock()
+	for _, s := range c.shards() {
+		fn(s)
+	}
+}
+
+func (c *shardedCache) removePrefix(prefix string) (n int) {
+	c.walk(func(s *cache) {
+		n += s.removePrefix(prefix)
+	})
+	return n
+}
+
+func (c *shardedCache) prefixStats(prefix string) (n int, bytes int64) {
+	for _, s := range c.shards() {
+		sn, sb := s.prefixStats(prefix)
+		n, bytes = n+sn, bytes+sb
+	}
+	return n, bytes
+}
+
+func (c *shardedCache) clear() {
+	c.walk((*cache).clear)
+}
+
+// shrink evicts entries until at most maxBytes are used, spreading the
+// reduction over the shards in proportion to their budgets.
+func (c *shardedCache) shrink(maxBytes int64) {
+	c.splitMu.RLock()
+	defer c.splitMu.RUnlock()
+	t := c.table.Load()
+	for i, s := range t.shards {
+		s.shrink(int64(float64(maxBytes) * float64(t.highs[i]-uint64(t.lows[i])) / hashSpace))
+	}
+}
+
+// iterate calls fn for the entries of every shard, see lru.Cache.Iterate.
+// The entries of a shard are copied under its lock and visited after
+// releasing it, so that fn may write to the network or disk without
+// stalling the shard.
+func (c *shardedCache) iterate(fn func(key string, value lru.Value, o lru.EntryOptions) bool) {
+	type item struct {
+		key   string
+		value lru.Value
+		o     lru.EntryOptions
+	}
+	var items []item
+	for _, s := range c.shards() {
+		items = items[:0]
+		s.mu.Lock()
+		if s.lru != nil {
+			s.lru.Iterate(func(key string, v lru.Value) bool {
+				if av, ok := v.(arenaView); ok {
+					v = av.view() // 解锁后 arena 中的空间可能被回收重用
+				}
+				o, _ := s.lru.Options(key)
+				items = append(items, item{key, v, o})
+				return true
+			})
+		}
+		s.mu.Unlock()
+		for _, it := range items {
+			if !fn(it.key, it.value, it.o) {
+				return
+			}
+		}
+	}
+}
+
+// resize changes the budget to cacheBytes, evicting entries over it.
+func (c *shardedCache) resize(cacheBytes int64) {
+	// 与拆分互斥，保证新分片按新的预算创建
+	c.splitMu.Lock()
+	defer c.splitMu.Unlock()
+	c.cacheBytes.Store(cacheBytes)
+	t := c.table.Load()
+	for i, s := range t.shards {
+		s.resize(c.budget(uint64(t.lows[i]), t.highs[i]))
+	}
+}
+
+func (c *shardedCache) compact() {
+	c.walk((*cache).compact)
+}
+
+func (c *shardedCache) compactIdle(idle time.Duration) (compressed int) {
+	c.walk(func(s *cache) {
+		compressed += s.compactIdle(idle)
+	})
+	return
+}
+
+func (c *shardedCache) stats() CacheStats {
+	var res CacheStats
+	for _, s := range c.shards() {
+		st := s.stats()
+		res.Bytes += st.Bytes
+		res.Items += st.Items
+		res.Gets += st.Gets
+		res.Hits += st.Hits
+		res.Evictions += st.Evictions
+		if !st.OldestAccess.IsZero() && (res.OldestAccess.IsZero() || st.OldestAccess.Before(res.OldestAccess)) {
+			res.OldestAccess = st.OldestAccess
+		}
+	}
+	return res
+}
+
+// ShardStat describes one shard of a group's cache.
+type ShardStat struct {
+	Items     int64
+	Bytes     int64
+	Locks     int64         // lock acquisitions
+	Contended int64         // acquisitions that had to wait
+	Wait      time.Duration // total time spent waiting
+}
+
+// ShardStats describes the sharding of a group's cache.
+type ShardStats struct {
+	Shards []ShardStat
+	// Recommended is the shard count suggested by the contention observed
+	// since the last evaluation: one more per hot shard.
+	Recommended int
+}
+
+// ShardStats returns per-shard statistics of the group's cache.
+func (g *Group) ShardStats() ShardStats {
+	c := g.mainCache
+	res := ShardStats{}
+	for _, s := range c.shards() {
+		s.mu.Lock()
+		st := ShardStat{Locks: s.nlock, Contended: s.ncontended, Wait: s.wait}
+		if s.lru != nil {
+			st.Items, st.Bytes = int64(s.lru.Len()), s.lru.Bytes()
+		}
+		s.mu.Unlock()
+		res.Shards = append(res.Shards, st)
+	}
+	res.Recommended = len(res.Shards) + len(c.hotShards(false))
+	return res
+}
+
+// hotShards returns the shards whose contention since the previous call
+// with advance set exceeds hotShardRatio.
+func (c *shardedCache) hotShards(advance bool) []*cache {
+	c.splitMu.Lock()
+	defer c.splitMu.Unlock()
+	var hot []*cache
+	prev := make(map[*cache][2]int64)
+	for _, s := range c.shards() {
+		s.mu.Lock()
+		locks, contended := s.nlock, s.ncontended
+		s.mu.Unlock()
+		last := c.prev[s]
+		prev[s] = [2]int64{locks, contended}
+		dl, dc := locks-last[0], contended-last[1]
+		if dl >= minShardLocks && float64(dc) > float64(dl)*hotShardRatio {
+			hot = append(hot, s)
+		}
+	}
+	if advance {
+		c.prev = prev
+	}
+	return hot
+}
+
+// tune splits the hot shards, as long as there are fewer than maxShards.
+func (c *shardedCache) tune() (split int) {
+	for _, s := range c.hotShards(true) {
+		if len(c.shards()) >= c.maxShards {
+			break
+		}
+		if c.split(s) {
+			split++
+		}
+	}
+	return
+}
+
+// split replaces s by two shards serving one half of its hash range each,
+// moving its entries over in least recently used order.
+func (c *shardedCache) split(s *cache) bool {
+	c.splitMu.Lock()
+	defer c.splitMu.Unlock()
+	old := c.table.Load()
+	i := -1
+	for j, sh := range old.shards {
+		if sh == s {
+			i = j
+		}
+	}
+	if i < 0 {
+		return false // 已经被拆分过
+	}
+	lo, hi := uint64(old.lows[i]), old.highs[i]
+	if hi-lo < 2 {
+		return false
+	}
+	mid := lo + (hi-lo)/2
+	a, b := c.newShard(lo, mid), c.newShard(mid, hi)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.nhit, a.nget, a.nevict = s.nhit, s.nget, s.nevict // 保持总数单调递增
+	// 搬过去的条目不算新加入
+	a.internal, b.internal = true, true
+	if s.lru != nil {
+		a.grow(s.lru.Len() / 2)
+		b.grow(s.lru.Len() / 2)
+		s.lru.WalkIdle(0, func(key string, v lru.Value) (lru.Value, bool) {
+			o, _ := s.lru.Options(key) // 保留过期时间与优先级
+			if uint64(hashKey32(key)) < mid {
+				a.addWith(key, v, o)
+			} else {
+				b.addWith(key, v, o)
+			}
+			return nil, true
+		})
+	}
+	a.internal, b.internal = false, false
+	t := &shardTable{
+		lows:   append(append(append([]uint32{}, old.lows[:i]...), uint32(lo), uint32(mid)), old.lows[i+1:]...),
+		highs:  append(append(append([]uint64{}, old.highs[:i]...), mid, hi), old.highs[i+1:]...),
+		shards: append(append(append([]*cache{}, old.shards[:i]...), a, b), old.shards[i+1:]...),
+	}
+	// 先发布新布局再释放旧分片的锁，等待旧分片的请求随后会重新路由
+	c.table.Store(t)
+	s.retired = true
+	return true
+}
+
+// WithShards splits the group's cache into n shards locked independently,
+// reducing lock contention under concurrent load. Each shard evicts on its
+// own, so the group as a whole approximates LRU order.
+func WithShards(n int) Option {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithShardTuning lets the group split shards that see heavy lock
+// contention at runtime, up to maxShards shards in total.
+func WithShardTuning(maxShards int) Option {
+	return func(g *Group) {
+		g.maxShards = maxShards
+	}
+}
+
+func (g *Group) tuneShardsLoop() {
+	ticker := time.NewTicker(shardTuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		if n := g.mainCache.tune(); n > 0 {
+			g.logger.Info("split hot cache shards", "group", g.name, "split", n, "shards", len(g.mainCache.shards()))
+		}
+	}
+}
@@ -7,6 +7,8 @@ type call struct {
 	wg  sync.WaitGroup // 避免重入，并发协程之间不需要消息传递，非常适合 sync.WaitGroup
 	val interface{}
 	err error
+
+	dups int // 等待同一次请求结果的其它调用者数
 }
 
 // 管理不同 key 的请求(call)
@@ -17,11 +19,20 @@ type Group struct {
 
 // 针对相同的 key，无论 Do 被调用多少次，函数 fn 都只会被调用一次，等待 fn 调用结束了，返回返回值或错误
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.DoShared(key, fn, nil)
+}
+
+// DoShared is like Do, but if share is not nil it is called with the
+// result of fn and the number of callers receiving it, the one that ran fn
+// included, before any of them returns. It lets callers share a resource
+// each of them releases once.
+func (g *Group) DoShared(key string, fn func() (interface{}, error), share func(v interface{}, callers int)) (interface{}, error) {
 	g.mu.Lock()
 	if g.m == nil { // 延迟初始化
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
+		c.dups++
 		g.mu.Unlock()
 		c.wg.Wait()         // 如果请求正在进行中，则等待
 		return c.val, c.err // 请求结束，返回结果
@@ -32,11 +43,14 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	g.mu.Unlock()
 
 	c.val, c.err = fn() // 调用 fn，发起请求
-	c.wg.Done()         // 请求结束
 
 	g.mu.Lock()
-	delete(g.m, key) // 更新 g.m
+	delete(g.m, key) // 更新 g.m，此后不会再有调用者加入，dups 不再变化
 	g.mu.Unlock()
+	if share != nil {
+		share(c.val, c.dups+1)
+	}
+	c.wg.Done() // 请求结束
 
 	return c.val, c.err // 返回结果
 }
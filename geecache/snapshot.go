@@ -0,0 +1,295 @@
+package geecache
+
+import (
+	"GeeCache/geecache/lru"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照：把缓存内容（key、值与过期时间）写入文件，重启后载入，
+// 避免节点重启后命中率归零、大量请求直接打到数据源
+//
+// 文件格式：魔数，随后是条目序列（见 writeEntry），最后是此前所有字节的 CRC-32 校验和。
+// 条目按最近使用到最久未使用的顺序排列。开启加密时，整个文件加密后写在另一个魔数之后
+
+var (
+	snapshotMagic       = []byte("GEESNAP1")
+	sealedSnapshotMagic = []byte("GEESNAPE")
+)
+
+// ErrBadSnapshot reports a snapshot file that is truncated or corrupt.
+var ErrBadSnapshot = errors.New("geecache: bad snapshot")
+
+// SaveSnapshot writes the entries cached by the group on this node to
+// path. The file is replaced atomically, and encrypted if the group has
+// WithEncryption.
+func (g *Group) SaveSnapshot(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后删除不会生效
+	// 加密时先在内存中生成明文，与 LoadSnapshot 整个读入内存相当
+	var out io.Writer = tmp
+	var plain bytes.Buffer
+	if g.aead != nil {
+		out = &plain
+	}
+	crc := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(out, crc))
+	w.Write(snapshotMagic)
+	g.writeEntries(w, func(string) bool { return true })
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	binary.Write(out, binary.LittleEndian, crc.Sum32())
+	if g.aead != nil {
+		sealed, err := seal(g.aead, append([]byte{}, sealedSnapshotMagic...), plain.Bytes(), sealedSnapshotMagic)
+		if err == nil {
+			_, err = tmp.Write(sealed)
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type snapshotEntry struct {
+	key    string
+	value  []byte
+	expire int64
+	idle   int64
+	flags  uint32
+}
+
+// LoadSnapshot adds the entries of a snapshot written by SaveSnapshot to
+// the group's cache, skipping expired ones. Nothing is added if the file
+// is corrupt, or encrypted with another key than the group's. It returns
+// the number of entries added.
+func (g *Group) LoadSnapshot(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if bytes.HasPrefix(data, sealedSnapshotMagic) {
+		if g.aead == nil {
+			return 0, fmt.Errorf("%s: %w: %v", path, ErrBadSnapshot, errNoKey)
+		}
+		if data, err = open(g.aead, data[len(sealedSnapshotMagic):], sealedSnapshotMagic); err != nil {
+			return 0, fmt.Errorf("%s: %w: %v", path, ErrBadSnapshot, err)
+		}
+	}
+	entries, err := parseSnapshot(data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	now := time.Now().UnixNano()
+	n := 0
+	g.mainCache.grow(len(entries))
+	// 从最久未使用的开始加入，恢复原来的访问顺序
+	for i := len(entries) - 1; i >= 0; i-- {
+		if g.addEntry(entries[i], now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func parseSnapshot(data []byte) ([]snapshotEntry, error) {
+	if len(data) < len(snapshotMagic)+5 || string(data[:len(snapshotMagic)]) != string(snapshotMagic) {
+		return nil, ErrBadSnapshot
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, ErrBadSnapshot
+	}
+	r := bytes.NewReader(body[len(snapshotMagic):])
+	var entries []snapshotEntry
+	for {
+		e, err := readEntry(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if r.Len() != 0 {
+		return nil, ErrBadSnapshot
+	}
+	return entries, nil
+}
+
+// writeEntries writes the cached entries whose key match, followed by the
+// end marker. Each entry is a 1 byte, the uvarint length-prefixed key and
+// value, then the expiry time (UnixNano, 0 for none) and the idle timeout
+// (ns) as varints. Entries with flags start with a 2 byte instead and end
+// with the flags as a uvarint.
+func (g *Group) writeEntries(w io.Writer, match func(key string) bool) {
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriter(w)
+		defer bw.Flush()
+	}
+	g.mainCache.iterate(func(key string, v lru.Value, o lru.EntryOptions) bool {
+		if !match(key) {
+			return true
+		}
+		if value, ok := viewOf(v); ok {
+			writeEntry(bw, key, value, o)
+		}
+		return true
+	})
+	bw.WriteByte(0)
+}
+
+// writeEntry writes one entry in the format of writeEntries.
+func writeEntry(bw *bufio.Writer, key string, value ByteView, o lru.EntryOptions) {
+	var buf [binary.MaxVarintLen64]byte
+	var expire int64
+	if !o.Expire.IsZero() {
+		expire = o.Expire.UnixNano()
+	}
+	// 没有标志位的条目保持原来的格式，旧版本仍能读取
+	if value.flags != 0 {
+		bw.WriteByte(2)
+	} else {
+		bw.WriteByte(1)
+	}
+	bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key)))])
+	bw.WriteString(key)
+	bw.Write(buf[:binary.PutUvarint(buf[:], uint64(value.Len()))])
+	bw.Write(value.b)
+	bw.Write(buf[:binary.PutVarint(buf[:], expire)])
+	bw.Write(buf[:binary.PutVarint(buf[:], int64(o.Idle))])
+	if value.flags != 0 {
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(value.flags))])
+	}
+}
+
+// entryReader is what readEntry reads from.
+type entryReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// maxEntryField bounds the lengths readEntry accepts, so that a corrupt
+// length doesn't make it allocate gigabytes.
+const maxEntryField = 1 << 30
+
+// readEntry reads an entry written by writeEntries, returning io.EOF at
+// the end marker.
+func readEntry(r entryReader) (e snapshotEntry, err error) {
+	return readEntryMax(r, maxEntryField)
+}
+
+// readEntryMax is readEntry refusing keys and values over max bytes.
+func readEntryMax(r entryReader, max uint64) (e snapshotEntry, err error) {
+	marker, err := r.ReadByte()
+	if err != nil || marker > 2 {
+		return e, ErrBadSnapshot
+	}
+	if marker == 0 {
+		return e, io.EOF
+	}
+	field := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > max {
+			return nil, ErrBadSnapshot
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, ErrBadSnapshot
+		}
+		return b, nil
+	}
+	key, err := field()
+	if err != nil {
+		return e, err
+	}
+	if e.value, err = field(); err != nil {
+		return e, err
+	}
+	e.key = string(key)
+	if e.expire, err = binary.ReadVarint(r); err != nil {
+		return e, ErrBadSnapshot
+	}
+	if e.idle, err = binary.ReadVarint(r); err != nil {
+		return e, ErrBadSnapshot
+	}
+	if marker == 2 {
+		flags, err := binary.ReadUvarint(r)
+		if err != nil || flags > math.MaxUint32 {
+			return e, ErrBadSnapshot
+		}
+		e.flags = uint32(flags)
+	}
+	return e, nil
+}
+
+// addEntry caches an entry read from a snapshot or a peer, reporting
+// whether it hadn't expired yet.
+func (g *Group) addEntry(e snapshotEntry, now int64) bool {
+	return g.addEntryTo(g.mainCache, e, now)
+}
+
+// addEntryTo is addEntry caching the entry in c.
+func (g *Group) addEntryTo(c *shardedCache, e snapshotEntry, now int64) bool {
+	if e.expire != 0 && e.expire <= now {
+		return false
+	}
+	o := lru.EntryOptions{Idle: time.Duration(e.idle)}
+	if e.expire != 0 {
+		o.Expire = time.Unix(0, e.expire)
+	}
+	o.Priority = g.policyFor(e.key).Priority
+	c.add(e.key, g.storedForm(ByteView{b: e.value, version: g.versions.next(), flags: e.flags}), o)
+	return true
+}
+
+// WithSnapshots makes the group load the snapshot at path when it is
+// created, if there is one, and save a new one every interval.
+func WithSnapshots(path string, interval time.Duration) Option {
+	return func(g *Group) {
+		g.snapshotPath, g.snapshotEvery = path, interval
+	}
+}
+
+func (g *Group) snapshotLoop() {
+	if n, err := g.LoadSnapshot(g.snapshotPath); err == nil {
+		g.logger.Info("snapshot loaded", "group", g.name, "entries", n)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		g.logger.Warn("loading snapshot failed", "group", g.name, "err", err)
+	}
+	if g.snapshotEvery <= 0 {
+		return
+	}
+	ticker := time.NewTicker(g.snapshotEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := g.SaveSnapshot(g.snapshotPath); err != nil {
+			g.logger.Warn("saving snapshot failed", "group", g.name, "err", err)
+		}
+	}
+}
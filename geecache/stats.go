@@ -0,0 +1,109 @@
+package geecache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are per-group statistics.
+type Stats struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // the cache had the value
+	TierHits       AtomicInt // cache hits served from the disk tier
+	PeerLoads      AtomicInt // either remote load or remote cache hit (not an error)
+	PeerErrors     AtomicInt
+	Loads          AtomicInt // (gets - cacheHits)
+	LoadsDeduped   AtomicInt // after singleflight
+	LocalLoads     AtomicInt // total good local loads
+	LocalLoadErrs  AtomicInt // total bad local loads
+	LoadsRejected  AtomicInt // loads rejected by admission control or a load limit
+	StaleHits      AtomicInt // expired values served while loads were limited
+	ServerRequests AtomicInt // gets that came over the network from peers
+	Sets           AtomicInt // Set calls, and sets received from peers
+	HintsStored    AtomicInt // sets kept here while their owner was unreachable
+	HintsReplayed  AtomicInt // hints delivered to the owner later
+	StoreWriteErrs AtomicInt // write-behind writes dropped after retries
+	RefreshAheads  AtomicInt // reloads started before the entry expired
+	Hedges         AtomicInt // peer fetches repeated on the next peer, see WithHedging
+	HedgeWins      AtomicInt // hedged fetches answered before the owner
+	LeasesRejected AtomicInt // values refused for lacking a valid lease, see WithLeases
+	SlowLoads      AtomicInt // loads from the Getter slower than WithSlowLoadLog allows
+	EvictionsLost  AtomicInt // evicted entries not handed to WithEvictionHandler, its queue being full
+	ChunksReloaded AtomicInt // chunked values loaded again for missing a chunk, see WithChunking
+	Corrupted      AtomicInt // values from peers failing their checksum, see ErrCorrupted
+
+	PeerNotModified AtomicInt // peer fetches answered 304 Not Modified for the expired hot copy
+	CacheBypasses   AtomicInt // gets told to skip or refresh the cache, see SkipCache and ForceRefresh
+	PeerLoadWaits   AtomicInt // peer fetches asked again while the owner was loading, see WithDistributedDedup
+}
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// MarshalJSON encodes the current value of i.
+func (i *AtomicInt) MarshalJSON() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// CacheStats are returned by stats accessors on Group.
+type CacheStats struct {
+	Bytes     int64
+	Items     int64
+	Gets      int64
+	Hits      int64
+	Evictions int64
+	// OldestAccess is when the least recently used entry, the next to be
+	// evicted, was last read; its age tells how long entries stay cached.
+	OldestAccess time.Time
+}
+
+// CacheStats returns stats about the group's cache, or its main cache
+// with WithHotCache.
+func (g *Group) CacheStats() CacheStats {
+	return g.mainCache.stats()
+}
+
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// groupStats is the JSON form of a group's statistics.
+type groupStats struct {
+	Stats       *Stats      `json:"stats"`
+	Cache       CacheStats  `json:"cache"`
+	HotCache    *CacheStats `json:"hot_cache,omitempty"`
+	RejectRate  float64     `json:"reject_rate,omitempty"`
+	LoadLatency LoadLatency `json:"load_latency"`
+}
+
+// allGroupStats snapshots the statistics of every registered group.
+func allGroupStats() map[string]groupStats {
+	mu.RLock()
+	defer mu.RUnlock()
+	res := make(map[string]groupStats, len(groups))
+	for name, g := range groups {
+		s := groupStats{Stats: &g.Stats, Cache: g.CacheStats(), RejectRate: g.RejectRate(), LoadLatency: g.LoadLatency()}
+		if g.hotCache != nil {
+			hot := g.HotCacheStats()
+			s.HotCache = &hot
+		}
+		res[name] = s
+	}
+	return res
+}
@@ -0,0 +1,124 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 持久化存储：group 可以配置一个 Store 作为数据源（read-through）并把 Set 同步写入其中（write-through），
+// 不必为每种数据源各写一个 Getter。常见实现见 geecache/store 包
+
+// A Store is durable storage behind a group. Get returns an error wrapping
+// ErrNotFound for missing keys.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// A FlagStore is a Store keeping the flags of values too, see WithFlags.
+// Groups read and write a FlagStore with GetFlags and SetFlags, so that
+// values loaded from it keep their flags; those of other stores are lost
+// once the cached value is evicted.
+type FlagStore interface {
+	Store
+	GetFlags(ctx context.Context, key string) (value []byte, flags uint32, err error)
+	SetFlags(ctx context.Context, key string, value []byte, flags uint32) error
+}
+
+// WithStore backs the group with s. Loads read s first and only call the
+// Getter for keys s doesn't have, writing what it returns back to s; Set
+// writes to s before caching the value, and Delete removes keys from it.
+func WithStore(s Store) Option {
+	return func(g *Group) {
+		g.store = s
+	}
+}
+
+// loadFromStore reads key from the group's store, falling back to the
+// Getter and saving its value on a miss.
+func (g *Group) loadFromStore(ctx context.Context, key string) (ByteView, error) {
+	var deleted bool
+	if g.writeBehind != nil {
+		// 尚未写完的值比 store 中的新；正在删除的 key 视为不存在
+		var v ByteView
+		var ok bool
+		if v, deleted, ok = g.writeBehind.get(key); ok && !deleted {
+			return v, nil
+		}
+	}
+	if !deleted {
+		v, err := g.readStore(ctx, key)
+		if err == nil || !errors.Is(err, ErrNotFound) {
+			return v, err
+		}
+	}
+	b, err := g.getter.Get(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	if err := g.store.Set(ctx, key, b); err != nil {
+		// 值已经取到，写回失败只影响下一次加载
+		g.logger.Warn("[GeeCache] saving loaded value to store failed", "group", g.name, "err", err)
+	}
+	return ByteView{b: b}, nil
+}
+
+// readStore reads key from the group's store, with its flags if it is a
+// FlagStore.
+func (g *Group) readStore(ctx context.Context, key string) (ByteView, error) {
+	if fs, ok := g.store.(FlagStore); ok {
+		b, flags, err := fs.GetFlags(ctx, key)
+		return ByteView{b: b, flags: flags}, err
+	}
+	b, err := g.store.Get(ctx, key)
+	return ByteView{b: b}, err
+}
+
+// saveStore writes value to the group's store, with its flags if it is a
+// FlagStore.
+func (g *Group) saveStore(ctx context.Context, key string, value ByteView) error {
+	if fs, ok := g.store.(FlagStore); ok {
+		return fs.SetFlags(ctx, key, value.b, value.flags)
+	}
+	return g.store.Set(ctx, key, value.b)
+}
+
+// Delete removes key from the group's store, if any, and from the caches
+// of this node and of the peer owning key.
+func (g *Group) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.Delete")
+	defer func() { endSpan(span, err) }()
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.writeBehind != nil {
+		// 丢弃排队的写入，并等正在进行的写入完成，否则它可能在删除之后落盘
+		g.writeBehind.cancel(key)
+		g.writeBehind.begin(key, inflightWrite{deleted: true})
+	}
+	if g.store != nil {
+		err := g.store.Delete(ctx, key)
+		if g.writeBehind != nil {
+			g.writeBehind.end(key)
+		}
+		if err != nil {
+			return fmt.Errorf("deleting from store: %w", err)
+		}
+	}
+	g.Remove(key)
+	if g.peers == nil {
+		return nil
+	}
+	peer, ok := g.peers.PickPeer(g.routeKey(key, ""))
+	if !ok {
+		return nil
+	}
+	setter, ok := peer.(PeerSetter)
+	if !ok {
+		return ErrReadOnlyPeer
+	}
+	return setter.Delete(ctx, &pb.Request{Group: g.name, Key: key})
+}
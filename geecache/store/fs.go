@@ -0,0 +1,78 @@
+// Package store provides geecache.Store implementations for common
+// kinds of durable storage.
+package store
+
+import (
+	"GeeCache/geecache"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir stores each value in a file below a directory. File names are
+// derived from a hash of the key, so keys may contain any character.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a Dir storing values below root, creating it if needed.
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &Dir{root: root}, nil
+}
+
+// path returns the file of key. 按哈希前两位分子目录，避免单个目录下文件过多
+func (d *Dir) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.root, name[:2], name)
+}
+
+// Get reads the value of key.
+func (d *Dir) Get(_ context.Context, key string) ([]byte, error) {
+	b, err := os.ReadFile(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", geecache.ErrNotFound, key)
+	}
+	return b, err
+}
+
+// Set writes value to a temporary file and renames it into place, so that
+// readers never see a partial value.
+func (d *Dir) Set(_ context.Context, key string, value []byte) error {
+	name := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (d *Dir) Delete(_ context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+var _ geecache.Store = (*Dir)(nil)
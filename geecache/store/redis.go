@@ -0,0 +1,172 @@
+package store
+
+import (
+	"GeeCache/geecache"
+	"GeeCache/geecache/internal/resp"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// 只用到 GET/SET/DEL 几个命令，用 internal/resp 中 RESP 协议的最小子集，不引入第三方客户端
+
+// RedisOptions configures a Redis store.
+type RedisOptions struct {
+	Password string
+	DB       int
+	Prefix   string        // prepended to every key
+	TTL      time.Duration // expiry of values written, 0 for none
+	// MaxIdle is the number of idle connections kept for reuse, default 4.
+	MaxIdle int
+	// DialTimeout bounds connecting, AUTH and SELECT included, defaults
+	// to 5s.
+	DialTimeout time.Duration
+}
+
+// Redis stores values in a Redis server.
+type Redis struct {
+	addr string
+	opts RedisOptions
+	idle chan *redisConn
+}
+
+// NewRedis returns a store talking to the Redis server at addr
+// (host:port). Connections are made on first use.
+func NewRedis(addr string, o *RedisOptions) *Redis {
+	r := &Redis{addr: addr}
+	if o != nil {
+		r.opts = *o
+	}
+	if r.opts.MaxIdle <= 0 {
+		r.opts.MaxIdle = 4
+	}
+	if r.opts.DialTimeout <= 0 {
+		r.opts.DialTimeout = 5 * time.Second
+	}
+	r.idle = make(chan *redisConn, r.opts.MaxIdle)
+	return r
+}
+
+// Get reads the value of key.
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := r.do(ctx, "GET", r.opts.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%w: %s", geecache.ErrNotFound, key)
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v", v)
+	}
+	return b, nil
+}
+
+// Set writes value, with the configured TTL if any.
+func (r *Redis) Set(ctx context.Context, key string, value []byte) error {
+	args := []interface{}{"SET", r.opts.Prefix + key, value}
+	if r.opts.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(r.opts.TTL.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Delete removes key.
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", r.opts.Prefix+key)
+	return err
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do runs one command on a pooled connection.
+func (r *Redis) do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	} else {
+		c.SetDeadline(time.Time{})
+	}
+	v, err := c.do(args...)
+	var rerr resp.Error
+	if err != nil && !errors.As(err, &rerr) {
+		// 连接状态未知，不能再放回池中
+		c.Close()
+		return nil, err
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.Close()
+	}
+	return v, err
+}
+
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: r.opts.DialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	// 服务器接受连接后不应答时，AUTH 和 SELECT 不能无限等待
+	deadline := time.Now().Add(r.opts.DialTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+	if r.opts.Password != "" {
+		if _, err := c.do("AUTH", r.opts.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.opts.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(r.opts.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// do sends a command and reads the reply: nil, a string, []byte or
+// int64, or a resp.Error.
+func (c *redisConn) do(args ...interface{}) (interface{}, error) {
+	if err := resp.WriteCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+	return resp.ReadReply(c.r, 0)
+}
+
+var _ geecache.Store = (*Redis)(nil)
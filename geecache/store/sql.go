@@ -0,0 +1,138 @@
+package store
+
+import (
+	"GeeCache/geecache"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SQL stores values in a table with a primary key column and a binary
+// value column, e.g.
+//
+//	CREATE TABLE cache (cache_key VARCHAR(255) PRIMARY KEY, cache_value BLOB)
+//
+// It only uses portable statements, so it works with any database/sql
+// driver; the caller imports the driver and opens db. With
+// SQLOptions.FlagsColumn, an integer column, it keeps the flags of values
+// too.
+type SQL struct {
+	db                       *sql.DB
+	get, update, insert, del string
+	flags                    bool
+}
+
+// SQLOptions names the table layout. Empty fields take the defaults shown
+// above.
+type SQLOptions struct {
+	Table       string // defaults to "cache"
+	KeyColumn   string // defaults to "cache_key"
+	ValueColumn string // defaults to "cache_value"
+	FlagsColumn string // keeps the flags of values if set, see geecache.FlagStore
+	// Placeholder returns the bind parameter for the n-th argument,
+	// counting from 1. Defaults to "?"; use DollarPlaceholder for PostgreSQL.
+	Placeholder func(n int) string
+}
+
+// DollarPlaceholder numbers bind parameters $1, $2, ... as PostgreSQL expects.
+func DollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// NewSQL returns a store using db. Table and column names are used as
+// they are and must come from the configuration, never from users.
+func NewSQL(db *sql.DB, o *SQLOptions) *SQL {
+	var opts SQLOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Table == "" {
+		opts.Table = "cache"
+	}
+	if opts.KeyColumn == "" {
+		opts.KeyColumn = "cache_key"
+	}
+	if opts.ValueColumn == "" {
+		opts.ValueColumn = "cache_value"
+	}
+	ph := opts.Placeholder
+	if ph == nil {
+		ph = func(int) string { return "?" }
+	}
+	t, k, v, f := opts.Table, opts.KeyColumn, opts.ValueColumn, opts.FlagsColumn
+	if f == "" {
+		return &SQL{
+			db:     db,
+			get:    fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", v, t, k, ph(1)),
+			update: fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = %s", t, v, ph(1), k, ph(2)),
+			insert: fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (%s, %s)", t, k, v, ph(1), ph(2)),
+			del:    fmt.Sprintf("DELETE FROM %s WHERE %s = %s", t, k, ph(1)),
+		}
+	}
+	return &SQL{
+		db:     db,
+		get:    fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s = %s", v, f, t, k, ph(1)),
+		update: fmt.Sprintf("UPDATE %s SET %s = %s, %s = %s WHERE %s = %s", t, v, ph(1), f, ph(2), k, ph(3)),
+		insert: fmt.Sprintf("INSERT INTO %s (%s, %s, %s) VALUES (%s, %s, %s)", t, k, v, f, ph(1), ph(2), ph(3)),
+		del:    fmt.Sprintf("DELETE FROM %s WHERE %s = %s", t, k, ph(1)),
+		flags:  true,
+	}
+}
+
+// Get reads the value of key.
+func (s *SQL) Get(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := s.GetFlags(ctx, key)
+	return value, err
+}
+
+// GetFlags reads the value of key and its flags, 0 without a flags column.
+func (s *SQL) GetFlags(ctx context.Context, key string) ([]byte, uint32, error) {
+	var value []byte
+	var flags sql.NullInt64
+	var err error
+	if s.flags {
+		err = s.db.QueryRowContext(ctx, s.get, key).Scan(&value, &flags)
+	} else {
+		err = s.db.QueryRowContext(ctx, s.get, key).Scan(&value)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, fmt.Errorf("%w: %s", geecache.ErrNotFound, key)
+	}
+	return value, uint32(flags.Int64), err
+}
+
+// Set updates the row of key, inserting it if there is none, with no flags.
+func (s *SQL) Set(ctx context.Context, key string, value []byte) error {
+	return s.SetFlags(ctx, key, value, 0)
+}
+
+// SetFlags is Set storing flags too, if there is a flags column. 各数据库的
+// upsert 语法不同，这里先 UPDATE 再 INSERT；并发插入同一个 key 失败时再 UPDATE 一次
+func (s *SQL) SetFlags(ctx context.Context, key string, value []byte, flags uint32) error {
+	updateArgs, insertArgs := []any{value, key}, []any{key, value}
+	if s.flags {
+		updateArgs, insertArgs = []any{value, int64(flags), key}, []any{key, value, int64(flags)}
+	}
+	res, err := s.db.ExecContext(ctx, s.update, updateArgs...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+	if _, err := s.db.ExecContext(ctx, s.insert, insertArgs...); err != nil {
+		if _, err2 := s.db.ExecContext(ctx, s.update, updateArgs...); err2 != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the row of key.
+func (s *SQL) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.del, key)
+	return err
+}
+
+var _ geecache.FlagStore = (*SQL)(nil)
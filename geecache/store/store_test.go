@@ -0,0 +1,301 @@
+package store
+
+import (
+	"GeeCache/geecache"
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStore exercises the behavior every Store must have.
+func testStore(t *testing.T, s geecache.Store) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, geecache.ErrNotFound) {
+		t.Fatalf("get of a missing key: %v", err)
+	}
+	for _, v := range []string{"v1", "v2"} {
+		if err := s.Set(ctx, "a/b c", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Get(ctx, "a/b c"); err != nil || string(got) != v {
+			t.Fatalf("get = %q, %v, want %q", got, err, v)
+		}
+	}
+	if err := s.Delete(ctx, "a/b c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "a/b c"); !errors.Is(err, geecache.ErrNotFound) {
+		t.Fatalf("get after delete: %v", err)
+	}
+	if err := s.Delete(ctx, "a/b c"); err != nil {
+		t.Fatalf("deleting a missing key: %v", err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	d, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, d)
+}
+
+// fakeRedis serves GET, SET and DEL from a map.
+func fakeRedis(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var mu sync.Mutex
+	data := make(map[string]string)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						if v, ok := data[args[1]]; ok {
+							fmt.Fprintf(c, "$%d\r\n%s\r\n", len(v), v)
+						} else {
+							io.WriteString(c, "$-1\r\n")
+						}
+					case "SET":
+						data[args[1]] = args[2]
+						io.WriteString(c, "+OK\r\n")
+					case "DEL":
+						_, ok := data[args[1]]
+						delete(data, args[1])
+						fmt.Fprintf(c, ":%d\r\n", map[bool]int{true: 1}[ok])
+					default:
+						io.WriteString(c, "-ERR unknown command\r\n")
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func TestRedis(t *testing.T) {
+	r := NewRedis(fakeRedis(t), &RedisOptions{Prefix: "gee:"})
+	defer r.Close()
+	testStore(t, r)
+
+	// 接受连接却不应答 AUTH 的服务器
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	silent := NewRedis(l.Addr().String(), &RedisOptions{Password: "secret", DialTimeout: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := silent.Get(context.Background(), "k"); err == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("AUTH on a silent server: %v after %v", err, time.Since(start))
+	}
+}
+
+// fakeSQL is a database/sql driver keeping one table in a map. It only
+// understands the statements NewSQL builds, which it records.
+type fakeSQL struct {
+	mu      sync.Mutex
+	rows    map[string]fakeSQLRow
+	queries []string
+}
+
+type fakeSQLRow struct {
+	value []byte
+	flags int64
+}
+
+func (d *fakeSQL) Open(string) (driver.Conn, error) { return fakeSQLConn{d}, nil }
+
+type fakeSQLConn struct{ d *fakeSQL }
+
+func (c fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	c.d.queries = append(c.d.queries, query)
+	c.d.mu.Unlock()
+	return fakeSQLStmt{c.d, query}, nil
+}
+
+func (fakeSQLConn) Close() error              { return nil }
+func (fakeSQLConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type fakeSQLStmt struct {
+	d     *fakeSQL
+	query string
+}
+
+func (fakeSQLStmt) Close() error  { return nil }
+func (fakeSQLStmt) NumInput() int { return -1 }
+
+func (s fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	switch verb, _, _ := strings.Cut(s.query, " "); verb {
+	case "UPDATE":
+		key := args[len(args)-1].(string)
+		if _, ok := s.d.rows[key]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		row := fakeSQLRow{value: args[0].([]byte)}
+		if len(args) == 3 {
+			row.flags = args[1].(int64)
+		}
+		s.d.rows[key] = row
+	case "INSERT":
+		key := args[0].(string)
+		if _, ok := s.d.rows[key]; ok {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		row := fakeSQLRow{value: args[1].([]byte)}
+		if len(args) == 3 {
+			row.flags = args[2].(int64)
+		}
+		s.d.rows[key] = row
+	case "DELETE":
+		key := args[0].(string)
+		if _, ok := s.d.rows[key]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		delete(s.d.rows, key)
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	row, ok := s.d.rows[args[0].(string)]
+	columns := []string{"value"}
+	if strings.Contains(s.query, ", ") {
+		columns = append(columns, "flags")
+	}
+	return &fakeSQLRows{row: row, columns: columns, left: ok}, nil
+}
+
+type fakeSQLRows struct {
+	row     fakeSQLRow
+	columns []string
+	left    bool
+}
+
+func (r *fakeSQLRows) Columns() []string { return r.columns }
+func (*fakeSQLRows) Close() error        { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if !r.left {
+		return io.EOF
+	}
+	r.left = false
+	dest[0] = r.row.value
+	if len(dest) > 1 {
+		dest[1] = r.row.flags
+	}
+	return nil
+}
+
+func TestSQL(t *testing.T) {
+	d := &fakeSQL{rows: make(map[string]fakeSQLRow)}
+	sql.Register("geecache-fake", d)
+	db, err := sql.Open("geecache-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	testStore(t, NewSQL(db, &SQLOptions{Table: "kv", KeyColumn: "k", ValueColumn: "v", Placeholder: DollarPlaceholder}))
+
+	want := map[string]bool{
+		"SELECT v FROM kv WHERE k = $1":         true,
+		"UPDATE kv SET v = $1 WHERE k = $2":     true,
+		"INSERT INTO kv (k, v) VALUES ($1, $2)": true,
+		"DELETE FROM kv WHERE k = $1":           true,
+	}
+	for _, q := range d.queries {
+		if _, ok := want[q]; !ok {
+			t.Fatalf("unexpected statement %q", q)
+		}
+		want[q] = false
+	}
+	for q, missing := range want {
+		if missing {
+			t.Fatalf("%q never run", q)
+		}
+	}
+
+	s := NewSQL(db, &SQLOptions{Table: "kv", KeyColumn: "k", ValueColumn: "v", FlagsColumn: "f"})
+	testStore(t, s)
+	ctx := context.Background()
+	if err := s.SetFlags(ctx, "flagged", []byte("v"), 42); err != nil {
+		t.Fatal(err)
+	}
+	if v, flags, err := s.GetFlags(ctx, "flagged"); err != nil || string(v) != "v" || flags != 42 {
+		t.Fatalf("GetFlags = %q, %d, %v", v, flags, err)
+	}
+	if err := s.Set(ctx, "flagged", []byte("w")); err != nil {
+		t.Fatal(err)
+	}
+	if _, flags, _ := s.GetFlags(ctx, "flagged"); flags != 0 {
+		t.Fatalf("Set kept flags %d", flags)
+	}
+	if q := d.queries[len(d.queries)-1]; q != "SELECT v, f FROM kv WHERE k = ?" {
+		t.Fatalf("statement %q", q)
+	}
+}
@@ -0,0 +1,625 @@
+package geecache
+
+import (
+	"GeeCache/geecache/consistenthash"
+	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/internal/tcpserver"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 二进制 TCP 传输：节点之间用长度前缀的帧代替 HTTP，省去请求行与头部的编解码，
+// 连接长期复用。只承载集群内部的 Get/Set/Delete，管理接口、迁移等仍需 HTTPPool
+//
+// 请求与响应的帧格式相同：
+//
+//	magic   2 字节 "GC"
+//	version 1 字节 tcpVersion
+//	op      1 字节 请求的操作码，响应中为状态
+//	length  4 字节 大端序，body 的长度
+//	body    请求为 pb.Request 或 pb.SetRequest（含 group、key、value），
+//	        成功的 Get 响应为 pb.Response，失败的响应为 错误码 \0 错误信息
+
+const (
+	tcpMagic     = "GC"
+	tcpVersion   = 1
+	tcpHeaderLen = 8
+)
+
+// 请求的操作码
+const (
+	opAuth   byte = 1 //连接建立后的第一帧，body 为 AuthToken
+	opGet    byte = 2
+	opSet    byte = 3
+	opDelete byte = 4
+)
+
+// 响应的状态
+const (
+	tcpOK    byte = 0
+	tcpError byte = 1
+)
+
+// frameChunk is how much of a frame body readFrame allocates ahead of
+// the bytes received.
+const frameChunk = 64 << 10
+
+// DefaultMaxFrameSize bounds the frames read by a TCPPool when
+// TCPPoolOptions.MaxFrameSize is 0.
+const DefaultMaxFrameSize = 64 << 20
+
+// ErrServerClosed is returned by TCPPool.Serve after Close.
+var ErrServerClosed = errors.New("geecache: server closed")
+
+// TCPPoolOptions configures a TCPPool.
+type TCPPoolOptions struct {
+	// AuthToken is a secret shared by all nodes. Connections must present
+	// it before any request when set.
+	AuthToken string
+	// Hash places keys and peers on the ring, consistenthash.CRC32 if nil.
+	// Every node must use the same.
+	Hash consistenthash.Hash
+	// DialTimeout bounds connecting to a peer, 2s if 0.
+	DialTimeout time.Duration
+	// MaxIdleConns is the number of connections kept open to each peer
+	// between requests, 4 if 0.
+	MaxIdleConns int
+	// MaxFrameSize bounds the frames read from connections,
+	// DefaultMaxFrameSize if 0.
+	MaxFrameSize int
+	// MinProtocolVersion is the oldest ProtocolVersion of the peers this
+	// node talks to, 1 if 0, as for HTTPPoolOptions.
+	MinProtocolVersion int
+	// Divergent, if set, reports the groups configured differently on
+	// some peer, which are then not served, e.g. HTTPPool.Divergent of
+	// the node's HTTPPool after CheckManifests.
+	Divergent func(group string) bool
+	// Logger receives connection errors. Defaults to the standard logger.
+	Logger Logger
+}
+
+// TCPPool is a PeerPicker whose peers talk a length-prefixed binary
+// protocol over TCP instead of HTTP: a lower-overhead alternative for
+// traffic within the cluster. Peers are named by host:port, and every node
+// must serve the protocol with Serve or ListenAndServe.
+type TCPPool struct {
+	self string
+	opts TCPPoolOptions
+
+	mu      sync.Mutex
+	peers   consistenthash.Ring
+	getters map[string]*tcpGetter
+
+	conns tcpserver.Conns
+}
+
+// NewTCPPool returns a pool for the node serving the protocol at self,
+// host:port. o may be nil.
+func NewTCPPool(self string, o *TCPPoolOptions) *TCPPool {
+	p := &TCPPool{self: self, peers: consistenthash.New(defaultReplicas, nil)}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.DialTimeout <= 0 {
+		p.opts.DialTimeout = 2 * time.Second
+	}
+	if p.opts.MaxIdleConns <= 0 {
+		p.opts.MaxIdleConns = 4
+	}
+	if p.opts.MaxFrameSize <= 0 {
+		p.opts.MaxFrameSize = DefaultMaxFrameSize
+	}
+	if p.opts.Logger == nil {
+		p.opts.Logger = defaultLogger
+	}
+	return p
+}
+
+// Set updates the pool's list of peers, closing the idle connections to
+// the peers it no longer has.
+func (p *TCPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(defaultReplicas, p.opts.Hash)
+	p.peers.Add(peers...)
+	getters := make(map[string]*tcpGetter, len(peers))
+	for _, peer := range peers {
+		if getters[peer] = p.getters[peer]; getters[peer] == nil {
+			getters[peer] = &tcpGetter{addr: peer, opts: &p.opts}
+		}
+	}
+	for peer, g := range p.getters {
+		if getters[peer] == nil {
+			g.close()
+		}
+	}
+	p.getters = getters
+}
+
+// PickPeer implements PeerPicker.
+func (p *TCPPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		return p.getters[peer], true
+	}
+	return nil, false
+}
+
+// PickPeers implements ReplicaPicker.
+func (p *TCPPool) PickPeers(key string, n int) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var res []PeerGetter
+	for _, peer := range p.peers.GetN(key, n+1) {
+		if peer != p.self && len(res) < n {
+			res = append(res, p.getters[peer])
+		}
+	}
+	return res
+}
+
+// AllPeers implements PeerLister.
+func (p *TCPPool) AllPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]PeerGetter, 0, len(p.getters))
+	for peer, g := range p.getters {
+		if peer != p.self {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+var (
+	_ ReplicaPicker = (*TCPPool)(nil)
+	_ PeerLister    = (*TCPPool)(nil)
+)
+
+// ListenAndServe listens on the TCP address addr and serves it.
+func (p *TCPPool) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve accepts connections from peers on l until Close, serving each of
+// them in its own goroutine.
+func (p *TCPPool) Serve(l net.Listener) error {
+	return p.conns.Serve(l, p.serveConn, ErrServerClosed)
+}
+
+// Close stops the listeners, closes the connections being served and the
+// idle connections to peers.
+func (p *TCPPool) Close() error {
+	p.conns.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, g := range p.getters {
+		g.close()
+	}
+	return nil
+}
+
+// serveConn answers the requests of a connection one after the other.
+func (p *TCPPool) serveConn(c net.Conn) {
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	authed := p.opts.AuthToken == ""
+	for {
+		limit := p.opts.MaxFrameSize
+		if !authed {
+			// 认证之前只接受装得下 AuthToken 的帧
+			limit = len(p.opts.AuthToken)
+		}
+		op, body, err := readFrame(r, limit)
+		if err != nil {
+			if err != io.EOF && !p.conns.Closed() {
+				p.opts.Logger.Warn("tcp peer connection", "server", p.self, "peer", c.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+		var res []byte
+		switch {
+		case op == opAuth:
+			authed = subtle.ConstantTimeCompare(body, []byte(p.opts.AuthToken)) == 1
+			if !authed {
+				err = ErrUnauthorized
+			}
+		case !authed:
+			err = ErrUnauthorized
+		case op == opGet:
+			res, err = p.serveGet(body)
+		case op == opSet:
+			err = p.serveSet(body)
+		case op == opDelete:
+			res, err = p.serveDelete(body)
+		default:
+			err = fmt.Errorf("unknown opcode %d", op)
+		}
+		status := tcpOK
+		if err != nil {
+			_, code := errorStatus(err)
+			status, res = tcpError, []byte(code+"\x00"+err.Error())
+		}
+		if err := writeFrame(w, status, res); err != nil {
+			return
+		}
+		// 客户端流水线发来的请求还在缓冲区时，合并到一次写
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if !authed {
+			// 认证失败的连接不再读取后续请求
+			w.Flush()
+			return
+		}
+	}
+}
+
+// minProtocol returns the oldest protocol version this node talks to.
+func (o *TCPPoolOptions) minProtocol() int {
+	return min(max(o.MinProtocolVersion, 1), ProtocolVersion)
+}
+
+// checkProtocol refuses requests of peers speaking version v, older than
+// TCPPoolOptions.MinProtocolVersion.
+func (p *TCPPool) checkProtocol(v uint32) error {
+	return checkPeerProtocol("", fieldProtocol(v), p.opts.minProtocol())
+}
+
+// group returns the group name to serve to peers.
+func (p *TCPPool) group(name string) (*Group, error) {
+	group := GetGroup(name)
+	if group == nil {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	if p.opts.Divergent != nil && p.opts.Divergent(name) {
+		return nil, fmt.Errorf("%w: %s", ErrConfigMismatch, name)
+	}
+	return group, nil
+}
+
+// serveGet answers a Get from a peer like HTTPPool does.
+func (p *TCPPool) serveGet(body []byte) ([]byte, error) {
+	in := &pb.Request{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		return nil, fmt.Errorf("bad request: %v", err)
+	}
+	if err := p.checkProtocol(in.ProtocolVersion); err != nil {
+		return nil, err
+	}
+	group, err := p.group(in.Group)
+	if err != nil {
+		return nil, err
+	}
+	group.Stats.ServerRequests.Add(1)
+	if in.Lease {
+		view, lease, err := group.leaseLocally(in.Key)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(&pb.Response{Value: view.ByteSlice(), Version: view.Version(), Lease: lease,
+			ProtocolVersion: ProtocolVersion, Checksum: view.checksum()})
+	}
+	var view ByteView
+	if in.Peek {
+		view, err = group.peek(in.Key)
+	} else {
+		opts := []GetOption{WithAffinity(in.Affinity)}
+		if !in.Whole {
+			opts = append(opts, readManifest)
+		}
+		if in.Local {
+			opts = append(opts, loadLocally)
+		}
+		if opt := requestBypass(in); opt != nil {
+			opts = append(opts, opt)
+		}
+		view, err = group.getForPeer(context.Background(), in.Key, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer view.Release()
+	res := &pb.Response{Version: view.Version(), ProtocolVersion: ProtocolVersion, ExpiresMs: expiresMs(view),
+		Flags: view.flags, Checksum: view.checksum()}
+	if in.IfNoneMatch != "" && in.IfNoneMatch == contentTag(view) {
+		res.NotModified = true
+	} else {
+		res.Value = view.ByteSlice()
+	}
+	return proto.Marshal(res)
+}
+
+// serveSet caches the value of a Set from a peer.
+func (p *TCPPool) serveSet(body []byte) error {
+	in := &pb.SetRequest{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		return fmt.Errorf("bad request: %v", err)
+	}
+	if err := p.checkProtocol(in.ProtocolVersion); err != nil {
+		return err
+	}
+	group, err := p.group(in.Group)
+	if err != nil {
+		return err
+	}
+	return group.setFromPeer(in)
+}
+
+// serveDelete drops the key of a Delete from a peer. The answer is a
+// pb.Response carrying only the protocol version, which tells the peer
+// its prefix was honored: older nodes answer with an empty body.
+func (p *TCPPool) serveDelete(body []byte) ([]byte, error) {
+	in := &pb.Request{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		return nil, fmt.Errorf("bad request: %v", err)
+	}
+	if err := p.checkProtocol(in.ProtocolVersion); err != nil {
+		return nil, err
+	}
+	group, err := p.group(in.Group)
+	if err != nil {
+		return nil, err
+	}
+	if in.Prefix {
+		if in.Key == "" {
+			// 空前缀会清空整个 group，TCP 上没有管理员身份可以要求它
+			return nil, fmt.Errorf("%w: empty prefix", ErrForbidden)
+		}
+		group.RemovePrefix(in.Key)
+	} else {
+		group.Remove(in.Key)
+	}
+	return proto.Marshal(&pb.Response{ProtocolVersion: ProtocolVersion})
+}
+
+// writeFrame writes a frame with the given opcode or status.
+func writeFrame(w io.Writer, op byte, body []byte) error {
+	var h [tcpHeaderLen]byte
+	copy(h[:], tcpMagic)
+	h[2], h[3] = tcpVersion, op
+	binary.BigEndian.PutUint32(h[4:], uint32(len(body)))
+	if _, err := w.Write(h[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// readFrame reads a frame of at most max bytes of body. It returns
+// io.EOF only if the connection was closed between frames.
+func readFrame(r io.Reader, max int) (op byte, body []byte, err error) {
+	var h [tcpHeaderLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, fmt.Errorf("truncated frame header")
+		}
+		return 0, nil, err
+	}
+	if string(h[:2]) != tcpMagic {
+		return 0, nil, fmt.Errorf("bad frame magic %q", h[:2])
+	}
+	if h[2] != tcpVersion {
+		return 0, nil, fmt.Errorf("%w: frame version %d", ErrProtocolMismatch, h[2])
+	}
+	n := binary.BigEndian.Uint32(h[4:])
+	if int64(n) > int64(max) {
+		return 0, nil, fmt.Errorf("%w: frame of %d bytes", ErrValueTooLarge, n)
+	}
+	// 缓冲区随收到的数据增长，只发来帧头的连接不能让这里预先分配 n 字节
+	var buf bytes.Buffer
+	buf.Grow(int(min(n, frameChunk)))
+	if _, err := io.Copy(&buf, io.LimitReader(r, int64(n))); err != nil {
+		return 0, nil, fmt.Errorf("truncated frame: %v", err)
+	}
+	if buf.Len() != int(n) {
+		return 0, nil, fmt.Errorf("truncated frame: %v", io.ErrUnexpectedEOF)
+	}
+	return h[3], buf.Bytes(), nil
+}
+
+// tcpErrorFromBody turns the body of an error response back into an error
+// wrapping the matching sentinel.
+func tcpErrorFromBody(body []byte) error {
+	code, msg, _ := strings.Cut(string(body), "\x00")
+	for _, c := range errorCodes {
+		if c.code == code {
+			return &remoteError{msg: msg, err: c.err}
+		}
+	}
+	return errors.New(msg)
+}
+
+// tcpGetter is the client of a peer of a TCPPool. Every connection carries
+// one request at a time.
+type tcpGetter struct {
+	addr string
+	opts *TCPPoolOptions
+
+	mu   sync.Mutex
+	idle []*tcpConn
+}
+
+type tcpConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// Get implements PeerGetter.
+func (t *tcpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	in.ProtocolVersion = ProtocolVersion
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := t.roundTrip(ctx, opGet, body)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(res, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	v := fieldProtocol(out.ProtocolVersion)
+	if err := checkPeerProtocol(t.addr, v, t.opts.minProtocol()); err != nil {
+		return err
+	}
+	if out.NotModified {
+		if in.IfNoneMatch == "" {
+			return fmt.Errorf("%w: unexpected not modified response", ErrPeerUnavailable)
+		}
+		return nil
+	}
+	if err := checkWhole(t.addr, v, in, out); err != nil {
+		return err
+	}
+	if v < checksumProtocol {
+		return nil
+	}
+	return verifyChecksum(out.Value, out.Checksum)
+}
+
+// Set implements PeerSetter.
+func (t *tcpGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	in.ProtocolVersion = ProtocolVersion
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	_, err = t.roundTrip(ctx, opSet, body)
+	return err
+}
+
+// Delete implements PeerSetter.
+func (t *tcpGetter) Delete(ctx context.Context, in *pb.Request) error {
+	in.ProtocolVersion = ProtocolVersion
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := t.roundTrip(ctx, opDelete, body)
+	if err != nil || !in.Prefix {
+		return err
+	}
+	out := &pb.Response{}
+	if err := proto.Unmarshal(res, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	return checkPeerProtocol(t.addr, fieldProtocol(out.ProtocolVersion), prefixProtocol)
+}
+
+var _ PeerSetter = (*tcpGetter)(nil)
+
+// roundTrip sends a request on an idle or new connection and returns the
+// body of the response.
+func (t *tcpGetter) roundTrip(ctx context.Context, op byte, body []byte) ([]byte, error) {
+	c, err := t.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 取消 ctx 时让阻塞的读写立即返回
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Unix(1, 0)) })
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+	status, res, err := t.exchange(c, op, body)
+	if !stop() || err != nil {
+		// 连接上可能还留着半个帧，不能再复用
+		c.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnavailable, err)
+	}
+	t.release(c)
+	if status != tcpOK {
+		return nil, tcpErrorFromBody(res)
+	}
+	return res, nil
+}
+
+// exchange writes a request frame and reads the response.
+func (t *tcpGetter) exchange(c *tcpConn, op byte, body []byte) (byte, []byte, error) {
+	if err := writeFrame(c.w, op, body); err != nil {
+		return 0, nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return 0, nil, err
+	}
+	return readFrame(c.r, t.opts.MaxFrameSize)
+}
+
+// conn returns an idle connection, or dials one and authenticates it.
+func (t *tcpGetter) conn(ctx context.Context) (*tcpConn, error) {
+	t.mu.Lock()
+	if n := len(t.idle); n > 0 {
+		c := t.idle[n-1]
+		t.idle = t.idle[:n-1]
+		t.mu.Unlock()
+		return c, nil
+	}
+	t.mu.Unlock()
+
+	d := net.Dialer{Timeout: t.opts.DialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPeerUnavailable, err)
+	}
+	c := &tcpConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if t.opts.AuthToken == "" {
+		return c, nil
+	}
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+	status, res, err := t.exchange(c, opAuth, []byte(t.opts.AuthToken))
+	switch {
+	case err != nil:
+		err = fmt.Errorf("%w: %v", ErrPeerUnavailable, err)
+	case status != tcpOK:
+		err = tcpErrorFromBody(res)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// release keeps c for the next request, or closes it if enough are idle.
+func (t *tcpGetter) release(c *tcpConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.idle) >= t.opts.MaxIdleConns {
+		c.Close()
+		return
+	}
+	c.SetDeadline(time.Time{})
+	t.idle = append(t.idle, c)
+}
+
+// close closes the idle connections.
+func (t *tcpGetter) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.idle {
+		c.Close()
+	}
+	t.idle = nil
+}
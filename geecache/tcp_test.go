@@ -0,0 +1,199 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTCPPool(t *testing.T) {
+	g := NewGroup("tcp", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTCPPool(l.Addr().String(), &TCPPoolOptions{AuthToken: "secret"})
+	go server.Serve(l)
+	defer server.Close()
+
+	client := NewTCPPool("127.0.0.1:1", &TCPPoolOptions{AuthToken: "secret"})
+	defer client.Close()
+	client.Set(l.Addr().String())
+	peer, ok := client.PickPeer("k")
+	if !ok {
+		t.Fatal("no peer picked")
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		out := &pb.Response{}
+		if err := peer.Get(ctx, &pb.Request{Group: "tcp", Key: "k"}, out); err != nil || string(out.Value) != "value of k" {
+			t.Fatalf("get = %q, %v", out.Value, err)
+		}
+	}
+	if n := len(peer.(*tcpGetter).idle); n != 1 {
+		t.Fatalf("%d idle connections, want the one reused", n)
+	}
+
+	setter := peer.(PeerSetter)
+	if err := setter.Set(ctx, &pb.SetRequest{Group: "tcp", Key: "set", Value: []byte("pushed")}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.get("set"); !ok || v.String() != "pushed" {
+		t.Fatalf("set over tcp cached %q, %v", v.String(), ok)
+	}
+	if err := setter.Delete(ctx, &pb.Request{Group: "tcp", Key: "set"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("set"); ok {
+		t.Fatal("delete over tcp left the key cached")
+	}
+	g.setLocally("prefix:1", ByteView{b: []byte("v")})
+	if err := setter.Delete(ctx, &pb.Request{Group: "tcp", Key: "prefix:", Prefix: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("prefix:1"); ok {
+		t.Fatal("prefix delete over tcp left the key cached")
+	}
+
+	out := &pb.Response{}
+	if err := peer.Get(ctx, &pb.Request{Group: "tcp-missing", Key: "k"}, out); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("get from a missing group: %v", err)
+	}
+	tag := contentTag(ByteView{b: []byte("value of k")})
+	if err := peer.Get(ctx, &pb.Request{Group: "tcp", Key: "k", IfNoneMatch: tag}, out); err != nil || !out.NotModified || out.Value != nil {
+		t.Fatalf("conditional get = %v, not modified %v", err, out.NotModified)
+	}
+
+	intruder := NewTCPPool("127.0.0.1:1", &TCPPoolOptions{AuthToken: "wrong"})
+	defer intruder.Close()
+	intruder.Set(l.Addr().String())
+	peer, _ = intruder.PickPeer("k")
+	if err := peer.Get(ctx, &pb.Request{Group: "tcp", Key: "k"}, &pb.Response{}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("get with a wrong token: %v", err)
+	}
+}
+
+func TestTCPProtocol(t *testing.T) {
+	NewGroup("tcp-protocol", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTCPPool(l.Addr().String(), &TCPPoolOptions{MinProtocolVersion: ProtocolVersion})
+	go server.Serve(l)
+	defer server.Close()
+
+	// 版本化之前的节点不带 protocol_version
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	body, _ := proto.Marshal(&pb.Request{Group: "tcp-protocol", Key: "k"})
+	if err := writeFrame(c, opGet, body); err != nil {
+		t.Fatal(err)
+	}
+	status, res, err := readFrame(c, DefaultMaxFrameSize)
+	if err != nil || status != tcpError || !errors.Is(tcpErrorFromBody(res), ErrProtocolMismatch) {
+		t.Fatalf("request of an old peer = %d %q, %v", status, res, err)
+	}
+
+	// 旧版本的节点的响应同样被拒绝
+	old, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	go func() {
+		c, err := old.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if _, _, err := readFrame(c, DefaultMaxFrameSize); err != nil {
+			return
+		}
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("v")})
+		writeFrame(c, tcpOK, body)
+		// 旧版本的节点对删除应答空的 body，前缀删除也只删了一个 key
+		for {
+			if _, _, err := readFrame(c, DefaultMaxFrameSize); err != nil {
+				return
+			}
+			writeFrame(c, tcpOK, nil)
+		}
+	}()
+	client := NewTCPPool("127.0.0.1:1", &TCPPoolOptions{MinProtocolVersion: ProtocolVersion})
+	defer client.Close()
+	client.Set(old.Addr().String())
+	peer, _ := client.PickPeer("k")
+	if err := peer.Get(context.Background(), &pb.Request{Group: "tcp-protocol", Key: "k"}, &pb.Response{}); !errors.Is(err, ErrProtocolMismatch) {
+		t.Fatalf("answer of an old peer: %v", err)
+	}
+	setter := peer.(PeerSetter)
+	if err := setter.Delete(context.Background(), &pb.Request{Group: "tcp-protocol", Key: "k"}); err != nil {
+		t.Fatalf("delete on an old peer: %v", err)
+	}
+	if err := setter.Delete(context.Background(), &pb.Request{Group: "tcp-protocol", Key: "k", Prefix: true}); !errors.Is(err, ErrProtocolMismatch) {
+		t.Fatalf("prefix delete on an old peer: %v", err)
+	}
+}
+
+func TestTCPFrameLimits(t *testing.T) {
+	NewGroup("tcp-divergent", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTCPPool(l.Addr().String(), &TCPPoolOptions{AuthToken: "secret",
+		Divergent: func(group string) bool { return group == "tcp-divergent" }})
+	go server.Serve(l)
+	defer server.Close()
+
+	// 认证之前，比 AuthToken 长的帧直接断开连接
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := writeFrame(c, opGet, make([]byte, 1<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readFrame(c, DefaultMaxFrameSize); err == nil {
+		t.Fatal("large frame before auth answered")
+	}
+
+	client := NewTCPPool("127.0.0.1:1", &TCPPoolOptions{AuthToken: "secret"})
+	defer client.Close()
+	client.Set(l.Addr().String())
+	peer, _ := client.PickPeer("k")
+	if err := peer.Get(context.Background(), &pb.Request{Group: "tcp-divergent", Key: "k"}, &pb.Response{}); !errors.Is(err, ErrConfigMismatch) {
+		t.Fatalf("get from a divergent group: %v", err)
+	}
+	if err := peer.(PeerSetter).Set(context.Background(), &pb.SetRequest{Group: "tcp-divergent", Key: "k"}); !errors.Is(err, ErrConfigMismatch) {
+		t.Fatalf("set in a divergent group: %v", err)
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	writeFrame(&buf, opGet, []byte("body"))
+	full := buf.Bytes()
+	if _, body, err := readFrame(bytes.NewReader(full), 16); err != nil || string(body) != "body" {
+		t.Fatalf("readFrame = %q, %v", body, err)
+	}
+	if _, _, err := readFrame(bytes.NewReader(full[:len(full)-1]), 16); err == nil {
+		t.Fatal("truncated frame read")
+	}
+}
@@ -0,0 +1,79 @@
+package geecache
+
+import (
+	"GeeCache/geecache/ratelimit"
+	"context"
+	"io"
+)
+
+// 后台流量限速：重平衡、预热同步、复制和备份的数据搬运与前台 Get 请求分开计量，
+// 避免在共享网卡上挤占在线请求的带宽
+
+// TrafficClass identifies a kind of background data movement between peers.
+type TrafficClass int
+
+const (
+	TrafficRebalance TrafficClass = iota
+	TrafficWarmSync
+	TrafficReplication
+	TrafficBackup
+)
+
+func (c TrafficClass) String() string {
+	switch c {
+	case TrafficRebalance:
+		return "rebalance"
+	case TrafficWarmSync:
+		return "warm-sync"
+	case TrafficReplication:
+		return "replication"
+	case TrafficBackup:
+		return "backup"
+	}
+	return "unknown"
+}
+
+// newBandwidthBucket returns a bucket for bytesPerSec, or nil (unlimited)
+// when bytesPerSec is not positive. The burst allows a quarter second of traffic.
+func newBandwidthBucket(bytesPerSec int64) *ratelimit.Bucket {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	burst := bytesPerSec / 4
+	if burst < 4<<10 {
+		burst = 4 << 10
+	}
+	return ratelimit.NewBucket(float64(bytesPerSec), int(burst))
+}
+
+// backgroundBuckets returns the buckets limiting class: its own cap, if
+// any, and the budget shared by all background traffic.
+func (p *HTTPPool) backgroundBuckets(class TrafficClass) []*ratelimit.Bucket {
+	var buckets []*ratelimit.Bucket
+	if b := p.classBuckets[class]; b != nil {
+		buckets = append(buckets, b)
+	}
+	if p.backgroundBucket != nil {
+		buckets = append(buckets, p.backgroundBucket)
+	}
+	return buckets
+}
+
+// ThrottleReader limits reads from r to the bandwidth configured for class.
+// Foreground Get traffic is never throttled.
+func (p *HTTPPool) ThrottleReader(ctx context.Context, class TrafficClass, r io.Reader) io.Reader {
+	buckets := p.backgroundBuckets(class)
+	if len(buckets) == 0 {
+		return r
+	}
+	return ratelimit.NewReader(ctx, r, buckets...)
+}
+
+// ThrottleWriter limits writes to w to the bandwidth configured for class.
+func (p *HTTPPool) ThrottleWriter(ctx context.Context, class TrafficClass, w io.Writer) io.Writer {
+	buckets := p.backgroundBuckets(class)
+	if len(buckets) == 0 {
+		return w
+	}
+	return ratelimit.NewWriter(ctx, w, buckets...)
+}
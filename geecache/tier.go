@@ -0,0 +1,453 @@
+package geecache
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 磁盘二级缓存：内存中因容量被淘汰的条目写入本地磁盘上的追加式段文件，
+// 磁盘命中时再提升回内存，使单个节点能容纳远大于内存的工作集。
+// 磁盘层只是缓存，不保证持久：打开时会清空目录中已有的段文件
+
+const (
+	defaultSegmentBytes = 64 << 20
+	segmentPattern      = "segment-*.log"
+	recordHeaderLen     = 4 + 8 + 4 + 4 // crc, expire, key length, value length
+)
+
+// A DiskTier stores the entries evicted from a group's memory cache in
+// append-only segment files. When it outgrows its limit, the oldest
+// segment is dropped with the entries in it. The keys and values are
+// encrypted if the group has WithEncryption.
+//
+// Evicted entries are queued and written by a background goroutine, so
+// that evictions never wait for the disk; while the queue holds more than
+// a segment's worth of bytes, further evictions are dropped.
+type DiskTier struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu       sync.Mutex
+	segments []*segment // oldest first, the last one is written to
+	index    map[string]recordLoc
+	nextID   int
+	aead     cipher.AEAD // 可为 nil，见 WithEncryption
+
+	// 淘汰时只入队，由 writeLoop 在分片锁之外写盘。qmu 从不在磁盘读写期间持有
+	qmu          sync.Mutex
+	pending      map[string]spilled // 每个 key 最新的待写条目
+	queue        []string           // 待写 key 的入队顺序，可能重复
+	pendingBytes int64
+	seq          uint64
+	wake         chan struct{}
+	stop         chan struct{}
+	done         chan struct{}
+	closeOnce    sync.Once
+	logError     func(error) // 后台写盘失败时调用，可为 nil
+}
+
+// spilled is an evicted entry waiting to be written.
+type spilled struct {
+	value  []byte
+	expire time.Time
+	seq    uint64
+}
+
+type segment struct {
+	id   int
+	f    *os.File
+	size int64
+}
+
+type recordLoc struct {
+	seg    *segment
+	off    int64
+	length int64
+}
+
+// NewDiskTier opens a disk tier in dir using at most maxBytes of disk,
+// removing the segments a previous process left there.
+func NewDiskTier(dir string, maxBytes int64) (*DiskTier, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	old, err := filepath.Glob(filepath.Join(dir, segmentPattern))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range old {
+		if err := os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	t := &DiskTier{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: defaultSegmentBytes,
+		index:        make(map[string]recordLoc),
+		pending:      make(map[string]spilled),
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if maxBytes > 0 && maxBytes/4 < t.segmentBytes {
+		t.segmentBytes = maxBytes / 4 // 至少分成 4 段，淘汰时不会一次丢掉太多
+	}
+	go t.writeLoop()
+	return t, nil
+}
+
+// WithDiskTier makes the group spill the entries evicted from its memory
+// cache for lack of space to t, and promote them back on access. The tier
+// must not be shared with other groups.
+func WithDiskTier(t *DiskTier) Option {
+	return func(g *Group) {
+		g.tier = t
+		t.logError = func(err error) {
+			g.logger.Warn("spilling to disk failed", "group", g.name, "err", err)
+		}
+		g.cacheOpts.spill = func(key string, value ByteView, expire time.Time) {
+			t.enqueue(key, value.b, expire)
+		}
+	}
+}
+
+// enqueue queues key and value for writeLoop. It is called with the lock
+// of a cache shard held and must not wait for the disk.
+func (t *DiskTier) enqueue(key string, value []byte, expire time.Time) {
+	t.qmu.Lock()
+	select {
+	case <-t.stop:
+		t.qmu.Unlock()
+		return
+	default:
+	}
+	old, queued := t.pending[key]
+	if queued {
+		t.pendingBytes -= int64(len(key) + len(old.value))
+	}
+	if t.pendingBytes+int64(len(key)+len(value)) > t.segmentBytes {
+		// 写盘跟不上时丢弃新淘汰的条目；磁盘层只是缓存
+		if queued {
+			delete(t.pending, key)
+		}
+		t.qmu.Unlock()
+		return
+	}
+	t.seq++
+	t.pending[key] = spilled{value: value, expire: expire, seq: t.seq}
+	t.pendingBytes += int64(len(key) + len(value))
+	t.queue = append(t.queue, key)
+	t.qmu.Unlock()
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop writes queued entries until Close.
+func (t *DiskTier) writeLoop() {
+	defer close(t.done)
+	for {
+		select {
+		case <-t.wake:
+			for t.writeNext() {
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// writeNext writes the oldest queued entry, reporting whether there was
+// one. The entry stays queued while it is written, so that Take finds it.
+func (t *DiskTier) writeNext() bool {
+	t.qmu.Lock()
+	if len(t.queue) == 0 {
+		t.qmu.Unlock()
+		return false
+	}
+	key := t.queue[0]
+	t.queue = t.queue[1:]
+	s, ok := t.pending[key]
+	t.qmu.Unlock()
+	if !ok {
+		return true // 已被 Take、Delete 取走或已写入
+	}
+	loc, err := t.put(key, s.value, s.expire)
+	if err != nil && t.logError != nil {
+		t.logError(err)
+	}
+	t.qmu.Lock()
+	current := t.pending[key].seq == s.seq
+	if current {
+		delete(t.pending, key)
+		t.pendingBytes -= int64(len(key) + len(s.value))
+	}
+	t.qmu.Unlock()
+	if !current && loc.seg != nil {
+		// 写入期间条目被取走、删除或替换，刚写入的记录已经过期
+		t.mu.Lock()
+		if t.index[key] == loc {
+			delete(t.index, key)
+		}
+		t.mu.Unlock()
+	}
+	return true
+}
+
+// flush waits until the entries queued so far are written.
+func (t *DiskTier) flush() {
+	for {
+		t.qmu.Lock()
+		n := len(t.pending)
+		t.qmu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Put appends key and value to the current segment.
+func (t *DiskTier) Put(key string, value []byte, expire time.Time) error {
+	_, err := t.put(key, value, expire)
+	return err
+}
+
+// put is Put returning where the record was written, if it was.
+func (t *DiskTier) put(key string, value []byte, expire time.Time) (recordLoc, error) {
+	overhead := 0
+	if t.aead != nil {
+		overhead = t.aead.NonceSize() + t.aead.Overhead()
+	}
+	length := int64(recordHeaderLen + len(key) + len(value) + overhead)
+	if t.maxBytes > 0 && length > t.segmentBytes {
+		return recordLoc{}, nil // 单条记录比一段还大，不值得写入
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seg, err := t.writable(length)
+	if err != nil {
+		return recordLoc{}, err
+	}
+	rec := make([]byte, recordHeaderLen, length)
+	var exp int64
+	if !expire.IsZero() {
+		exp = expire.UnixNano()
+	}
+	binary.LittleEndian.PutUint64(rec[4:], uint64(exp))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(rec[16:], uint32(len(value)))
+	if t.aead != nil {
+		// key 与值一起加密，头部作为附加数据参与认证，过期时间无法被篡改
+		if rec, err = seal(t.aead, rec, append([]byte(key), value...), rec[4:recordHeaderLen]); err != nil {
+			return recordLoc{}, err
+		}
+	} else {
+		rec = append(append(rec, key...), value...)
+	}
+	binary.LittleEndian.PutUint32(rec, crc32.ChecksumIEEE(rec[4:]))
+	if _, err := seg.f.WriteAt(rec, seg.size); err != nil {
+		return recordLoc{}, err
+	}
+	loc := recordLoc{seg: seg, off: seg.size, length: length}
+	t.index[key] = loc
+	seg.size += length
+	return loc, nil
+}
+
+// writable returns the segment to append length bytes to, rolling over to
+// a new one and dropping the oldest ones as needed. t.mu must be held.
+func (t *DiskTier) writable(length int64) (*segment, error) {
+	if n := len(t.segments); n > 0 && t.segments[n-1].size+length <= t.segmentBytes {
+		return t.segments[n-1], nil
+	}
+	for t.maxBytes > 0 && len(t.segments) > 0 && t.size()+t.segmentBytes > t.maxBytes {
+		t.dropOldest()
+	}
+	f, err := os.Create(filepath.Join(t.dir, fmt.Sprintf("segment-%06d.log", t.nextID)))
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{id: t.nextID, f: f}
+	t.nextID++
+	t.segments = append(t.segments, seg)
+	return seg, nil
+}
+
+// size returns the bytes of all segments. t.mu must be held.
+func (t *DiskTier) size() (n int64) {
+	for _, s := range t.segments {
+		n += s.size
+	}
+	return
+}
+
+// dropOldest deletes the oldest segment. t.mu must be held.
+func (t *DiskTier) dropOldest() {
+	seg := t.segments[0]
+	t.segments = t.segments[1:]
+	for key, loc := range t.index {
+		if loc.seg == seg {
+			delete(t.index, key)
+		}
+	}
+	seg.f.Close()
+	os.Remove(seg.f.Name())
+}
+
+// errCorruptRecord reports a record failing its checksum.
+var errCorruptRecord = errors.New("geecache: corrupt disk tier record")
+
+// Take returns the value of key and removes it from the tier, as it is
+// being promoted to memory. Expired entries are not returned.
+func (t *DiskTier) Take(key string) (value []byte, expire time.Time, ok bool, err error) {
+	if s, ok := t.unqueue(key); ok {
+		if !s.expire.IsZero() && !time.Now().Before(s.expire) {
+			return nil, time.Time{}, false, nil
+		}
+		return s.value, s.expire, true, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	loc, ok := t.index[key]
+	if !ok {
+		return nil, time.Time{}, false, nil
+	}
+	delete(t.index, key)
+	rec := make([]byte, loc.length)
+	if _, err := loc.seg.f.ReadAt(rec, loc.off); err != nil {
+		return nil, time.Time{}, false, err
+	}
+	if crc32.ChecksumIEEE(rec[4:]) != binary.LittleEndian.Uint32(rec) {
+		return nil, time.Time{}, false, errCorruptRecord
+	}
+	if exp := int64(binary.LittleEndian.Uint64(rec[4:])); exp != 0 {
+		if expire = time.Unix(0, exp); !time.Now().Before(expire) {
+			return nil, time.Time{}, false, nil
+		}
+	}
+	keyLen := int(binary.LittleEndian.Uint32(rec[12:]))
+	body := rec[recordHeaderLen:]
+	if t.aead != nil {
+		if body, err = open(t.aead, body, rec[4:recordHeaderLen]); err != nil || len(body) < keyLen || string(body[:keyLen]) != key {
+			return nil, time.Time{}, false, errCorruptRecord
+		}
+	}
+	return body[keyLen:], expire, true, nil
+}
+
+// unqueue removes key from the write queue, returning its entry if it
+// was queued.
+func (t *DiskTier) unqueue(key string) (spilled, bool) {
+	t.qmu.Lock()
+	defer t.qmu.Unlock()
+	s, ok := t.pending[key]
+	if ok {
+		delete(t.pending, key)
+		t.pendingBytes -= int64(len(key) + len(s.value))
+	}
+	return s, ok
+}
+
+// Delete removes key from the tier. The space is reclaimed when its
+// segment is dropped.
+func (t *DiskTier) Delete(key string) {
+	t.unqueue(key)
+	t.mu.Lock()
+	delete(t.index, key)
+	t.mu.Unlock()
+}
+
+// DeletePrefix removes the keys starting with prefix from the tier.
+func (t *DiskTier) DeletePrefix(prefix string) {
+	t.qmu.Lock()
+	for k, s := range t.pending {
+		if strings.HasPrefix(k, prefix) {
+			delete(t.pending, k)
+			t.pendingBytes -= int64(len(k) + len(s.value))
+		}
+	}
+	t.qmu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k := range t.index {
+		if strings.HasPrefix(k, prefix) {
+			delete(t.index, k)
+		}
+	}
+}
+
+// Clear removes every entry and segment.
+func (t *DiskTier) Clear() {
+	t.qmu.Lock()
+	t.pending, t.queue, t.pendingBytes = make(map[string]spilled), nil, 0
+	t.qmu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.segments) > 0 {
+		t.dropOldest()
+	}
+	t.index = make(map[string]recordLoc)
+}
+
+// Len returns the number of entries in the tier, including the ones
+// waiting to be written.
+func (t *DiskTier) Len() int {
+	t.qmu.Lock()
+	queued := make([]string, 0, len(t.pending))
+	for k := range t.pending {
+		queued = append(queued, k)
+	}
+	t.qmu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.index)
+	for _, k := range queued {
+		if _, ok := t.index[k]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Close stops writing evicted entries, and closes and removes the segment
+// files.
+func (t *DiskTier) Close() error {
+	t.closeOnce.Do(func() {
+		t.qmu.Lock()
+		close(t.stop)
+		t.qmu.Unlock()
+		<-t.done
+	})
+	t.Clear()
+	return nil
+}
+
+// fromTier promotes key from the disk tier to the memory cache.
+func (g *Group) fromTier(key string) (ByteView, bool) {
+	b, expire, ok, err := g.tier.Take(key)
+	if err != nil {
+		g.logger.Warn("reading from disk failed", "group", g.name, "err", err)
+	}
+	if !ok {
+		return ByteView{}, false
+	}
+	value := ByteView{b: b, version: g.versions.next()}
+	o := g.entryOptions(key)
+	if !expire.IsZero() {
+		o.Expire = expire
+	}
+	g.mainCache.add(key, g.storedForm(value), o)
+	return value, true
+}
@@ -0,0 +1,141 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestPKI writes a CA and a leaf certificate for 127.0.0.1 signed by
+// it into dir, returning the cert, key and CA file names.
+func writeTestPKI(t *testing.T, dir string, serial int64) (certFile, keyFile, caFile string) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "geecache test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "peer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile = filepath.Join(dir, "peer.crt")
+	keyFile = filepath.Join(dir, "peer.key")
+	caFile = filepath.Join(dir, "ca.crt")
+	write := func(name, typ string, b []byte) {
+		if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(certFile, "CERTIFICATE", der)
+	write(keyFile, "EC PRIVATE KEY", keyDER)
+	write(caFile, "CERTIFICATE", caDER)
+	return
+}
+
+func servedSerial(t *testing.T, r *CertReloader) int64 {
+	t.Helper()
+	cfg, err := r.ServerConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := writeTestPKI(t, dir, 100)
+	r, err := NewCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := servedSerial(t, r); got != 100 {
+		t.Fatalf("serial = %d, want 100", got)
+	}
+
+	writeTestPKI(t, dir, 200)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := servedSerial(t, r); got != 200 {
+		t.Fatalf("serial after reload = %d, want 200", got)
+	}
+
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected reload of a broken key to fail")
+	}
+	if got := servedSerial(t, r); got != 200 {
+		t.Fatalf("serial after failed reload = %d, want 200", got)
+	}
+}
+
+func TestHTTPPoolMutualTLS(t *testing.T) {
+	certFile, keyFile, caFile := writeTestPKI(t, t.TempDir(), 1)
+	creds, err := NewCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetGroup("mtls") == nil {
+		NewGroup("mtls", GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithCacheBytes(2<<10))
+	}
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{TLS: creds})
+	srv := httptest.NewUnstartedServer(pool)
+	srv.TLS = creds.ServerConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: pool.client}
+	res := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "mtls", Key: "k"}, res); err != nil {
+		t.Fatalf("get over mutual TLS: %v", err)
+	}
+	if string(res.Value) != "k" {
+		t.Fatalf("got %q, want %q", res.Value, "k")
+	}
+
+	if err := (&httpGetter{baseURL: srv.URL + defaultBasePath}).Get(context.Background(), &pb.Request{Group: "mtls", Key: "k"}, res); err == nil {
+		t.Fatal("expected a client without credentials to be rejected")
+	}
+}
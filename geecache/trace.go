@@ -0,0 +1,87 @@
+package geecache
+
+import (
+	"context"
+	"net/http"
+)
+
+// 链路追踪：为 Get、远程节点访问和回源加载创建 span，并在节点之间传递 traceparent，
+// 从而判断一次慢请求是慢在本地未命中、远程节点还是回源
+
+// Tracer starts spans. It mirrors the subset of OpenTelemetry's
+// trace.Tracer that geecache needs, so an adapter around an OpenTelemetry
+// tracer is a few lines; the package itself doesn't depend on it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a unit of work started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// Propagator carries trace context between peers in HTTP headers.
+type Propagator interface {
+	Inject(ctx context.Context, h http.Header)
+	Extract(ctx context.Context, h http.Header) context.Context
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) RecordError(error)        {}
+func (noopSpan) End()                     {}
+
+// recording reports whether span records anything. Attributes that aren't
+// constants allocate when boxed, so hot paths skip them for no-op spans.
+func recording(span Span) bool {
+	_, noop := span.(noopSpan)
+	return !noop
+}
+
+// TraceContext is a Propagator forwarding the W3C "traceparent" and
+// "tracestate" headers unchanged. It keeps traces connected across peers
+// even when this process doesn't record spans itself; tracers that do
+// should supply a Propagator injecting their own span context.
+type TraceContext struct{}
+
+type traceContextKey struct{}
+
+type traceHeaders struct {
+	parent, state string
+}
+
+// Inject implements Propagator.
+func (TraceContext) Inject(ctx context.Context, h http.Header) {
+	if th, ok := ctx.Value(traceContextKey{}).(traceHeaders); ok {
+		h.Set("traceparent", th.parent)
+		if th.state != "" {
+			h.Set("tracestate", th.state)
+		}
+	}
+}
+
+// Extract implements Propagator.
+func (TraceContext) Extract(ctx context.Context, h http.Header) context.Context {
+	parent := h.Get("traceparent")
+	if parent == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceContextKey{}, traceHeaders{parent: parent, state: h.Get("tracestate")})
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
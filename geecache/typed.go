@@ -0,0 +1,109 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"google.golang.org/protobuf/proto"
+)
+
+// 泛型封装：调用方直接存取结构体，由 Codec 负责与 []byte 之间的转换
+
+// A Codec converts values of type T to and from the bytes kept in the cache.
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec[T any] struct{}
+
+// Marshal implements Codec.
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements Codec.
+func (JSONCodec[T]) Unmarshal(data []byte) (v T, err error) {
+	err = json.Unmarshal(data, &v)
+	return
+}
+
+// GobCodec encodes values with encoding/gob.
+type GobCodec[T any] struct{}
+
+// Marshal implements Codec.
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements Codec.
+func (GobCodec[T]) Unmarshal(data []byte) (v T, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return
+}
+
+// ProtoCodec encodes protobuf messages; T is a generated message pointer
+// type such as *pb.Request.
+type ProtoCodec[T proto.Message] struct{}
+
+// Marshal implements Codec.
+func (ProtoCodec[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+// Unmarshal implements Codec.
+func (ProtoCodec[T]) Unmarshal(data []byte) (T, error) {
+	var zero T
+	// 生成代码的 ProtoReflect 允许 nil 接收者，借此拿到消息类型并新建实例
+	v := zero.ProtoReflect().Type().New().Interface().(T)
+	if err := proto.Unmarshal(data, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// TypedGroup is a Group holding values of type T.
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+}
+
+// NewTypedGroup creates a Group whose values are loaded by getter and
+// stored encoded with codec.
+func NewTypedGroup[T any](name string, codec Codec[T], getter func(key string) (T, error), opts ...Option) *TypedGroup[T] {
+	g := NewGroup(name, GetterFunc(func(key string) ([]byte, error) {
+		v, err := getter(key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(v)
+	}), opts...)
+	return &TypedGroup[T]{group: g, codec: codec}
+}
+
+// Group returns the underlying Group, e.g. to register peers.
+func (t *TypedGroup[T]) Group() *Group {
+	return t.group
+}
+
+// Get returns the decoded value of key.
+func (t *TypedGroup[T]) Get(key string, opts ...GetOption) (T, error) {
+	return t.GetContext(context.Background(), key, opts...)
+}
+
+// GetContext is like Get but carries ctx, see Group.GetContext.
+func (t *TypedGroup[T]) GetContext(ctx context.Context, key string, opts ...GetOption) (T, error) {
+	view, err := t.group.GetContext(ctx, key, opts...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	// ByteView 只读，解码时不能让结果引用到缓存内部的数组
+	return t.codec.Unmarshal(view.ByteSlice())
+}
@@ -0,0 +1,410 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/lru"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 原地更新：计数器等读-改-写操作在归属节点上持有分片锁完成，避免 Get 与 Set 之间的竞争
+
+// PeerUpdater is implemented by peers able to change a value in place,
+// answering with the new value.
+type PeerUpdater interface {
+	Update(ctx context.Context, in *pb.UpdateRequest, out *pb.Response) error
+}
+
+// Operations of pb.UpdateRequest.
+const (
+	opIncrement = "incr"
+	opAppend    = "append"
+	opPrepend   = "prepend"
+	opTouch     = "touch"
+	opTTL       = "ttl" // 只读取剩余的生存时间，新版本改用 peek 读取，保留以应答旧节点
+)
+
+// Increment adds delta to the decimal integer stored at key on its owner
+// and returns the result. A key that neither the cache nor the Getter has
+// counts as 0; a value that is not an integer fails with ErrNotNumeric.
+// The entry keeps its lifetime, and with WithStore the owner writes the
+// result to the store, in the order the updates of key were applied.
+func (g *Group) Increment(ctx context.Context, key string, delta int64) (n int64, err error) {
+	in := &pb.UpdateRequest{Group: g.name, Key: key, Op: opIncrement, Delta: delta}
+	value, err := g.update(ctx, in)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value.String(), 10, 64)
+}
+
+// Decrement subtracts delta from the integer stored at key, see Increment.
+func (g *Group) Decrement(ctx context.Context, key string, delta int64) (int64, error) {
+	return g.Increment(ctx, key, -delta)
+}
+
+// Append adds suffix to the end of the value of key on its owner, which
+// avoids sending the whole value back and forth to grow it. A key that
+// neither the cache nor the Getter has is set to suffix.
+func (g *Group) Append(ctx context.Context, key string, suffix []byte) error {
+	_, err := g.update(ctx, &pb.UpdateRequest{Group: g.name, Key: key, Op: opAppend, Data: suffix})
+	return err
+}
+
+// Prepend adds prefix to the start of the value of key, see Append.
+func (g *Group) Prepend(ctx context.Context, key string, prefix []byte) error {
+	_, err := g.update(ctx, &pb.UpdateRequest{Group: g.name, Key: key, Op: opPrepend, Data: prefix})
+	return err
+}
+
+// Touch sets the key to expire ttl from now on its owner, or never if ttl
+// is 0, without reloading or resending its value. It fails with
+// ErrNotFound if the owner doesn't cache key. Pinned keys don't expire
+// and are left as they are.
+func (g *Group) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := g.update(ctx, &pb.UpdateRequest{Group: g.name, Key: key, Op: opTouch, TtlMs: ttl.Milliseconds()})
+	return err
+}
+
+// Expire drops the cached value of key on its owner, as if its lifetime
+// had run out: unlike Delete, the store keeps the key and the next Get
+// loads it again.
+func (g *Group) Expire(ctx context.Context, key string) error {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(g.routeKey(key, "")); ok {
+			setter, ok := peer.(PeerSetter)
+			if !ok {
+				return ErrReadOnlyPeer
+			}
+			if err := setter.Delete(ctx, &pb.Request{Group: g.name, Key: key}); err != nil {
+				return err
+			}
+		}
+	}
+	g.Remove(key)
+	return nil
+}
+
+// TTL returns how long key has left to live on its owner, 0 if it doesn't
+// expire. It fails with ErrNotFound if the owner doesn't cache key. The
+// owner is asked with a read, which needs no write permission.
+func (g *Group) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(g.routeKey(key, "")); ok {
+			out := &pb.Response{}
+			if err := peer.Get(ctx, &pb.Request{Group: g.name, Key: key, Peek: true}, out); err != nil {
+				return 0, err
+			}
+			if out.ExpiresMs == 0 {
+				return 0, nil
+			}
+			ttl := time.Until(time.UnixMilli(out.ExpiresMs))
+			if ttl <= 0 {
+				return 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+			}
+			return ttl, nil
+		}
+	}
+	return g.ttlLocally(key)
+}
+
+// ttlLocally returns the remaining lifetime of key on this node.
+func (g *Group) ttlLocally(key string) (time.Duration, error) {
+	if _, ok := g.pins.get(key); ok {
+		return 0, nil
+	}
+	o, ok := g.mainCache.options(key)
+	if ok && !o.Expire.IsZero() {
+		ttl := time.Until(o.Expire)
+		if ttl > 0 {
+			return ttl, nil
+		}
+		ok = false
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return 0, nil
+}
+
+// update applies in on the owner of its key, which writes the result to
+// the store.
+func (g *Group) update(ctx context.Context, in *pb.UpdateRequest) (value ByteView, err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.Update")
+	defer func() { endSpan(span, err) }()
+	span.SetAttribute("geecache.group", g.name)
+	if in.Key == "" {
+		return ByteView{}, fmt.Errorf("key is required")
+	}
+	owned := true
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(g.routeKey(in.Key, "")); ok {
+			owned = false
+			if value, err = g.updateOnPeer(ctx, peer, in); err != nil {
+				return ByteView{}, err
+			}
+		}
+	}
+	if owned {
+		return g.updateLocally(ctx, in)
+	}
+	return value, nil
+}
+
+func (g *Group) updateOnPeer(ctx context.Context, peer PeerGetter, in *pb.UpdateRequest) (ByteView, error) {
+	updater, ok := peer.(PeerUpdater)
+	if !ok {
+		return ByteView{}, ErrReadOnlyPeer
+	}
+	out := &pb.Response{}
+	if err := updater.Update(ctx, in, out); err != nil {
+		return ByteView{}, err
+	}
+	g.Remove(in.Key)
+	return ByteView{b: out.Value, version: out.Version}, nil
+}
+
+// updateLocally applies in to the value of its key on this node, loading
+// the key first if it isn't cached, and writes the result to the store.
+func (g *Group) updateLocally(ctx context.Context, in *pb.UpdateRequest) (ByteView, error) {
+	if in.Op == opTouch {
+		return g.touchLocally(in.Key, time.Duration(in.TtlMs)*time.Millisecond)
+	}
+	fn, err := updateFunc(in)
+	if err != nil {
+		return ByteView{}, err
+	}
+	// 读到的值只作为后备：读-改-写在下面一次加锁中完成，
+	// 期间条目若被淘汰或替换，以锁内看到的为准
+	loaded, err := g.GetContext(ctx, in.Key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return ByteView{}, err
+	}
+	defer loaded.Release()
+	found := err == nil
+	var res ByteView
+	turn := uint64(0)
+	apply := func(current ByteView, ok bool) (ByteView, error) {
+		if !ok && found {
+			current, ok = loaded, true
+		}
+		value, err := fn(current, ok)
+		if err != nil {
+			return ByteView{}, err
+		}
+		if size := int64(len(in.Key) + value.Len()); g.maxEntry > 0 && size > g.maxEntry {
+			return ByteView{}, fmt.Errorf("%w: %d bytes for key %q", ErrValueTooLarge, size, in.Key)
+		}
+		value.version = g.versions.next()
+		value.flags = current.flags // 修改值不改变标志位
+		res = value
+		if g.store != nil {
+			// 在锁内取号，写入 store 的顺序与生效的顺序一致
+			turn = g.updateTurns.take(in.Key)
+		}
+		return value, nil
+	}
+	kept := true
+	pinned, err := g.pins.update(in.Key, apply)
+	switch {
+	case !pinned && res.version != 0:
+		// 新值超出了钉住的上限，key 不再钉住，改放入 LRU 缓存
+		kept, err = g.mainCache.update(in.Key, g.entryOptions(in.Key), func(ByteView, bool) (lru.Value, error) {
+			return g.storedForm(res), nil
+		})
+	case !pinned && err == nil:
+		kept, err = g.mainCache.update(in.Key, g.entryOptions(in.Key), func(current ByteView, ok bool) (lru.Value, error) {
+			value, err := apply(current, ok)
+			if err != nil {
+				return nil, err
+			}
+			return g.storedForm(value), nil
+		})
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	g.invalidateCopies(in.Key)
+	if !kept {
+		// 新值放不进缓存，旧值也已被替换掉：报告失败，store 保留旧值
+		err = fmt.Errorf("%w: %d bytes for key %q don't fit in the cache", ErrValueTooLarge, len(in.Key)+res.Len(), in.Key)
+	}
+	if g.store != nil {
+		g.updateTurns.wait(in.Key, turn)
+		if err == nil {
+			err = g.writeStore(ctx, in.Key, res)
+		}
+		g.updateTurns.done(in.Key)
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	return res, nil
+}
+
+// storeTurns orders the store writes of the updates of each key: a turn
+// taken when an update is applied to the cache is served once every
+// earlier turn of the key is done. The zero value is ready to use.
+type storeTurns struct {
+	mu    sync.Mutex
+	keys  map[string]*storeTurn
+	moved *sync.Cond //有写入完成时广播
+}
+
+type storeTurn struct {
+	next    uint64 // 下一个取到的号
+	serving uint64 // 正在写入的号
+}
+
+// take returns the next turn of key.
+func (t *storeTurns) take(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.keys == nil {
+		t.keys = make(map[string]*storeTurn)
+		t.moved = sync.NewCond(&t.mu)
+	}
+	k := t.keys[key]
+	if k == nil {
+		k = &storeTurn{}
+		t.keys[key] = k
+	}
+	k.next++
+	return k.next - 1
+}
+
+// wait blocks until turn is served.
+func (t *storeTurns) wait(key string, turn uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.keys[key].serving != turn {
+		t.moved.Wait()
+	}
+}
+
+// done ends the turn being served, which wait must have returned.
+func (t *storeTurns) done(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := t.keys[key]
+	if k.serving++; k.serving == k.next {
+		delete(t.keys, key)
+	}
+	t.moved.Broadcast()
+}
+
+// touchLocally changes when key expires on this node, returning its value
+// without the bytes.
+func (g *Group) touchLocally(key string, ttl time.Duration) (ByteView, error) {
+	if v, ok := g.pins.get(key); ok {
+		return ByteView{version: v.version}, nil
+	}
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	version, ok := g.mainCache.setExpire(key, expire)
+	if !ok {
+		return ByteView{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return ByteView{version: version}, nil
+}
+
+// updateFunc returns the change in describes.
+func updateFunc(in *pb.UpdateRequest) (func(current ByteView, ok bool) (ByteView, error), error) {
+	switch in.Op {
+	case opIncrement:
+		return func(current ByteView, ok bool) (ByteView, error) {
+			var n int64
+			if ok {
+				var err error
+				if n, err = strconv.ParseInt(current.String(), 10, 64); err != nil {
+					return ByteView{}, fmt.Errorf("%w: key %q", ErrNotNumeric, in.Key)
+				}
+			}
+			return ByteView{b: strconv.AppendInt(nil, n+in.Delta, 10)}, nil
+		}, nil
+	case opAppend, opPrepend:
+		return func(current ByteView, ok bool) (ByteView, error) {
+			// 总是复制到新数组：旧值的底层数组可能仍被读取方持有
+			b := make([]byte, 0, current.Len()+len(in.Data))
+			if in.Op == opAppend {
+				b = append(append(b, current.b...), in.Data...)
+			} else {
+				b = append(append(b, in.Data...), current.b...)
+			}
+			return ByteView{b: b}, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown update operation %q", in.Op)
+}
+
+// maxUpdateBytes bounds update requests to groups without
+// WithMaxEntryBytes.
+const maxUpdateBytes = 64 << 20
+
+// serveUpdate answers PATCH <group>/<key> from a peer with the new value,
+// or only its version for appends and prepends, whose callers don't need
+// the value back.
+func (p *HTTPPool) serveUpdate(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	limit := group.maxEntry
+	if limit == 0 {
+		limit = maxUpdateBytes
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit+1<<10))
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", ErrValueTooLarge, err))
+		return
+	}
+	in := &pb.UpdateRequest{}
+	if proto.Unmarshal(data, in) != nil || in.Group != group.name || in.Key != key {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	out := &pb.Response{ProtocolVersion: ProtocolVersion}
+	if in.Op == opTTL {
+		ttl, err := group.ttlLocally(key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		// 不足 1 毫秒的按 1 毫秒算，0 表示永不过期
+		out.TtlMs = int64((ttl + time.Millisecond - 1) / time.Millisecond)
+	} else {
+		value, err := group.updateLocally(r.Context(), in)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		out.Version = value.version
+		if in.Op == opIncrement {
+			out.Value = value.b
+		}
+	}
+	res, err := proto.Marshal(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(res)
+}
+
+// Update sends in to the peer with a PATCH request.
+func (h *httpGetter) Update(ctx context.Context, in *pb.UpdateRequest, out *pb.Response) error {
+	in.ProtocolVersion = ProtocolVersion
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return h.send(ctx, http.MethodPatch, in.GetGroup(), in.GetKey(), body, nil, out, 0)
+}
+
+var _ PeerUpdater = (*httpGetter)(nil)
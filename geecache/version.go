@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/lru"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 版本号与 CAS：每次加载或写入 key 时在其归属节点上分配新的版本号，
+// CompareAndSet 只在版本号未变化时写入，支持乐观并发的读-改-写
+
+// versionClock hands out increasing versions. They follow the wall clock,
+// so that versions keep increasing across restarts and owner changes as
+// long as clocks roughly agree.
+type versionClock struct {
+	last atomic.Uint64
+}
+
+func (c *versionClock) next() uint64 {
+	for {
+		last := c.last.Load()
+		v := uint64(time.Now().UnixNano())
+		if v <= last {
+			v = last + 1
+		}
+		if c.last.CompareAndSwap(last, v) {
+			return v
+		}
+	}
+}
+
+// versionOf returns the version of a cached value without decompressing it.
+func versionOf(v lru.Value) uint64 {
+	switch v := v.(type) {
+	case ByteView:
+		return v.version
+	case compactedView:
+		return v.version
+	case compressedView:
+		return v.version
+	case arenaView:
+		return v.version
+	}
+	return 0
+}
+
+// CompareAndSet sets key like Set, but only if the value cached on the
+// owner still has version expected, as returned by ByteView.Version;
+// expected 0 means the key must not be cached. Otherwise it returns
+// ErrVersionMismatch and the caller should read the key again. Values the
+// owner can't be reached for are never kept as hints.
+func (g *Group) CompareAndSet(ctx context.Context, key string, value []byte, expected uint64, opts ...SetOption) (err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.CompareAndSet")
+	defer func() { endSpan(span, err) }()
+	span.SetAttribute("geecache.group", g.name)
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	view := newView(value, opts)
+	if size := int64(len(key) + view.Len()); g.maxEntry > 0 && size > g.maxEntry {
+		return fmt.Errorf("%w: %d bytes for key %q", ErrValueTooLarge, size, key)
+	}
+	g.Stats.Sets.Add(1)
+	owned := true
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(g.routeKey(key, "")); ok {
+			owned = false
+			in := &pb.SetRequest{Group: g.name, Key: key, Value: view.b, Flags: view.flags, Compare: true, ExpectedVersion: expected}
+			if err := g.setOnPeer(ctx, peer, in); err != nil {
+				return err
+			}
+		}
+	}
+	if owned && !g.casLocally(key, view, expected) {
+		return fmt.Errorf("%w: %q", ErrVersionMismatch, key)
+	}
+	// 只有比较成功后才能写入 store
+	return g.writeStore(ctx, key, view)
+}
+
+// casLocally caches value as a new version of key if the current version
+// is expected, reporting whether it did.
+func (g *Group) casLocally(key string, value ByteView, expected uint64) bool {
+	value.version = g.versions.next()
+	stored, pinned := g.pins.swap(key, value, func(current uint64) bool { return current == expected })
+	if !pinned {
+		stored = g.mainCache.compareAndSwap(key, expected, g.storedForm(value), g.entryOptions(key))
+	}
+	if stored {
+		g.invalidateCopies(key)
+	}
+	return stored
+}
@@ -0,0 +1,146 @@
+package geecache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 节点加入时的预热：新节点向此前拥有这些 key 的节点批量拉取现在归它所有的条目，
+// 避免重平衡后的 key 在新节点上集中未命中、一齐打到数据源
+
+// transferPath is served below the base path as _transfer/<group>.
+const transferPath = "_transfer/"
+
+// WarmUp fetches, from every other peer, the cached entries of the named
+// groups (all registered groups if none are given) that the current ring
+// assigns to this node, and adds them to the local caches. Call it right
+// after joining the ring, once Set includes this node; peers that are
+// unreachable are skipped. It returns the number of entries added.
+func (p *HTTPPool) WarmUp(ctx context.Context, groups ...string) (int, error) {
+	p.mu.Lock()
+	var node string
+	var peers []string
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		peers = append(peers, peer)
+		if p.selves[peer] {
+			node = peer
+		} else {
+			getters[peer] = getter
+		}
+	}
+	p.mu.Unlock()
+	if node == "" {
+		// 本节点不在环上，不拥有任何 key
+		return 0, nil
+	}
+	sort.Strings(peers)
+
+	var n int
+	var firstErr error
+	targets := allGroups()
+	if len(groups) > 0 {
+		targets = targets[:0]
+		for _, name := range groups {
+			if g := GetGroup(name); g != nil {
+				targets = append(targets, g)
+			}
+		}
+	}
+	for _, g := range targets {
+		for peer, getter := range getters {
+			added, err := getter.transfer(ctx, g, node, peers)
+			n += added
+			if err != nil {
+				p.opts.Logger.Warn("warm-up from peer failed", "peer", peer, "group", g.name, "err", err)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("peer %s: %w", peer, err)
+				}
+			}
+		}
+	}
+	return n, firstErr
+}
+
+// serveTransfer answers GET _transfer/<group>?node=<addr>&peers=<addr>,...
+// with the entries of group that node owns on the ring made of peers, and
+// POST _transfer/<group> with the entries migrated to this node.
+func (p *HTTPPool) serveTransfer(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, p.basePath+transferPath)
+	if !p.authorize(w, r, EndpointPeer, name) {
+		return
+	}
+	group := GetGroup(name)
+	if group == nil {
+		writeError(w, fmt.Errorf("%w: %s", ErrGroupNotFound, name))
+		return
+	}
+	if p.Divergent(name) {
+		writeError(w, fmt.Errorf("%w: %s", ErrConfigMismatch, name))
+		return
+	}
+	if r.Method == http.MethodPost {
+		p.receiveTransfer(w, r, group)
+		return
+	}
+	q := r.URL.Query()
+	node, list := q.Get("node"), q.Get("peers")
+	if node == "" || list == "" {
+		http.Error(w, "node and peers are required", http.StatusBadRequest)
+		return
+	}
+	node = p.normalizePeers([]string{node})[0]
+	ring := p.newRing()
+	ring.Add(p.normalizePeers(strings.Split(list, ","))...)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	bw := bufio.NewWriter(p.ThrottleWriter(r.Context(), TrafficWarmSync, w))
+	group.writeEntries(bw, func(key string) bool {
+		return ring.Get(group.routeKey(key, "")) == node
+	})
+	bw.Flush()
+}
+
+// transfer fetches the entries of g owned by node and adds them to g.
+func (h *httpGetter) transfer(ctx context.Context, g *Group, node string, peers []string) (int, error) {
+	q := url.Values{"node": {node}, "peers": {strings.Join(peers, ",")}}
+	u := h.baseURL + transferPath + url.PathEscape(g.name) + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := h.roundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return 0, errorFromResponse(res, body)
+	}
+
+	// 边读边写入缓存，不必把整个响应留在内存里
+	br := bufio.NewReader(res.Body)
+	now := time.Now().UnixNano()
+	var n int
+	for {
+		e, err := readEntry(br)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			// 连接中断时已收到的条目仍然有效
+			return n, fmt.Errorf("reading transfer: %w", err)
+		}
+		if g.addEntry(e, now) {
+			n++
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package geecache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 异步回写（write-behind）：Set 缓存后立即返回，由后台 worker 批量写入 Store 并在失败时重试，
+// 以持久性换取写入延迟。进程崩溃时尚未写入的值会丢失
+
+// WriteBehind configures asynchronous writes to the group's Store, see
+// WithWriteBehind. Zero fields take their defaults.
+type WriteBehind struct {
+	Workers    int           // concurrent flushes, default 1
+	MaxPending int           // keys waiting to be written, default 10000
+	BatchSize  int           // keys written per flush, default 100
+	Interval   time.Duration // how long writes wait to be batched, default 100ms
+	MaxRetries int           // retries of a failed write before it's dropped, default 3
+	RetryDelay time.Duration // delay before the first retry, doubled after each, default 1s
+}
+
+// A BatchStore is a Store that can write several values at once. Write-behind
+// flushes use SetMulti when the store implements it, unless it is a
+// FlagStore.
+type BatchStore interface {
+	Store
+	SetMulti(ctx context.Context, values map[string][]byte) error
+}
+
+// WithWriteBehind makes Set return once the value is cached and write it
+// to the Store set by WithStore in the background. Repeated writes of a
+// key waiting to be flushed are coalesced. When MaxPending keys are
+// waiting, Set writes synchronously until the queue drains.
+func WithWriteBehind(cfg WriteBehind) Option {
+	return func(g *Group) {
+		if cfg.Workers <= 0 {
+			cfg.Workers = 1
+		}
+		if cfg.MaxPending <= 0 {
+			cfg.MaxPending = 10000
+		}
+		if cfg.BatchSize <= 0 {
+			cfg.BatchSize = 100
+		}
+		if cfg.Interval <= 0 {
+			cfg.Interval = 100 * time.Millisecond
+		}
+		if cfg.MaxRetries <= 0 {
+			cfg.MaxRetries = 3
+		}
+		if cfg.RetryDelay <= 0 {
+			cfg.RetryDelay = time.Second
+		}
+		q := &writeQueue{
+			cfg:      cfg,
+			pending:  make(map[string]ByteView),
+			inflight: make(map[string]inflightWrite),
+			wake:     make(chan struct{}, 1),
+		}
+		q.idle = sync.NewCond(&q.mu)
+		q.released = sync.NewCond(&q.mu)
+		g.writeBehind = q
+	}
+}
+
+// writeQueue holds the values waiting to be written, the latest per key.
+type writeQueue struct {
+	cfg WriteBehind
+
+	mu       sync.Mutex
+	pending  map[string]ByteView
+	inflight map[string]inflightWrite //正在写入的 key，同一个 key 不能并发写入，否则旧值可能覆盖新值
+	idle     *sync.Cond               //pending 与 inflight 都为空时广播，由 FlushWrites 等待
+	released *sync.Cond               //有 key 写完时广播，由 begin 等待
+	wake     chan struct{}
+}
+
+// inflightWrite is a write of a key to the store that has started but
+// not finished.
+type inflightWrite struct {
+	value   ByteView
+	deleted bool // 正在从 store 删除
+}
+
+// add queues value for key, reporting false if the queue is full.
+func (q *writeQueue) add(key string, value ByteView) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[key]; !ok && len(q.pending) >= q.cfg.MaxPending {
+		return false
+	}
+	q.pending[key] = value
+	if len(q.pending) >= q.cfg.BatchSize {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// get returns the value waiting to be written, or being written, for
+// key, which is newer than the store's. deleted reports that key is being
+// deleted from the store.
+func (q *writeQueue) get(key string) (value ByteView, deleted, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if v, ok := q.pending[key]; ok {
+		return v, false, true
+	}
+	w, ok := q.inflight[key]
+	return w.value, w.deleted, ok
+}
+
+// cancel drops the pending write of key.
+func (q *writeQueue) cancel(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, key)
+	q.signalIdle()
+}
+
+// begin waits until no write of key is in flight and records w as the
+// one in flight, for writes made outside the queue: Delete and Set when
+// the queue is full. end must be called once the write is done.
+func (q *writeQueue) begin(key string, w inflightWrite) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if _, busy := q.inflight[key]; !busy {
+			break
+		}
+		q.released.Wait()
+	}
+	q.inflight[key] = w
+}
+
+func (q *writeQueue) end(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, key)
+	q.released.Broadcast()
+	q.signalIdle()
+}
+
+// take removes up to BatchSize pending keys not being written already.
+func (q *writeQueue) take() map[string]ByteView {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	batch := make(map[string]ByteView)
+	for key, value := range q.pending {
+		if len(batch) >= q.cfg.BatchSize {
+			break
+		}
+		if _, busy := q.inflight[key]; busy {
+			continue
+		}
+		batch[key] = value
+		q.inflight[key] = inflightWrite{value: value}
+		delete(q.pending, key)
+	}
+	return batch
+}
+
+func (q *writeQueue) done(batch map[string]ByteView) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key := range batch {
+		delete(q.inflight, key)
+	}
+	q.released.Broadcast()
+	q.signalIdle()
+}
+
+// signalIdle must be called with q.mu held.
+func (q *writeQueue) signalIdle() {
+	if len(q.pending) == 0 && len(q.inflight) == 0 {
+		q.idle.Broadcast()
+	}
+}
+
+// PendingWrites returns the number of keys waiting to be written to the store.
+func (g *Group) PendingWrites() int {
+	if g.writeBehind == nil {
+		return 0
+	}
+	q := g.writeBehind
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) + len(q.inflight)
+}
+
+// FlushWrites writes the pending values to the store now and waits until
+// they're written or dropped after failing, or ctx is done.
+func (g *Group) FlushWrites(ctx context.Context) error {
+	q := g.writeBehind
+	if q == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		q.mu.Lock()
+		for len(q.pending) > 0 || len(q.inflight) > 0 {
+			select {
+			case q.wake <- struct{}{}:
+			default:
+			}
+			q.idle.Wait()
+		}
+		q.mu.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *Group) writeBehindLoop() {
+	q := g.writeBehind
+	ticker := time.NewTicker(q.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		stopping := false
+		select {
+		case <-g.stop:
+			stopping = true
+		case <-ticker.C:
+		case <-q.wake:
+		}
+		// 取完为止：积压较多时不必等下一个周期
+		for batch := q.take(); len(batch) > 0; batch = q.take() {
+			g.flushBatch(batch)
+			q.done(batch)
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+// storeWriteTimeout bounds each attempt to write a batch.
+const storeWriteTimeout = 10 * time.Second
+
+// flushBatch writes batch to the store, retrying failures with backoff.
+func (g *Group) flushBatch(batch map[string]ByteView) {
+	q := g.writeBehind
+	delay := q.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), storeWriteTimeout)
+		failed := g.writeBatch(ctx, batch)
+		cancel()
+		if len(failed) == 0 {
+			return
+		}
+		if attempt == q.cfg.MaxRetries {
+			g.Stats.StoreWriteErrs.Add(int64(len(failed)))
+			g.logger.Warn("[GeeCache] dropping writes after retries", "group", g.name, "keys", len(failed))
+			return
+		}
+		batch = failed
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// writeBatch writes batch, returning the values that failed.
+func (g *Group) writeBatch(ctx context.Context, batch map[string]ByteView) map[string]ByteView {
+	if bs, ok := g.store.(BatchStore); ok {
+		if _, flags := g.store.(FlagStore); !flags {
+			values := make(map[string][]byte, len(batch))
+			for key, value := range batch {
+				values[key] = value.b
+			}
+			if err := bs.SetMulti(ctx, values); err != nil {
+				return batch
+			}
+			return nil
+		}
+	}
+	var failed map[string]ByteView
+	for key, value := range batch {
+		if err := g.saveStore(ctx, key, value); err != nil {
+			if failed == nil {
+				failed = make(map[string]ByteView)
+			}
+			failed[key] = value
+		}
+	}
+	return failed
+}
@@ -0,0 +1,129 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"io"
+	"time"
+)
+
+// 机房/可用区感知：key 的归属仍按全局哈希环决定，但读取时优先选择与本节点同一
+// 可用区的副本（环上紧随归属节点的几个节点），减少跨可用区的流量费用
+
+// defaultZoneReplicas is how many nodes following a key on the ring may
+// serve its reads, the owner included, unless HTTPPoolOptions.ZoneReplicas
+// says otherwise.
+const defaultZoneReplicas = 2
+
+// defaultZoneReplicaTTL bounds the lifetime of the copies zone replicas
+// load, unless HTTPPoolOptions.ZoneReplicaTTL says otherwise.
+const defaultZoneReplicaTTL = time.Minute
+
+// ReadPeerPicker is implemented by PeerPickers that may direct reads of a
+// key to another peer than its owner. Writes always go to the owner.
+type ReadPeerPicker interface {
+	PeerPicker
+	// PickReadPeer returns the peer to read key from; ok is false if this
+	// node should load it.
+	PickReadPeer(key string) (peer PeerGetter, ok bool)
+}
+
+// SetZones records the zone, e.g. the availability zone or rack, of each
+// peer, keyed by address like Set. Together with HTTPPoolOptions.Zone it
+// makes reads prefer the replicas of a key in this node's zone; peers
+// without a zone are never preferred.
+func (p *HTTPPool) SetZones(zones map[string]string) {
+	normalized := make(map[string]string, len(zones))
+	for addr, zone := range zones {
+		normalized[p.normalizePeers([]string{addr})[0]] = zone
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.zones = normalized
+}
+
+// PickReadPeer implements ReadPeerPicker. Without a zone configured, or
+// when no replica of key is in this node's zone, it picks the owner like
+// PickPeer. A replica in the zone other than the owner is asked to load
+// the key itself, so values written to the owner may take until its copy
+// expires, after HTTPPoolOptions.ZoneReplicaTTL at most, to reach it.
+func (p *HTTPPool) PickReadPeer(key string) (PeerGetter, bool) {
+	if p.opts.Zone == "" {
+		return p.PickPeer(key)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := p.opts.ZoneReplicas
+	if n <= 0 {
+		n = defaultZoneReplicas
+	}
+	replicas := p.peers.GetN(key, n)
+	for i, peer := range replicas {
+		switch {
+		case p.isSelf(peer):
+			return nil, false // 本节点就是同区的副本
+		case p.zones[peer] != p.opts.Zone:
+			continue
+		case i == 0:
+			return p.httpGetters[peer], true
+		}
+		return replicaGetter{p.httpGetters[peer]}, true
+	}
+	// 没有同区的副本时照常读归属节点
+	if len(replicas) > 0 {
+		return p.httpGetters[replicas[0]], true
+	}
+	return nil, false
+}
+
+// replicaGetter asks a peer that doesn't own a key to serve it itself
+// rather than forwarding the request to the owner.
+type replicaGetter struct {
+	h *httpGetter
+}
+
+func (r replicaGetter) request(in *pb.Request) *pb.Request {
+	return &pb.Request{Group: in.Group, Key: in.Key, Affinity: in.Affinity, Local: true}
+}
+
+func (r replicaGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return r.h.Get(ctx, r.request(in), out)
+}
+
+func (r replicaGetter) GetStream(ctx context.Context, in *pb.Request, w io.Writer) error {
+	return r.h.GetStream(ctx, r.request(in), w)
+}
+
+// copyTTLPicker is implemented by PeerPickers bounding the lifetime of the
+// copies of keys a node loads without owning them, which writes to the
+// owner don't reach.
+type copyTTLPicker interface {
+	copyTTL() time.Duration // 0 for no bound
+}
+
+// copyTTL bounds copies with a zone configured, see ZoneReplicaTTL.
+func (p *HTTPPool) copyTTL() time.Duration {
+	if p.opts.Zone == "" {
+		return 0
+	}
+	if p.opts.ZoneReplicaTTL > 0 {
+		return p.opts.ZoneReplicaTTL
+	}
+	return defaultZoneReplicaTTL
+}
+
+// copyTTL returns how long this node may keep a copy of key it caches, 0
+// for as long as its policy says: copies of keys it doesn't own may be
+// bounded by the PeerPicker.
+func (g *Group) copyTTL(key string) time.Duration {
+	cp, ok := g.peers.(copyTTLPicker)
+	if !ok {
+		return 0
+	}
+	if ttl := cp.copyTTL(); ttl > 0 && !g.owns(g.routeKey(key, "")) {
+		return ttl
+	}
+	return 0
+}
+
+var _ ReadPeerPicker = (*HTTPPool)(nil)
@@ -0,0 +1,74 @@
+package geecache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPickReadPeer(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Zone: "z1", Middleware: []Middleware{}})
+	pool.Set("http://a", "http://b", "http://c")
+	pool.SetZones(map[string]string{"http://a": "z1", "http://b": "z1", "http://c": "z2"})
+
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		key := strconv.Itoa(i)
+		replicas := pool.peers.GetN(key, 2)
+		owner, remote := pool.PickPeer(key)
+		peer, ok := pool.PickReadPeer(key)
+		var want string
+		// 按环上的顺序取第一个同区的节点
+		switch {
+		case replicas[0] == "http://b":
+			want = "owner"
+			if !ok || peer != owner || !remote {
+				t.Fatalf("key %s owned in the zone not read from its owner", key)
+			}
+		case replicas[0] == "http://a" || replicas[1] == "http://a":
+			want = "self"
+			if ok {
+				t.Fatalf("key %s with a replica here read from a peer", key)
+			}
+		default: // c 拥有，b 是同区的副本
+			want = "replica"
+			r, isReplica := peer.(replicaGetter)
+			if !ok || !isReplica || r.h != pool.httpGetters["http://b"] {
+				t.Fatalf("key %s owned in another zone read from %v", key, peer)
+			}
+		}
+		seen[want] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("keys only covered %v", seen)
+	}
+
+	// 不归本节点所有的副本最多保留 ZoneReplicaTTL
+	pool.opts.ZoneReplicaTTL = time.Minute
+	g := NewGroup("zone-copies", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.RegisterPeers(pool)
+	for i := 0; i < 20; i++ {
+		key := strconv.Itoa(i)
+		g.populateCache(key, ByteView{b: []byte(key)}, false)
+		ttl, err := g.ttlLocally(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, remote := pool.PickPeer(key); remote != (ttl > 0 && ttl <= time.Minute) {
+			t.Fatalf("key %s owned by a peer: %v, cached for %v", key, remote, ttl)
+		}
+	}
+
+	// 未配置可用区时与 PickPeer 相同
+	plain := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Middleware: []Middleware{}})
+	plain.Set("http://a", "http://b", "http://c")
+	for i := 0; i < 20; i++ {
+		p1, ok1 := plain.PickPeer(strconv.Itoa(i))
+		p2, ok2 := plain.PickReadPeer(strconv.Itoa(i))
+		if p1 != p2 || ok1 != ok2 {
+			t.Fatalf("PickReadPeer without zones differs from PickPeer")
+		}
+	}
+}
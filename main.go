@@ -2,10 +2,17 @@ package main
 
 import (
 	"GeeCache/geecache"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var db = map[string]string{
@@ -15,22 +22,58 @@ var db = map[string]string{
 }
 
 func createGroup() *geecache.Group {
-	return geecache.NewGroup("scores", 2<<10, geecache.GetterFunc(
+	return geecache.NewGroup("scores", geecache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+		}), geecache.WithCacheBytes(2<<10))
 }
 
-func startCacheSever(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
+func startCacheSever(addr string, addrs []string, gee *geecache.Group, token string, creds *geecache.CertReloader) {
+	peers := geecache.NewHTTPPoolOpts(addr, &geecache.HTTPPoolOptions{AuthToken: token, TLS: creds})
 	peers.Set(addrs...)
 	gee.RegisterPeers(peers)
+	go checkManifests(peers)
 	log.Println("geecache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	u, err := url.Parse(addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if creds == nil {
+		log.Fatal(http.ListenAndServe(u.Host, peers))
+	}
+	srv := &http.Server{Addr: u.Host, Handler: peers, TLSConfig: creds.ServerConfig()}
+	log.Fatal(srv.ListenAndServeTLS("", ""))
+}
+
+// checkManifests compares the group configurations with the peers once
+// they had time to start, retrying while some of them are unreachable.
+func checkManifests(peers *geecache.HTTPPool) {
+	for attempt := 0; attempt < 5; attempt++ {
+		time.Sleep(5 * time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := peers.CheckManifests(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+}
+
+// reloadCertsOnSignal reloads the TLS credentials whenever the process receives SIGHUP.
+func reloadCertsOnSignal(creds *geecache.CertReloader) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if err := creds.Reload(); err != nil {
+			log.Println("reload TLS credentials:", err)
+			continue
+		}
+		log.Println("TLS credentials reloaded")
+	}
 }
 
 func startAPIServer(apiAddr string, gee *geecache.Group) {
@@ -38,6 +81,10 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
 			view, err := gee.Get(key)
+			if errors.Is(err, geecache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -45,6 +92,8 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 			w.Header().Set("Content-Type", "application/octet-stream")
 			w.Write(view.ByteSlice())
 		}))
+	// JSON API: /api/<group>/<key>，支持 X-Deadline-Ms
+	http.Handle("/api/", geecache.NewAPIHandler("/api/", nil))
 	log.Println("fontend server is running at", apiAddr)
 	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
 }
@@ -53,17 +102,35 @@ func main() {
 
 	var port int
 	var api bool
+	var token string
+	var certFile, keyFile, caFile string
 	//flag包来解析命令行参数
 	//(用于存储命令行参数中的值,参数的名称,默认值,参数用途的简短描述)
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&token, "token", "", "Shared secret required on peer requests")
+	flag.StringVar(&certFile, "cert", "", "TLS certificate file for peer traffic")
+	flag.StringVar(&keyFile, "key", "", "TLS private key file for peer traffic")
+	flag.StringVar(&caFile, "ca", "", "CA bundle used to verify peers (enables mutual TLS)")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
+	var creds *geecache.CertReloader
+	scheme := "http"
+	if certFile != "" {
+		var err error
+		if creds, err = geecache.NewCertReloader(certFile, keyFile, caFile); err != nil {
+			log.Fatal(err)
+		}
+		creds.Watch(time.Minute, func(err error) { log.Println("reload TLS credentials:", err) })
+		go reloadCertsOnSignal(creds)
+		scheme = "https"
+	}
+
 	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+		8001: scheme + "://localhost:8001",
+		8002: scheme + "://localhost:8002",
+		8003: scheme + "://localhost:8003",
 	}
 
 	var addrs []string
@@ -76,5 +143,5 @@ func main() {
 		go startAPIServer(apiAddr, gee)
 	}
 
-	startCacheSever(addrMap[port], []string(addrs), gee)
+	startCacheSever(addrMap[port], []string(addrs), gee, token, creds)
 }